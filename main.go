@@ -3,20 +3,45 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 
+	"github.com/supporttools/go-sql-proxy/pkg/admin"
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/cache"
+	"github.com/supporttools/go-sql-proxy/pkg/canary"
+	"github.com/supporttools/go-sql-proxy/pkg/capture"
 	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/credentials"
+	"github.com/supporttools/go-sql-proxy/pkg/discovery"
+	"github.com/supporttools/go-sql-proxy/pkg/faults"
+	"github.com/supporttools/go-sql-proxy/pkg/firewall"
 	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/maintenance"
 	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/pcap"
 	"github.com/supporttools/go-sql-proxy/pkg/proxy"
+	"github.com/supporttools/go-sql-proxy/pkg/replay"
+	"github.com/supporttools/go-sql-proxy/pkg/replication"
+	"github.com/supporttools/go-sql-proxy/pkg/rewrite"
+	"github.com/supporttools/go-sql-proxy/pkg/routing"
+	"github.com/supporttools/go-sql-proxy/pkg/shadow"
+	"github.com/supporttools/go-sql-proxy/pkg/sharding"
+	"github.com/supporttools/go-sql-proxy/pkg/timeouts"
 )
 
 var logger = logging.SetupLogging()
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replay.Run(os.Args[2:]))
+	}
+
 	logger.Println("Starting go-sql-proxy server...")
 	config.LoadConfiguration()
 	if config.CFG.Debug {
@@ -30,6 +55,49 @@ func main() {
 		//logger.Printf("Source Database Password: %s", config.CFG.SourceDatabasePassword)
 		logger.Printf("Bind Address: %s", config.CFG.BindAddress)
 		logger.Printf("Bind Port: %d", config.CFG.BindPort)
+		logger.Printf("Client SSL Cert File: %s", config.CFG.ClientSSLCertFile)
+		logger.Printf("Firewall Rules File: %s", config.CFG.FirewallRulesFile)
+		logger.Printf("Firewall Mode: %s", config.CFG.FirewallMode)
+		logger.Printf("Firewall Allow List File: %s", config.CFG.FirewallAllowlistFile)
+		logger.Printf("Rewrite Rules File: %s", config.CFG.RewriteRulesFile)
+		logger.Printf("Rewrite Dry Run: %t", config.CFG.RewriteDryRun)
+		logger.Printf("Cache Rules File: %s", config.CFG.CacheRulesFile)
+		logger.Printf("Cache Max Memory: %d", config.CFG.CacheMaxMemory)
+		logger.Printf("Cache Invalidate On Write: %t", config.CFG.CacheInvalidateOnWrite)
+		logger.Printf("Query Timeout: %s", config.CFG.QueryTimeout)
+		logger.Printf("Query Timeout Rules File: %s", config.CFG.QueryTimeoutRulesFile)
+		logger.Printf("Client Disconnect Kill: %s", config.CFG.ClientDisconnectKill)
+		logger.Printf("Shadow Database Server: %s", config.CFG.ShadowDatabaseServer)
+		logger.Printf("Shadow Database Port: %d", config.CFG.ShadowDatabasePort)
+		logger.Printf("Shadow Mode: %s", config.CFG.ShadowMode)
+		logger.Printf("Capture File: %s", config.CFG.CaptureFile)
+		logger.Printf("Pcap Directory: %s", config.CFG.PcapDir)
+		logger.Printf("Admin MySQL Port: %d", config.CFG.AdminMySQLPort)
+		logger.Printf("Admin MySQL User: %s", config.CFG.AdminMySQLUser)
+		logger.Printf("Backend Users File: %s", config.CFG.BackendUsersFile)
+		logger.Printf("Pause Max Held: %d", config.CFG.PauseMaxHeld)
+		logger.Printf("Pause Timeout: %s", config.CFG.PauseTimeout)
+		logger.Printf("Backend Connect Timeout: %s", config.CFG.BackendConnectTimeout)
+		logger.Printf("Backend Connect Retries: %d (backoff %s, max %s)", config.CFG.BackendConnectRetries, config.CFG.BackendRetryBackoff, config.CFG.BackendRetryMaxBackoff)
+		logger.Printf("Backend Fallbacks: %s", config.CFG.BackendFallbacks)
+		logger.Printf("Circuit Breaker: %d failures, %s cooldown", config.CFG.CircuitBreakerThreshold, config.CFG.CircuitBreakerCooldown)
+		logger.Printf("Backend Discovery: %s (DNS TTL %s to %s)", config.CFG.BackendDiscovery, config.CFG.DNSTTLMin, config.CFG.DNSTTLMax)
+		logger.Printf("DNS Servers: %s", config.CFG.DNSServers)
+		logger.Printf("Backends File: %s (checked every %s)", config.CFG.BackendsFile, config.CFG.BackendsFileInterval)
+		logger.Printf("Read/Write Split: %t", config.CFG.ReadWriteSplit)
+		logger.Printf("Replica Max Lag: %s (checked every %s)", config.CFG.ReplicaMaxLag, config.CFG.ReplicaLagCheckInterval)
+		logger.Printf("Replica Lag Query: %s", config.CFG.ReplicaLagQuery)
+		logger.Printf("Read Your Writes: %t (wait %s)", config.CFG.ReadYourWrites, config.CFG.ReadYourWritesWait)
+		logger.Printf("Query Hints: %t (strip %t)", config.CFG.QueryHints, config.CFG.QueryHintsStrip)
+		logger.Printf("Routing Rules File: %s", config.CFG.RoutingRulesFile)
+		logger.Printf("Shard Map File: %s", config.CFG.ShardMapFile)
+		logger.Printf("Canary: group %s, weight %d%% by %s", config.CFG.CanaryGroup, config.CFG.CanaryWeight, config.CFG.CanaryHashBy)
+		logger.Printf("Canary Rollback: error ratio %g, p99 latency ratio %g, window %s, min %d statements", config.CFG.CanaryMaxErrorRatio, config.CFG.CanaryMaxLatencyRatio, config.CFG.CanaryWindow, config.CFG.CanaryMinStatements)
+		logger.Printf("Fault Rules File: %s", config.CFG.FaultRulesFile)
+		logger.Printf("Reconnect Timeout: %s", config.CFG.ReconnectTimeout)
+		logger.Printf("Reconnect SET Variables: %s", config.CFG.ReconnectSetVariables)
+		logger.Printf("Maintenance Mode: %t", config.CFG.MaintenanceMode)
+		logger.Printf("Maintenance Error: %d (%s) %s", config.CFG.MaintenanceErrorCode, config.CFG.MaintenanceSQLState, config.CFG.MaintenanceMessage)
 	}
 
 	go func() {
@@ -41,6 +109,142 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel() // Ensure cancel is called to release resources if main exits before signal
 
+	if config.CFG.FirewallRulesFile != "" {
+		if err := firewall.LoadRules(config.CFG.FirewallRulesFile); err != nil {
+			logger.Fatalf("Failed to load firewall rules: %v", err)
+		}
+	}
+	if err := firewall.ConfigureAllowlist(ctx, firewall.Mode(config.CFG.FirewallMode), config.CFG.FirewallAllowlistFile, config.CFG.FirewallLearnDuration); err != nil {
+		logger.Fatalf("Failed to configure firewall allow list: %v", err)
+	}
+	if clientTLS, err := config.ClientTLSConfig(); err != nil {
+		logger.Fatalf("Failed to configure client TLS: %v", err)
+	} else if clientTLS == nil && firewall.Enabled() {
+		logger.Println("TLS is not offered to clients while the firewall is active, since CLIENT_SSL_CERT_FILE is not set")
+	}
+	if config.CFG.RewriteRulesFile != "" {
+		if err := rewrite.LoadRules(config.CFG.RewriteRulesFile); err != nil {
+			logger.Fatalf("Failed to load rewrite rules: %v", err)
+		}
+	}
+	rewrite.SetDryRun(config.CFG.RewriteDryRun)
+	cache.SetMaxMemory(config.CFG.CacheMaxMemory)
+	if config.CFG.CacheRulesFile != "" {
+		if err := cache.LoadRules(config.CFG.CacheRulesFile); err != nil {
+			logger.Fatalf("Failed to load cache rules: %v", err)
+		}
+	}
+	timeouts.SetDefault(config.CFG.QueryTimeout)
+	if config.CFG.QueryTimeoutRulesFile != "" {
+		if err := timeouts.LoadRules(config.CFG.QueryTimeoutRulesFile); err != nil {
+			logger.Fatalf("Failed to load timeout rules: %v", err)
+		}
+	}
+	if config.CFG.RoutingRulesFile != "" {
+		if err := routing.LoadRules(config.CFG.RoutingRulesFile); err != nil {
+			logger.Fatalf("Failed to load routing rules: %v", err)
+		}
+	}
+	if config.CFG.ShardMapFile != "" {
+		if err := sharding.LoadMap(config.CFG.ShardMapFile); err != nil {
+			logger.Fatalf("Failed to load shard map: %v", err)
+		}
+	}
+	if config.CFG.FaultRulesFile != "" {
+		if err := faults.LoadRules(config.CFG.FaultRulesFile); err != nil {
+			logger.Fatalf("Failed to load fault rules: %v", err)
+		}
+	}
+	if config.CFG.CanaryGroup != "" {
+		err := canary.Configure(canary.Config{
+			Group:           config.CFG.CanaryGroup,
+			HashBy:          config.CFG.CanaryHashBy,
+			Weight:          config.CFG.CanaryWeight,
+			MaxErrorRatio:   config.CFG.CanaryMaxErrorRatio,
+			MaxLatencyRatio: config.CFG.CanaryMaxLatencyRatio,
+			Window:          config.CFG.CanaryWindow,
+			MinStatements:   config.CFG.CanaryMinStatements,
+		})
+		if err != nil {
+			logger.Fatalf("Failed to configure canary: %v", err)
+		}
+	}
+	if config.CFG.BackendUsersFile != "" {
+		if err := credentials.LoadUsers(config.CFG.BackendUsersFile); err != nil {
+			logger.Fatalf("Failed to load backend users: %v", err)
+		}
+	}
+	if config.CFG.ShadowDatabaseServer != "" {
+		err := shadow.Configure(shadow.Config{
+			Mode:      shadow.Mode(config.CFG.ShadowMode),
+			Address:   net.JoinHostPort(config.CFG.ShadowDatabaseServer, strconv.Itoa(config.CFG.ShadowDatabasePort)),
+			User:      config.CFG.ShadowDatabaseUser,
+			Password:  config.CFG.ShadowDatabasePassword,
+			Timeout:   config.CFG.ShadowTimeout,
+			QueueSize: config.CFG.ShadowQueueSize,
+			Dial:      proxy.DialBackend,
+		})
+		if err != nil {
+			logger.Fatalf("Failed to configure shadow backend: %v", err)
+		}
+	}
+	if config.CFG.CaptureFile != "" {
+		if err := capture.Start(config.CFG.CaptureFile); err != nil {
+			logger.Fatalf("Failed to start capture: %v", err)
+		}
+	}
+	if config.CFG.MaintenanceErrorCode < 1 || config.CFG.MaintenanceErrorCode > 65535 {
+		logger.Fatalf("Invalid maintenance error code: %d", config.CFG.MaintenanceErrorCode)
+	}
+	if config.CFG.MaintenanceMode {
+		maintenance.Set(maintenance.Mode{Enabled: true})
+	}
+	if config.CFG.AdminAPIToken != "" {
+		metrics.Handle("/admin/", admin.Handler(config.CFG.AdminAPIToken))
+	}
+	if config.CFG.AdminMySQLPort != 0 && config.CFG.AdminMySQLPassword == "" {
+		logger.Println("Admin interface is disabled because ADMIN_MYSQL_PASSWORD is not set")
+	} else if config.CFG.AdminMySQLPort != 0 {
+		address := net.JoinHostPort(config.CFG.BindAddress, strconv.Itoa(config.CFG.AdminMySQLPort))
+		go func() {
+			if err := admin.ServeMySQL(ctx, address, config.CFG.AdminMySQLUser, config.CFG.AdminMySQLPassword); err != nil {
+				logger.Fatalf("Failed to start admin interface: %v", err)
+			}
+		}()
+	}
+
+	if config.CFG.BackendsFile != "" {
+		if err := backends.LoadFile(config.CFG.BackendsFile); err != nil {
+			logger.Fatalf("Failed to load backends file: %v", err)
+		}
+		if config.CFG.BackendsFileInterval > 0 {
+			go backends.WatchFile(ctx, config.CFG.BackendsFile, config.CFG.BackendsFileInterval)
+		}
+	}
+	if config.CFG.ReadWriteSplit && config.CFG.ReplicaLagCheckInterval > 0 {
+		go replication.WatchLag(ctx, replication.Config{
+			Interval: config.CFG.ReplicaLagCheckInterval,
+			MaxLag:   config.CFG.ReplicaMaxLag,
+			Query:    config.CFG.ReplicaLagQuery,
+			GTIDs:    config.CFG.ReadYourWrites,
+		})
+	}
+	var dnsServers []string
+	if config.CFG.DNSServers != "" {
+		dnsServers = strings.Split(config.CFG.DNSServers, ",")
+	}
+	err := discovery.Start(ctx, discovery.Config{
+		Mode:    discovery.Mode(config.CFG.BackendDiscovery),
+		Name:    config.CFG.SourceDatabaseServer,
+		Port:    config.CFG.SourceDatabasePort,
+		Servers: dnsServers,
+		MinTTL:  config.CFG.DNSTTLMin,
+		MaxTTL:  config.CFG.DNSTTLMax,
+	})
+	if err != nil {
+		logger.Fatalf("Failed to start backend discovery: %v", err)
+	}
+
 	p := proxy.NewProxy(ctx, config.CFG.SourceDatabaseServer, config.CFG.SourceDatabasePort, config.CFG.UseSSL)
 	p.EnableDecoding = true
 
@@ -52,9 +256,14 @@ func main() {
 	go func() {
 		<-c
 		log.Println("Signal received, stopping and exiting...")
-		cancel()   // Notify all operations to start shutting down
-		wg.Wait()  // Wait for all goroutines to finish
-		os.Exit(0) // Ensure the program exits
+		if err := firewall.SaveAllowlist(); err != nil {
+			log.Printf("Failed to save firewall allow list: %v", err)
+		}
+		capture.Stop() // Flush the capture file before exiting
+		pcap.Stop()    // Finish a running pcap capture
+		cancel()       // Notify all operations to start shutting down
+		wg.Wait()      // Wait for all goroutines to finish
+		os.Exit(0)     // Ensure the program exits
 	}()
 
 	wg.Add(1)
@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/pcap"
+	"github.com/supporttools/go-sql-proxy/pkg/shadow"
+)
+
+var logger = logging.SetupLogging()
+
+// Handler serves the admin API below /admin/. Requests must carry token as a
+// bearer token in the Authorization header.
+func Handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/connections", listConnections)
+	mux.HandleFunc("GET /admin/connections/{id}", getConnection)
+	mux.HandleFunc("DELETE /admin/connections/{id}", killConnection)
+	mux.HandleFunc("GET /admin/backends", listBackends)
+	mux.HandleFunc("PUT /admin/backends/{address}/state", setBackendState)
+	mux.HandleFunc("PUT /admin/primary", setPrimary)
+	mux.HandleFunc("GET /admin/pause", getPause)
+	mux.HandleFunc("POST /admin/pause", pauseTraffic)
+	mux.HandleFunc("POST /admin/resume", resumeTraffic)
+	mux.HandleFunc("GET /admin/maintenance", getMaintenance)
+	mux.HandleFunc("PUT /admin/maintenance", putMaintenance)
+	mux.HandleFunc("GET /admin/canary", getCanary)
+	mux.HandleFunc("PUT /admin/canary", putCanary)
+	mux.HandleFunc("GET /admin/faults", listFaults)
+	mux.HandleFunc("PUT /admin/faults", disableFaults)
+	mux.HandleFunc("PUT /admin/faults/{name}", setFault)
+	mux.HandleFunc("POST /admin/reload", reload)
+	if config.CFG.PcapDir != "" {
+		captures := pcap.Handler("/admin/pcap", config.CFG.PcapDir)
+		mux.Handle("/admin/pcap", captures)
+		mux.Handle("/admin/pcap/", captures)
+	}
+	if shadow.Enabled() {
+		mux.Handle("GET /admin/shadow", shadow.ReportHandler())
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-sql-proxy"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authorized returns true if r carries the admin token.
+func authorized(r *http.Request, token string) bool {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorf("Failed to write admin response: %v", err)
+	}
+}
+
+// writeError writes an error message as a JSON response.
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/proxy"
+)
+
+// Backend describes a backend.
+type Backend struct {
+	Address     string                `json:"address"`
+	Primary     bool                  `json:"primary"`
+	State       backends.State        `json:"state"`
+	Connections int64                 `json:"connections"`
+	Circuit     backends.BreakerState `json:"circuit"`
+	Discovered  bool                  `json:"discovered"`
+	// Spec is the backend's entry in the backends file, if it is listed.
+	Spec *backends.Spec `json:"spec,omitempty"`
+	// ReplicationLag is the replication lag last measured on a replica, in
+	// seconds, if it is known.
+	ReplicationLag *float64 `json:"replicationLag,omitempty"`
+}
+
+// describeBackend returns the description of b.
+func describeBackend(b *backends.Backend) Backend {
+	d := Backend{Address: b.Address, Primary: b == backends.Primary(), State: b.State(), Connections: b.Connections(), Circuit: b.Breaker(), Discovered: b.Discovered(), Spec: b.Spec()}
+	if lag, known := b.Lag(); known {
+		seconds := lag.Seconds()
+		d.ReplicationLag = &seconds
+	}
+	return d
+}
+
+// listBackends lists the backends.
+func listBackends(w http.ResponseWriter, _ *http.Request) {
+	list := make([]Backend, 0)
+	for _, b := range backends.List() {
+		list = append(list, describeBackend(b))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// setBackendState changes the state of a backend to the one in the request
+// body, {"state": "active|drain|maintenance"}. Sessions of a backend put into
+// maintenance are closed.
+func setBackendState(w http.ResponseWriter, r *http.Request) {
+	b, ok := backends.Lookup(r.PathValue("address"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown backend")
+		return
+	}
+
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	state, err := backends.ParseState(body.State)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	b.SetState(state)
+	if state == backends.StateMaintenance {
+		for _, c := range proxy.Connections() {
+			if c.BackendAddress() == b.Address {
+				if err := proxy.KillConnection(c.ID, "maintenance"); err != nil {
+					logger.Warnf("Failed to close connection %d: %v", c.ID, err)
+				}
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, describeBackend(b))
+}
@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/supporttools/go-sql-proxy/pkg/canary"
+)
+
+// getCanary shows the canary's weight and the statistics it compares.
+func getCanary(w http.ResponseWriter, _ *http.Request) {
+	status := canary.Current()
+	if status == nil {
+		writeError(w, http.StatusNotFound, "canary is not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// putCanary changes the percentage of new sessions sent to the canary to the
+// one in the request body, {"weight": 10}. Setting the weight again after an
+// automatic rollback resumes the canary.
+func putCanary(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Weight *int `json:"weight"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Weight == nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !canary.Enabled() {
+		writeError(w, http.StatusNotFound, "canary is not configured")
+		return
+	}
+	if err := canary.SetWeight(*body.Weight); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, canary.Current())
+}
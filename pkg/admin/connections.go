@@ -0,0 +1,105 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+	"github.com/supporttools/go-sql-proxy/pkg/proxy"
+)
+
+// Connection describes a client connection.
+type Connection struct {
+	ID                uint64            `json:"id"`
+	ClientAddress     string            `json:"clientAddress"`
+	User              string            `json:"user"`
+	Schema            string            `json:"schema"`
+	Backend           string            `json:"backend"`
+	State             string            `json:"state"`
+	Statement         string            `json:"statement,omitempty"`
+	StateSeconds      float64           `json:"stateSeconds"`
+	ConnectedAt       time.Time         `json:"connectedAt"`
+	AgeSeconds        float64           `json:"ageSeconds"`
+	BytesIn           uint64            `json:"bytesIn"`
+	BytesOut          uint64            `json:"bytesOut"`
+	BackendThreadID   uint32            `json:"backendThreadId,omitempty"`
+	ConnectAttributes map[string]string `json:"connectAttributes,omitempty"`
+}
+
+// describeConnection returns the description of c. Details adds the fields
+// only shown for a single connection.
+func describeConnection(c *models.Connection, details bool) Connection {
+	user, schema := c.Identity()
+	activity := c.CurrentActivity()
+	now := time.Now()
+
+	description := Connection{
+		ID:            c.ID,
+		ClientAddress: c.Conn.RemoteAddr().String(),
+		User:          user,
+		Schema:        schema,
+		Backend:       c.BackendAddress(),
+		State:         activity.State,
+		Statement:     activity.Statement,
+		StateSeconds:  now.Sub(activity.Since).Seconds(),
+		ConnectedAt:   c.ConnectedAt,
+		AgeSeconds:    now.Sub(c.ConnectedAt).Seconds(),
+		BytesIn:       c.BytesIn.Load(),
+		BytesOut:      c.BytesOut.Load(),
+	}
+	if details {
+		description.BackendThreadID = c.BackendThreadID.Load()
+		description.ConnectAttributes = c.ConnectAttributes()
+	}
+	return description
+}
+
+// listConnections lists the open client connections.
+func listConnections(w http.ResponseWriter, _ *http.Request) {
+	connections := proxy.Connections()
+	list := make([]Connection, 0, len(connections))
+	for _, c := range connections {
+		list = append(list, describeConnection(c, false))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getConnection shows the details of a client connection.
+func getConnection(w http.ResponseWriter, r *http.Request) {
+	c, ok := lookupConnection(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, describeConnection(c, true))
+}
+
+// killConnection closes a client connection and its backend connection.
+func killConnection(w http.ResponseWriter, r *http.Request) {
+	c, ok := lookupConnection(w, r)
+	if !ok {
+		return
+	}
+	if err := proxy.KillConnection(c.ID, "admin"); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	logger.Infof("Killed connection %d through the admin API", c.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupConnection returns the connection named by the id path parameter,
+// answering the request if there is none.
+func lookupConnection(w http.ResponseWriter, r *http.Request) (*models.Connection, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid connection ID")
+		return nil, false
+	}
+	c, ok := proxy.LookupConnection(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown connection ID")
+		return nil, false
+	}
+	return c, true
+}
@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/supporttools/go-sql-proxy/pkg/faults"
+)
+
+// Fault describes a fault rule.
+type Fault struct {
+	*faults.Rule
+	Enabled bool `json:"enabled"`
+}
+
+// describeFaults returns the descriptions of the fault rules.
+func describeFaults() []Fault {
+	list := make([]Fault, 0)
+	for _, rule := range faults.Rules() {
+		list = append(list, Fault{Rule: rule, Enabled: faults.Enabled(rule.Name)})
+	}
+	return list
+}
+
+// listFaults lists the fault rules and whether they are enabled.
+func listFaults(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, describeFaults())
+}
+
+// disableFaults disables all fault rules if the request body is
+// {"enabled": false}. Rules are enabled one at a time.
+func disableFaults(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if *body.Enabled {
+		writeError(w, http.StatusBadRequest, "fault rules are enabled one at a time")
+		return
+	}
+	faults.DisableAll()
+	writeJSON(w, http.StatusOK, describeFaults())
+}
+
+// setFault enables or disables a fault rule as the request body,
+// {"enabled": true}, says.
+func setFault(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := faults.SetEnabled(r.PathValue("name"), *body.Enabled); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	for _, f := range describeFaults() {
+		if f.Name == r.PathValue("name") {
+			writeJSON(w, http.StatusOK, f)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "unknown fault rule")
+}
@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/supporttools/go-sql-proxy/pkg/maintenance"
+	"github.com/supporttools/go-sql-proxy/pkg/proxy"
+)
+
+// setMaintenance changes the maintenance mode and, if it drains, closes the
+// connections not running a command. It returns the number of connections
+// closed.
+func setMaintenance(m maintenance.Mode) int {
+	maintenance.Set(m)
+	if !maintenance.Draining() {
+		return 0
+	}
+	return proxy.DrainConnections("maintenance")
+}
+
+// getMaintenance shows the maintenance mode.
+func getMaintenance(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, maintenance.Current())
+}
+
+// putMaintenance changes the maintenance mode to the one in the request body,
+// {"enabled": true, "errorCode": 1053, "sqlState": "08S01", "message": "...",
+// "drain": true}. The error fields default to the configured ones.
+func putMaintenance(w http.ResponseWriter, r *http.Request) {
+	var m maintenance.Mode
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if m.SQLState != "" && len(m.SQLState) != 5 {
+		writeError(w, http.StatusBadRequest, "sqlState must have 5 characters")
+		return
+	}
+
+	if drained := setMaintenance(m); drained > 0 {
+		logger.Infof("Closed %d idle connections for maintenance", drained)
+	}
+	writeJSON(w, http.StatusOK, maintenance.Current())
+}
@@ -0,0 +1,223 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// serverCapabilities are the capabilities the admin interface supports.
+const serverCapabilities = protocol.ClientLongPassword |
+	protocol.ClientConnectWithDB |
+	protocol.ClientProtocol41 |
+	protocol.ClientTransactions |
+	protocol.ClientSecureConn |
+	protocol.ClientMultiResults |
+	protocol.ClientPluginAuth |
+	protocol.ClientPluginAuthLenEncClientData |
+	protocol.ClientConnectAttrs |
+	protocol.ClientDeprecateEOF
+
+// MySQL errors returned by the admin interface.
+const (
+	errAccessDenied   uint16 = 1045
+	errUnknownCommand uint16 = 1047
+	errBadDatabase    uint16 = 1049
+	errBadField       uint16 = 1054
+	errParse          uint16 = 1064
+	errUnknown        uint16 = 1105
+	errUnknownTable   uint16 = 1146
+)
+
+// sessionIDs numbers the admin sessions.
+var sessionIDs atomic.Uint32
+
+// ServeMySQL accepts admin sessions speaking the MySQL protocol on address
+// until ctx is done. Clients authenticate as user with password using
+// mysql_native_password.
+func ServeMySQL(ctx context.Context, address, user, password string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Admin interface listening on %s", address)
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logger.Warnf("Failed to accept admin connection: %v", err)
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			s := &adminSession{conn: conn, in: bufio.NewReader(conn)}
+			if err := s.serve(user, password); err != nil && !errors.Is(err, io.EOF) {
+				logger.Warnf("Admin session from %s ended: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// adminSession is a client session of the admin interface.
+type adminSession struct {
+	conn         net.Conn
+	in           *bufio.Reader
+	capabilities protocol.CapabilityFlag
+}
+
+// serve authenticates the client and answers its commands.
+func (s *adminSession) serve(user, password string) error {
+	if err := s.authenticate(user, password); err != nil {
+		return err
+	}
+
+	for {
+		packet, err := protocol.ReadPacket(s.in)
+		if err != nil {
+			return err
+		}
+		if len(packet.Payload) == 0 {
+			return errors.New("received empty command packet")
+		}
+
+		switch packet.Payload[0] {
+		case protocol.ComQuit:
+			return nil
+		case protocol.ComPing:
+			err = s.writeOK(1, 0)
+		case protocol.ComInitDB:
+			if schema := string(packet.Payload[1:]); schema != schemaName {
+				err = s.writeError(1, errBadDatabase, "42000", fmt.Sprintf("Unknown database '%s'", schema))
+			} else {
+				err = s.writeOK(1, 0)
+			}
+		case protocol.ComQuery:
+			err = s.query(string(packet.Payload[1:]))
+		default:
+			err = s.writeError(1, errUnknownCommand, "08S01", "Unknown command")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// authenticate runs the handshake and checks the client's credentials.
+func (s *adminSession) authenticate(user, password string) error {
+	scramble := make([]byte, 20)
+	if _, err := rand.Read(scramble); err != nil {
+		return err
+	}
+	for i := range scramble {
+		// The scramble is sent NUL-terminated, so it must not contain NUL bytes.
+		scramble[i] = scramble[i]%127 + 1
+	}
+
+	handshake := protocol.InitialHandshakePacket{
+		ProtocolVersion:   10,
+		ServerVersion:     []byte("8.0.0-go-sql-proxy-admin"),
+		ConnectionID:      sessionIDs.Add(1),
+		AuthPluginData:    append(append([]byte{}, scramble...), 0),
+		CapabilitiesFlags: serverCapabilities,
+		CharacterSet:      uint8(protocol.CharacterSetUTF8MB4),
+		StatusFlags:       protocol.ServerStatusAutocommit,
+		AuthPluginDataLen: 21,
+		AuthPluginName:    []byte(protocol.NativePassword),
+	}
+	encoded, err := handshake.Encode()
+	if err != nil {
+		return err
+	}
+	if _, err := s.conn.Write(encoded); err != nil {
+		return err
+	}
+
+	packet, err := protocol.ReadPacket(s.in)
+	if err != nil {
+		return err
+	}
+	seq := packet.NextSequenceID()
+	if protocol.IsSSLRequest(packet.Payload) {
+		return s.writeError(seq, errAccessDenied, "28000", "The admin interface does not support TLS")
+	}
+
+	response := &protocol.HandshakeResponse41{}
+	if err := response.Decode(packet.Payload); err != nil {
+		return err
+	}
+	s.capabilities = response.CapabilityFlags & serverCapabilities
+
+	authResponse := response.AuthResponse
+	if response.AuthPluginName != protocol.NativePassword && response.CapabilityFlags.Has(protocol.ClientPluginAuth) {
+		// Ask clients that default to another method to switch.
+		authSwitch := protocol.AuthSwitchRequest{PluginName: protocol.NativePassword, PluginData: scramble}
+		if err := protocol.WritePacket(s.conn, seq, authSwitch.Encode()); err != nil {
+			return err
+		}
+		packet, err := protocol.ReadPacket(s.in)
+		if err != nil {
+			return err
+		}
+		seq = packet.NextSequenceID()
+		authResponse = packet.Payload
+	}
+
+	if response.Username != user || !checkPassword(authResponse, scramble, password) {
+		if err := s.writeError(seq, errAccessDenied, "28000", fmt.Sprintf("Access denied for user '%s'", response.Username)); err != nil {
+			return err
+		}
+		return fmt.Errorf("access denied for user %q", response.Username)
+	}
+	if response.Database != "" && response.Database != schemaName {
+		if err := s.writeError(seq, errBadDatabase, "42000", fmt.Sprintf("Unknown database '%s'", response.Database)); err != nil {
+			return err
+		}
+		return fmt.Errorf("unknown database %q", response.Database)
+	}
+	return s.writeOK(seq, 0)
+}
+
+// checkPassword verifies a mysql_native_password authentication response.
+func checkPassword(response, scramble []byte, password string) bool {
+	expected := protocol.ScrambleNativePassword(password, scramble)
+	return subtle.ConstantTimeCompare(response, expected) == 1
+}
+
+// writeOK sends an OK packet.
+func (s *adminSession) writeOK(seq uint8, affectedRows uint64) error {
+	ok := protocol.OKPacket{Header: protocol.OKHeader, AffectedRows: affectedRows, StatusFlags: protocol.ServerStatusAutocommit}
+	return protocol.WritePacket(s.conn, seq, ok.Encode(s.capabilities))
+}
+
+// writeError sends an ERR packet.
+func (s *adminSession) writeError(seq uint8, code uint16, sqlState, message string) error {
+	errPacket := protocol.ERRPacket{Code: code, SQLState: sqlState, Message: message}
+	return protocol.WritePacket(s.conn, seq, errPacket.Encode())
+}
+
+// writeResultSet sends a result set answering a query.
+func (s *adminSession) writeResultSet(rs protocol.ResultSet) error {
+	w := bufio.NewWriter(s.conn)
+	for _, p := range rs.Encode(s.capabilities, protocol.ServerStatusAutocommit) {
+		if _, err := w.Write(p.Encode()); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+	"github.com/supporttools/go-sql-proxy/pkg/pause"
+	"github.com/supporttools/go-sql-proxy/pkg/proxy"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+// PauseStatus describes whether traffic is paused.
+type PauseStatus struct {
+	Paused  bool      `json:"paused"`
+	Since   time.Time `json:"since,omitempty"`
+	Held    int       `json:"held"`
+	MaxHeld int       `json:"maxHeld,omitempty"`
+	Timeout string    `json:"timeout,omitempty"`
+	// Active is the number of connections still running a command. Backends
+	// can be swapped once it drops to zero.
+	Active int `json:"active"`
+}
+
+// describePause returns the pause status.
+func describePause() PauseStatus {
+	status := pause.Current()
+	description := PauseStatus{Paused: status.Paused, Held: status.Held, Active: activeConnections()}
+	if status.Paused {
+		description.Since = status.Since
+		description.MaxHeld = status.MaxHeld
+		description.Timeout = status.Timeout.String()
+	}
+	return description
+}
+
+// activeConnections returns the number of connections running a command.
+func activeConnections() int {
+	active := 0
+	for _, c := range proxy.Connections() {
+		if c.CurrentActivity().State == models.StateActive {
+			active++
+		}
+	}
+	return active
+}
+
+// pauseTraffic holds new commands at statement boundaries, with the
+// configured limits unless the request body, {"maxHeld": 500, "timeout":
+// "30s"}, overrides them.
+func pauseTraffic(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		MaxHeld int            `json:"maxHeld"`
+		Timeout rules.Duration `json:"timeout"`
+	}{MaxHeld: config.CFG.PauseMaxHeld, Timeout: rules.Duration(config.CFG.PauseTimeout)}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if body.MaxHeld <= 0 || body.Timeout <= 0 {
+		writeError(w, http.StatusBadRequest, "maxHeld and timeout must be positive")
+		return
+	}
+
+	if !pause.Pause(body.MaxHeld, time.Duration(body.Timeout)) {
+		writeError(w, http.StatusConflict, "traffic is already paused")
+		return
+	}
+	writeJSON(w, http.StatusOK, describePause())
+}
+
+// resumeTraffic releases the held commands.
+func resumeTraffic(w http.ResponseWriter, _ *http.Request) {
+	if !pause.Resume() {
+		writeError(w, http.StatusConflict, "traffic is not paused")
+		return
+	}
+	writeJSON(w, http.StatusOK, describePause())
+}
+
+// getPause shows whether traffic is paused.
+func getPause(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, describePause())
+}
+
+// setPrimary makes the backend in the request body, {"address":
+// "host:port"}, the primary. New sessions are proxied to it, and sessions on
+// the previous primary follow at their next command.
+func setPrimary(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Address == "" {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	writeJSON(w, http.StatusOK, describeBackend(backends.SetPrimary(body.Address)))
+}
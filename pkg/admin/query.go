@@ -0,0 +1,306 @@
+package admin
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/canary"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/faults"
+	"github.com/supporttools/go-sql-proxy/pkg/maintenance"
+	"github.com/supporttools/go-sql-proxy/pkg/pause"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/proxy"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// versionComment is reported as @@version_comment, which the mysql client
+// shows on connect.
+const versionComment = "go-sql-proxy admin interface"
+
+// query answers a statement sent to the admin interface.
+func (s *adminSession) query(query string) error {
+	words := statementWords(query)
+	if len(words) == 0 {
+		return s.writeError(1, errParse, "42000", "Query was empty")
+	}
+
+	switch strings.ToUpper(words[0].Text) {
+	case "SELECT":
+		return s.selectStatement(words[1:])
+	case "SHOW":
+		return s.show(words[1:])
+	case "USE":
+		if len(words) == 2 && sqlparse.Unquote(words[1].Text) == schemaName {
+			return s.writeOK(1, 0)
+		}
+	case "SET":
+		// Clients set session variables on connect; there are none to set.
+		return s.writeOK(1, 0)
+	case "PROXY":
+		return s.proxyCommand(words[1:])
+	}
+	return s.writeError(1, errParse, "42000", fmt.Sprintf("Unsupported statement: %s", query))
+}
+
+// selectStatement answers SELECT * | column, ... FROM [proxy.]table [LIMIT n]
+// and the variable lookups clients run on connect.
+func (s *adminSession) selectStatement(words []sqlparse.Token) error {
+	if len(words) == 0 {
+		return s.writeError(1, errParse, "42000", "Incomplete SELECT statement")
+	}
+
+	switch strings.ToLower(words[0].Text) {
+	case "@@version_comment":
+		return s.writeResultSet(resultSet(columns("@@version_comment", protocol.TypeVarString), [][]string{{versionComment}}))
+	case "database":
+		return s.writeResultSet(resultSet(columns("DATABASE()", protocol.TypeVarString), [][]string{{schemaName}}))
+	}
+
+	from := -1
+	for i, w := range words {
+		if strings.EqualFold(w.Text, "FROM") {
+			from = i
+			break
+		}
+	}
+	if from < 1 || from+1 >= len(words) {
+		return s.writeError(1, errParse, "42000", "Expected SELECT columns FROM table")
+	}
+
+	name, rest := tableName(words[from+1:])
+	t, ok := tables[name]
+	if !ok {
+		return s.writeError(1, errUnknownTable, "42S02", fmt.Sprintf("Table '%s.%s' doesn't exist", schemaName, name))
+	}
+
+	limit := -1
+	if len(rest) > 0 {
+		if len(rest) != 2 || !strings.EqualFold(rest[0].Text, "LIMIT") {
+			return s.writeError(1, errParse, "42000", "Only LIMIT may follow the table name")
+		}
+		n, err := strconv.Atoi(rest[1].Text)
+		if err != nil || n < 0 {
+			return s.writeError(1, errParse, "42000", "Invalid LIMIT")
+		}
+		limit = n
+	}
+
+	selected, unknown := selectColumns(t.columns, words[:from])
+	if selected == nil {
+		return s.writeError(1, errBadField, "42S22", fmt.Sprintf("Unknown column '%s' in 'field list'", unknown))
+	}
+
+	rows := t.rows()
+	if limit >= 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	projected := make([][]string, len(rows))
+	for i, row := range rows {
+		projected[i] = make([]string, len(selected))
+		for j, column := range selected {
+			projected[i][j] = row[column]
+		}
+	}
+
+	defs := make([]protocol.ColumnDefinition41, len(selected))
+	for i, column := range selected {
+		defs[i] = t.columns[column]
+		defs[i].Table = name
+		defs[i].OrgTable = name
+	}
+	return s.writeResultSet(resultSet(defs, projected))
+}
+
+// tableName returns the table named by words, optionally qualified with the
+// proxy schema, and the words following it.
+func tableName(words []sqlparse.Token) (string, []sqlparse.Token) {
+	name := sqlparse.Unquote(words[0].Text)
+	if len(words) >= 3 && words[1].Text == "." && strings.EqualFold(name, schemaName) {
+		return strings.ToLower(sqlparse.Unquote(words[2].Text)), words[3:]
+	}
+	return strings.ToLower(name), words[1:]
+}
+
+// selectColumns returns the indexes of the columns named in a select list, or
+// nil and the first item that is not a column.
+func selectColumns(defs []protocol.ColumnDefinition41, list []sqlparse.Token) ([]int, string) {
+	if len(list) == 1 && list[0].Text == "*" {
+		selected := make([]int, len(defs))
+		for i := range defs {
+			selected[i] = i
+		}
+		return selected, ""
+	}
+
+	var selected []int
+	for i, w := range list {
+		if i%2 == 1 {
+			if w.Text != "," {
+				return nil, w.Text
+			}
+			continue
+		}
+		name := strings.ToLower(sqlparse.Unquote(w.Text))
+		found := false
+		for j, def := range defs {
+			if def.Name == name {
+				selected = append(selected, j)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, name
+		}
+	}
+	return selected, ""
+}
+
+// show answers SHOW DATABASES and SHOW TABLES.
+func (s *adminSession) show(words []sqlparse.Token) error {
+	if len(words) == 1 {
+		switch strings.ToUpper(words[0].Text) {
+		case "DATABASES":
+			return s.writeResultSet(resultSet(columns("Database", protocol.TypeVarString), [][]string{{schemaName}}))
+		case "TABLES":
+			names := make([]string, 0, len(tables))
+			for name := range tables {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			rows := make([][]string, len(names))
+			for i, name := range names {
+				rows[i] = []string{name}
+			}
+			return s.writeResultSet(resultSet(columns("Tables_in_"+schemaName, protocol.TypeVarString), rows))
+		}
+	}
+	return s.writeError(1, errParse, "42000", "Only SHOW DATABASES and SHOW TABLES are supported")
+}
+
+// proxyCommand answers PROXY KILL <id>, PROXY RELOAD, PROXY MAINTENANCE,
+// PROXY PAUSE, PROXY RESUME, PROXY PRIMARY 'host:port', PROXY CANARY
+// <weight> and PROXY FAULT.
+func (s *adminSession) proxyCommand(words []sqlparse.Token) error {
+	switch {
+	case len(words) == 2 && strings.EqualFold(words[0].Text, "KILL"):
+		id, err := strconv.ParseUint(words[1].Text, 10, 64)
+		if err != nil {
+			return s.writeError(1, errParse, "42000", "Invalid connection ID")
+		}
+		if err := proxy.KillConnection(id, "admin"); err != nil {
+			return s.writeError(1, errUnknown, "HY000", err.Error())
+		}
+		logger.Infof("Killed connection %d through the admin interface", id)
+		return s.writeOK(1, 1)
+	case len(words) == 1 && strings.EqualFold(words[0].Text, "RELOAD"):
+		if err := Reload(); err != nil {
+			return s.writeError(1, errUnknown, "HY000", err.Error())
+		}
+		logger.Info("Reloaded rules through the admin interface")
+		return s.writeOK(1, 0)
+	case len(words) >= 2 && strings.EqualFold(words[0].Text, "MAINTENANCE"):
+		return s.maintenanceCommand(words[1:])
+	case len(words) == 1 && strings.EqualFold(words[0].Text, "PAUSE"):
+		if !pause.Pause(config.CFG.PauseMaxHeld, config.CFG.PauseTimeout) {
+			return s.writeError(1, errUnknown, "HY000", "Traffic is already paused")
+		}
+		return s.writeOK(1, 0)
+	case len(words) == 1 && strings.EqualFold(words[0].Text, "RESUME"):
+		if !pause.Resume() {
+			return s.writeError(1, errUnknown, "HY000", "Traffic is not paused")
+		}
+		return s.writeOK(1, 0)
+	case len(words) == 2 && strings.EqualFold(words[0].Text, "PRIMARY") && words[1].Kind == sqlparse.TokenString:
+		backends.SetPrimary(sqlparse.Unquote(words[1].Text))
+		return s.writeOK(1, 0)
+	case len(words) == 2 && strings.EqualFold(words[0].Text, "CANARY"):
+		weight, err := strconv.Atoi(words[1].Text)
+		if err != nil {
+			return s.writeError(1, errParse, "42000", "Invalid canary weight")
+		}
+		if err := canary.SetWeight(weight); err != nil {
+			return s.writeError(1, errUnknown, "HY000", err.Error())
+		}
+		return s.writeOK(1, 0)
+	case len(words) >= 2 && strings.EqualFold(words[0].Text, "FAULT"):
+		return s.faultCommand(words[1:])
+	}
+	return s.writeError(1, errParse, "42000", "Expected PROXY KILL <id>, RELOAD, MAINTENANCE ON [DRAIN] | OFF, PAUSE, RESUME, PRIMARY 'host:port', CANARY <weight> or FAULT ['name'] ON | OFF")
+}
+
+// faultCommand answers PROXY FAULT 'name' ON, PROXY FAULT 'name' OFF and
+// PROXY FAULT OFF, which disables all fault rules and reports how many were
+// enabled as affected rows.
+func (s *adminSession) faultCommand(words []sqlparse.Token) error {
+	if len(words) == 1 && strings.EqualFold(words[0].Text, "OFF") {
+		disabled := faults.DisableAll()
+		return s.writeOK(1, uint64(disabled)) // #nosec G115 - a count of rules is never negative
+	}
+	if len(words) != 2 || words[0].Kind != sqlparse.TokenString {
+		return s.writeError(1, errParse, "42000", "Expected PROXY FAULT ['name'] ON | OFF")
+	}
+	var on bool
+	switch strings.ToUpper(words[1].Text) {
+	case "ON":
+		on = true
+	case "OFF":
+	default:
+		return s.writeError(1, errParse, "42000", "Expected PROXY FAULT 'name' ON | OFF")
+	}
+	if err := faults.SetEnabled(sqlparse.Unquote(words[0].Text), on); err != nil {
+		return s.writeError(1, errUnknown, "HY000", err.Error())
+	}
+	return s.writeOK(1, 0)
+}
+
+// maintenanceCommand answers PROXY MAINTENANCE ON [DRAIN] ['message'] and
+// PROXY MAINTENANCE OFF. It reports the connections closed by a drain as
+// affected rows.
+func (s *adminSession) maintenanceCommand(words []sqlparse.Token) error {
+	m := maintenance.Mode{}
+	switch strings.ToUpper(words[0].Text) {
+	case "ON":
+		m.Enabled = true
+		rest := words[1:]
+		if len(rest) > 0 && strings.EqualFold(rest[0].Text, "DRAIN") {
+			m.Drain = true
+			rest = rest[1:]
+		}
+		if len(rest) == 1 && rest[0].Kind == sqlparse.TokenString {
+			m.Message = sqlparse.Unquote(rest[0].Text)
+			rest = rest[1:]
+		}
+		if len(rest) > 0 {
+			return s.writeError(1, errParse, "42000", "Expected PROXY MAINTENANCE ON [DRAIN] ['message']")
+		}
+	case "OFF":
+		if len(words) != 1 {
+			return s.writeError(1, errParse, "42000", "Expected PROXY MAINTENANCE OFF")
+		}
+	default:
+		return s.writeError(1, errParse, "42000", "Expected PROXY MAINTENANCE ON [DRAIN] | OFF")
+	}
+
+	drained := setMaintenance(m)
+	return s.writeOK(1, uint64(drained)) // #nosec G115 - a count of connections is never negative
+}
+
+// statementWords returns the tokens of query without whitespace, comments and
+// a trailing semicolon.
+func statementWords(query string) []sqlparse.Token {
+	var words []sqlparse.Token
+	for _, t := range sqlparse.Tokenize(query) {
+		if t.Kind != sqlparse.TokenSpace && t.Kind != sqlparse.TokenComment {
+			words = append(words, t)
+		}
+	}
+	for len(words) > 0 && words[len(words)-1].Text == ";" {
+		words = words[:len(words)-1]
+	}
+	return words
+}
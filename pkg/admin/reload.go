@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/cache"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/credentials"
+	"github.com/supporttools/go-sql-proxy/pkg/faults"
+	"github.com/supporttools/go-sql-proxy/pkg/firewall"
+	"github.com/supporttools/go-sql-proxy/pkg/rewrite"
+	"github.com/supporttools/go-sql-proxy/pkg/routing"
+	"github.com/supporttools/go-sql-proxy/pkg/sharding"
+	"github.com/supporttools/go-sql-proxy/pkg/timeouts"
+)
+
+// Reload reloads the configured rule files, the firewall allow list, backend users and
+// backends. Files that fail to load keep their previous content active.
+func Reload() error {
+	files := []struct {
+		path string
+		load func(string) error
+	}{
+		{config.CFG.FirewallRulesFile, firewall.LoadRules},
+		{config.CFG.RewriteRulesFile, rewrite.LoadRules},
+		{config.CFG.CacheRulesFile, cache.LoadRules},
+		{config.CFG.QueryTimeoutRulesFile, timeouts.LoadRules},
+		{config.CFG.RoutingRulesFile, routing.LoadRules},
+		{config.CFG.ShardMapFile, sharding.LoadMap},
+		{config.CFG.FaultRulesFile, faults.LoadRules},
+		{config.CFG.BackendUsersFile, credentials.LoadUsers},
+		{config.CFG.BackendsFile, backends.LoadFile},
+	}
+
+	var errs []error
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		if err := f.load(f.path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := firewall.ReloadAllowlist(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// reload reloads the configured rule files, the firewall allow list, backend users and backends.
+func reload(w http.ResponseWriter, _ *http.Request) {
+	if err := Reload(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,267 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/cache"
+	"github.com/supporttools/go-sql-proxy/pkg/digests"
+	"github.com/supporttools/go-sql-proxy/pkg/faults"
+	"github.com/supporttools/go-sql-proxy/pkg/firewall"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/proxy"
+	"github.com/supporttools/go-sql-proxy/pkg/rewrite"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/timeouts"
+)
+
+// schemaName is the schema holding the virtual tables.
+const schemaName = "proxy"
+
+// timeFormat formats timestamps in virtual tables.
+const timeFormat = "2006-01-02 15:04:05.000000"
+
+// table is a virtual table answering SELECT statements.
+type table struct {
+	columns []protocol.ColumnDefinition41
+	rows    func() [][]string
+}
+
+// tables are the virtual tables of the proxy schema.
+var tables = map[string]table{
+	"connections": {
+		columns: columns(
+			"id", protocol.TypeLongLong,
+			"client_address", protocol.TypeVarString,
+			"user", protocol.TypeVarString,
+			"schema", protocol.TypeVarString,
+			"backend", protocol.TypeVarString,
+			"backend_thread_id", protocol.TypeLongLong,
+			"state", protocol.TypeVarString,
+			"state_seconds", protocol.TypeDouble,
+			"statement", protocol.TypeVarString,
+			"connected_at", protocol.TypeVarString,
+			"bytes_in", protocol.TypeLongLong,
+			"bytes_out", protocol.TypeLongLong,
+		),
+		rows: connectionRows,
+	},
+	"backends": {
+		columns: columns(
+			"address", protocol.TypeVarString,
+			"primary", protocol.TypeTiny,
+			"state", protocol.TypeVarString,
+			"connections", protocol.TypeLongLong,
+			"circuit", protocol.TypeVarString,
+			"discovered", protocol.TypeTiny,
+			"role", protocol.TypeVarString,
+			"weight", protocol.TypeLongLong,
+			"tags", protocol.TypeVarString,
+			"max_connections", protocol.TypeLongLong,
+			"replication_lag", protocol.TypeDouble,
+		),
+		rows: backendRows,
+	},
+	"query_digests": {
+		columns: columns(
+			"user", protocol.TypeVarString,
+			"schema", protocol.TypeVarString,
+			"digest", protocol.TypeVarString,
+			"digest_text", protocol.TypeVarString,
+			"count_star", protocol.TypeLongLong,
+			"errors", protocol.TypeLongLong,
+			"sum_time_us", protocol.TypeLongLong,
+			"min_time_us", protocol.TypeLongLong,
+			"max_time_us", protocol.TypeLongLong,
+			"first_seen", protocol.TypeVarString,
+			"last_seen", protocol.TypeVarString,
+		),
+		rows: digestRows,
+	},
+	"rules": {
+		columns: columns(
+			"type", protocol.TypeVarString,
+			"name", protocol.TypeVarString,
+			"priority", protocol.TypeLongLong,
+			"match", protocol.TypeVarString,
+			"action", protocol.TypeVarString,
+		),
+		rows: ruleRows,
+	},
+}
+
+// columns returns the definitions of columns given as name and type pairs.
+func columns(pairs ...interface{}) []protocol.ColumnDefinition41 {
+	defs := make([]protocol.ColumnDefinition41, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		c := protocol.NewColumn(pairs[i].(string), pairs[i+1].(byte))
+		c.Schema = schemaName
+		defs = append(defs, c)
+	}
+	return defs
+}
+
+// connectionRows returns the rows of proxy.connections.
+func connectionRows() [][]string {
+	var rows [][]string
+	for _, c := range proxy.Connections() {
+		d := describeConnection(c, true)
+		rows = append(rows, []string{
+			strconv.FormatUint(d.ID, 10),
+			d.ClientAddress,
+			d.User,
+			d.Schema,
+			d.Backend,
+			strconv.FormatUint(uint64(d.BackendThreadID), 10),
+			d.State,
+			strconv.FormatFloat(d.StateSeconds, 'f', 3, 64),
+			d.Statement,
+			d.ConnectedAt.Format(timeFormat),
+			strconv.FormatUint(d.BytesIn, 10),
+			strconv.FormatUint(d.BytesOut, 10),
+		})
+	}
+	return rows
+}
+
+// backendRows returns the rows of proxy.backends.
+func backendRows() [][]string {
+	var rows [][]string
+	for _, b := range backends.List() {
+		d := describeBackend(b)
+		row := []string{d.Address, formatBool(d.Primary), string(d.State), strconv.FormatInt(d.Connections, 10), string(d.Circuit), formatBool(d.Discovered)}
+		if d.Spec != nil {
+			row = append(row, string(d.Spec.Role), strconv.Itoa(d.Spec.Weight), strings.Join(d.Spec.Tags, ","), strconv.FormatInt(d.Spec.MaxConnections, 10))
+		} else {
+			// Backends not listed in the backends file have no spec.
+			row = append(row, "", "", "", "")
+		}
+		if d.ReplicationLag != nil {
+			row = append(row, strconv.FormatFloat(*d.ReplicationLag, 'f', 3, 64))
+		} else {
+			row = append(row, "")
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// digestRows returns the rows of proxy.query_digests.
+func digestRows() [][]string {
+	var rows [][]string
+	for _, s := range digests.List() {
+		rows = append(rows, []string{
+			s.User,
+			s.Schema,
+			s.Digest,
+			s.Fingerprint,
+			strconv.FormatUint(s.Count, 10),
+			strconv.FormatUint(s.Errors, 10),
+			strconv.FormatInt(s.TotalLatency.Microseconds(), 10),
+			strconv.FormatInt(s.MinLatency.Microseconds(), 10),
+			strconv.FormatInt(s.MaxLatency.Microseconds(), 10),
+			s.FirstSeen.Format(timeFormat),
+			s.LastSeen.Format(timeFormat),
+		})
+	}
+	return rows
+}
+
+// ruleRows returns the rows of proxy.rules, the active firewall, rewrite,
+// cache, timeout and fault rules.
+func ruleRows() [][]string {
+	var rows [][]string
+	add := func(kind, name string, priority int, match rules.Match, action string) {
+		rows = append(rows, []string{kind, name, strconv.Itoa(priority), describeMatch(match), action})
+	}
+
+	for _, r := range firewall.Rules() {
+		action := string(r.Action)
+		if r.Action == firewall.ActionDeny && r.ErrorMessage != "" {
+			action = fmt.Sprintf("%s: %s", action, r.ErrorMessage)
+		}
+		add("firewall", r.Name, r.Priority, r.Match, action)
+	}
+	for _, r := range rewrite.Rules() {
+		var action []string
+		if r.Replace != "" {
+			action = append(action, "replace "+r.Replace)
+		}
+		if r.Append != "" {
+			action = append(action, "append "+r.Append)
+		}
+		if r.DryRun {
+			action = append(action, "dry run")
+		}
+		add("rewrite", r.Name, r.Priority, r.Match, strings.Join(action, ", "))
+	}
+	for _, r := range cache.Rules() {
+		add("cache", r.Name, r.Priority, r.Match, "cache for "+time.Duration(r.TTL).String())
+	}
+	for _, r := range timeouts.Rules() {
+		add("timeout", r.Name, r.Priority, r.Match, "timeout after "+time.Duration(r.Timeout).String())
+	}
+	for _, r := range faults.Rules() {
+		add("fault", r.Name, r.Priority, r.Match, describeFault(r))
+	}
+	return rows
+}
+
+// describeFault returns the faults of a fault rule and whether it is enabled.
+func describeFault(r *faults.Rule) string {
+	var action []string
+	if r.Latency > 0 {
+		action = append(action, "latency "+time.Duration(r.Latency).String())
+	}
+	if r.Error != 0 {
+		action = append(action, fmt.Sprintf("error %d", r.Error))
+	}
+	if r.Drop {
+		action = append(action, fmt.Sprintf("drop after %d rows", r.DropAfterRows))
+	}
+	if r.Bandwidth > 0 {
+		action = append(action, fmt.Sprintf("bandwidth %d bytes/s", r.Bandwidth))
+	}
+	state := "disabled"
+	if faults.Enabled(r.Name) {
+		state = "enabled"
+	}
+	return fmt.Sprintf("%s in %g%% (%s)", strings.Join(action, ", "), r.Percentage, state)
+}
+
+// formatBool returns a boolean as a TINYINT value.
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// describeMatch returns the criteria of a rule as JSON.
+func describeMatch(m rules.Match) string {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// resultSet returns a result set with the given columns and rows. Empty
+// values of rows are sent as NULL.
+func resultSet(columns []protocol.ColumnDefinition41, rows [][]string) protocol.ResultSet {
+	rs := protocol.ResultSet{Columns: columns}
+	for _, row := range rows {
+		textRow := make(protocol.TextRow, len(row))
+		for i, value := range row {
+			if value != "" {
+				textRow[i] = []byte(value)
+			}
+		}
+		rs.Rows = append(rs.Rows, textRow)
+	}
+	return rs
+}
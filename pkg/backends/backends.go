@@ -0,0 +1,213 @@
+package backends
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/supporttools/go-sql-proxy/pkg/gtid"
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+)
+
+var logger = logging.SetupLogging()
+
+// State is the administrative state of a backend.
+type State string
+
+const (
+	// StateActive backends accept new sessions.
+	StateActive State = "active"
+	// StateDrain backends keep their sessions but accept no new ones.
+	StateDrain State = "drain"
+	// StateMaintenance backends accept no new sessions, and their existing
+	// sessions are closed when the state is entered.
+	StateMaintenance State = "maintenance"
+)
+
+// ParseState returns the state named s.
+func ParseState(s string) (State, error) {
+	switch State(s) {
+	case StateActive, StateDrain, StateMaintenance:
+		return State(s), nil
+	}
+	return "", fmt.Errorf("unknown backend state %q", s)
+}
+
+// Backend is a MySQL server sessions are proxied to.
+type Backend struct {
+	Address string
+
+	state       atomic.Value
+	connections atomic.Int64
+	breaker     breaker
+	discovered  atomic.Bool
+	// spec is the backend's entry in the backends file, if it is listed.
+	spec atomic.Pointer[Spec]
+	// lag is the replication lag last measured on the backend.
+	lag atomic.Pointer[lag]
+	// executed is the gtid_executed last read from the backend.
+	executed atomic.Pointer[gtid.Set]
+}
+
+var (
+	mu       sync.RWMutex
+	backends = make(map[string]*Backend)
+)
+
+// primary is the backend new sessions are proxied to.
+var primary atomic.Pointer[Backend]
+
+// discovered are the backends currently resolved from DNS.
+var discovered atomic.Pointer[[]*Backend]
+
+// Register returns the backend at address, adding it in StateActive if it
+// is not known yet.
+func Register(address string) *Backend {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if b, ok := backends[address]; ok {
+		return b
+	}
+	b := &Backend{Address: address}
+	b.state.Store(StateActive)
+	b.breaker.state = BreakerClosed
+	backends[address] = b
+	return b
+}
+
+// SetPrimary makes the backend at address, registering it if it is not known
+// yet, the one new sessions are proxied to and returns it.
+func SetPrimary(address string) *Backend {
+	b := Register(address)
+	if previous := primary.Swap(b); previous != nil && previous != b {
+		logger.Infof("Primary backend changed from %s to %s", previous.Address, b.Address)
+	}
+	return b
+}
+
+// Primary returns the backend new sessions are proxied to, or nil if none
+// has been set.
+func Primary() *Backend {
+	return primary.Load()
+}
+
+// SetDiscovered replaces the backends resolved from DNS with the ones at
+// addresses, in order of preference, registering new ones. Backends that are
+// no longer resolved stay registered while sessions use them. Unless the
+// primary is still among them, the first one becomes the primary.
+func SetDiscovered(addresses []string) {
+	list := make([]*Backend, len(addresses))
+	for i, address := range addresses {
+		list[i] = Register(address)
+	}
+	if previous := discovered.Swap(&list); previous != nil {
+		for _, b := range *previous {
+			b.discovered.Store(false)
+		}
+	}
+	for _, b := range list {
+		b.discovered.Store(true)
+	}
+
+	if p := Primary(); len(list) > 0 && (p == nil || !p.Discovered()) {
+		SetPrimary(list[0].Address)
+	}
+}
+
+// Discovered returns the backends resolved from DNS, in order of preference.
+func Discovered() []*Backend {
+	list := discovered.Load()
+	if list == nil {
+		return nil
+	}
+	return *list
+}
+
+// Lookup returns the backend at address.
+func Lookup(address string) (*Backend, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	b, ok := backends[address]
+	return b, ok
+}
+
+// List returns all backends ordered by address.
+func List() []*Backend {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]*Backend, 0, len(backends))
+	for _, b := range backends {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address < list[j].Address
+	})
+	return list
+}
+
+// State returns the administrative state of the backend.
+func (b *Backend) State() State {
+	return b.state.Load().(State)
+}
+
+// SetState changes the administrative state of the backend.
+func (b *Backend) SetState(state State) {
+	if previous := b.state.Swap(state); previous != state {
+		logger.Infof("Backend %s changed from %s to %s", b.Address, previous, state)
+	}
+}
+
+// Accepting returns true if new sessions may be proxied to the backend.
+func (b *Backend) Accepting() bool {
+	return b.State() == StateActive
+}
+
+// Discovered returns true if the backend is currently resolved from DNS.
+func (b *Backend) Discovered() bool {
+	return b.discovered.Load()
+}
+
+// Spec returns the entry of the backend in the backends file, or nil if it
+// is not listed there.
+func (b *Backend) Spec() *Spec {
+	return b.spec.Load()
+}
+
+// Full returns true if the backend has reached the maximum number of
+// connections of its spec.
+func (b *Backend) Full() bool {
+	spec := b.Spec()
+	return spec != nil && spec.MaxConnections > 0 && b.Connections() >= spec.MaxConnections
+}
+
+// Acquire counts a session proxied to the backend.
+func (b *Backend) Acquire() {
+	b.connections.Add(1)
+}
+
+// TryAcquire counts a session proxied to the backend unless the backend has
+// reached the maximum number of connections of its spec.
+func (b *Backend) TryAcquire() bool {
+	for {
+		n := b.connections.Load()
+		if spec := b.Spec(); spec != nil && spec.MaxConnections > 0 && n >= spec.MaxConnections {
+			return false
+		}
+		if b.connections.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// Release counts the end of a session proxied to the backend.
+func (b *Backend) Release() {
+	b.connections.Add(-1)
+}
+
+// Connections returns the number of sessions proxied to the backend.
+func (b *Backend) Connections() int64 {
+	return b.connections.Load()
+}
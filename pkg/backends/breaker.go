@@ -0,0 +1,109 @@
+package backends
+
+import (
+	"sync"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+)
+
+// BreakerState is the state of the circuit breaker of a backend.
+type BreakerState string
+
+const (
+	// BreakerClosed backends are connected to normally.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen backends failed repeatedly, and connecting to them fails
+	// fast until the cooldown has passed.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen backends are probed by a single connection attempt,
+	// which closes the breaker if it succeeds and opens it again if not.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// breaker counts the consecutive connection failures of a backend.
+type breaker struct {
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// Allow returns true if a connection to the backend may be attempted. After
+// CIRCUIT_BREAKER_THRESHOLD consecutive failures the breaker opens for
+// CIRCUIT_BREAKER_COOLDOWN, then half-opens to let one attempt probe the
+// backend. Report the outcome of allowed attempts with ReportSuccess or
+// ReportFailure.
+func (b *Backend) Allow() bool {
+	b.breaker.mu.Lock()
+	defer b.breaker.mu.Unlock()
+
+	switch b.breaker.state {
+	case BreakerOpen:
+		if time.Since(b.breaker.openedAt) < config.CFG.CircuitBreakerCooldown {
+			metrics.IncrementBackendConnectAttempts(b.Address, "rejected")
+			return false
+		}
+		b.setBreakerState(BreakerHalfOpen)
+		return true
+	case BreakerHalfOpen:
+		// Only the probing attempt is allowed.
+		metrics.IncrementBackendConnectAttempts(b.Address, "rejected")
+		return false
+	}
+	return true
+}
+
+// ReportSuccess records a successful connection to the backend, closing its
+// circuit breaker.
+func (b *Backend) ReportSuccess() {
+	b.breaker.mu.Lock()
+	defer b.breaker.mu.Unlock()
+
+	metrics.IncrementBackendConnectAttempts(b.Address, "success")
+	b.breaker.failures = 0
+	b.setBreakerState(BreakerClosed)
+}
+
+// ReportFailure records a failed connection to the backend, opening its
+// circuit breaker after too many consecutive failures or a failed probe.
+func (b *Backend) ReportFailure() {
+	b.breaker.mu.Lock()
+	defer b.breaker.mu.Unlock()
+
+	metrics.IncrementBackendConnectAttempts(b.Address, "failure")
+	b.breaker.failures++
+	threshold := config.CFG.CircuitBreakerThreshold
+	if b.breaker.state == BreakerHalfOpen || (threshold > 0 && b.breaker.failures >= threshold) {
+		b.breaker.openedAt = time.Now()
+		b.setBreakerState(BreakerOpen)
+	}
+}
+
+// Breaker returns the state of the circuit breaker of the backend.
+func (b *Backend) Breaker() BreakerState {
+	b.breaker.mu.Lock()
+	defer b.breaker.mu.Unlock()
+	return b.breaker.state
+}
+
+// setBreakerState changes the state of the circuit breaker. The caller must
+// hold the breaker's lock.
+func (b *Backend) setBreakerState(state BreakerState) {
+	previous := b.breaker.state
+	b.breaker.state = state
+	if previous == state {
+		return
+	}
+	logger.Infof("Circuit breaker of backend %s changed from %s to %s", b.Address, previous, state)
+
+	value := 0
+	switch state {
+	case BreakerHalfOpen:
+		value = 1
+	case BreakerOpen:
+		value = 2
+	}
+	metrics.SetBackendCircuitState(b.Address, value)
+}
@@ -0,0 +1,93 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+)
+
+// setBreakerConfig configures the circuit breakers for the rest of the test.
+func setBreakerConfig(t *testing.T, threshold int, cooldown time.Duration) {
+	t.Helper()
+	previousThreshold, previousCooldown := config.CFG.CircuitBreakerThreshold, config.CFG.CircuitBreakerCooldown
+	config.CFG.CircuitBreakerThreshold = threshold
+	config.CFG.CircuitBreakerCooldown = cooldown
+	t.Cleanup(func() {
+		config.CFG.CircuitBreakerThreshold = previousThreshold
+		config.CFG.CircuitBreakerCooldown = previousCooldown
+	})
+}
+
+// checkBreaker fails the test unless the breaker of b is in state want.
+func checkBreaker(t *testing.T, b *Backend, want BreakerState) {
+	t.Helper()
+	if got := b.Breaker(); got != want {
+		t.Fatalf("breaker = %s, want %s", got, want)
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	setBreakerConfig(t, 3, cooldown)
+	b := Register("breaker-transitions:3306")
+
+	// Failures below the threshold, and a success resetting them, keep the
+	// breaker closed.
+	b.ReportFailure()
+	b.ReportFailure()
+	b.ReportSuccess()
+	b.ReportFailure()
+	b.ReportFailure()
+	checkBreaker(t, b, BreakerClosed)
+	if !b.Allow() {
+		t.Fatal("closed breaker rejected a connection attempt")
+	}
+
+	b.ReportFailure()
+	checkBreaker(t, b, BreakerOpen)
+	if b.Allow() {
+		t.Fatal("open breaker allowed a connection attempt before the cooldown")
+	}
+
+	// After the cooldown a single attempt probes the backend.
+	time.Sleep(cooldown)
+	if !b.Allow() {
+		t.Fatal("open breaker rejected the probe after the cooldown")
+	}
+	checkBreaker(t, b, BreakerHalfOpen)
+	if b.Allow() {
+		t.Fatal("half-open breaker allowed a second attempt")
+	}
+
+	// A failed probe opens the breaker again at once.
+	b.ReportFailure()
+	checkBreaker(t, b, BreakerOpen)
+	if b.Allow() {
+		t.Fatal("breaker reopened by a failed probe allowed an attempt before the cooldown")
+	}
+
+	// A successful probe closes it.
+	time.Sleep(cooldown)
+	if !b.Allow() {
+		t.Fatal("open breaker rejected the probe after the cooldown")
+	}
+	b.ReportSuccess()
+	checkBreaker(t, b, BreakerClosed)
+	if !b.Allow() {
+		t.Fatal("closed breaker rejected a connection attempt")
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	setBreakerConfig(t, 0, time.Minute)
+	b := Register("breaker-disabled:3306")
+
+	for i := 0; i < 10; i++ {
+		b.ReportFailure()
+	}
+	checkBreaker(t, b, BreakerClosed)
+	if !b.Allow() {
+		t.Error("breaker without a threshold rejected a connection attempt")
+	}
+}
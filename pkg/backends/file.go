@@ -0,0 +1,167 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Role is the replication role of a backend listed in the backends file.
+type Role string
+
+const (
+	// RolePrimary is the backend new sessions are proxied to.
+	RolePrimary Role = "primary"
+	// RoleReplica backends replicate from the primary.
+	RoleReplica Role = "replica"
+)
+
+// Spec describes a backend listed in the backends file.
+type Spec struct {
+	Address string   `json:"address" yaml:"address"`
+	Role    Role     `json:"role" yaml:"role"`
+	Weight  int      `json:"weight" yaml:"weight"`
+	Tags    []string `json:"tags,omitempty" yaml:"tags"`
+	// MaxConnections limits the sessions proxied to the backend, or 0 for
+	// no limit.
+	MaxConnections int64 `json:"maxConnections" yaml:"maxConnections"`
+}
+
+// File is the content of the backends file, in JSON or, for files named
+// *.yaml or *.yml, in YAML.
+type File struct {
+	Backends []Spec `json:"backends" yaml:"backends"`
+}
+
+var (
+	fileMu sync.Mutex
+	// fileContent is the content of the backends file last loaded.
+	fileContent []byte
+	// rejectedContent is the content of the backends file that last failed
+	// to load, which is not reported again.
+	rejectedContent []byte
+	// listed are the backends of the backends file last loaded.
+	listed []*Backend
+)
+
+// LoadFile loads the backends file and applies it: listed backends are
+// registered with their specs, the primary one becomes the primary, and
+// backends no longer listed lose their specs but keep their sessions.
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to read backends file: %w", err)
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	return applyFile(path, data)
+}
+
+// WatchFile loads the backends file again whenever its content changes,
+// checking every interval until ctx is done. Invalid content is logged, and
+// the backends last loaded stay in effect.
+func WatchFile(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+		if err != nil {
+			logger.Warnf("Failed to read backends file: %v", err)
+			continue
+		}
+		fileMu.Lock()
+		if !bytes.Equal(data, fileContent) && !bytes.Equal(data, rejectedContent) {
+			if err := applyFile(path, data); err != nil {
+				rejectedContent = data
+				logger.Warnf("Keeping the previous backends: %v", err)
+			}
+		}
+		fileMu.Unlock()
+	}
+}
+
+// applyFile parses and applies the content of the backends file. The caller
+// must hold fileMu.
+func applyFile(path string, data []byte) error {
+	file := &File{}
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, file)
+	default:
+		err = json.Unmarshal(data, file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse backends file: %w", err)
+	}
+
+	var primaryAddress string
+	seen := make(map[string]bool, len(file.Backends))
+	for i := range file.Backends {
+		spec := &file.Backends[i]
+		switch {
+		case spec.Address == "":
+			return fmt.Errorf("backend without an address in %s", path)
+		case seen[spec.Address]:
+			return fmt.Errorf("backend %s is listed twice in %s", spec.Address, path)
+		case spec.Weight < 0 || spec.MaxConnections < 0:
+			return fmt.Errorf("backend %s has a negative weight or maximum of connections", spec.Address)
+		}
+		seen[spec.Address] = true
+
+		switch spec.Role {
+		case "":
+			spec.Role = RoleReplica
+		case RolePrimary:
+			if primaryAddress != "" {
+				return fmt.Errorf("backends %s and %s are both primary in %s", primaryAddress, spec.Address, path)
+			}
+			primaryAddress = spec.Address
+		case RoleReplica:
+		default:
+			return fmt.Errorf("backend %s has unknown role %q", spec.Address, spec.Role)
+		}
+	}
+
+	for _, b := range listed {
+		if !seen[b.Address] {
+			b.spec.Store(nil)
+			logger.Infof("Backend %s is no longer listed in %s", b.Address, path)
+		}
+	}
+	listed = listed[:0]
+	for i := range file.Backends {
+		spec := file.Backends[i]
+		b := Register(spec.Address)
+		switch previous := b.spec.Swap(&spec); {
+		case previous == nil:
+			logger.Infof("Backend %s listed in %s as %s", spec.Address, path, spec.Role)
+		case previous.Role != spec.Role:
+			logger.Infof("Backend %s changed role from %s to %s", spec.Address, previous.Role, spec.Role)
+		}
+		listed = append(listed, b)
+	}
+	if primaryAddress != "" {
+		SetPrimary(primaryAddress)
+	}
+
+	fileContent = data
+	logger.Infof("Loaded %d backends from %s", len(listed), path)
+	return nil
+}
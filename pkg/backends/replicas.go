@@ -0,0 +1,161 @@
+package backends
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/gtid"
+)
+
+// lag is the replication lag last measured on a replica.
+type lag struct {
+	value time.Duration
+	known bool
+}
+
+// SetLag records the replication lag measured on the backend. Lag that is
+// not known, such as when replication is stopped or the backend cannot be
+// queried, keeps the backend out of the read pool.
+func (b *Backend) SetLag(value time.Duration, known bool) {
+	b.lag.Store(&lag{value: value, known: known})
+}
+
+// Lag returns the replication lag last measured on the backend, and false if
+// it is not known.
+func (b *Backend) Lag() (time.Duration, bool) {
+	l := b.lag.Load()
+	if l == nil {
+		return 0, false
+	}
+	return l.value, l.known
+}
+
+// SetExecutedGTIDs records the GTID set the backend has executed, as read
+// from gtid_executed, or nil if it is not known.
+func (b *Backend) SetExecutedGTIDs(set gtid.Set) {
+	if set == nil {
+		b.executed.Store(nil)
+		return
+	}
+	b.executed.Store(&set)
+}
+
+// ExecutedGTIDs returns the GTID set the backend had executed when it was
+// last read, or nil if it is not known. The backend may have executed more
+// since.
+func (b *Backend) ExecutedGTIDs() gtid.Set {
+	set := b.executed.Load()
+	if set == nil {
+		return nil
+	}
+	return *set
+}
+
+// Tagged returns true if the backend has the tag name in the backends file.
+func (b *Backend) Tagged(name string) bool {
+	spec := b.Spec()
+	return spec != nil && slices.Contains(spec.Tags, name)
+}
+
+// Replica returns true if the backend is listed as a replica in the backends
+// file.
+func (b *Backend) Replica() bool {
+	spec := b.Spec()
+	return spec != nil && spec.Role == RoleReplica
+}
+
+// Readable returns true if reads may be routed to the backend: it is a
+// replica accepting sessions, not full, its circuit breaker is not open and,
+// unless maxLag is 0, its lag is known and at most maxLag.
+func (b *Backend) Readable(maxLag time.Duration) bool {
+	if !b.Replica() || !b.Accepting() || b.Full() || b.Breaker() == BreakerOpen {
+		return false
+	}
+	if maxLag <= 0 {
+		return true
+	}
+	value, known := b.Lag()
+	return known && value <= maxLag
+}
+
+// Replicas returns the backends listed as replicas in the backends file.
+func Replicas() []*Backend {
+	var replicas []*Backend
+	for _, b := range List() {
+		if b.Replica() {
+			replicas = append(replicas, b)
+		}
+	}
+	return replicas
+}
+
+// ReadPool returns the replicas reads may be routed to, as by Readable.
+func ReadPool(maxLag time.Duration) []*Backend {
+	var pool []*Backend
+	for _, b := range Replicas() {
+		if b.Readable(maxLag) {
+			pool = append(pool, b)
+		}
+	}
+	return pool
+}
+
+// PickReplica returns a replica of the read pool that accept, unless it is
+// nil, returns true for, chosen at random in proportion to the weights of the
+// backends file, where a weight of 0 counts as 1. It returns nil if there is
+// no such replica.
+func PickReplica(maxLag time.Duration, accept func(*Backend) bool) *Backend {
+	var pool []*Backend
+	for _, b := range ReadPool(maxLag) {
+		if accept == nil || accept(b) {
+			pool = append(pool, b)
+		}
+	}
+	return pickWeighted(pool)
+}
+
+// PickTagged returns a backend with the tag name in the backends file, or at
+// the address name, that accepts sessions, is not full and whose circuit
+// breaker is not open, chosen at random in proportion to the weights of the
+// backends file. It returns nil if there is no such backend.
+func PickTagged(name string) *Backend {
+	var pool []*Backend
+	for _, b := range List() {
+		if b.Address != name && !b.Tagged(name) {
+			continue
+		}
+		if b.Accepting() && !b.Full() && b.Breaker() != BreakerOpen {
+			pool = append(pool, b)
+		}
+	}
+	return pickWeighted(pool)
+}
+
+// pickWeighted returns a backend of pool chosen at random in proportion to
+// the weights of the backends file, or nil if pool is empty.
+func pickWeighted(pool []*Backend) *Backend {
+	if len(pool) == 0 {
+		return nil
+	}
+
+	total := 0
+	for _, b := range pool {
+		total += backendWeight(b)
+	}
+	n := rand.IntN(total) // #nosec G404 - load balancing does not need a secure random number
+	for _, b := range pool {
+		if n -= backendWeight(b); n < 0 {
+			return b
+		}
+	}
+	return pool[len(pool)-1]
+}
+
+// backendWeight returns the weight of a backend when picking one at random.
+func backendWeight(b *Backend) int {
+	if spec := b.Spec(); spec != nil && spec.Weight > 0 {
+		return spec.Weight
+	}
+	return 1
+}
@@ -0,0 +1,280 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+var logger = logging.SetupLogging()
+
+// defaultMaxEntrySize is the largest result set cached by rules without a maxEntrySize.
+const defaultMaxEntrySize = 1 << 20
+
+// Rule selects the SELECT statements whose result sets are cached. The first
+// matching rule in ascending priority order applies.
+type Rule struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	rules.Match
+	TTL          rules.Duration `json:"ttl"`
+	MaxEntrySize int            `json:"maxEntrySize,omitempty"`
+}
+
+// RuleSet is the content of the cache rules file.
+type RuleSet struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// ruleSet holds the active rules, swapped atomically on reload.
+var ruleSet atomic.Pointer[RuleSet]
+
+// entry is a cached result set.
+type entry struct {
+	key       string
+	rule      string
+	resultSet *protocol.ResultSet
+	tables    []string
+	size      int
+	expires   time.Time
+}
+
+// store is an LRU of cached result sets bounded by the memory they use.
+type store struct {
+	mu        sync.Mutex
+	maxMemory int
+	size      int
+	lru       *list.List
+	entries   map[string]*list.Element
+}
+
+var results = &store{
+	lru:     list.New(),
+	entries: make(map[string]*list.Element),
+}
+
+// LoadRules loads and activates the cache rules from a JSON file.
+func LoadRules(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to read cache rules: %w", err)
+	}
+
+	set := &RuleSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("failed to parse cache rules: %w", err)
+	}
+
+	for i, rule := range set.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.TTL <= 0 {
+			return fmt.Errorf("cache rule %q: ttl is required", rule.Name)
+		}
+		if rule.MaxEntrySize <= 0 {
+			rule.MaxEntrySize = defaultMaxEntrySize
+		}
+		if err := rule.Compile(); err != nil {
+			return fmt.Errorf("cache rule %q: %w", rule.Name, err)
+		}
+	}
+	sort.SliceStable(set.Rules, func(i, j int) bool {
+		return set.Rules[i].Priority < set.Rules[j].Priority
+	})
+
+	ruleSet.Store(set)
+	Purge()
+	logger.Infof("Loaded %d cache rules from %s", len(set.Rules), path)
+	return nil
+}
+
+// SetMaxMemory sets the memory the cached result sets may use, in bytes.
+func SetMaxMemory(bytes int) {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	results.maxMemory = bytes
+	results.evict()
+}
+
+// Rules returns the active cache rules in evaluation order.
+func Rules() []*Rule {
+	if set := ruleSet.Load(); set != nil {
+		return set.Rules
+	}
+	return nil
+}
+
+// Enabled returns true if cache rules have been loaded.
+func Enabled() bool {
+	return ruleSet.Load() != nil
+}
+
+// FindRule returns the rule caching the result of a statement, or nil.
+func FindRule(r *rules.Request) *Rule {
+	set := ruleSet.Load()
+	if set == nil {
+		return nil
+	}
+
+	for _, rule := range set.Rules {
+		if rule.Matches(r) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Key returns the cache key of a statement run by user in schema. Session
+// describes the session state the result depends on, such as the character
+// set and session variables, so sessions in different states never share
+// results.
+func Key(user, schema, session, query string) string {
+	return user + "\x00" + schema + "\x00" + session + "\x00" + query
+}
+
+// Get returns the cached result set for key.
+func Get(key string, rule *Rule) (*protocol.ResultSet, bool) {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	element, ok := results.entries[key]
+	if ok && time.Now().After(element.Value.(*entry).expires) {
+		results.remove(element)
+		ok = false
+	}
+	if !ok {
+		metrics.IncrementCacheMisses(rule.Name)
+		return nil, false
+	}
+
+	results.lru.MoveToFront(element)
+	metrics.IncrementCacheHits(rule.Name)
+	return element.Value.(*entry).resultSet, true
+}
+
+// Put caches the result set for key under rule. Tables are the schema-qualified
+// tables the statement reads, used for invalidation. Result sets larger than
+// the rule's maxEntrySize are not cached.
+func Put(key string, rule *Rule, tables []string, rs *protocol.ResultSet) bool {
+	size := rs.Size() + len(key)
+	if size > rule.MaxEntrySize {
+		return false
+	}
+
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	if results.maxMemory > 0 && size > results.maxMemory {
+		return false
+	}
+	if element, ok := results.entries[key]; ok {
+		results.remove(element)
+	}
+
+	e := &entry{
+		key:       key,
+		rule:      rule.Name,
+		resultSet: rs,
+		tables:    normalizeTables(tables),
+		size:      size,
+		expires:   time.Now().Add(time.Duration(rule.TTL)),
+	}
+	results.entries[key] = results.lru.PushFront(e)
+	results.size += size
+	results.evict()
+	results.updateMetrics()
+	return true
+}
+
+// Invalidate removes the cached result sets that read any of the given
+// schema-qualified tables and returns how many were removed.
+func Invalidate(tables []string) int {
+	if len(tables) == 0 {
+		return 0
+	}
+	invalidated := make(map[string]bool, len(tables))
+	for _, table := range normalizeTables(tables) {
+		invalidated[table] = true
+	}
+
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	removed := 0
+	for element := results.lru.Front(); element != nil; {
+		next := element.Next()
+		for _, table := range element.Value.(*entry).tables {
+			if invalidated[table] {
+				results.remove(element)
+				removed++
+				break
+			}
+		}
+		element = next
+	}
+
+	if removed > 0 {
+		metrics.AddCacheInvalidations(removed)
+		results.updateMetrics()
+		logger.Debugf("Invalidated %d cached result sets for tables %v", removed, tables)
+	}
+	return removed
+}
+
+// Purge removes all cached result sets.
+func Purge() {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	results.lru.Init()
+	results.entries = make(map[string]*list.Element)
+	results.size = 0
+	results.updateMetrics()
+}
+
+// evict removes the least recently used entries until the cache fits in its memory cap.
+func (c *store) evict() {
+	for c.maxMemory > 0 && c.size > c.maxMemory {
+		element := c.lru.Back()
+		if element == nil {
+			return
+		}
+		c.remove(element)
+		metrics.IncrementCacheEvictions()
+	}
+	c.updateMetrics()
+}
+
+// remove removes an entry from the cache.
+func (c *store) remove(element *list.Element) {
+	e := c.lru.Remove(element).(*entry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+// updateMetrics publishes the size of the cache.
+func (c *store) updateMetrics() {
+	metrics.SetCacheSize(c.lru.Len(), c.size)
+}
+
+// normalizeTables lowercases table names so invalidation is case-insensitive.
+func normalizeTables(tables []string) []string {
+	normalized := make([]string, len(tables))
+	for i, table := range tables {
+		normalized[i] = strings.ToLower(table)
+	}
+	return normalized
+}
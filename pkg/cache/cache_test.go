@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+func testRule() *Rule {
+	return &Rule{Name: "test", TTL: rules.Duration(time.Minute), MaxEntrySize: defaultMaxEntrySize}
+}
+
+func testResultSet() *protocol.ResultSet {
+	return &protocol.ResultSet{
+		Columns: []protocol.ColumnDefinition41{protocol.NewColumn("id", protocol.TypeLongLong)},
+		Rows:    []protocol.TextRow{{[]byte("1")}},
+	}
+}
+
+func TestKeySeparatesSessions(t *testing.T) {
+	const query = "SELECT * FROM users"
+	keys := []string{
+		Key("app", "shop", "45", query),
+		Key("app", "shop", "45 deprecate_eof", query),
+		Key("app", "shop", "45\x00SET time_zone = '+02:00'", query),
+		Key("app", "crm", "45", query),
+		Key("report", "shop", "45", query),
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if seen[key] {
+			t.Errorf("Key() returned %q twice", key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	t.Cleanup(Purge)
+	rule := testRule()
+	Put("users", rule, []string{"shop.Users"}, testResultSet())
+	Put("orders", rule, []string{"shop.orders", "shop.items"}, testResultSet())
+
+	if n := Invalidate([]string{"SHOP.users"}); n != 1 {
+		t.Errorf("Invalidate(shop.users) removed %d entries, want 1", n)
+	}
+	if _, ok := Get("users", rule); ok {
+		t.Error("entry reading shop.users survived its invalidation")
+	}
+	if _, ok := Get("orders", rule); !ok {
+		t.Error("entry reading other tables was invalidated")
+	}
+
+	Purge()
+	if _, ok := Get("orders", rule); ok {
+		t.Error("entry survived Purge()")
+	}
+}
+
+func TestPutLimits(t *testing.T) {
+	t.Cleanup(Purge)
+	rule := testRule()
+	rule.MaxEntrySize = 8
+	if Put("big", rule, nil, testResultSet()) {
+		t.Error("Put() cached a result set larger than maxEntrySize")
+	}
+
+	expired := testRule()
+	expired.TTL = rules.Duration(-time.Second)
+	Put("expired", expired, nil, testResultSet())
+	if _, ok := Get("expired", expired); ok {
+		t.Error("Get() returned an expired entry")
+	}
+}
@@ -0,0 +1,286 @@
+package canary
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+)
+
+var logger = logging.SetupLogging()
+
+// Keys hashed to select the sessions sent to the canary.
+const (
+	// HashUser sends all sessions of a user to the same side.
+	HashUser = "user"
+	// HashClientIP sends all sessions from a client IP to the same side.
+	HashClientIP = "ip"
+)
+
+// Cohorts of sessions compared by the canary.
+const (
+	// Canary are the sessions routed to the canary group.
+	Canary = "canary"
+	// Baseline are the sessions not selected for the canary.
+	Baseline = "baseline"
+)
+
+// maxSamples bounds the statement latencies kept per cohort and window. Once
+// it is reached, new latencies replace random samples.
+const maxSamples = 10000
+
+// Config configures the canary.
+type Config struct {
+	// Group is the backend group of the canary: the backends with its name
+	// as a tag in the backends file.
+	Group  string
+	HashBy string
+	// Weight is the initial percentage of new sessions sent to the canary.
+	Weight int
+	// MaxErrorRatio rolls the canary back if its error rate exceeds the
+	// baseline's by this factor. Zero disables the check.
+	MaxErrorRatio float64
+	// MaxLatencyRatio rolls the canary back if its p99 latency exceeds the
+	// baseline's by this factor. Zero disables the check.
+	MaxLatencyRatio float64
+	// Window is the period the cohorts are compared over.
+	Window time.Duration
+	// MinStatements are the statements each cohort must have run in a
+	// window for it to be compared.
+	MinStatements int
+}
+
+// Stats are the statistics of a cohort in the current window.
+type Stats struct {
+	Statements int     `json:"statements"`
+	Errors     int     `json:"errors"`
+	ErrorRate  float64 `json:"errorRate"`
+	P99        string  `json:"p99"`
+}
+
+// Status describes the canary.
+type Status struct {
+	Group  string `json:"group"`
+	HashBy string `json:"hashBy"`
+	Weight int    `json:"weight"`
+	// RolledBack is true if the canary was rolled back since its weight was
+	// last set.
+	RolledBack     bool       `json:"rolledBack"`
+	RollbackReason string     `json:"rollbackReason,omitempty"`
+	RolledBackAt   *time.Time `json:"rolledBackAt,omitempty"`
+	WindowStart    time.Time  `json:"windowStart"`
+	Canary         Stats      `json:"canary"`
+	Baseline       Stats      `json:"baseline"`
+}
+
+// cohort collects the statements of a cohort in the current window.
+type cohort struct {
+	statements int
+	errors     int
+	latencies  []time.Duration
+}
+
+var (
+	mu         sync.Mutex
+	cfg        *Config
+	weight     int
+	rolledBack bool
+	reason     string
+	rolledAt   *time.Time
+	started    time.Time
+	cohorts    = map[string]*cohort{Canary: {}, Baseline: {}}
+)
+
+// Configure enables the canary.
+func Configure(c Config) error {
+	switch {
+	case c.Group == "":
+		return errors.New("group is required")
+	case c.HashBy != HashUser && c.HashBy != HashClientIP:
+		return fmt.Errorf("unknown hash key %q", c.HashBy)
+	case c.Weight < 0 || c.Weight > 100:
+		return fmt.Errorf("weight %d is not a percentage", c.Weight)
+	case c.MaxErrorRatio < 0 || c.MaxLatencyRatio < 0:
+		return errors.New("rollback ratios must not be negative")
+	case c.Window <= 0:
+		return errors.New("window must be positive")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	cfg = &c
+	setWeight(c.Weight)
+	logger.Infof("Canary group %s receives %d%% of new sessions by %s", c.Group, c.Weight, c.HashBy)
+	return nil
+}
+
+// Enabled returns true if the canary has been configured.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return cfg != nil
+}
+
+// SetWeight changes the percentage of new sessions sent to the canary and
+// starts a new comparison window. Sessions already routed stay where they
+// are.
+func SetWeight(w int) error {
+	if w < 0 || w > 100 {
+		return fmt.Errorf("weight %d is not a percentage", w)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if cfg == nil {
+		return errors.New("canary is not configured")
+	}
+	setWeight(w)
+	logger.Infof("Canary group %s receives %d%% of new sessions", cfg.Group, w)
+	return nil
+}
+
+// setWeight changes the weight with mu held.
+func setWeight(w int) {
+	weight = w
+	rolledBack, reason, rolledAt = false, "", nil
+	resetWindow(time.Now())
+	metrics.SetCanaryWeight(w)
+}
+
+// resetWindow starts a new comparison window with mu held.
+func resetWindow(now time.Time) {
+	started = now
+	for _, c := range cohorts {
+		*c = cohort{}
+	}
+}
+
+// Select returns the canary group and whether a new session of user from
+// clientIP is sent to it, or an empty group if the canary is not configured.
+// Sessions are selected by the hash of their user or client IP, so the same
+// user or client stays on the same side while the weight does not drop.
+func Select(user string, clientIP net.IP) (string, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	if cfg == nil {
+		return "", false
+	}
+
+	key := user
+	if cfg.HashBy == HashClientIP && clientIP != nil {
+		key = clientIP.String()
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return cfg.Group, int(h.Sum32()%100) < weight
+}
+
+// Record records a statement of a session in cohort that completed after
+// latency, failed or not, and rolls the canary back if it did worse than the
+// baseline in the window that ended.
+func Record(name string, latency time.Duration, failed bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	c, ok := cohorts[name]
+	if cfg == nil || !ok {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(started) >= cfg.Window {
+		if weight > 0 {
+			evaluate(now)
+		}
+		resetWindow(now)
+	}
+
+	c.statements++
+	if failed {
+		c.errors++
+	}
+	if len(c.latencies) < maxSamples {
+		c.latencies = append(c.latencies, latency)
+	} else if i := rand.IntN(c.statements); i < maxSamples { // #nosec G404 - sampling needs no secure randomness
+		c.latencies[i] = latency
+	}
+}
+
+// evaluate compares the cohorts of the window that ended with mu held and
+// rolls the canary back if it crossed a threshold.
+func evaluate(now time.Time) {
+	canary, baseline := cohorts[Canary], cohorts[Baseline]
+	if canary.statements < cfg.MinStatements || baseline.statements < cfg.MinStatements {
+		return
+	}
+
+	var why string
+	// A baseline without errors counts as one, so that a single canary
+	// error does not roll back.
+	baselineRate := float64(max(baseline.errors, 1)) / float64(baseline.statements)
+	canaryRate := canary.errorRate()
+	canaryP99, baselineP99 := canary.p99(), baseline.p99()
+	switch {
+	case cfg.MaxErrorRatio > 0 && canaryRate > baselineRate*cfg.MaxErrorRatio:
+		why = fmt.Sprintf("error rate %.4f exceeds %.1f times the baseline's %.4f", canaryRate, cfg.MaxErrorRatio, baseline.errorRate())
+	case cfg.MaxLatencyRatio > 0 && float64(canaryP99) > float64(baselineP99)*cfg.MaxLatencyRatio:
+		why = fmt.Sprintf("p99 latency %s exceeds %.1f times the baseline's %s", canaryP99, cfg.MaxLatencyRatio, baselineP99)
+	default:
+		return
+	}
+
+	weight = 0
+	rolledBack, reason, rolledAt = true, why, &now
+	metrics.SetCanaryWeight(0)
+	metrics.IncrementCanaryRollbacks()
+	logger.Warnf("Rolled back canary group %s: %s", cfg.Group, why)
+}
+
+// errorRate returns the share of the cohort's statements that failed.
+func (c *cohort) errorRate() float64 {
+	if c.statements == 0 {
+		return 0
+	}
+	return float64(c.errors) / float64(c.statements)
+}
+
+// p99 returns the 99th percentile of the cohort's sampled latencies.
+func (c *cohort) p99() time.Duration {
+	if len(c.latencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(c.latencies)
+	slices.Sort(sorted)
+	return sorted[(len(sorted)*99-1)/100]
+}
+
+// stats returns the statistics of the cohort.
+func (c *cohort) stats() Stats {
+	return Stats{Statements: c.statements, Errors: c.errors, ErrorRate: c.errorRate(), P99: c.p99().String()}
+}
+
+// Current returns the status of the canary, or nil if it is not configured.
+func Current() *Status {
+	mu.Lock()
+	defer mu.Unlock()
+	if cfg == nil {
+		return nil
+	}
+	return &Status{
+		Group:          cfg.Group,
+		HashBy:         cfg.HashBy,
+		Weight:         weight,
+		RolledBack:     rolledBack,
+		RollbackReason: reason,
+		RolledBackAt:   rolledAt,
+		WindowStart:    started,
+		Canary:         cohorts[Canary].stats(),
+		Baseline:       cohorts[Baseline].stats(),
+	}
+}
@@ -0,0 +1,172 @@
+package capture
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+)
+
+var logger = logging.SetupLogging()
+
+// queueSize is the number of records buffered for the writer before new ones are dropped.
+const queueSize = 10000
+
+// flushInterval is how often buffered records are flushed to the capture file.
+const flushInterval = time.Second
+
+// writer writes records to the capture file in the background.
+type writer struct {
+	file    *os.File
+	gz      *gzip.Writer
+	start   time.Time
+	records chan *Record
+	stop    chan struct{}
+	done    chan struct{}
+	buf     []byte
+}
+
+var (
+	active   atomic.Pointer[writer]
+	stopOnce sync.Once
+)
+
+// Start records the commands of all sessions to a new capture file at path.
+func Start(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to create capture file: %w", err)
+	}
+
+	gz, err := gzip.NewWriterLevel(file, gzip.BestSpeed)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := gz.Write([]byte(magic)); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write capture file: %w", err)
+	}
+
+	w := &writer{
+		file:    file,
+		gz:      gz,
+		start:   time.Now(),
+		records: make(chan *Record, queueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	active.Store(w)
+	go w.run()
+
+	logger.Infof("Capturing client commands to %s", path)
+	return nil
+}
+
+// Stop flushes the records captured so far and closes the capture file.
+func Stop() {
+	w := active.Load()
+	if w == nil {
+		return
+	}
+	stopOnce.Do(func() {
+		active.Store(nil)
+		close(w.stop)
+		<-w.done
+	})
+}
+
+// Enabled returns true if commands are captured.
+func Enabled() bool {
+	return active.Load() != nil
+}
+
+// SessionStart records that a client session authenticated.
+func SessionStart(connectionID uint64, user, schema, clientIP string) {
+	enqueue(&Record{Type: RecordSessionStart, ConnectionID: connectionID, User: user, Schema: schema, ClientIP: clientIP}, time.Now())
+}
+
+// Command records a command that was received at start and answered after
+// latency. The record's Type, ConnectionID and Offset are set by Command.
+func Command(connectionID uint64, start time.Time, r *Record) {
+	r.Type = RecordCommand
+	r.ConnectionID = connectionID
+	enqueue(r, start)
+}
+
+// SessionEnd records that a client session ended.
+func SessionEnd(connectionID uint64) {
+	enqueue(&Record{Type: RecordSessionEnd, ConnectionID: connectionID}, time.Now())
+}
+
+// enqueue queues a record that happened at the given time for the writer.
+func enqueue(r *Record, at time.Time) {
+	w := active.Load()
+	if w == nil {
+		return
+	}
+	r.Offset = at.Sub(w.start)
+
+	// Capturing must not slow down clients, so records are dropped if the
+	// writer falls behind.
+	select {
+	case w.records <- r:
+	default:
+		metrics.IncrementCaptureDropped()
+	}
+}
+
+// run writes queued records until Stop is called.
+func (w *writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case r := <-w.records:
+			w.write(r)
+		case <-w.stop:
+			// Write what was queued before the capture stopped.
+			for {
+				select {
+				case r := <-w.records:
+					w.write(r)
+				default:
+					w.close()
+					return
+				}
+			}
+		case <-ticker.C:
+			if err := w.gz.Flush(); err != nil {
+				logger.Errorf("Failed to flush capture file: %v", err)
+			}
+		}
+	}
+}
+
+// write writes a record to the capture file.
+func (w *writer) write(r *Record) {
+	w.buf = r.encode(w.buf[:0])
+	if _, err := w.gz.Write(w.buf); err != nil {
+		logger.Errorf("Failed to write capture file: %v", err)
+		return
+	}
+	metrics.IncrementCaptureRecords()
+}
+
+// close finishes the gzip stream and closes the capture file.
+func (w *writer) close() {
+	if err := w.gz.Close(); err != nil {
+		logger.Errorf("Failed to finish capture file: %v", err)
+	}
+	if err := w.file.Close(); err != nil {
+		logger.Errorf("Failed to close capture file: %v", err)
+	}
+}
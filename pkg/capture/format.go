@@ -0,0 +1,174 @@
+package capture
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The capture file is a gzip stream starting with magic, followed by records.
+// Each record starts with its type and the connection ID as uvarints and the
+// time since the capture started in nanoseconds as a varint. Strings and
+// payloads are written as a uvarint length followed by their bytes.
+const magic = "GSPCAP1\n"
+
+// RecordType identifies the kind of a capture record.
+type RecordType uint64
+
+const (
+	// RecordSessionStart is written when a client session authenticated.
+	RecordSessionStart RecordType = 1
+	// RecordCommand is written for each command the session sent.
+	RecordCommand RecordType = 2
+	// RecordSessionEnd is written when the session ended.
+	RecordSessionEnd RecordType = 3
+)
+
+// Record is a single entry of a capture file.
+type Record struct {
+	Type         RecordType
+	ConnectionID uint64
+	// Offset is the time since the capture started.
+	Offset time.Duration
+
+	// Session start fields.
+	User     string
+	Schema   string
+	ClientIP string
+
+	// Command fields. Payload is the command packet payload, starting with
+	// the command byte, as forwarded to the backend.
+	Payload   []byte
+	Latency   time.Duration
+	ErrorCode uint16
+	// StatementID and Params are the statement ID the backend assigned to a
+	// prepared statement and its number of parameters, for COM_STMT_PREPARE.
+	StatementID uint32
+	Params      uint16
+}
+
+// errCorrupt is returned for capture files that cannot be decoded.
+var errCorrupt = errors.New("corrupt capture file")
+
+// encode appends the encoded record to buf.
+func (r *Record) encode(buf []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(r.Type))
+	buf = binary.AppendUvarint(buf, r.ConnectionID)
+	buf = binary.AppendVarint(buf, int64(r.Offset))
+
+	switch r.Type {
+	case RecordSessionStart:
+		buf = appendBytes(buf, []byte(r.User))
+		buf = appendBytes(buf, []byte(r.Schema))
+		buf = appendBytes(buf, []byte(r.ClientIP))
+	case RecordCommand:
+		buf = appendBytes(buf, r.Payload)
+		buf = binary.AppendUvarint(buf, uint64(r.Latency))
+		buf = binary.AppendUvarint(buf, uint64(r.ErrorCode))
+		buf = binary.AppendUvarint(buf, uint64(r.StatementID))
+		buf = binary.AppendUvarint(buf, uint64(r.Params))
+	}
+	return buf
+}
+
+// appendBytes appends b prefixed with its length.
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// Reader reads the records of a capture file.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a reader of the capture file read from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+
+	br := bufio.NewReader(gz)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, header); err != nil || string(header) != magic {
+		return nil, errCorrupt
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the file.
+func (r *Reader) Next() (*Record, error) {
+	recordType, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &Record{Type: RecordType(recordType)}
+	if record.ConnectionID, err = binary.ReadUvarint(r.r); err != nil {
+		return nil, unexpected(err)
+	}
+	offset, err := binary.ReadVarint(r.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	record.Offset = time.Duration(offset)
+
+	switch record.Type {
+	case RecordSessionStart:
+		fields := make([][]byte, 3)
+		for i := range fields {
+			if fields[i], err = r.readBytes(); err != nil {
+				return nil, err
+			}
+		}
+		record.User, record.Schema, record.ClientIP = string(fields[0]), string(fields[1]), string(fields[2])
+	case RecordCommand:
+		if record.Payload, err = r.readBytes(); err != nil {
+			return nil, err
+		}
+		fields := make([]uint64, 4)
+		for i := range fields {
+			if fields[i], err = binary.ReadUvarint(r.r); err != nil {
+				return nil, unexpected(err)
+			}
+		}
+		record.Latency = time.Duration(fields[0]) // #nosec G115 - written from a time.Duration
+		record.ErrorCode = uint16(fields[1])      // #nosec G115 - written from a uint16
+		record.StatementID = uint32(fields[2])    // #nosec G115 - written from a uint32
+		record.Params = uint16(fields[3])         // #nosec G115 - written from a uint16
+	case RecordSessionEnd:
+	default:
+		return nil, errCorrupt
+	}
+
+	return record, nil
+}
+
+// readBytes reads a length-prefixed byte string.
+func (r *Reader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	if n > 1<<30 {
+		return nil, errCorrupt
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, unexpected(err)
+	}
+	return b, nil
+}
+
+// unexpected turns io.EOF inside a record into io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
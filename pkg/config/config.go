@@ -4,24 +4,92 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 )
 
 // AppConfig structure for environment-based configurations.
 type AppConfig struct {
-	Debug                  bool   `json:"debug"`
-	MetricsPort            int    `json:"metricsPort"`
-	SourceDatabaseServer   string `json:"sourceDatabaseServer"`
-	SourceDatabasePort     int    `json:"sourceDatabasePort"`
-	SourceDatabaseUser     string `json:"sourceDatabaseUser"`
-	SourceDatabasePassword string `json:"sourceDatabasePassword"`
-	SourceDatabaseName     string `json:"sourceDatabaseName"`
-	BindAddress            string `json:"bindAddress"`
-	BindPort               int    `json:"bindPort"`
-	UseSSL                 bool   `json:"useSSL"`
-	SSLSkipVerify          bool   `json:"sslSkipVerify"`
-	SSLCAFile              string `json:"sslCAFile"`
-	SSLCertFile            string `json:"sslCertFile"`
-	SSLKeyFile             string `json:"sslKeyFile"`
+	Debug                   bool          `json:"debug"`
+	MetricsPort             int           `json:"metricsPort"`
+	SourceDatabaseServer    string        `json:"sourceDatabaseServer"`
+	SourceDatabasePort      int           `json:"sourceDatabasePort"`
+	SourceDatabaseUser      string        `json:"sourceDatabaseUser"`
+	SourceDatabasePassword  string        `json:"sourceDatabasePassword"`
+	SourceDatabaseName      string        `json:"sourceDatabaseName"`
+	BindAddress             string        `json:"bindAddress"`
+	BindPort                int           `json:"bindPort"`
+	UseSSL                  bool          `json:"useSSL"`
+	SSLSkipVerify           bool          `json:"sslSkipVerify"`
+	SSLCAFile               string        `json:"sslCAFile"`
+	SSLCertFile             string        `json:"sslCertFile"`
+	SSLKeyFile              string        `json:"sslKeyFile"`
+	ClientSSLCertFile       string        `json:"clientSSLCertFile"`
+	ClientSSLKeyFile        string        `json:"clientSSLKeyFile"`
+	FirewallRulesFile       string        `json:"firewallRulesFile"`
+	FirewallMode            string        `json:"firewallMode"`
+	FirewallAllowlistFile   string        `json:"firewallAllowlistFile"`
+	FirewallLearnDuration   time.Duration `json:"firewallLearnDuration"`
+	RewriteRulesFile        string        `json:"rewriteRulesFile"`
+	RewriteDryRun           bool          `json:"rewriteDryRun"`
+	CacheRulesFile          string        `json:"cacheRulesFile"`
+	CacheMaxMemory          int           `json:"cacheMaxMemory"`
+	CacheInvalidateOnWrite  bool          `json:"cacheInvalidateOnWrite"`
+	QueryTimeout            time.Duration `json:"queryTimeout"`
+	QueryTimeoutRulesFile   string        `json:"queryTimeoutRulesFile"`
+	ClientDisconnectKill    string        `json:"clientDisconnectKill"`
+	ShadowDatabaseServer    string        `json:"shadowDatabaseServer"`
+	ShadowDatabasePort      int           `json:"shadowDatabasePort"`
+	ShadowDatabaseUser      string        `json:"shadowDatabaseUser"`
+	ShadowDatabasePassword  string        `json:"shadowDatabasePassword"`
+	ShadowMode              string        `json:"shadowMode"`
+	ShadowTimeout           time.Duration `json:"shadowTimeout"`
+	ShadowQueueSize         int           `json:"shadowQueueSize"`
+	CaptureFile             string        `json:"captureFile"`
+	PcapDir                 string        `json:"pcapDir"`
+	AdminAPIToken           string        `json:"adminApiToken"`
+	AdminMySQLPort          int           `json:"adminMySQLPort"`
+	AdminMySQLUser          string        `json:"adminMySQLUser"`
+	AdminMySQLPassword      string        `json:"adminMySQLPassword"`
+	MaintenanceMode         bool          `json:"maintenanceMode"`
+	MaintenanceErrorCode    int           `json:"maintenanceErrorCode"`
+	MaintenanceSQLState     string        `json:"maintenanceSqlState"`
+	MaintenanceMessage      string        `json:"maintenanceMessage"`
+	BackendUsersFile        string        `json:"backendUsersFile"`
+	PauseMaxHeld            int           `json:"pauseMaxHeld"`
+	PauseTimeout            time.Duration `json:"pauseTimeout"`
+	ReconnectTimeout        time.Duration `json:"reconnectTimeout"`
+	ReconnectSetVariables   string        `json:"reconnectSetVariables"`
+	BackendConnectTimeout   time.Duration `json:"backendConnectTimeout"`
+	BackendConnectRetries   int           `json:"backendConnectRetries"`
+	BackendRetryBackoff     time.Duration `json:"backendRetryBackoff"`
+	BackendRetryMaxBackoff  time.Duration `json:"backendRetryMaxBackoff"`
+	BackendFallbacks        string        `json:"backendFallbacks"`
+	CircuitBreakerThreshold int           `json:"circuitBreakerThreshold"`
+	CircuitBreakerCooldown  time.Duration `json:"circuitBreakerCooldown"`
+	BackendDiscovery        string        `json:"backendDiscovery"`
+	DNSServers              string        `json:"dnsServers"`
+	DNSTTLMin               time.Duration `json:"dnsTtlMin"`
+	DNSTTLMax               time.Duration `json:"dnsTtlMax"`
+	BackendsFile            string        `json:"backendsFile"`
+	BackendsFileInterval    time.Duration `json:"backendsFileInterval"`
+	ReadWriteSplit          bool          `json:"readWriteSplit"`
+	ReplicaMaxLag           time.Duration `json:"replicaMaxLag"`
+	ReplicaLagCheckInterval time.Duration `json:"replicaLagCheckInterval"`
+	ReplicaLagQuery         string        `json:"replicaLagQuery"`
+	ReadYourWrites          bool          `json:"readYourWrites"`
+	ReadYourWritesWait      time.Duration `json:"readYourWritesWait"`
+	QueryHints              bool          `json:"queryHints"`
+	QueryHintsStrip         bool          `json:"queryHintsStrip"`
+	RoutingRulesFile        string        `json:"routingRulesFile"`
+	ShardMapFile            string        `json:"shardMapFile"`
+	CanaryGroup             string        `json:"canaryGroup"`
+	CanaryWeight            int           `json:"canaryWeight"`
+	CanaryHashBy            string        `json:"canaryHashBy"`
+	CanaryMaxErrorRatio     float64       `json:"canaryMaxErrorRatio"`
+	CanaryMaxLatencyRatio   float64       `json:"canaryMaxLatencyRatio"`
+	CanaryWindow            time.Duration `json:"canaryWindow"`
+	CanaryMinStatements     int           `json:"canaryMinStatements"`
+	FaultRulesFile          string        `json:"faultRulesFile"`
 }
 
 // CFG is the global configuration object.
@@ -43,6 +111,73 @@ func LoadConfiguration() {
 	CFG.SSLCAFile = getEnvOrDefault("SSL_CA_FILE", "")
 	CFG.SSLCertFile = getEnvOrDefault("SSL_CERT_FILE", "")
 	CFG.SSLKeyFile = getEnvOrDefault("SSL_KEY_FILE", "")
+	CFG.ClientSSLCertFile = getEnvOrDefault("CLIENT_SSL_CERT_FILE", "")
+	CFG.ClientSSLKeyFile = getEnvOrDefault("CLIENT_SSL_KEY_FILE", "")
+	CFG.FirewallRulesFile = getEnvOrDefault("FIREWALL_RULES_FILE", "")
+	CFG.FirewallMode = getEnvOrDefault("FIREWALL_MODE", "off")
+	CFG.FirewallAllowlistFile = getEnvOrDefault("FIREWALL_ALLOWLIST_FILE", "")
+	CFG.FirewallLearnDuration = parseEnvDuration("FIREWALL_LEARN_DURATION", 0)
+	CFG.RewriteRulesFile = getEnvOrDefault("REWRITE_RULES_FILE", "")
+	CFG.RewriteDryRun = parseEnvBool("REWRITE_DRY_RUN", false)
+	CFG.CacheRulesFile = getEnvOrDefault("CACHE_RULES_FILE", "")
+	CFG.CacheMaxMemory = parseEnvInt("CACHE_MAX_MEMORY", 64<<20)
+	CFG.CacheInvalidateOnWrite = parseEnvBool("CACHE_INVALIDATE_ON_WRITE", true)
+	CFG.QueryTimeout = parseEnvDuration("QUERY_TIMEOUT", 0)
+	CFG.QueryTimeoutRulesFile = getEnvOrDefault("QUERY_TIMEOUT_RULES_FILE", "")
+	CFG.ClientDisconnectKill = getEnvOrDefault("CLIENT_DISCONNECT_KILL", "off")
+	CFG.ShadowDatabaseServer = getEnvOrDefault("SHADOW_DATABASE_SERVER", "")
+	CFG.ShadowDatabasePort = parseEnvInt("SHADOW_DATABASE_PORT", 3306)
+	CFG.ShadowDatabaseUser = getEnvOrDefault("SHADOW_DATABASE_USER", "")
+	CFG.ShadowDatabasePassword = getEnvOrDefault("SHADOW_DATABASE_PASSWORD", "")
+	CFG.ShadowMode = getEnvOrDefault("SHADOW_MODE", "reads")
+	CFG.ShadowTimeout = parseEnvDuration("SHADOW_TIMEOUT", 30*time.Second)
+	CFG.ShadowQueueSize = parseEnvInt("SHADOW_QUEUE_SIZE", 1000)
+	CFG.CaptureFile = getEnvOrDefault("CAPTURE_FILE", "")
+	CFG.PcapDir = getEnvOrDefault("PCAP_DIR", "")
+	CFG.AdminAPIToken = getEnvOrDefault("ADMIN_API_TOKEN", "")
+	CFG.AdminMySQLPort = parseEnvInt("ADMIN_MYSQL_PORT", 0)
+	CFG.AdminMySQLUser = getEnvOrDefault("ADMIN_MYSQL_USER", "admin")
+	CFG.AdminMySQLPassword = getEnvOrDefault("ADMIN_MYSQL_PASSWORD", "")
+	CFG.MaintenanceMode = parseEnvBool("MAINTENANCE_MODE", false)
+	CFG.MaintenanceErrorCode = parseEnvInt("MAINTENANCE_ERROR_CODE", 1053)
+	CFG.MaintenanceSQLState = getEnvOrDefault("MAINTENANCE_SQL_STATE", "08S01")
+	CFG.MaintenanceMessage = getEnvOrDefault("MAINTENANCE_MESSAGE", "database under maintenance")
+	CFG.BackendUsersFile = getEnvOrDefault("BACKEND_USERS_FILE", "")
+	CFG.PauseMaxHeld = parseEnvInt("PAUSE_MAX_HELD", 1000)
+	CFG.PauseTimeout = parseEnvDuration("PAUSE_TIMEOUT", 30*time.Second)
+	CFG.ReconnectTimeout = parseEnvDuration("RECONNECT_TIMEOUT", 10*time.Second)
+	CFG.ReconnectSetVariables = getEnvOrDefault("RECONNECT_SET_VARIABLES", "names,character set,character_set_client,character_set_results,character_set_connection,collation_connection,sql_mode,time_zone,autocommit,transaction,transaction_isolation,transaction_read_only,tx_isolation,wait_timeout,interactive_timeout,net_read_timeout,net_write_timeout,sql_select_limit,max_execution_time,group_concat_max_len,foreign_key_checks,unique_checks,sql_safe_updates,innodb_lock_wait_timeout,lc_time_names")
+	CFG.BackendConnectTimeout = parseEnvDuration("BACKEND_CONNECT_TIMEOUT", 5*time.Second)
+	CFG.BackendConnectRetries = parseEnvInt("BACKEND_CONNECT_RETRIES", 3)
+	CFG.BackendRetryBackoff = parseEnvDuration("BACKEND_RETRY_BACKOFF", 100*time.Millisecond)
+	CFG.BackendRetryMaxBackoff = parseEnvDuration("BACKEND_RETRY_MAX_BACKOFF", 2*time.Second)
+	CFG.BackendFallbacks = getEnvOrDefault("BACKEND_FALLBACKS", "")
+	CFG.CircuitBreakerThreshold = parseEnvInt("CIRCUIT_BREAKER_THRESHOLD", 5)
+	CFG.CircuitBreakerCooldown = parseEnvDuration("CIRCUIT_BREAKER_COOLDOWN", 10*time.Second)
+	CFG.BackendDiscovery = getEnvOrDefault("BACKEND_DISCOVERY", "off")
+	CFG.DNSServers = getEnvOrDefault("DNS_SERVERS", "")
+	CFG.DNSTTLMin = parseEnvDuration("DNS_TTL_MIN", 5*time.Second)
+	CFG.DNSTTLMax = parseEnvDuration("DNS_TTL_MAX", 5*time.Minute)
+	CFG.BackendsFile = getEnvOrDefault("BACKENDS_FILE", "")
+	CFG.BackendsFileInterval = parseEnvDuration("BACKENDS_FILE_INTERVAL", 5*time.Second)
+	CFG.ReadWriteSplit = parseEnvBool("READ_WRITE_SPLIT", false)
+	CFG.ReplicaMaxLag = parseEnvDuration("REPLICA_MAX_LAG", 10*time.Second)
+	CFG.ReplicaLagCheckInterval = parseEnvDuration("REPLICA_LAG_CHECK_INTERVAL", 2*time.Second)
+	CFG.ReplicaLagQuery = getEnvOrDefault("REPLICA_LAG_QUERY", "")
+	CFG.ReadYourWrites = parseEnvBool("READ_YOUR_WRITES", false)
+	CFG.ReadYourWritesWait = parseEnvDuration("READ_YOUR_WRITES_WAIT", 100*time.Millisecond)
+	CFG.QueryHints = parseEnvBool("QUERY_HINTS", true)
+	CFG.QueryHintsStrip = parseEnvBool("QUERY_HINTS_STRIP", false)
+	CFG.RoutingRulesFile = getEnvOrDefault("ROUTING_RULES_FILE", "")
+	CFG.ShardMapFile = getEnvOrDefault("SHARD_MAP_FILE", "")
+	CFG.CanaryGroup = getEnvOrDefault("CANARY_GROUP", "")
+	CFG.CanaryWeight = parseEnvInt("CANARY_WEIGHT", 0)
+	CFG.CanaryHashBy = getEnvOrDefault("CANARY_HASH_BY", "user")
+	CFG.CanaryMaxErrorRatio = parseEnvFloat("CANARY_MAX_ERROR_RATIO", 2)
+	CFG.CanaryMaxLatencyRatio = parseEnvFloat("CANARY_MAX_LATENCY_RATIO", 2)
+	CFG.CanaryWindow = parseEnvDuration("CANARY_WINDOW", time.Minute)
+	CFG.CanaryMinStatements = parseEnvInt("CANARY_MIN_STATEMENTS", 100)
+	CFG.FaultRulesFile = getEnvOrDefault("FAULT_RULES_FILE", "")
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -77,3 +212,29 @@ func parseEnvBool(key string, defaultValue bool) bool {
 	}
 	return boolValue
 }
+
+func parseEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	durationValue, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Error parsing %s as duration: %v. Using default value: %s", key, err, defaultValue)
+		return defaultValue
+	}
+	return durationValue
+}
+
+func parseEnvFloat(key string, defaultValue float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Error parsing %s as float: %v. Using default value: %g", key, err, defaultValue)
+		return defaultValue
+	}
+	return floatValue
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// BackendNet is the network name the MySQL driver dials backends with, so
+// connections the proxy opens itself use the same dial and TLS mode as
+// sessions. Use it as the Net of driver configurations, without TLSConfig.
+const BackendNet = "go-sql-proxy-backend"
+
+func init() {
+	mysql.RegisterDialContext(BackendNet, DialBackend)
+}
+
+// backendTLSConfig builds the backend TLS configuration once.
+var backendTLSConfig = sync.OnceValues(func() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: CFG.SSLSkipVerify, // #nosec G402 - InsecureSkipVerify is configurable for development environments
+	}
+
+	// Load custom CA if provided
+	if CFG.SSLCAFile != "" {
+		caCert, err := os.ReadFile(CFG.SSLCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA certificate")
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	// Load client certificates if provided
+	if CFG.SSLCertFile != "" && CFG.SSLKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(CFG.SSLCertFile, CFG.SSLKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificates: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+})
+
+// BackendTLSConfig returns the TLS configuration of connections to backends,
+// built from SSL_SKIP_VERIFY, SSL_CA_FILE, SSL_CERT_FILE and SSL_KEY_FILE.
+func BackendTLSConfig() (*tls.Config, error) {
+	return backendTLSConfig()
+}
+
+// DialBackend opens a connection to the MySQL server at address within the
+// configured connect timeout. With USE_SSL, TLS starts with the first byte,
+// and the timeout includes the TLS handshake.
+func DialBackend(ctx context.Context, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: CFG.BackendConnectTimeout}
+	if !CFG.UseSSL {
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+	tlsConfig, err := BackendTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+	return tlsDialer.DialContext(ctx, "tcp", address)
+}
+
+// clientTLSConfig builds the client TLS configuration once.
+var clientTLSConfig = sync.OnceValues(func() (*tls.Config, error) {
+	if CFG.ClientSSLCertFile == "" || CFG.ClientSSLKeyFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(CFG.ClientSSLCertFile, CFG.ClientSSLKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the proxy's certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+})
+
+// ClientTLSConfig returns the TLS configuration the proxy terminates TLS of
+// clients with, built from CLIENT_SSL_CERT_FILE and CLIENT_SSL_KEY_FILE, or
+// nil if they are not set.
+func ClientTLSConfig() (*tls.Config, error) {
+	return clientTLSConfig()
+}
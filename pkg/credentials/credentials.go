@@ -0,0 +1,63 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+)
+
+var logger = logging.SetupLogging()
+
+// User is the password of a backend account. The proxy relays the client's
+// own authentication, so it only needs passwords to open further backend
+// connections for a session, such as when moving it to another backend.
+type User struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// UserSet is the content of the backend users file.
+type UserSet struct {
+	Users []User `json:"users"`
+}
+
+// passwords holds the passwords by user, swapped atomically on reload.
+var passwords atomic.Pointer[map[string]string]
+
+// LoadUsers loads and activates the backend users from a JSON file.
+func LoadUsers(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to read backend users: %w", err)
+	}
+
+	set := &UserSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("failed to parse backend users: %w", err)
+	}
+
+	users := make(map[string]string, len(set.Users))
+	for _, u := range set.Users {
+		if u.User == "" {
+			return fmt.Errorf("backend user without a name in %s", path)
+		}
+		users[u.User] = u.Password
+	}
+
+	passwords.Store(&users)
+	logger.Infof("Loaded %d backend users from %s", len(users), path)
+	return nil
+}
+
+// Password returns the password of a backend user, if it is known.
+func Password(user string) (string, bool) {
+	users := passwords.Load()
+	if users == nil {
+		return "", false
+	}
+	password, ok := (*users)[user]
+	return password, ok
+}
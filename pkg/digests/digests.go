@@ -0,0 +1,99 @@
+package digests
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// maxEntries bounds the number of user, schema and digest combinations
+// tracked. Statements of new combinations are not tracked once it is reached.
+const maxEntries = 10000
+
+// Stats are the statistics of the statements of one digest run by a user in
+// a schema.
+type Stats struct {
+	User         string
+	Schema       string
+	Digest       string
+	Fingerprint  string
+	Count        uint64
+	Errors       uint64
+	TotalLatency time.Duration
+	MinLatency   time.Duration
+	MaxLatency   time.Duration
+	FirstSeen    time.Time
+	LastSeen     time.Time
+}
+
+// key identifies the statistics of a digest.
+type key struct {
+	user, schema, digest string
+}
+
+var (
+	mu    sync.Mutex
+	stats = make(map[key]*Stats)
+)
+
+// Record records a statement with the given digest that completed after
+// latency, failed or not.
+func Record(user, schema, digest, query string, latency time.Duration, failed bool) {
+	now := time.Now()
+	k := key{user: user, schema: schema, digest: digest}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	s, ok := stats[k]
+	if !ok {
+		if len(stats) >= maxEntries {
+			return
+		}
+		s = &Stats{
+			User:        user,
+			Schema:      schema,
+			Digest:      digest,
+			Fingerprint: sqlparse.Normalize(query),
+			MinLatency:  latency,
+			FirstSeen:   now,
+		}
+		stats[k] = s
+	}
+
+	s.Count++
+	if failed {
+		s.Errors++
+	}
+	s.TotalLatency += latency
+	s.MinLatency = min(s.MinLatency, latency)
+	s.MaxLatency = max(s.MaxLatency, latency)
+	s.LastSeen = now
+}
+
+// List returns the statistics of all digests, the most frequent first.
+func List() []Stats {
+	mu.Lock()
+	list := make([]Stats, 0, len(stats))
+	for _, s := range stats {
+		list = append(list, *s)
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Digest < list[j].Digest
+	})
+	return list
+}
+
+// Reset discards the statistics of all digests.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	stats = make(map[key]*Stats)
+}
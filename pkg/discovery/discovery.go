@@ -0,0 +1,234 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+)
+
+var logger = logging.SetupLogging()
+
+// Mode selects how backends are discovered.
+type Mode string
+
+const (
+	// ModeOff uses the configured backend address as it is.
+	ModeOff Mode = "off"
+	// ModeDNS resolves the backend host name to all of its A and AAAA
+	// records, each a backend on the configured port.
+	ModeDNS Mode = "dns"
+	// ModeSRV resolves the backend host name as an SRV name, such as
+	// _mysql._tcp.db.svc, whose targets and ports are the backends.
+	ModeSRV Mode = "srv"
+)
+
+// Config configures backend discovery.
+type Config struct {
+	Mode Mode
+	// Name is the host name or SRV name resolved.
+	Name string
+	// Port is the port of backends resolved from A and AAAA records.
+	Port int
+	// Servers are the DNS servers queried, or empty for those of
+	// /etc/resolv.conf.
+	Servers []string
+	// MinTTL and MaxTTL bound the time until the name is resolved again.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+}
+
+// Start resolves the backends once and keeps resolving them again, when
+// their records expire, until ctx is done. The resolved backends are diffed
+// into the backend set; the last known good set is kept while resolution
+// fails. Only invalid configurations return an error.
+func Start(ctx context.Context, cfg Config) error {
+	switch cfg.Mode {
+	case ModeOff:
+		return nil
+	case ModeDNS, ModeSRV:
+	default:
+		return fmt.Errorf("unknown backend discovery mode %q", cfg.Mode)
+	}
+	if cfg.MinTTL <= 0 || cfg.MaxTTL < cfg.MinTTL {
+		return fmt.Errorf("invalid DNS TTL bounds %s to %s", cfg.MinTTL, cfg.MaxTTL)
+	}
+
+	r := &resolver{cfg: cfg, client: newClient(cfg.Servers)}
+	wait := r.refresh()
+	go func() {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				timer.Reset(r.refresh())
+			}
+		}
+	}()
+	return nil
+}
+
+// resolver keeps the discovered backends up to date.
+type resolver struct {
+	cfg    Config
+	client *client
+	// addresses is the last known good set of backend addresses.
+	addresses []string
+}
+
+// refresh resolves the backends and applies changes to the backend set. It
+// returns the time until the next resolution.
+func (r *resolver) refresh() time.Duration {
+	addresses, ttl, err := r.resolve()
+	if err == nil && len(addresses) == 0 {
+		err = errors.New("no backends resolved")
+	}
+	if err != nil {
+		metrics.IncrementDNSResolutions("failure")
+		if r.addresses == nil {
+			logger.Warnf("Failed to resolve backends from %s: %v", r.cfg.Name, err)
+		} else {
+			logger.Warnf("Failed to resolve backends from %s, keeping %d known backends: %v", r.cfg.Name, len(r.addresses), err)
+		}
+		return r.cfg.MinTTL
+	}
+	metrics.IncrementDNSResolutions("success")
+
+	added, removed := diff(r.addresses, addresses)
+	for _, address := range added {
+		logger.Infof("Discovered backend %s from %s", address, r.cfg.Name)
+	}
+	for _, address := range removed {
+		logger.Infof("Backend %s is no longer in %s", address, r.cfg.Name)
+	}
+	if !slices.Equal(r.addresses, addresses) {
+		backends.SetDiscovered(addresses)
+		metrics.SetDiscoveredBackends(len(addresses))
+	}
+	r.addresses = addresses
+
+	return min(max(ttl, r.cfg.MinTTL), r.cfg.MaxTTL)
+}
+
+// resolve returns the backend addresses, in order of preference, and the
+// lowest TTL of the records they were resolved from.
+func (r *resolver) resolve() ([]string, time.Duration, error) {
+	if r.cfg.Mode == ModeSRV {
+		return r.resolveSRV()
+	}
+	ips, ttl, err := r.resolveHost(r.cfg.Name)
+	if err != nil {
+		return nil, 0, err
+	}
+	addresses := make([]string, len(ips))
+	for i, ip := range ips {
+		addresses[i] = net.JoinHostPort(ip, strconv.Itoa(r.cfg.Port))
+	}
+	return addresses, ttl, nil
+}
+
+// resolveSRV resolves the SRV records of the name and their targets. The
+// targets are ordered by priority and then by descending weight.
+func (r *resolver) resolveSRV() ([]string, time.Duration, error) {
+	answers, err := r.client.lookup(r.cfg.Name, typeSRV)
+	if err != nil {
+		return nil, 0, err
+	}
+	ttl := minTTL(answers)
+
+	var records []*net.SRV
+	for _, a := range answers {
+		if a.srv != nil {
+			records = append(records, a.srv)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		return records[i].Weight > records[j].Weight
+	})
+
+	var addresses []string
+	for _, srv := range records {
+		ips, targetTTL, err := r.resolveHost(srv.Target)
+		if err != nil {
+			return nil, 0, err
+		}
+		ttl = min(ttl, targetTTL)
+		for _, ip := range ips {
+			address := net.JoinHostPort(ip, strconv.Itoa(int(srv.Port)))
+			if !slices.Contains(addresses, address) {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses, ttl, nil
+}
+
+// resolveHost returns the addresses of host, sorted, and the lowest TTL of
+// their records. Names that DNS does not resolve are looked up with the
+// system resolver, which also reads /etc/hosts, and are resolved again after
+// the minimum TTL.
+func (r *resolver) resolveHost(host string) ([]string, time.Duration, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}, r.cfg.MaxTTL, nil
+	}
+
+	answers, err := r.client.lookup(host, typeA, typeAAAA)
+	if err != nil {
+		ips, lookupErr := net.DefaultResolver.LookupHost(context.Background(), strings.TrimSuffix(host, "."))
+		if lookupErr != nil {
+			return nil, 0, err
+		}
+		sort.Strings(ips)
+		return ips, 0, nil
+	}
+
+	var ips []string
+	for _, a := range answers {
+		if a.ip != nil && !slices.Contains(ips, a.ip.String()) {
+			ips = append(ips, a.ip.String())
+		}
+	}
+	sort.Strings(ips)
+	return ips, minTTL(answers), nil
+}
+
+// minTTL returns the lowest TTL of answers.
+func minTTL(answers []answer) time.Duration {
+	ttl := time.Duration(-1)
+	for _, a := range answers {
+		if ttl < 0 || a.ttl < ttl {
+			ttl = a.ttl
+		}
+	}
+	return max(ttl, 0)
+}
+
+// diff returns the addresses added to and removed from previous.
+func diff(previous, current []string) (added, removed []string) {
+	for _, address := range current {
+		if !slices.Contains(previous, address) {
+			added = append(added, address)
+		}
+	}
+	for _, address := range previous {
+		if !slices.Contains(current, address) {
+			removed = append(removed, address)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,340 @@
+package discovery
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS record types and classes queried by the client.
+const (
+	typeA     uint16 = 1
+	typeCNAME uint16 = 5
+	typeAAAA  uint16 = 28
+	typeSRV   uint16 = 33
+	classIN   uint16 = 1
+)
+
+// rcodeNameError is the NXDOMAIN response code.
+const rcodeNameError = 3
+
+// queryTimeout bounds a single DNS query.
+const queryTimeout = 2 * time.Second
+
+// errNotFound is returned when a name has no records of the queried type.
+var errNotFound = errors.New("no such host")
+
+// resolvConf is the resolver configuration read when no DNS servers are
+// configured.
+const resolvConf = "/etc/resolv.conf"
+
+// answer is a resource record of a DNS response.
+type answer struct {
+	rtype uint16
+	ttl   time.Duration
+	ip    net.IP
+	srv   *net.SRV
+}
+
+// client is a minimal DNS stub resolver. Unlike net.Resolver it reports the
+// TTLs of the records, which decide when names are resolved again.
+type client struct {
+	servers []string
+	search  []string
+	ndots   int
+}
+
+// newClient returns a client querying servers, or the name servers of
+// /etc/resolv.conf if none are given. The search domains of resolv.conf are
+// applied in either case, so that Kubernetes service names resolve.
+func newClient(servers []string) *client {
+	c := &client{ndots: 1}
+	if f, err := os.Open(resolvConf); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 {
+				continue
+			}
+			switch fields[0] {
+			case "nameserver":
+				c.servers = append(c.servers, net.JoinHostPort(fields[1], "53"))
+			case "search":
+				c.search = fields[1:]
+			case "options":
+				for _, option := range fields[1:] {
+					if n, ok := strings.CutPrefix(option, "ndots:"); ok {
+						if ndots, err := strconv.Atoi(n); err == nil {
+							c.ndots = ndots
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(servers) > 0 {
+		c.servers = servers
+	}
+	if len(c.servers) == 0 {
+		c.servers = []string{"127.0.0.1:53"}
+	}
+	return c
+}
+
+// candidates returns the fully qualified names tried for name, in order.
+func (c *client) candidates(name string) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{name}
+	}
+	var names []string
+	if strings.Count(name, ".") >= c.ndots {
+		names = append(names, name+".")
+	}
+	for _, domain := range c.search {
+		names = append(names, name+"."+strings.TrimSuffix(domain, ".")+".")
+	}
+	if strings.Count(name, ".") < c.ndots {
+		names = append(names, name+".")
+	}
+	return names
+}
+
+// lookup resolves name with the search domains and returns the answers of
+// type qtype, with the CNAME records leading to them, from the first name
+// that has any.
+func (c *client) lookup(name string, qtypes ...uint16) ([]answer, error) {
+	var lastErr error
+	for _, fqdn := range c.candidates(name) {
+		var answers []answer
+		for _, qtype := range qtypes {
+			found, err := c.query(fqdn, qtype)
+			if err != nil && !errors.Is(err, errNotFound) {
+				return nil, err
+			}
+			answers = append(answers, found...)
+		}
+		for _, a := range answers {
+			if a.rtype != typeCNAME {
+				return answers, nil
+			}
+		}
+		lastErr = fmt.Errorf("lookup %s: %w", name, errNotFound)
+	}
+	return nil, lastErr
+}
+
+// query sends a query for fqdn to the servers in turn until one answers.
+func (c *client) query(fqdn string, qtype uint16) ([]answer, error) {
+	request, id, err := encodeQuery(fqdn, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, server := range c.servers {
+		response, err := exchangeUDP(server, request)
+		if err == nil && len(response) > 2 && response[2]&0x02 != 0 {
+			// Truncated, such as SRV records of large headless services.
+			response, err = exchangeTCP(server, request)
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("query %s at %s: %w", fqdn, server, err)
+			continue
+		}
+		answers, err := decodeResponse(response, id, qtype)
+		if err != nil && !errors.Is(err, errNotFound) {
+			lastErr = fmt.Errorf("query %s at %s: %w", fqdn, server, err)
+			continue
+		}
+		return answers, err
+	}
+	return nil, lastErr
+}
+
+// exchangeUDP sends request to server over UDP and returns the response.
+func exchangeUDP(server string, request []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", server, queryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(queryTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, 65535)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray responses to other queries.
+		if n >= 2 && binary.BigEndian.Uint16(response) == binary.BigEndian.Uint16(request) {
+			return response[:n], nil
+		}
+	}
+}
+
+// exchangeTCP sends request to server over TCP and returns the response.
+func exchangeTCP(server string, request []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", server, queryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(queryTimeout)); err != nil {
+		return nil, err
+	}
+
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(request))) // #nosec G115 - queries are far below 64 KiB
+	if _, err := conn.Write(append(framed, request...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// encodeQuery returns a recursive query for fqdn and its ID.
+func encodeQuery(fqdn string, qtype uint16) ([]byte, uint16, error) {
+	id := uint16(rand.N(1 << 16)) // #nosec G115 - below 1<<16
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	// Recursion desired, one question.
+	msg = append(msg, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0)
+	for _, label := range strings.Split(strings.TrimSuffix(fqdn, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid DNS name %q", fqdn)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, classIN)
+	return msg, id, nil
+}
+
+// decodeResponse returns the answers of type qtype and the CNAME records of
+// the response to query id.
+func decodeResponse(msg []byte, id, qtype uint16) ([]answer, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("short DNS response")
+	}
+	if binary.BigEndian.Uint16(msg) != id || msg[2]&0x80 == 0 {
+		return nil, errors.New("unexpected DNS response")
+	}
+	switch rcode := msg[3] & 0x0f; rcode {
+	case 0:
+	case rcodeNameError:
+		return nil, errNotFound
+	default:
+		return nil, fmt.Errorf("DNS response code %d", rcode)
+	}
+
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := decodeName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+
+	var found []answer
+	for i := 0; i < answers; i++ {
+		_, next, err := decodeName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errors.New("short DNS record")
+		}
+		rtype := binary.BigEndian.Uint16(msg[next:])
+		ttl := time.Duration(binary.BigEndian.Uint32(msg[next+4:])) * time.Second
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		data := next + 10
+		if data+length > len(msg) {
+			return nil, errors.New("short DNS record")
+		}
+		offset = data + length
+
+		a := answer{rtype: rtype, ttl: ttl}
+		switch {
+		case rtype == typeCNAME:
+		case rtype != qtype:
+			continue
+		case rtype == typeA && length == net.IPv4len, rtype == typeAAAA && length == net.IPv6len:
+			a.ip = net.IP(append([]byte(nil), msg[data:data+length]...))
+		case rtype == typeSRV && length > 6:
+			target, _, err := decodeName(msg, data+6)
+			if err != nil {
+				return nil, err
+			}
+			a.srv = &net.SRV{
+				Priority: binary.BigEndian.Uint16(msg[data:]),
+				Weight:   binary.BigEndian.Uint16(msg[data+2:]),
+				Port:     binary.BigEndian.Uint16(msg[data+4:]),
+				Target:   target,
+			}
+		default:
+			return nil, fmt.Errorf("malformed DNS record of type %d", rtype)
+		}
+		found = append(found, a)
+	}
+	return found, nil
+}
+
+// decodeName decodes the possibly compressed name at offset and returns it
+// with the offset following it.
+func decodeName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errors.New("short DNS name")
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) || jumps > 10 {
+				return "", 0, errors.New("invalid DNS name compression")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+			jumps++
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errors.New("short DNS name")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
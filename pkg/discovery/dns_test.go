@@ -0,0 +1,182 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// testID is the query ID of the test responses.
+const testID = 0x1234
+
+// question is the question section for db.example.com, type A. The name
+// starts at offset 12 and example.com at offset 15.
+var question = []byte{2, 'd', 'b', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1}
+
+// response returns a DNS response to testID with rcode, the question and the
+// given answer records.
+func response(rcode byte, records ...[]byte) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, testID)
+	msg = append(msg, 0x81, 0x80|rcode, 0, 1)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(records)))
+	msg = append(msg, 0, 0, 0, 0)
+	msg = append(msg, question...)
+	for _, r := range records {
+		msg = append(msg, r...)
+	}
+	return msg
+}
+
+// record returns a resource record named by a pointer to offset.
+func record(offset int, rtype uint16, ttl uint32, data []byte) []byte {
+	r := binary.BigEndian.AppendUint16(nil, 0xc000|uint16(offset))
+	r = binary.BigEndian.AppendUint16(r, rtype)
+	r = binary.BigEndian.AppendUint16(r, classIN)
+	r = binary.BigEndian.AppendUint32(r, ttl)
+	r = binary.BigEndian.AppendUint16(r, uint16(len(data)))
+	return append(r, data...)
+}
+
+func TestDecodeResponse(t *testing.T) {
+	srvData := []byte{0, 10, 0, 5, 0x0c, 0xea, 5, 'm', 'y', 's', 'q', 'l', 0xc0, 15}
+	v6 := net.ParseIP("2001:db8::1")
+
+	tests := []struct {
+		name  string
+		msg   []byte
+		qtype uint16
+		want  []answer
+	}{
+		{
+			name:  "compressed A record",
+			msg:   response(0, record(12, typeA, 30, []byte{10, 0, 0, 1})),
+			qtype: typeA,
+			want:  []answer{{rtype: typeA, ttl: 30 * time.Second, ip: net.IPv4(10, 0, 0, 1).To4()}},
+		},
+		{
+			name: "CNAME leading to A record",
+			msg: response(0,
+				record(12, typeCNAME, 60, []byte{3, 'w', 'w', 'w', 0xc0, 15}),
+				record(12, typeA, 5, []byte{10, 0, 0, 2})),
+			qtype: typeA,
+			want:  []answer{{rtype: typeCNAME, ttl: time.Minute}, {rtype: typeA, ttl: 5 * time.Second, ip: net.IPv4(10, 0, 0, 2).To4()}},
+		},
+		{
+			name:  "AAAA record",
+			msg:   response(0, record(12, typeAAAA, 1, v6)),
+			qtype: typeAAAA,
+			want:  []answer{{rtype: typeAAAA, ttl: time.Second, ip: v6}},
+		},
+		{
+			name:  "records of other types are skipped",
+			msg:   response(0, record(12, typeA, 30, []byte{10, 0, 0, 1})),
+			qtype: typeAAAA,
+		},
+		{
+			name:  "SRV record with compressed target",
+			msg:   response(0, record(12, typeSRV, 10, srvData)),
+			qtype: typeSRV,
+			want: []answer{{rtype: typeSRV, ttl: 10 * time.Second, srv: &net.SRV{
+				Target: "mysql.example.com.", Port: 3306, Priority: 10, Weight: 5,
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := decodeResponse(tt.msg, testID, tt.qtype)
+		if err != nil {
+			t.Errorf("%s: decodeResponse failed: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: decodeResponse = %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i, a := range got {
+			want := tt.want[i]
+			if a.rtype != want.rtype || a.ttl != want.ttl || !a.ip.Equal(want.ip) ||
+				(a.srv == nil) != (want.srv == nil) || (a.srv != nil && *a.srv != *want.srv) {
+				t.Errorf("%s: answer %d = %+v, want %+v", tt.name, i, a, want)
+			}
+		}
+	}
+}
+
+func TestDecodeResponseErrors(t *testing.T) {
+	valid := response(0, record(12, typeA, 30, []byte{10, 0, 0, 1}))
+	otherID := append([]byte(nil), valid...)
+	otherID[1]++
+	query := append([]byte(nil), valid...)
+	query[2] &^= 0x80
+
+	tests := []struct {
+		name  string
+		msg   []byte
+		qtype uint16
+	}{
+		{"empty", nil, typeA},
+		{"truncated header", valid[:11], typeA},
+		{"other ID", otherID, typeA},
+		{"query instead of response", query, typeA},
+		{"server failure", response(2), typeA},
+		{"truncated question", valid[:20], typeA},
+		{"truncated record header", valid[:len(valid)-6], typeA},
+		{"truncated record data", valid[:len(valid)-1], typeA},
+		{"pointer out of range", response(0, record(200, typeA, 30, []byte{10, 0, 0, 1})), typeA},
+		{"pointer loop", response(0, record(32, typeA, 30, []byte{10, 0, 0, 1})), typeA},
+		{"A record of wrong length", response(0, record(12, typeA, 30, []byte{10, 0, 0})), typeA},
+		{"truncated SRV target", response(0, record(12, typeSRV, 10, []byte{0, 10, 0, 5, 0x0c, 0xea, 5, 'm', 'y'})), typeSRV},
+	}
+	for _, tt := range tests {
+		if got, err := decodeResponse(tt.msg, testID, tt.qtype); err == nil {
+			t.Errorf("%s: decodeResponse = %+v, want an error", tt.name, got)
+		}
+	}
+
+	if _, err := decodeResponse(response(rcodeNameError), testID, typeA); !errors.Is(err, errNotFound) {
+		t.Errorf("NXDOMAIN: decodeResponse error = %v, want %v", err, errNotFound)
+	}
+}
+
+func TestDecodeName(t *testing.T) {
+	msg := append(make([]byte, 12), question...)
+	msg = append(msg, 5, 'm', 'y', 's', 'q', 'l', 0xc0, 15, 0)
+
+	tests := []struct {
+		offset int
+		want   string
+		next   int
+	}{
+		{12, "db.example.com.", 28},
+		{15, "example.com.", 28},
+		{27, ".", 28},
+		{32, "mysql.example.com.", 40},
+		{38, "example.com.", 40},
+	}
+	for _, tt := range tests {
+		name, next, err := decodeName(msg, tt.offset)
+		if err != nil || name != tt.want || next != tt.next {
+			t.Errorf("decodeName(msg, %d) = %q, %d, %v, want %q, %d", tt.offset, name, next, err, tt.want, tt.next)
+		}
+	}
+}
+
+func TestEncodeQuery(t *testing.T) {
+	msg, id, err := encodeQuery("db.example.com.", typeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint16(msg) != id {
+		t.Errorf("query ID = %d, want %d", binary.BigEndian.Uint16(msg), id)
+	}
+	if got := msg[12:]; string(got) != string(question) {
+		t.Errorf("question = %v, want %v", got, question)
+	}
+
+	for _, name := range []string{"db..example.com.", string(make([]byte, 64)) + ".com."} {
+		if _, _, err := encodeQuery(name, typeA); err == nil {
+			t.Errorf("encodeQuery(%q) succeeded, want an error", name)
+		}
+	}
+}
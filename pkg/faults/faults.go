@@ -0,0 +1,226 @@
+package faults
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+var logger = logging.SetupLogging()
+
+// MySQL errors with a known SQL state and message.
+const (
+	// ErrLockWaitTimeout is ER_LOCK_WAIT_TIMEOUT.
+	ErrLockWaitTimeout uint16 = 1205
+	// ErrLockDeadlock is ER_LOCK_DEADLOCK.
+	ErrLockDeadlock uint16 = 1213
+	// ErrLostConnection is CR_SERVER_LOST, a client error. The proxy closes
+	// the connection instead of answering it.
+	ErrLostConnection uint16 = 2013
+)
+
+// knownErrors are the SQL states and messages of known errors.
+var knownErrors = map[uint16][2]string{
+	ErrLockWaitTimeout: {"HY000", "Lock wait timeout exceeded; try restarting transaction"},
+	ErrLockDeadlock:    {"40001", "Deadlock found when trying to get lock; try restarting transaction"},
+}
+
+// Rule injects faults into the statements it matches while it is enabled.
+// Rules are loaded disabled.
+type Rule struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	rules.Match
+	// Percentage is the share of matching statements the faults are
+	// injected into, 100 if zero.
+	Percentage float64 `json:"percentage,omitempty"`
+	// Latency delays statements before they are forwarded.
+	Latency rules.Duration `json:"latency,omitempty"`
+	// Error answers statements with a MySQL error instead of forwarding
+	// them, or closes the connection for ErrLostConnection.
+	Error    uint16 `json:"error,omitempty"`
+	SQLState string `json:"sqlState,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// Drop closes the connection after DropAfterRows rows of a result set
+	// were relayed.
+	Drop          bool `json:"drop,omitempty"`
+	DropAfterRows int  `json:"dropAfterRows,omitempty"`
+	// Bandwidth throttles responses to this many bytes per second.
+	Bandwidth int `json:"bandwidth,omitempty"`
+}
+
+// RuleSet is the content of the fault rules file.
+type RuleSet struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// ruleSet holds the active rules, swapped atomically on reload.
+var ruleSet atomic.Pointer[RuleSet]
+
+var (
+	mu sync.Mutex
+	// enabled are the names of the enabled rules.
+	enabled = make(map[string]bool)
+	// anyEnabled is true while a rule is enabled, so statements skip the
+	// rules otherwise.
+	anyEnabled atomic.Bool
+)
+
+// LoadRules loads and activates the fault rules from a JSON file. Rules that
+// were enabled stay enabled if the file still has a rule of their name.
+func LoadRules(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to read fault rules: %w", err)
+	}
+
+	set := &RuleSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("failed to parse fault rules: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for i, rule := range set.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("fault rule %q is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("fault rule %q: %w", rule.Name, err)
+		}
+		if err := rule.Compile(); err != nil {
+			return fmt.Errorf("fault rule %q: %w", rule.Name, err)
+		}
+	}
+	sort.SliceStable(set.Rules, func(i, j int) bool {
+		return set.Rules[i].Priority < set.Rules[j].Priority
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name := range enabled {
+		if !names[name] {
+			delete(enabled, name)
+		}
+	}
+	anyEnabled.Store(len(enabled) > 0)
+	ruleSet.Store(set)
+	logger.Infof("Loaded %d fault rules from %s", len(set.Rules), path)
+	return nil
+}
+
+// validate checks the faults of the rule and fills in defaults.
+func (r *Rule) validate() error {
+	switch {
+	case r.Percentage < 0 || r.Percentage > 100:
+		return fmt.Errorf("percentage %g is out of range", r.Percentage)
+	case r.Latency < 0:
+		return errors.New("latency must not be negative")
+	case r.DropAfterRows < 0:
+		return errors.New("dropAfterRows must not be negative")
+	case r.Bandwidth < 0:
+		return errors.New("bandwidth must not be negative")
+	case r.Latency == 0 && r.Error == 0 && !r.Drop && r.Bandwidth == 0:
+		return errors.New("no fault is configured")
+	case r.SQLState != "" && len(r.SQLState) != 5:
+		return errors.New("sqlState must have 5 characters")
+	}
+	if r.Percentage == 0 {
+		r.Percentage = 100
+	}
+	if r.Error != 0 && r.Error != ErrLostConnection {
+		known, ok := knownErrors[r.Error]
+		if !ok {
+			known = [2]string{"HY000", "Fault injected by the proxy"}
+		}
+		if r.SQLState == "" {
+			r.SQLState = known[0]
+		}
+		if r.Message == "" {
+			r.Message = known[1]
+		}
+	}
+	return nil
+}
+
+// Rules returns the active fault rules in evaluation order.
+func Rules() []*Rule {
+	if set := ruleSet.Load(); set != nil {
+		return set.Rules
+	}
+	return nil
+}
+
+// Enabled returns true if the rule named name is enabled.
+func Enabled(name string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled[name]
+}
+
+// SetEnabled enables or disables the rule named name.
+func SetEnabled(name string, on bool) error {
+	found := false
+	for _, rule := range Rules() {
+		found = found || rule.Name == name
+	}
+	if !found {
+		return fmt.Errorf("unknown fault rule %q", name)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if on {
+		enabled[name] = true
+		logger.Warnf("Enabled fault rule %q", name)
+	} else if enabled[name] {
+		delete(enabled, name)
+		logger.Infof("Disabled fault rule %q", name)
+	}
+	anyEnabled.Store(len(enabled) > 0)
+	return nil
+}
+
+// DisableAll disables all rules and returns how many were enabled.
+func DisableAll() int {
+	mu.Lock()
+	defer mu.Unlock()
+	n := len(enabled)
+	clear(enabled)
+	anyEnabled.Store(false)
+	if n > 0 {
+		logger.Infof("Disabled %d fault rules", n)
+	}
+	return n
+}
+
+// For returns the rule whose faults are injected into a statement, or nil.
+// Enabled rules matching the statement are sampled in ascending priority
+// order, and the first one selected for the statement by its percentage
+// applies.
+func For(r *rules.Request) *Rule {
+	if !anyEnabled.Load() {
+		return nil
+	}
+	for _, rule := range Rules() {
+		if !Enabled(rule.Name) || !rule.Matches(r) {
+			continue
+		}
+		if rule.Percentage < 100 && rand.Float64()*100 >= rule.Percentage { // #nosec G404 - sampling needs no secure randomness
+			continue
+		}
+		return rule
+	}
+	return nil
+}
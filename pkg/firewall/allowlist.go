@@ -0,0 +1,263 @@
+package firewall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// Mode controls how statements whose digest is missing from the allow list are treated.
+type Mode string
+
+const (
+	// ModeOff disables the allow list.
+	ModeOff Mode = "off"
+	// ModeLearn records every digest per user into the allow list.
+	ModeLearn Mode = "learn"
+	// ModeProtectLogOnly logs statements with unknown digests but lets them through.
+	ModeProtectLogOnly Mode = "protect-log-only"
+	// ModeEnforce rejects statements with unknown digests.
+	ModeEnforce Mode = "enforce"
+)
+
+// allowlistFlushInterval is how often learned digests are written to the allow list file.
+const allowlistFlushInterval = 10 * time.Second
+
+// Allowlist maps users to the digests they are allowed to run. Each digest maps
+// to its statement fingerprint so the file can be reviewed before it is checked in.
+type Allowlist struct {
+	Users map[string]map[string]string `json:"users"`
+}
+
+// allowlistState is the active allow list and the mode it is applied in.
+type allowlistState struct {
+	mu         sync.RWMutex
+	mode       Mode
+	path       string
+	list       Allowlist
+	learnUntil time.Time
+	dirty      bool
+}
+
+var allowlist = &allowlistState{mode: ModeOff}
+
+// ConfigureAllowlist activates the allow list in the given mode. In learn mode,
+// digests are recorded for learnDuration (forever if zero) and flushed to path
+// periodically until ctx is done; an existing file is extended. The other modes
+// load the allow list from path.
+func ConfigureAllowlist(ctx context.Context, mode Mode, path string, learnDuration time.Duration) error {
+	switch mode {
+	case ModeOff:
+		return nil
+	case ModeLearn, ModeProtectLogOnly, ModeEnforce:
+	default:
+		return fmt.Errorf("unknown firewall mode %q", mode)
+	}
+	if path == "" {
+		return fmt.Errorf("firewall mode %q requires an allow list file", mode)
+	}
+
+	list, err := readAllowlist(path)
+	if err != nil && (mode != ModeLearn || !errors.Is(err, os.ErrNotExist)) {
+		return err
+	}
+
+	allowlist.mu.Lock()
+	allowlist.mode = mode
+	allowlist.path = path
+	allowlist.list = list
+	allowlist.learnUntil = time.Time{}
+	if mode == ModeLearn && learnDuration > 0 {
+		allowlist.learnUntil = time.Now().Add(learnDuration)
+	}
+	allowlist.mu.Unlock()
+
+	logger.Infof("Firewall allow list in %s mode with %d digests from %s", mode, list.size(), path)
+
+	if mode == ModeLearn {
+		go flushAllowlist(ctx)
+	}
+	return nil
+}
+
+// ReloadAllowlist re-reads the allow list file outside of learn mode.
+func ReloadAllowlist() error {
+	allowlist.mu.RLock()
+	mode, path := allowlist.mode, allowlist.path
+	allowlist.mu.RUnlock()
+
+	if mode == ModeOff || mode == ModeLearn {
+		return nil
+	}
+
+	list, err := readAllowlist(path)
+	if err != nil {
+		return err
+	}
+
+	allowlist.mu.Lock()
+	allowlist.list = list
+	allowlist.mu.Unlock()
+	return nil
+}
+
+// CurrentMode returns the mode the allow list is applied in.
+func CurrentMode() Mode {
+	allowlist.mu.RLock()
+	defer allowlist.mu.RUnlock()
+	return allowlist.mode
+}
+
+// SaveAllowlist writes learned digests to the allow list file.
+func SaveAllowlist() error {
+	allowlist.mu.Lock()
+	defer allowlist.mu.Unlock()
+
+	if allowlist.mode != ModeLearn || !allowlist.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(allowlist.list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial allow list.
+	tmp, err := os.CreateTemp(filepath.Dir(allowlist.path), ".allowlist-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), allowlist.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	allowlist.dirty = false
+	return nil
+}
+
+// flushAllowlist periodically saves learned digests until ctx is done.
+func flushAllowlist(ctx context.Context) {
+	ticker := time.NewTicker(allowlistFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := SaveAllowlist(); err != nil {
+				logger.Errorf("Failed to save firewall allow list: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := SaveAllowlist(); err != nil {
+				logger.Errorf("Failed to save firewall allow list: %v", err)
+			}
+		}
+	}
+}
+
+// checkAllowlist applies the allow list to a statement no rule decided on.
+func checkAllowlist(r *rules.Request) Decision {
+	allowlist.mu.RLock()
+	mode := allowlist.mode
+	known := allowlist.list.contains(r.User, r.Digest)
+	learning := mode == ModeLearn && (allowlist.learnUntil.IsZero() || time.Now().Before(allowlist.learnUntil))
+	allowlist.mu.RUnlock()
+
+	if known || mode == ModeOff {
+		return Decision{Action: ActionAllow}
+	}
+
+	switch mode {
+	case ModeLearn:
+		if learning {
+			learnDigest(r)
+		}
+	case ModeProtectLogOnly:
+		metrics.IncrementFirewallUnknownDigests(r.User, string(mode))
+		logger.Warnf("Firewall allow list does not contain digest %s for user %s: %s", r.Digest, r.User, r.Query)
+	case ModeEnforce:
+		metrics.IncrementFirewallUnknownDigests(r.User, string(mode))
+		logger.Warnf("Firewall allow list rejected digest %s for user %s: %s", r.Digest, r.User, r.Query)
+		return Decision{
+			Action:       ActionDeny,
+			ErrorCode:    defaultErrorCode,
+			SQLState:     defaultSQLState,
+			ErrorMessage: fmt.Sprintf("Statement digest %s is not on the proxy allow list", r.Digest),
+		}
+	}
+
+	return Decision{Action: ActionAllow}
+}
+
+// learnDigest adds the digest of a statement to the allow list.
+func learnDigest(r *rules.Request) {
+	fingerprint := sqlparse.Normalize(r.Query)
+
+	allowlist.mu.Lock()
+	defer allowlist.mu.Unlock()
+
+	if allowlist.list.Users == nil {
+		allowlist.list.Users = make(map[string]map[string]string)
+	}
+	digests := allowlist.list.Users[r.User]
+	if digests == nil {
+		digests = make(map[string]string)
+		allowlist.list.Users[r.User] = digests
+	}
+	if _, ok := digests[r.Digest]; ok {
+		return
+	}
+
+	digests[r.Digest] = fingerprint
+	allowlist.dirty = true
+	metrics.IncrementFirewallLearnedDigests()
+	logger.Debugf("Firewall learned digest %s for user %s: %s", r.Digest, r.User, fingerprint)
+}
+
+// readAllowlist reads an allow list file.
+func readAllowlist(path string) (Allowlist, error) {
+	list := Allowlist{}
+
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return list, fmt.Errorf("failed to read firewall allow list: %w", err)
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return list, fmt.Errorf("failed to parse firewall allow list: %w", err)
+	}
+	return list, nil
+}
+
+// contains returns true if user may run statements with digest.
+func (a Allowlist) contains(user, digest string) bool {
+	_, ok := a.Users[user][digest]
+	return ok
+}
+
+// size returns the number of digests in the allow list.
+func (a Allowlist) size() int {
+	n := 0
+	for _, digests := range a.Users {
+		n += len(digests)
+	}
+	return n
+}
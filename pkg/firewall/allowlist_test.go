@@ -0,0 +1,74 @@
+package firewall
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+func writeAllowlist(t *testing.T, path string, queries ...string) {
+	t.Helper()
+	list := Allowlist{Users: map[string]map[string]string{"app": {}}}
+	for _, query := range queries {
+		list.Users["app"][sqlparse.Digest(query)] = sqlparse.Normalize(query)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllowlistEnforce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	writeAllowlist(t, path, "SELECT name FROM users WHERE id = 1")
+	if err := ConfigureAllowlist(context.Background(), ModeEnforce, path, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		allowlist.mu.Lock()
+		allowlist.mode = ModeOff
+		allowlist.mu.Unlock()
+	})
+
+	evaluate := func(query string) Action {
+		return Evaluate(&rules.Request{
+			User:          "app",
+			Query:         query,
+			Digest:        sqlparse.Digest(query),
+			StatementType: sqlparse.StatementType(query),
+		}).Action
+	}
+
+	tests := []struct {
+		query string
+		want  Action
+	}{
+		{"SELECT name FROM users WHERE id = 42", ActionAllow},
+		{"SELECT name FROM users WHERE id = 42 /* comment */", ActionAllow},
+		{"SELECT name FROM users WHERE id = 42 /*!50000 UNION SELECT password FROM users */", ActionDeny},
+		{"SELECT name FROM users WHERE id = 42 /*M!100100 UNION SELECT password FROM users */", ActionDeny},
+		{"SELECT name FROM users WHERE id = 42; DELETE FROM users", ActionDeny},
+		{"DELETE FROM users", ActionDeny},
+	}
+	for _, tt := range tests {
+		if got := evaluate(tt.query); got != tt.want {
+			t.Errorf("Evaluate(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	writeAllowlist(t, path, "SELECT name FROM users WHERE id = 1", "DELETE FROM users")
+	if err := ReloadAllowlist(); err != nil {
+		t.Fatal(err)
+	}
+	if got := evaluate("DELETE FROM users"); got != ActionAllow {
+		t.Errorf("Evaluate after reload = %q, want %q", got, ActionAllow)
+	}
+}
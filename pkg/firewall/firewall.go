@@ -0,0 +1,205 @@
+package firewall
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+var logger = logging.SetupLogging()
+
+// Action is what the firewall does with a statement matched by a rule.
+type Action string
+
+const (
+	// ActionAllow forwards the statement and stops rule evaluation.
+	ActionAllow Action = "allow"
+	// ActionDeny rejects the statement with a MySQL error and stops rule evaluation.
+	ActionDeny Action = "deny"
+	// ActionLog logs the statement and continues with the next rule.
+	ActionLog Action = "log"
+)
+
+// Default error returned to clients for denied statements.
+const (
+	defaultErrorCode    uint16 = 1148
+	defaultSQLState            = "42000"
+	defaultErrorMessage        = "Statement blocked by proxy firewall rule %q"
+)
+
+// Rule is a single firewall rule. Rules are evaluated in ascending priority order.
+type Rule struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	rules.Match
+	Action       Action `json:"action"`
+	ErrorCode    uint16 `json:"errorCode,omitempty"`
+	SQLState     string `json:"sqlState,omitempty"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// RuleSet is the content of the firewall rules file.
+type RuleSet struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// Decision is the outcome of evaluating a statement against the rules.
+type Decision struct {
+	Action       Action
+	Rule         *Rule
+	ErrorCode    uint16
+	SQLState     string
+	ErrorMessage string
+}
+
+// ruleSet holds the active rules, swapped atomically on reload.
+var ruleSet atomic.Pointer[RuleSet]
+
+// LoadRules loads and activates the firewall rules from a JSON file.
+func LoadRules(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to read firewall rules: %w", err)
+	}
+
+	set := &RuleSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("failed to parse firewall rules: %w", err)
+	}
+
+	for i, rule := range set.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		switch rule.Action {
+		case ActionAllow, ActionDeny, ActionLog:
+		default:
+			return fmt.Errorf("firewall rule %q: unknown action %q", rule.Name, rule.Action)
+		}
+		if err := rule.Compile(); err != nil {
+			return fmt.Errorf("firewall rule %q: %w", rule.Name, err)
+		}
+	}
+	sort.SliceStable(set.Rules, func(i, j int) bool {
+		return set.Rules[i].Priority < set.Rules[j].Priority
+	})
+
+	ruleSet.Store(set)
+	logger.Infof("Loaded %d firewall rules from %s", len(set.Rules), path)
+	return nil
+}
+
+// Rules returns the active firewall rules in evaluation order.
+func Rules() []*Rule {
+	if set := ruleSet.Load(); set != nil {
+		return set.Rules
+	}
+	return nil
+}
+
+// Enabled returns true if firewall rules have been loaded or the allow list is active.
+func Enabled() bool {
+	return ruleSet.Load() != nil || CurrentMode() != ModeOff
+}
+
+// Evaluate returns the firewall decision for a statement. Statements that match
+// no allow or deny rule are checked against the allow list, if one is active,
+// and allowed otherwise. Each statement of a multi-statement query is
+// evaluated on its own, and the query is denied if one of them is, as are
+// PREPARE statements whose statement text is denied.
+func Evaluate(r *rules.Request) Decision {
+	statements := sqlparse.SplitStatements(r.Query)
+	if len(statements) < 2 {
+		return evaluatePrepared(r, evaluate(r))
+	}
+
+	var decision Decision
+	for _, query := range statements {
+		statement := *r
+		statement.Query = query
+		statement.Digest = sqlparse.Digest(query)
+		statement.StatementType = sqlparse.StatementType(query)
+		if decision = evaluatePrepared(&statement, evaluate(&statement)); decision.Action == ActionDeny {
+			return decision
+		}
+	}
+	return decision
+}
+
+// evaluatePrepared also evaluates the statement a PREPARE ... FROM 'text'
+// statement prepares, so deny rules cannot be bypassed by running it with
+// EXECUTE. It returns the decision of the statement itself unless the
+// prepared statement is denied.
+func evaluatePrepared(r *rules.Request, decision Decision) Decision {
+	if decision.Action == ActionDeny {
+		return decision
+	}
+	text, ok := sqlparse.PreparedText(r.Query)
+	if !ok {
+		return decision
+	}
+
+	prepared := *r
+	prepared.Query = text
+	prepared.Digest = sqlparse.Digest(text)
+	prepared.StatementType = sqlparse.StatementType(text)
+	if denied := Evaluate(&prepared); denied.Action == ActionDeny {
+		return denied
+	}
+	return decision
+}
+
+// evaluate returns the firewall decision for a single statement.
+func evaluate(r *rules.Request) Decision {
+	set := ruleSet.Load()
+	if set == nil {
+		return checkAllowlist(r)
+	}
+
+	for _, rule := range set.Rules {
+		if !rule.Matches(r) {
+			continue
+		}
+		metrics.IncrementFirewallRuleHits(rule.Name, string(rule.Action))
+
+		switch rule.Action {
+		case ActionLog:
+			logger.Infof("Firewall rule %q matched statement from %s@%s: %s", rule.Name, r.User, r.ClientIP, r.Query)
+		case ActionAllow:
+			return Decision{Action: ActionAllow, Rule: rule}
+		case ActionDeny:
+			logger.Warnf("Firewall rule %q denied statement from %s@%s: %s", rule.Name, r.User, r.ClientIP, r.Query)
+			return denyDecision(rule)
+		}
+	}
+
+	return checkAllowlist(r)
+}
+
+// denyDecision builds the deny decision for rule, filling in default error details.
+func denyDecision(rule *Rule) Decision {
+	d := Decision{
+		Action:       ActionDeny,
+		Rule:         rule,
+		ErrorCode:    rule.ErrorCode,
+		SQLState:     rule.SQLState,
+		ErrorMessage: rule.ErrorMessage,
+	}
+	if d.ErrorCode == 0 {
+		d.ErrorCode = defaultErrorCode
+	}
+	if d.SQLState == "" {
+		d.SQLState = defaultSQLState
+	}
+	if d.ErrorMessage == "" {
+		d.ErrorMessage = fmt.Sprintf(defaultErrorMessage, rule.Name)
+	}
+	return d
+}
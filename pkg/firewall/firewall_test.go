@@ -0,0 +1,52 @@
+package firewall
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+func TestEvaluateDeniesHiddenStatements(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firewall.json")
+	data := `{"rules": [{"name": "no-drop", "statementTypes": ["DROP"], "action": "deny"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadRules(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ruleSet.Store(nil) })
+
+	tests := []struct {
+		query string
+		want  Action
+	}{
+		{"SELECT 1", ActionAllow},
+		{"DROP TABLE t", ActionDeny},
+		{"/*!50000 DROP TABLE t */", ActionDeny},
+		{"/*M!100100 DROP TABLE t */", ActionDeny},
+		{"/* DROP TABLE t */ SELECT 1", ActionAllow},
+		{"SELECT 1; DROP TABLE t", ActionDeny},
+		{"SELECT 1;/*!DROP TABLE t*/", ActionDeny},
+		{"SELECT ';DROP TABLE t'; SELECT 2", ActionAllow},
+		{"PREPARE s FROM 'DROP TABLE t'", ActionDeny},
+		{"PREPARE s FROM 'DROP ' 'TABLE t'", ActionDeny},
+		{"prepare s from _utf8mb4'/*!DROP TABLE t*/'", ActionDeny},
+		{"SELECT 1; PREPARE s FROM \"DROP TABLE t\"; EXECUTE s", ActionDeny},
+		{"PREPARE s FROM 'SELECT ?'", ActionAllow},
+	}
+	for _, tt := range tests {
+		r := &rules.Request{
+			User:          "app",
+			Query:         tt.query,
+			Digest:        sqlparse.Digest(tt.query),
+			StatementType: sqlparse.StatementType(tt.query),
+		}
+		if got := Evaluate(r); got.Action != tt.want {
+			t.Errorf("Evaluate(%q) = %q, want %q", tt.query, got.Action, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package gtid
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// interval is a range of transaction numbers, inclusive.
+type interval struct {
+	start, end uint64
+}
+
+// Set is a MySQL GTID set, such as the value of gtid_executed. It maps each
+// source, a server UUID optionally followed by a tag, to the sorted and
+// merged intervals of its transaction numbers.
+type Set map[string][]interval
+
+// Parse parses a GTID set in the format of gtid_executed, such as
+// "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:11,...", including tagged GTIDs
+// of MySQL 8.3 such as "3e11fa47-...:tag:1-5".
+func Parse(s string) (Set, error) {
+	set := make(Set)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid GTID set %q", part)
+		}
+
+		source := strings.ToLower(fields[0])
+		for _, field := range fields[1:] {
+			start, end, found := strings.Cut(field, "-")
+			first, err := strconv.ParseUint(start, 10, 64)
+			if err != nil {
+				// A tag applies to the intervals following it.
+				source = strings.ToLower(fields[0]) + ":" + strings.ToLower(field)
+				continue
+			}
+			last := first
+			if found {
+				if last, err = strconv.ParseUint(end, 10, 64); err != nil || last < first {
+					return nil, fmt.Errorf("invalid GTID interval %q", field)
+				}
+			}
+			set.add(source, interval{first, last})
+		}
+	}
+	return set, nil
+}
+
+// Add adds the GTIDs of other to s.
+func (s Set) Add(other Set) {
+	for source, intervals := range other {
+		for _, i := range intervals {
+			s.add(source, i)
+		}
+	}
+}
+
+// add adds an interval of a source, merging it with adjacent and overlapping
+// ones.
+func (s Set) add(source string, i interval) {
+	intervals := append(s[source], i)
+	sort.Slice(intervals, func(a, b int) bool {
+		return intervals[a].start < intervals[b].start
+	})
+	merged := intervals[:1]
+	for _, next := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if next.start <= last.end+1 {
+			last.end = max(last.end, next.end)
+			continue
+		}
+		merged = append(merged, next)
+	}
+	s[source] = merged
+}
+
+// Contains returns true if s contains all GTIDs of other.
+func (s Set) Contains(other Set) bool {
+	for source, intervals := range other {
+		for _, i := range intervals {
+			if !s.containsInterval(source, i) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// containsInterval returns true if one of the merged intervals of source
+// covers i.
+func (s Set) containsInterval(source string, i interval) bool {
+	for _, have := range s[source] {
+		if have.start <= i.start && i.end <= have.end {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the set in the format of gtid_executed, with its sources in
+// order.
+func (s Set) String() string {
+	sources := make([]string, 0, len(s))
+	for source := range s {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	parts := make([]string, 0, len(sources))
+	for _, source := range sources {
+		var b strings.Builder
+		b.WriteString(source)
+		for _, i := range s[source] {
+			b.WriteString(":")
+			b.WriteString(strconv.FormatUint(i.start, 10))
+			if i.end != i.start {
+				b.WriteString("-")
+				b.WriteString(strconv.FormatUint(i.end, 10))
+			}
+		}
+		parts = append(parts, b.String())
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,99 @@
+package gtid
+
+import "testing"
+
+const (
+	uuidA = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	uuidB = "4f22ab58-82db-22f2-af44-d91bb0530673"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{uuidA + ":1-5", uuidA + ":1-5"},
+		{uuidA + ":7", uuidA + ":7"},
+		{uuidA + ":1-5:11:13-20", uuidA + ":1-5:11:13-20"},
+		{uuidA + ":11:1-5", uuidA + ":1-5:11"},
+		{uuidA + ":1-5:6-9:10", uuidA + ":1-10"},
+		{uuidA + ":1-10:3-4", uuidA + ":1-10"},
+		{uuidA + ":1-3,\n" + uuidA + ":4-6", uuidA + ":1-6"},
+		{uuidB + ":2," + uuidA + ":1", uuidA + ":1," + uuidB + ":2"},
+		{" 3E11FA47-71CA-11E1-9E33-C80AA9429562:1 ", uuidA + ":1"},
+		{uuidA + ":1-5:Blue:1-3:red:7", uuidA + ":1-5," + uuidA + ":blue:1-3," + uuidA + ":red:7"},
+	}
+	for _, tt := range tests {
+		set, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got := set.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		uuidA,
+		uuidA + ":5-3",
+		uuidA + ":1-x",
+		uuidA + ":1-5," + uuidB,
+	} {
+		if set, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %q, want an error", in, set)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		set, other string
+		want       bool
+	}{
+		{"", "", true},
+		{uuidA + ":1-10", "", true},
+		{"", uuidA + ":1", false},
+		{uuidA + ":1-10", uuidA + ":1-10", true},
+		{uuidA + ":1-10", uuidA + ":3-4:10", true},
+		{uuidA + ":1-10", uuidA + ":10-11", false},
+		{uuidA + ":1-4:6-10", uuidA + ":4-6", false},
+		{uuidA + ":1-4:5-10", uuidA + ":4-6", true},
+		{uuidA + ":1-10", uuidB + ":1", false},
+		{uuidA + ":1-10," + uuidB + ":1-3", uuidA + ":5," + uuidB + ":3", true},
+		{uuidA + ":1-10," + uuidB + ":1-3", uuidA + ":5," + uuidB + ":4", false},
+		{uuidA + ":1-10", uuidA + ":tag:1", false},
+		{uuidA + ":tag:1-10", uuidA + ":TAG:2", true},
+	}
+	for _, tt := range tests {
+		set, err := Parse(tt.set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := Parse(tt.other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := set.Contains(other); got != tt.want {
+			t.Errorf("%q.Contains(%q) = %v, want %v", tt.set, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	set, err := Parse(uuidA + ":1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Parse(uuidA + ":6-8:20," + uuidB + ":1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Add(other)
+	if got, want := set.String(), uuidA+":1-8:20,"+uuidB+":1"; got != want {
+		t.Errorf("Add = %q, want %q", got, want)
+	}
+}
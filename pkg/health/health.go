@@ -10,6 +10,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/supporttools/go-sql-proxy/pkg/config"
 	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/maintenance"
 )
 
 // VersionInfo represents the structure of version information.
@@ -65,6 +66,13 @@ func ReadyzHandler(username, password, host string, port int, database string) h
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger.Info("ReadyzHandler")
 
+		// Report not ready in maintenance mode so load balancers stop routing new sessions.
+		if maintenance.Enabled() {
+			logger.Info("ReadyzHandler: Maintenance mode is enabled")
+			http.Error(w, "Maintenance", http.StatusServiceUnavailable)
+			return
+		}
+
 		// Construct the DSN (Data Source Name) string
 		dsn := buildDSN(username, password, host, port, database)
 
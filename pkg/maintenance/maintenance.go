@@ -0,0 +1,71 @@
+package maintenance
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+)
+
+var logger = logging.SetupLogging()
+
+// Mode is the maintenance mode of the proxy. While it is enabled, new client
+// connections are answered with a MySQL error instead of being proxied.
+type Mode struct {
+	Enabled   bool      `json:"enabled"`
+	ErrorCode uint16    `json:"errorCode"`
+	SQLState  string    `json:"sqlState"`
+	Message   string    `json:"message"`
+	Drain     bool      `json:"drain"`
+	Since     time.Time `json:"since"`
+}
+
+// mode holds the current mode, swapped atomically.
+var mode atomic.Pointer[Mode]
+
+func init() {
+	mode.Store(&Mode{})
+}
+
+// Set changes the maintenance mode. An error left empty in m is taken from
+// the configuration. Drain only applies while the mode is enabled.
+func Set(m Mode) {
+	if !m.Enabled {
+		m = Mode{}
+	} else {
+		if m.ErrorCode == 0 {
+			m.ErrorCode = uint16(config.CFG.MaintenanceErrorCode) // #nosec G115 - validated at startup
+		}
+		if m.SQLState == "" {
+			m.SQLState = config.CFG.MaintenanceSQLState
+		}
+		if m.Message == "" {
+			m.Message = config.CFG.MaintenanceMessage
+		}
+	}
+	m.Since = time.Now()
+	mode.Store(&m)
+
+	if m.Enabled {
+		logger.Infof("Maintenance mode enabled (drain: %t): %s", m.Drain, m.Message)
+	} else {
+		logger.Info("Maintenance mode disabled")
+	}
+}
+
+// Current returns the current maintenance mode.
+func Current() Mode {
+	return *mode.Load()
+}
+
+// Enabled returns true if new connections are rejected.
+func Enabled() bool {
+	return mode.Load().Enabled
+}
+
+// Draining returns true if existing sessions are closed as well.
+func Draining() bool {
+	m := mode.Load()
+	return m.Enabled && m.Drain
+}
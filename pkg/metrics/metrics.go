@@ -47,6 +47,225 @@ var (
 		Name: "proxy_last_request_latency_seconds",
 		Help: "The latency of the last proxy request in seconds.",
 	})
+	// firewallRuleHits is a counter for the number of statements matched by each firewall rule.
+	firewallRuleHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_firewall_rule_hits_total",
+		Help: "Total number of statements matched by each firewall rule.",
+	}, []string{"rule", "action"})
+	// firewallUnknownDigests is a counter for statements whose digest is missing from the firewall allow list.
+	firewallUnknownDigests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_firewall_unknown_digests_total",
+		Help: "Total number of statements whose digest is missing from the firewall allow list.",
+	}, []string{"user", "mode"})
+	// firewallLearnedDigests is a counter for digests recorded into the firewall allow list.
+	firewallLearnedDigests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proxy_firewall_learned_digests_total",
+		Help: "Total number of digests recorded into the firewall allow list in learn mode.",
+	})
+	// rewriteRuleHits is a counter for the number of statements rewritten by each rewrite rule.
+	rewriteRuleHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_rewrite_rule_hits_total",
+		Help: "Total number of statements rewritten by each rewrite rule.",
+	}, []string{"rule", "dry_run"})
+
+	// cacheHits is a counter for the number of statements answered from the result cache.
+	cacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_cache_hits_total",
+		Help: "Total number of statements answered from the result cache.",
+	}, []string{"rule"})
+
+	// cacheMisses is a counter for the number of cacheable statements forwarded to the backend.
+	cacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_cache_misses_total",
+		Help: "Total number of cacheable statements not found in the result cache.",
+	}, []string{"rule"})
+
+	// cacheEvictions is a counter for the number of result sets evicted to respect the memory cap.
+	cacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proxy_cache_evictions_total",
+		Help: "Total number of cached result sets evicted to respect the memory cap.",
+	})
+
+	// cacheInvalidations is a counter for the number of result sets invalidated by writes.
+	cacheInvalidations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proxy_cache_invalidations_total",
+		Help: "Total number of cached result sets invalidated by writes.",
+	})
+
+	// cacheEntries is a gauge for the number of cached result sets.
+	cacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "proxy_cache_entries",
+		Help: "Number of cached result sets.",
+	})
+
+	// cacheBytes is a gauge for the memory used by cached result sets.
+	cacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "proxy_cache_bytes",
+		Help: "Approximate memory used by cached result sets in bytes.",
+	})
+
+	// queryTimeouts is a counter for the number of statements killed for exceeding their timeout.
+	queryTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_query_timeouts_total",
+		Help: "Total number of statements killed on the backend for exceeding their proxy timeout.",
+	}, []string{"rule"})
+
+	// backendKills is a counter for the KILL statements the proxy issued on the backend.
+	backendKills = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_backend_kills_total",
+		Help: "Total number of KILL statements issued on the backend by the proxy.",
+	}, []string{"reason", "result"})
+
+	// clientDisconnectKills is a counter for the statements killed because their client disconnected.
+	clientDisconnectKills = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_client_disconnect_kills_total",
+		Help: "Total number of statements killed on the backend because their client disconnected.",
+	}, []string{"policy"})
+
+	// shadowStatements is a counter for the statements mirrored to the shadow backend by outcome.
+	shadowStatements = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_shadow_statements_total",
+		Help: "Total number of statements mirrored to the shadow backend by outcome.",
+	}, []string{"outcome"})
+
+	// shadowDigestDifferences is a counter for the mirrored statements whose outcome differed, per digest.
+	shadowDigestDifferences = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_shadow_digest_differences_total",
+		Help: "Total number of mirrored statements that failed or did not match on the shadow backend, per digest.",
+	}, []string{"digest", "outcome"})
+
+	// shadowLatency is a histogram of the latency of mirrored statements on the primary and shadow backend.
+	shadowLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "proxy_shadow_latency_seconds",
+		Help:    "Latency of mirrored statements on the primary and shadow backend.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"backend"})
+
+	// captureRecords is a counter for the records written to the capture file.
+	captureRecords = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proxy_capture_records_total",
+		Help: "Total number of records written to the capture file.",
+	})
+
+	// captureDropped is a counter for the records dropped because the capture writer fell behind.
+	captureDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proxy_capture_dropped_total",
+		Help: "Total number of capture records dropped because the writer fell behind.",
+	})
+
+	// rejectedConnections is a counter for client connections rejected before they reached a backend.
+	rejectedConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_rejected_connections_total",
+		Help: "Total number of client connections rejected before they reached a backend, by reason.",
+	}, []string{"reason"})
+
+	// heldCommands is a counter for commands held while traffic was paused, by outcome.
+	heldCommands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_held_commands_total",
+		Help: "Total number of commands held while traffic was paused, by outcome (resumed, timeout, rejected).",
+	}, []string{"outcome"})
+
+	// heldCommandsWaiting is a gauge for the commands currently held.
+	heldCommandsWaiting = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "proxy_held_commands",
+		Help: "Number of commands currently held while traffic is paused.",
+	})
+
+	// backendConnectAttempts is a counter for connection attempts to backends, by backend and outcome.
+	backendConnectAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_backend_connect_attempts_total",
+		Help: "Total number of connection attempts to backends, by backend and outcome (success, failure, rejected by the circuit breaker).",
+	}, []string{"backend", "outcome"})
+
+	// backendCircuitState is a gauge for the circuit breaker state of each backend.
+	backendCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "proxy_backend_circuit_breaker_state",
+		Help: "State of the circuit breaker of each backend (0 closed, 1 half-open, 2 open).",
+	}, []string{"backend"})
+
+	// dnsResolutions is a counter for resolutions of the backends from DNS, by outcome.
+	dnsResolutions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_dns_resolutions_total",
+		Help: "Total number of resolutions of the backends from DNS, by outcome (success, failure).",
+	}, []string{"outcome"})
+
+	// discoveredBackends is a gauge for the backends currently resolved from DNS.
+	discoveredBackends = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "proxy_discovered_backends",
+		Help: "Number of backends currently resolved from DNS.",
+	})
+
+	// backendReconnects is a counter for sessions whose backend connection was lost, by outcome.
+	backendReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_backend_reconnects_total",
+		Help: "Total number of idle sessions whose backend connection was lost, by outcome (transparent, forced).",
+	}, []string{"outcome"})
+
+	// replicationLag is a gauge for the replication lag of each replica.
+	replicationLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "proxy_backend_replication_lag_seconds",
+		Help: "Replication lag last measured on each replica, absent while it is not known.",
+	}, []string{"backend"})
+
+	// routedReads is a counter for read statements routed by read/write splitting, by target.
+	routedReads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_routed_reads_total",
+		Help: "Total number of read statements routed by read/write splitting, by target (replica, primary).",
+	}, []string{"target"})
+
+	// readYourWrites is a counter for reads of sessions with writes replicas must have executed, by outcome.
+	readYourWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_read_your_writes_total",
+		Help: "Total number of reads of sessions whose writes replicas must have executed, by outcome (caught_up, waited, primary).",
+	}, []string{"outcome"})
+
+	// queryHints is a counter for proxy hints in SQL comments, by hint and outcome.
+	queryHints = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_query_hints_total",
+		Help: "Total number of proxy hints in SQL comments, by hint and outcome (applied, ignored, invalid, unknown).",
+	}, []string{"hint", "outcome"})
+
+	// routedConnections is a counter for connections matched by routing rules, by backend group and outcome.
+	routedConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_routed_connections_total",
+		Help: "Total number of connections matched by routing rules, by backend group and outcome (routed, kept, unavailable).",
+	}, []string{"group", "outcome"})
+
+	// clientTLSSessions is a counter for clients that requested TLS, by outcome.
+	clientTLSSessions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_client_tls_sessions_total",
+		Help: "Total number of client connections that requested TLS, by outcome (terminated, relayed, failed).",
+	}, []string{"outcome"})
+
+	// shardStatements is a counter for statements on sharded tables, by shard and outcome.
+	shardStatements = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_shard_statements_total",
+		Help: "Total number of statements on sharded tables, by shard and outcome (routed, broadcast, rejected).",
+	}, []string{"shard", "outcome"})
+
+	// canarySessions is a counter for sessions compared by the canary, by cohort.
+	canarySessions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_canary_sessions_total",
+		Help: "Total number of new sessions compared by the canary, by cohort (canary, baseline).",
+	}, []string{"cohort"})
+
+	// canaryWeight is a gauge for the percentage of new sessions sent to the canary.
+	canaryWeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "proxy_canary_weight_percent",
+		Help: "Percentage of new sessions sent to the canary group.",
+	})
+
+	// canaryRollbacks is a counter for automatic rollbacks of the canary.
+	canaryRollbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proxy_canary_rollbacks_total",
+		Help: "Total number of times the canary was rolled back automatically.",
+	})
+
+	// injectedFaults is a counter for faults injected by fault rules, by rule and fault.
+	injectedFaults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_injected_faults_total",
+		Help: "Total number of faults injected into statements, by rule and fault (latency, error, drop, throttle).",
+	}, []string{"rule", "fault"})
 )
 
 // counterWriter is an io.Writer that increments a prometheus counter with the number of bytes written.
@@ -60,9 +279,16 @@ func init() {
 	prometheus.MustRegister(DataToClient)
 }
 
+// mux serves the metrics and health endpoints and the handlers registered with Handle.
+var mux = http.NewServeMux()
+
+// Handle registers an additional handler on the metrics server.
+func Handle(pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+}
+
 // StartMetricsServer starts the metrics server on the configured port.
 func StartMetricsServer() {
-	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.Handle("/version", health.VersionHandler())
 	mux.HandleFunc("/healthz", health.HealthzHandler(config.CFG.SourceDatabaseUser, config.CFG.SourceDatabasePassword, "localhost", config.CFG.BindPort, config.CFG.SourceDatabaseName))
@@ -111,6 +337,193 @@ func IncrementDataToClient() {
 	DataToClient.Inc()
 }
 
+// IncrementFirewallRuleHits increments the hit counter of a firewall rule.
+func IncrementFirewallRuleHits(rule, action string) {
+	firewallRuleHits.WithLabelValues(rule, action).Inc()
+}
+
+// IncrementFirewallUnknownDigests increments the counter of statements missing from the allow list.
+func IncrementFirewallUnknownDigests(user, mode string) {
+	firewallUnknownDigests.WithLabelValues(user, mode).Inc()
+}
+
+// IncrementFirewallLearnedDigests increments the counter of learned allow list digests.
+func IncrementFirewallLearnedDigests() {
+	firewallLearnedDigests.Inc()
+}
+
+// IncrementRewriteRuleHits increments the hit counter of a rewrite rule.
+func IncrementRewriteRuleHits(rule string, dryRun bool) {
+	rewriteRuleHits.WithLabelValues(rule, strconv.FormatBool(dryRun)).Inc()
+}
+
+// IncrementCacheHits increments the result cache hit counter of a cache rule.
+func IncrementCacheHits(rule string) {
+	cacheHits.WithLabelValues(rule).Inc()
+}
+
+// IncrementCacheMisses increments the result cache miss counter of a cache rule.
+func IncrementCacheMisses(rule string) {
+	cacheMisses.WithLabelValues(rule).Inc()
+}
+
+// IncrementCacheEvictions increments the result cache eviction counter.
+func IncrementCacheEvictions() {
+	cacheEvictions.Inc()
+}
+
+// AddCacheInvalidations adds n to the result cache invalidation counter.
+func AddCacheInvalidations(n int) {
+	cacheInvalidations.Add(float64(n))
+}
+
+// SetCacheSize sets the result cache entry and memory gauges.
+func SetCacheSize(entries, bytes int) {
+	cacheEntries.Set(float64(entries))
+	cacheBytes.Set(float64(bytes))
+}
+
+// IncrementQueryTimeouts increments the statement timeout counter of a timeout rule.
+func IncrementQueryTimeouts(rule string) {
+	queryTimeouts.WithLabelValues(rule).Inc()
+}
+
+// IncrementBackendKills increments the counter of KILL statements issued on the backend.
+func IncrementBackendKills(reason, result string) {
+	backendKills.WithLabelValues(reason, result).Inc()
+}
+
+// IncrementClientDisconnectKills increments the counter of statements killed after their client disconnected.
+func IncrementClientDisconnectKills(policy string) {
+	clientDisconnectKills.WithLabelValues(policy).Inc()
+}
+
+// IncrementShadowStatements increments the counter of mirrored statements with the given outcome.
+func IncrementShadowStatements(outcome string) {
+	shadowStatements.WithLabelValues(outcome).Inc()
+}
+
+// IncrementShadowDigestDifferences increments the counter of differing mirrored statements of a digest.
+func IncrementShadowDigestDifferences(digest, outcome string) {
+	shadowDigestDifferences.WithLabelValues(digest, outcome).Inc()
+}
+
+// ObserveShadowLatency records the latency of a mirrored statement on both backends.
+func ObserveShadowLatency(primary, shadow time.Duration) {
+	shadowLatency.WithLabelValues("primary").Observe(primary.Seconds())
+	shadowLatency.WithLabelValues("shadow").Observe(shadow.Seconds())
+}
+
+// IncrementCaptureRecords increments the counter of records written to the capture file.
+func IncrementCaptureRecords() {
+	captureRecords.Inc()
+}
+
+// IncrementCaptureDropped increments the counter of dropped capture records.
+func IncrementCaptureDropped() {
+	captureDropped.Inc()
+}
+
+// IncrementRejectedConnections increments the counter of rejected client connections.
+func IncrementRejectedConnections(reason string) {
+	rejectedConnections.WithLabelValues(reason).Inc()
+}
+
+// IncrementHeldCommands increments the counter of held commands with the given outcome.
+func IncrementHeldCommands(outcome string) {
+	heldCommands.WithLabelValues(outcome).Inc()
+}
+
+// SetHeldCommandsWaiting sets the number of commands currently held.
+func SetHeldCommandsWaiting(n int) {
+	heldCommandsWaiting.Set(float64(n))
+}
+
+// IncrementBackendConnectAttempts increments the counter of connection attempts to a backend.
+func IncrementBackendConnectAttempts(backend, outcome string) {
+	backendConnectAttempts.WithLabelValues(backend, outcome).Inc()
+}
+
+// SetBackendCircuitState sets the circuit breaker state gauge of a backend.
+func SetBackendCircuitState(backend string, state int) {
+	backendCircuitState.WithLabelValues(backend).Set(float64(state))
+}
+
+// IncrementDNSResolutions increments the counter of DNS resolutions with the given outcome.
+func IncrementDNSResolutions(outcome string) {
+	dnsResolutions.WithLabelValues(outcome).Inc()
+}
+
+// SetDiscoveredBackends sets the number of backends resolved from DNS.
+func SetDiscoveredBackends(n int) {
+	discoveredBackends.Set(float64(n))
+}
+
+// IncrementBackendReconnects increments the counter of lost backend connections with the given outcome.
+func IncrementBackendReconnects(outcome string) {
+	backendReconnects.WithLabelValues(outcome).Inc()
+}
+
+// SetReplicationLag sets the replication lag gauge of a replica, or removes it
+// if the lag is not known.
+func SetReplicationLag(backend string, seconds float64, known bool) {
+	if !known {
+		replicationLag.DeleteLabelValues(backend)
+		return
+	}
+	replicationLag.WithLabelValues(backend).Set(seconds)
+}
+
+// IncrementRoutedReads increments the counter of routed read statements with the given target.
+func IncrementRoutedReads(target string) {
+	routedReads.WithLabelValues(target).Inc()
+}
+
+// IncrementReadYourWrites increments the counter of read-your-writes checks with the given outcome.
+func IncrementReadYourWrites(outcome string) {
+	readYourWrites.WithLabelValues(outcome).Inc()
+}
+
+// IncrementQueryHints increments the counter of proxy hints with the given hint and outcome.
+func IncrementQueryHints(hint, outcome string) {
+	queryHints.WithLabelValues(hint, outcome).Inc()
+}
+
+// IncrementRoutedConnections increments the counter of connections matched by routing rules with the given group and outcome.
+func IncrementRoutedConnections(group, outcome string) {
+	routedConnections.WithLabelValues(group, outcome).Inc()
+}
+
+// IncrementClientTLSSessions increments the counter of client connections that requested TLS with the given outcome.
+func IncrementClientTLSSessions(outcome string) {
+	clientTLSSessions.WithLabelValues(outcome).Inc()
+}
+
+// IncrementShardStatements increments the counter of statements on sharded tables with the given shard and outcome.
+func IncrementShardStatements(shard, outcome string) {
+	shardStatements.WithLabelValues(shard, outcome).Inc()
+}
+
+// IncrementCanarySessions increments the counter of sessions compared by the canary with the given cohort.
+func IncrementCanarySessions(cohort string) {
+	canarySessions.WithLabelValues(cohort).Inc()
+}
+
+// SetCanaryWeight sets the gauge of the percentage of new sessions sent to the canary.
+func SetCanaryWeight(percent int) {
+	canaryWeight.Set(float64(percent))
+}
+
+// IncrementCanaryRollbacks increments the counter of automatic canary rollbacks.
+func IncrementCanaryRollbacks() {
+	canaryRollbacks.Inc()
+}
+
+// IncrementInjectedFaults increments the counter of injected faults with the given rule and fault.
+func IncrementInjectedFaults(rule, fault string) {
+	injectedFaults.WithLabelValues(rule, fault).Inc()
+}
+
 // SetLastRequestLatency sets the last request latency gauge.
 func (cw *counterWriter) Write(p []byte) (int, error) {
 	n := len(p)
@@ -1,6 +1,14 @@
 package models
 
-import "net"
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
 
 // Connection represents a proxy connection to a MySQL server.
 type Connection struct {
@@ -9,6 +17,45 @@ type Connection struct {
 	Conn           net.Conn
 	ID             uint64
 	EnableDecoding bool
+	ConnectedAt    time.Time
+
+	// Traffic counters, in bytes, of the client side of the connection.
+	BytesIn  atomic.Uint64
+	BytesOut atomic.Uint64
+
+	// Session details learned while decoding the protocol.
+	User            string
+	Schema          string
+	Attributes      map[string]string
+	Capabilities    protocol.CapabilityFlag
+	BackendThreadID atomic.Uint32
+	StatusFlags     uint16
+
+	// mu guards User, Schema, Attributes, the backend and the activity,
+	// which are read by other goroutines.
+	mu       sync.RWMutex
+	activity Activity
+	// backend is the address of the backend the session was moved to, and
+	// server the connection to the current backend once it is established.
+	backend string
+	server  net.Conn
+}
+
+// Connection states reported in its Activity.
+const (
+	StateHandshake   = "handshake"
+	StateIdle        = "idle"
+	StateActive      = "active"
+	StatePassthrough = "passthrough"
+)
+
+// Activity describes what a connection is doing.
+type Activity struct {
+	State string
+	// Statement is the statement or command being run in StateActive.
+	Statement string
+	// Since is when the connection entered the state.
+	Since time.Time
 }
 
 func (c *Connection) Read(p []byte) (int, error) {
@@ -18,3 +65,92 @@ func (c *Connection) Read(p []byte) (int, error) {
 func (c *Connection) Write(p []byte) (int, error) {
 	return c.Conn.Write(p)
 }
+
+// ClientIP returns the IP address of the client, or nil if it is not known.
+func (c *Connection) ClientIP() net.IP {
+	if addr, ok := c.Conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+// SetUser records the user the session is authenticated as.
+func (c *Connection) SetUser(user string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.User = user
+}
+
+// SetSchema records the default schema of the session.
+func (c *Connection) SetSchema(schema string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Schema = schema
+}
+
+// BackendAddress returns the host:port of the backend the connection is proxied to.
+func (c *Connection) BackendAddress() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.backend != "" {
+		return c.backend
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// SetBackend records the backend the connection is proxied to and the
+// connection to it.
+func (c *Connection) SetBackend(address string, server net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backend = address
+	c.server = server
+}
+
+// BackendConn returns the connection to the backend, or nil if it is not
+// established yet.
+func (c *Connection) BackendConn() net.Conn {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.server
+}
+
+// SetAttributes records the connection attributes the client sent.
+func (c *Connection) SetAttributes(attributes map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Attributes = attributes
+}
+
+// ConnectAttributes returns the connection attributes the client sent. Use it
+// to read them from outside the goroutine handling the connection.
+func (c *Connection) ConnectAttributes() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Attributes
+}
+
+// SetActivity records that the connection entered state, running statement.
+func (c *Connection) SetActivity(state, statement string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.activity = Activity{State: state, Statement: statement, Since: time.Now()}
+}
+
+// CurrentActivity returns what the connection is doing.
+func (c *Connection) CurrentActivity() Activity {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.activity.State == "" {
+		return Activity{State: StateHandshake, Since: c.ConnectedAt}
+	}
+	return c.activity
+}
+
+// Identity returns the user and default schema of the session. Use it to
+// read them from outside the goroutine handling the connection.
+func (c *Connection) Identity() (string, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.User, c.Schema
+}
@@ -0,0 +1,119 @@
+package pause
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+)
+
+var logger = logging.SetupLogging()
+
+var (
+	// ErrQueueFull is returned by Hold when the maximum number of commands
+	// is already held.
+	ErrQueueFull = errors.New("too many commands held while traffic is paused")
+	// ErrTimeout is returned by Hold when traffic is not resumed in time.
+	ErrTimeout = errors.New("traffic was not resumed in time")
+)
+
+// Status describes whether traffic is paused.
+type Status struct {
+	Paused  bool
+	Since   time.Time
+	Held    int
+	MaxHeld int
+	Timeout time.Duration
+}
+
+var (
+	mu sync.Mutex
+	// resumed is closed when traffic resumes, and nil while it flows.
+	resumed chan struct{}
+	since   time.Time
+	held    int
+	maxHeld int
+	timeout time.Duration
+)
+
+// Pause holds new commands until Resume, at most maxHeld at a time and each
+// for at most holdTimeout. It returns false if traffic is already paused.
+func Pause(maxHeldCommands int, holdTimeout time.Duration) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if resumed != nil {
+		return false
+	}
+	resumed = make(chan struct{})
+	since = time.Now()
+	maxHeld = maxHeldCommands
+	timeout = holdTimeout
+	logger.Infof("Traffic paused (holding up to %d commands for %s)", maxHeld, timeout)
+	return true
+}
+
+// Resume releases the held commands. It returns false if traffic is not paused.
+func Resume() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if resumed == nil {
+		return false
+	}
+	close(resumed)
+	resumed = nil
+	logger.Infof("Traffic resumed after %s", time.Since(since).Round(time.Millisecond))
+	return true
+}
+
+// Hold waits while traffic is paused. It returns ErrQueueFull or ErrTimeout
+// if the command may not wait or traffic was not resumed in time.
+func Hold() error {
+	mu.Lock()
+	if resumed == nil {
+		mu.Unlock()
+		return nil
+	}
+	if held >= maxHeld {
+		mu.Unlock()
+		metrics.IncrementHeldCommands("rejected")
+		return ErrQueueFull
+	}
+	held++
+	metrics.SetHeldCommandsWaiting(held)
+	ch, wait := resumed, timeout
+	mu.Unlock()
+
+	defer func() {
+		mu.Lock()
+		held--
+		metrics.SetHeldCommandsWaiting(held)
+		mu.Unlock()
+	}()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ch:
+		metrics.IncrementHeldCommands("resumed")
+		return nil
+	case <-timer.C:
+		metrics.IncrementHeldCommands("timeout")
+		return ErrTimeout
+	}
+}
+
+// Current returns whether traffic is paused.
+func Current() Status {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if resumed == nil {
+		return Status{Held: held}
+	}
+	return Status{Paused: true, Since: since, Held: held, MaxHeld: maxHeld, Timeout: timeout}
+}
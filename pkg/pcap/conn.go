@@ -0,0 +1,122 @@
+package pcap
+
+import (
+	"net"
+	"sync"
+)
+
+// Conn records the plaintext traffic of a connection as a synthesized TCP
+// stream while a capture is running. Wrapping a TLS connection records the
+// decrypted bytes.
+type Conn struct {
+	net.Conn
+	connectionID uint64
+	dialed       bool
+
+	mu sync.Mutex
+	// capture is the capture the stream was last opened in.
+	capture       *capture
+	local, remote endpoint
+	// localSeq and remoteSeq are the next sequence numbers of each side.
+	localSeq, remoteSeq uint32
+}
+
+// Tap wraps conn, which belongs to the proxy connection with the given ID.
+// dialed is true if the proxy opened conn, which makes the proxy the side
+// that starts the synthesized TCP handshake.
+func Tap(conn net.Conn, connectionID uint64, dialed bool) *Conn {
+	return &Conn{
+		Conn:         conn,
+		connectionID: connectionID,
+		dialed:       dialed,
+		local:        newEndpoint(conn.LocalAddr()),
+		remote:       newEndpoint(conn.RemoteAddr()),
+		localSeq:     1,
+		remoteSeq:    1,
+	}
+}
+
+// Read reads data from the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.record(false, p[:n])
+	}
+	return n, err
+}
+
+// Write writes data to the connection.
+func (c *Conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.record(true, p[:n])
+	}
+	return n, err
+}
+
+// Close ends the stream and closes the connection.
+func (c *Conn) Close() error {
+	c.End()
+	return c.Conn.Close()
+}
+
+// End records the end of the stream, for connections that are not closed
+// through the Conn.
+func (c *Conn) End() {
+	cp := active.Load()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cp == nil || c.capture != cp {
+		return
+	}
+	cp.writePacket(c.local, c.remote, c.localSeq, c.remoteSeq, tcpFIN|tcpACK, nil)
+	c.localSeq++
+	cp.writePacket(c.remote, c.local, c.remoteSeq, c.localSeq, tcpFIN|tcpACK, nil)
+	c.remoteSeq++
+	cp.writePacket(c.local, c.remote, c.localSeq, c.remoteSeq, tcpACK, nil)
+	c.capture = nil
+}
+
+// record writes data sent (outbound) or received on the connection to the
+// running capture.
+func (c *Conn) record(outbound bool, data []byte) {
+	cp := active.Load()
+	if cp == nil || !cp.includes(c.connectionID) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capture != cp {
+		// Streams that were already open when the capture started get a
+		// handshake too, so that Wireshark tracks them from here.
+		c.capture = cp
+		c.handshake(cp)
+	}
+
+	src, dst, seq, ack := c.local, c.remote, &c.localSeq, c.remoteSeq
+	if !outbound {
+		src, dst, seq, ack = c.remote, c.local, &c.remoteSeq, c.localSeq
+	}
+	for len(data) > 0 {
+		segment := data[:min(len(data), maxSegment)]
+		cp.writePacket(src, dst, *seq, ack, tcpPSH|tcpACK, segment)
+		*seq += uint32(len(segment)) // #nosec G115 - limited by maxSegment
+		data = data[len(segment):]
+	}
+}
+
+// handshake writes the TCP handshake that opens the stream in a capture.
+func (c *Conn) handshake(cp *capture) {
+	client, server := c.remote, c.local
+	clientSeq, serverSeq := c.remoteSeq, c.localSeq
+	if c.dialed {
+		client, server = c.local, c.remote
+		clientSeq, serverSeq = c.localSeq, c.remoteSeq
+	}
+	cp.writePacket(client, server, clientSeq-1, 0, tcpSYN, nil)
+	cp.writePacket(server, client, serverSeq-1, clientSeq, tcpSYN|tcpACK, nil)
+	cp.writePacket(client, server, clientSeq, serverSeq, tcpACK, nil)
+}
@@ -0,0 +1,125 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// TCP flags of synthesized segments.
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// maxSegment is the largest TCP payload of a synthesized segment, which keeps
+// frames within the 16-bit IP length fields.
+const maxSegment = 65000
+
+// endpoint is one side of a synthesized TCP stream.
+type endpoint struct {
+	ip   net.IP
+	port uint16
+}
+
+// newEndpoint returns the endpoint of addr, or a loopback placeholder for
+// addresses that are not TCP addresses.
+func newEndpoint(addr net.Addr) endpoint {
+	if tcp, ok := addr.(*net.TCPAddr); ok && tcp.IP != nil {
+		return endpoint{ip: tcp.IP, port: uint16(tcp.Port)} // #nosec G115 - TCP ports fit in 16 bits
+	}
+	return endpoint{ip: net.IPv4(127, 0, 0, 1)}
+}
+
+// sameFamily returns the IP addresses of a and b in the same family: IPv4 if
+// both are IPv4 addresses and IPv6 otherwise.
+func sameFamily(a, b net.IP) (net.IP, net.IP) {
+	if a4, b4 := a.To4(), b.To4(); a4 != nil && b4 != nil {
+		return a4, b4
+	}
+	return a.To16(), b.To16()
+}
+
+// macAddress returns a locally administered MAC address derived from ip, so
+// that every endpoint has a stable, distinct Ethernet address.
+func macAddress(ip net.IP) []byte {
+	mac := []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00}
+	copy(mac[2:], ip[len(ip)-4:])
+	return mac
+}
+
+// appendFrame appends an Ethernet frame carrying a TCP segment from src to dst.
+func appendFrame(buf []byte, src, dst endpoint, seq, ack uint32, flags byte, payload []byte) []byte {
+	srcIP, dstIP := sameFamily(src.ip, dst.ip)
+	tcpLength := 20 + len(payload)
+
+	buf = append(buf, macAddress(dstIP)...)
+	buf = append(buf, macAddress(srcIP)...)
+
+	var pseudo []byte
+	if len(srcIP) == net.IPv4len {
+		buf = binary.BigEndian.AppendUint16(buf, 0x0800)
+		header := make([]byte, 20)
+		header[0] = 0x45
+		binary.BigEndian.PutUint16(header[2:], uint16(20+tcpLength)) // #nosec G115 - limited by maxSegment
+		binary.BigEndian.PutUint16(header[6:], 0x4000)               // don't fragment
+		header[8] = 64
+		header[9] = 6
+		copy(header[12:], srcIP)
+		copy(header[16:], dstIP)
+		binary.BigEndian.PutUint16(header[10:], checksum(0, header))
+		buf = append(buf, header...)
+
+		pseudo = append(append(pseudo, srcIP...), dstIP...)
+		pseudo = append(pseudo, 0, 6)
+		pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(tcpLength)) // #nosec G115 - limited by maxSegment
+	} else {
+		buf = binary.BigEndian.AppendUint16(buf, 0x86DD)
+		header := make([]byte, 40)
+		header[0] = 0x60
+		binary.BigEndian.PutUint16(header[4:], uint16(tcpLength)) // #nosec G115 - limited by maxSegment
+		header[6] = 6
+		header[7] = 64
+		copy(header[8:], srcIP)
+		copy(header[24:], dstIP)
+		buf = append(buf, header...)
+
+		pseudo = append(append(pseudo, srcIP...), dstIP...)
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(tcpLength)) // #nosec G115 - limited by maxSegment
+		pseudo = append(pseudo, 0, 0, 0, 6)
+	}
+
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:], src.port)
+	binary.BigEndian.PutUint16(tcp[2:], dst.port)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	binary.BigEndian.PutUint32(tcp[8:], ack)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	sum := checksum(0, pseudo)
+	sum = checksum(^sum, tcp)
+	sum = checksum(^sum, payload)
+	binary.BigEndian.PutUint16(tcp[16:], sum)
+
+	buf = append(buf, tcp...)
+	return append(buf, payload...)
+}
+
+// checksum continues the Internet checksum of b from the one's complement
+// sum initial and returns its complement. Data after the first call must
+// start at an even offset, which holds for the fixed-size headers used here.
+func checksum(initial uint16, b []byte) uint16 {
+	sum := uint32(initial)
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum) // #nosec G115 - folded to 16 bits
+}
@@ -0,0 +1,88 @@
+package pcap
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler serves the capture endpoints below prefix, writing captures to dir:
+//
+//	GET  <prefix>        status of the running or last capture
+//	POST <prefix>/start  start a capture; query parameters connection (repeatable
+//	                     or comma-separated), snaplen and max_size select the traffic
+//	POST <prefix>/stop   stop the running capture
+func Handler(prefix, dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix && r.Method == http.MethodGet:
+			writeStatus(w, http.StatusOK, CurrentStatus())
+		case r.URL.Path == prefix+"/start" && r.Method == http.MethodPost:
+			opts, err := parseOptions(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if _, err := Start(dir, opts); err != nil {
+				if errors.Is(err, ErrActive) {
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeStatus(w, http.StatusOK, CurrentStatus())
+		case r.URL.Path == prefix+"/stop" && r.Method == http.MethodPost:
+			status, err := Stop()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			writeStatus(w, http.StatusOK, status)
+		case r.URL.Path == prefix || r.URL.Path == prefix+"/start" || r.URL.Path == prefix+"/stop":
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// parseOptions reads the capture options from the query parameters of r.
+func parseOptions(r *http.Request) (Options, error) {
+	var opts Options
+	query := r.URL.Query()
+
+	for _, value := range query["connection"] {
+		for _, field := range strings.Split(value, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 64)
+			if err != nil {
+				return opts, errors.New("invalid connection ID " + strconv.Quote(field))
+			}
+			opts.Connections = append(opts.Connections, id)
+		}
+	}
+
+	var err error
+	if value := query.Get("snaplen"); value != "" {
+		if opts.SnapLen, err = strconv.Atoi(value); err != nil || opts.SnapLen < 0 {
+			return opts, errors.New("invalid snaplen " + strconv.Quote(value))
+		}
+	}
+	if value := query.Get("max_size"); value != "" {
+		if opts.MaxSize, err = strconv.ParseInt(value, 10, 64); err != nil || opts.MaxSize < 0 {
+			return opts, errors.New("invalid max_size " + strconv.Quote(value))
+		}
+	}
+	return opts, nil
+}
+
+// writeStatus writes a capture status as JSON.
+func writeStatus(w http.ResponseWriter, code int, status Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logger.Errorf("Failed to write pcap status: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package pcap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+)
+
+var logger = logging.SetupLogging()
+
+// flushInterval is how often buffered packets are flushed to the pcapng file.
+const flushInterval = time.Second
+
+// Options select the traffic written to a pcapng file.
+type Options struct {
+	// Connections limits the capture to these proxy connection IDs. All
+	// connections are captured if it is empty.
+	Connections []uint64
+	// SnapLen is the number of TCP payload bytes kept of each packet, or 0
+	// to keep them all.
+	SnapLen int
+	// MaxSize stops the capture once the file would grow beyond this many
+	// bytes, or never if 0.
+	MaxSize int64
+}
+
+// Status describes the current or last capture.
+type Status struct {
+	Active      bool      `json:"active"`
+	File        string    `json:"file,omitempty"`
+	Connections []uint64  `json:"connections,omitempty"`
+	SnapLen     int       `json:"snapLen,omitempty"`
+	MaxSize     int64     `json:"maxSize,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	Packets     uint64    `json:"packets"`
+	Bytes       int64     `json:"bytes"`
+}
+
+// ErrActive is returned by Start while a capture is running.
+var ErrActive = errors.New("a pcap capture is already running")
+
+// ErrNotActive is returned by Stop when no capture is running.
+var ErrNotActive = errors.New("no pcap capture is running")
+
+// capture is a pcapng file being written.
+type capture struct {
+	path        string
+	opts        Options
+	connections map[uint64]bool
+	started     time.Time
+
+	mu      sync.Mutex
+	file    *os.File
+	out     *bufio.Writer
+	buf     []byte
+	packets uint64
+	bytes   int64
+	closed  bool
+	done    chan struct{}
+}
+
+var (
+	active atomic.Pointer[capture]
+	last   atomic.Pointer[capture]
+	// startMu serializes starting and stopping captures.
+	startMu sync.Mutex
+)
+
+// Start writes the traffic selected by opts to a new pcapng file in dir and
+// returns its path.
+func Start(dir string, opts Options) (string, error) {
+	startMu.Lock()
+	defer startMu.Unlock()
+
+	if active.Load() != nil {
+		return "", ErrActive
+	}
+	if opts.SnapLen < 0 || opts.MaxSize < 0 {
+		return "", errors.New("snap length and maximum size must not be negative")
+	}
+
+	now := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("proxy-%s.pcapng", now.UTC().Format("20060102-150405.000")))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600) // #nosec G304 - the name is generated in the configured directory
+	if err != nil {
+		return "", fmt.Errorf("failed to create pcapng file: %w", err)
+	}
+
+	c := &capture{
+		path:        path,
+		opts:        opts,
+		connections: make(map[uint64]bool, len(opts.Connections)),
+		started:     now,
+		file:        file,
+		out:         bufio.NewWriter(file),
+		done:        make(chan struct{}),
+	}
+	for _, id := range opts.Connections {
+		c.connections[id] = true
+	}
+
+	header := appendInterfaceDescription(appendSectionHeader(nil))
+	if _, err := c.out.Write(header); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write pcapng file: %w", err)
+	}
+	c.bytes = int64(len(header))
+
+	last.Store(c)
+	active.Store(c)
+	go c.flush()
+
+	logger.Infof("Writing proxied traffic to %s", path)
+	return path, nil
+}
+
+// Stop finishes the running capture and returns its status.
+func Stop() (Status, error) {
+	startMu.Lock()
+	defer startMu.Unlock()
+
+	c := active.Load()
+	if c == nil || !active.CompareAndSwap(c, nil) {
+		return Status{}, ErrNotActive
+	}
+	c.close()
+	return c.status(), nil
+}
+
+// CurrentStatus returns the status of the running capture, or of the last one.
+func CurrentStatus() Status {
+	c := last.Load()
+	if c == nil {
+		return Status{}
+	}
+	return c.status()
+}
+
+// status returns the status of the capture.
+func (c *capture) status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	connections := append([]uint64{}, c.opts.Connections...)
+	sort.Slice(connections, func(i, j int) bool { return connections[i] < connections[j] })
+	return Status{
+		Active:      !c.closed,
+		File:        c.path,
+		Connections: connections,
+		SnapLen:     c.opts.SnapLen,
+		MaxSize:     c.opts.MaxSize,
+		StartedAt:   c.started,
+		Packets:     c.packets,
+		Bytes:       c.bytes,
+	}
+}
+
+// includes returns true if traffic of the connection is captured.
+func (c *capture) includes(connectionID uint64) bool {
+	return len(c.connections) == 0 || c.connections[connectionID]
+}
+
+// writePacket writes a TCP segment from src to dst.
+func (c *capture) writePacket(src, dst endpoint, seq, ack uint32, flags byte, payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+
+	frame := appendFrame(nil, src, dst, seq, ack, flags, payload)
+	captured := frame
+	if c.opts.SnapLen > 0 && len(payload) > c.opts.SnapLen {
+		captured = frame[:len(frame)-len(payload)+c.opts.SnapLen]
+	}
+
+	c.buf = appendEnhancedPacket(c.buf[:0], time.Now(), captured, len(frame))
+	if c.opts.MaxSize > 0 && c.bytes+int64(len(c.buf)) > c.opts.MaxSize {
+		// Stop once the file is full, without waiting for the lock held here.
+		if active.CompareAndSwap(c, nil) {
+			logger.Infof("Stopping pcap capture %s at its maximum size", c.path)
+			go c.close()
+		}
+		return
+	}
+
+	if _, err := c.out.Write(c.buf); err != nil {
+		logger.Errorf("Failed to write pcapng file: %v", err)
+		return
+	}
+	c.packets++
+	c.bytes += int64(len(c.buf))
+}
+
+// flush periodically flushes buffered packets until the capture is closed.
+func (c *capture) flush() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			if !c.closed {
+				if err := c.out.Flush(); err != nil {
+					logger.Errorf("Failed to flush pcapng file: %v", err)
+				}
+			}
+			c.mu.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close flushes and closes the pcapng file.
+func (c *capture) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+
+	if err := c.out.Flush(); err != nil {
+		logger.Errorf("Failed to flush pcapng file: %v", err)
+	}
+	if err := c.file.Close(); err != nil {
+		logger.Errorf("Failed to close pcapng file: %v", err)
+	}
+	logger.Infof("Finished pcap capture %s with %d packets", c.path, c.packets)
+}
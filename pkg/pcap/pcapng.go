@@ -0,0 +1,63 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+
+const (
+	blockSectionHeader        = 0x0A0D0D0A
+	blockInterfaceDescription = 0x00000001
+	blockEnhancedPacket       = 0x00000006
+	byteOrderMagic            = 0x1A2B3C4D
+	linkTypeEthernet          = 1
+)
+
+// appendBlock appends a block with the given type and body, padded to 32 bits.
+func appendBlock(buf []byte, blockType uint32, body []byte) []byte {
+	padding := (4 - len(body)%4) % 4
+	length := uint32(12 + len(body) + padding) // #nosec G115 - blocks are limited to one frame
+
+	buf = binary.LittleEndian.AppendUint32(buf, blockType)
+	buf = binary.LittleEndian.AppendUint32(buf, length)
+	buf = append(buf, body...)
+	buf = append(buf, make([]byte, padding)...)
+	return binary.LittleEndian.AppendUint32(buf, length)
+}
+
+// appendSectionHeader appends the section header block that starts the file.
+func appendSectionHeader(buf []byte) []byte {
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, byteOrderMagic)
+	body = binary.LittleEndian.AppendUint16(body, 1) // major version
+	body = binary.LittleEndian.AppendUint16(body, 0) // minor version
+	body = binary.LittleEndian.AppendUint64(body, ^uint64(0))
+	return appendBlock(buf, blockSectionHeader, body)
+}
+
+// appendInterfaceDescription appends the description of the single synthetic
+// Ethernet interface all packets are written for. Timestamps are in microseconds.
+func appendInterfaceDescription(buf []byte) []byte {
+	var body []byte
+	body = binary.LittleEndian.AppendUint16(body, linkTypeEthernet)
+	body = binary.LittleEndian.AppendUint16(body, 0) // reserved
+	body = binary.LittleEndian.AppendUint32(body, 0) // no snapshot length limit
+	return appendBlock(buf, blockInterfaceDescription, body)
+}
+
+// appendEnhancedPacket appends a packet captured at ts, of which frame was
+// kept from originalLength bytes.
+func appendEnhancedPacket(buf []byte, ts time.Time, frame []byte, originalLength int) []byte {
+	micros := uint64(ts.UnixMicro()) // #nosec G115 - timestamps are after 1970
+
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, 0) // interface ID
+	body = binary.LittleEndian.AppendUint32(body, uint32(micros>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(micros))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(frame)))     // #nosec G115 - frames are smaller than 64 KiB
+	body = binary.LittleEndian.AppendUint32(body, uint32(originalLength)) // #nosec G115 - frames are smaller than 64 KiB
+	body = append(body, frame...)
+	return appendBlock(buf, blockEnhancedPacket, body)
+}
@@ -0,0 +1,67 @@
+package protocol
+
+import "encoding/binary"
+
+/*
+ChangeUserPacket represents a COM_CHANGE_USER command sent by the client
+*/
+type ChangeUserPacket struct {
+	Username       string
+	AuthResponse   []byte
+	Database       string
+	CharacterSet   uint16
+	AuthPluginName string
+}
+
+// Decode decodes a COM_CHANGE_USER payload sent by a client with the given capabilities.
+func (r *ChangeUserPacket) Decode(payload []byte, capabilities CapabilityFlag) error {
+	if len(payload) == 0 || payload[0] != ComChangeUser {
+		return errMalformedPacket
+	}
+	position := 1
+
+	username, n, err := readNullTerminated(payload[position:])
+	if err != nil {
+		return err
+	}
+	r.Username = string(username)
+	position += n
+
+	if capabilities.Has(ClientSecureConn) {
+		if position >= len(payload) || position+1+int(payload[position]) > len(payload) {
+			return errMalformedPacket
+		}
+		length := int(payload[position])
+		r.AuthResponse = payload[position+1 : position+1+length]
+		position += 1 + length
+	} else {
+		auth, n, err := readNullTerminated(payload[position:])
+		if err != nil {
+			return err
+		}
+		r.AuthResponse = auth
+		position += n
+	}
+
+	database, n, err := readNullTerminated(payload[position:])
+	if err != nil {
+		return err
+	}
+	r.Database = string(database)
+	position += n
+
+	if position+2 <= len(payload) {
+		r.CharacterSet = binary.LittleEndian.Uint16(payload[position : position+2])
+		position += 2
+	}
+
+	if capabilities.Has(ClientPluginAuth) && position < len(payload) {
+		plugin, _, err := readNullTerminated(payload[position:])
+		if err != nil {
+			return err
+		}
+		r.AuthPluginName = string(plugin)
+	}
+
+	return nil
+}
@@ -45,57 +45,64 @@ func (r CapabilityFlag) String() string {
 }
 
 const (
-	clientLongPassword CapabilityFlag = 1 << iota
-	clientFoundRows
-	clientLongFlag
-	clientConnectWithDB
-	clientNoSchema
-	clientCompress
-	clientODBC
-	clientLocalFiles
-	clientIgnoreSpace
-	clientProtocol41
-	clientInteractive
-	clientSSL
-	clientIgnoreSIGPIPE
-	clientTransactions
-	clientReserved
-	clientSecureConn
-	clientMultiStatements
-	clientMultiResults
-	clientPSMultiResults
-	clientPluginAuth
-	clientConnectAttrs
-	clientPluginAuthLenEncClientData
-	clientCanHandleExpiredPasswords
-	clientSessionTrack
-	clientDeprecateEOF
+	ClientLongPassword CapabilityFlag = 1 << iota
+	ClientFoundRows
+	ClientLongFlag
+	ClientConnectWithDB
+	ClientNoSchema
+	ClientCompress
+	ClientODBC
+	ClientLocalFiles
+	ClientIgnoreSpace
+	ClientProtocol41
+	ClientInteractive
+	ClientSSL
+	ClientIgnoreSIGPIPE
+	ClientTransactions
+	ClientReserved
+	ClientSecureConn
+	ClientMultiStatements
+	ClientMultiResults
+	ClientPSMultiResults
+	ClientPluginAuth
+	ClientConnectAttrs
+	ClientPluginAuthLenEncClientData
+	ClientCanHandleExpiredPasswords
+	ClientSessionTrack
+	ClientDeprecateEOF
+	ClientOptionalResultsetMetadata
+	ClientZstdCompressionAlgorithm
+	ClientQueryAttributes
+	ClientMultiFactorAuthentication
+	ClientCapabilityExtension
+	ClientSSLVerifyServerCert
+	ClientRememberOptions
 )
 
 var flags = map[CapabilityFlag]string{
-	clientLongPassword:               "clientLongPassword",
-	clientFoundRows:                  "clientFoundRows",
-	clientLongFlag:                   "clientLongFlag",
-	clientConnectWithDB:              "clientConnectWithDB",
-	clientNoSchema:                   "clientNoSchema",
-	clientCompress:                   "clientCompress",
-	clientODBC:                       "clientODBC",
-	clientLocalFiles:                 "clientLocalFiles",
-	clientIgnoreSpace:                "clientIgnoreSpace",
-	clientProtocol41:                 "clientProtocol41",
-	clientInteractive:                "clientInteractive",
-	clientSSL:                        "clientSSL",
-	clientIgnoreSIGPIPE:              "clientIgnoreSIGPIPE",
-	clientTransactions:               "clientTransactions",
-	clientReserved:                   "clientReserved",
-	clientSecureConn:                 "clientSecureConn",
-	clientMultiStatements:            "clientMultiStatements",
-	clientMultiResults:               "clientMultiResults",
-	clientPSMultiResults:             "clientPSMultiResults",
-	clientPluginAuth:                 "clientPluginAuth",
-	clientConnectAttrs:               "clientConnectAttrs",
-	clientPluginAuthLenEncClientData: "clientPluginAuthLenEncClientData",
-	clientCanHandleExpiredPasswords:  "clientCanHandleExpiredPasswords",
-	clientSessionTrack:               "clientSessionTrack",
-	clientDeprecateEOF:               "clientDeprecateEOF",
+	ClientLongPassword:               "ClientLongPassword",
+	ClientFoundRows:                  "ClientFoundRows",
+	ClientLongFlag:                   "ClientLongFlag",
+	ClientConnectWithDB:              "ClientConnectWithDB",
+	ClientNoSchema:                   "ClientNoSchema",
+	ClientCompress:                   "ClientCompress",
+	ClientODBC:                       "ClientODBC",
+	ClientLocalFiles:                 "ClientLocalFiles",
+	ClientIgnoreSpace:                "ClientIgnoreSpace",
+	ClientProtocol41:                 "ClientProtocol41",
+	ClientInteractive:                "ClientInteractive",
+	ClientSSL:                        "ClientSSL",
+	ClientIgnoreSIGPIPE:              "ClientIgnoreSIGPIPE",
+	ClientTransactions:               "ClientTransactions",
+	ClientReserved:                   "ClientReserved",
+	ClientSecureConn:                 "ClientSecureConn",
+	ClientMultiStatements:            "ClientMultiStatements",
+	ClientMultiResults:               "ClientMultiResults",
+	ClientPSMultiResults:             "ClientPSMultiResults",
+	ClientPluginAuth:                 "ClientPluginAuth",
+	ClientConnectAttrs:               "ClientConnectAttrs",
+	ClientPluginAuthLenEncClientData: "ClientPluginAuthLenEncClientData",
+	ClientCanHandleExpiredPasswords:  "ClientCanHandleExpiredPasswords",
+	ClientSessionTrack:               "ClientSessionTrack",
+	ClientDeprecateEOF:               "ClientDeprecateEOF",
 }
@@ -0,0 +1,216 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_response_packets.html
+
+// Header bytes identifying generic response packets.
+const (
+	OKHeader           byte = 0x00
+	AuthMoreDataHeader byte = 0x01
+	LocalInfileHeader  byte = 0xfb
+	EOFHeader          byte = 0xfe
+	ERRHeader          byte = 0xff
+)
+
+/*
+OKPacket represents an OK packet sent by the MySQL Server
+*/
+type OKPacket struct {
+	Header           byte
+	AffectedRows     uint64
+	LastInsertID     uint64
+	StatusFlags      uint16
+	Warnings         uint16
+	Info             []byte
+	SessionStateInfo []byte
+}
+
+// IsOKPacket returns true if payload is an OK packet.
+// With ClientDeprecateEOF an OK packet with an EOF header terminates result sets.
+func IsOKPacket(payload []byte, capabilities CapabilityFlag) bool {
+	if len(payload) == 0 {
+		return false
+	}
+	if payload[0] == OKHeader {
+		return len(payload) >= 7
+	}
+	return capabilities.Has(ClientDeprecateEOF) && payload[0] == EOFHeader && len(payload) < MaxPacketSize
+}
+
+// Decode decodes an OK packet payload.
+func (r *OKPacket) Decode(payload []byte, capabilities CapabilityFlag) error {
+	if len(payload) == 0 {
+		return errMalformedPacket
+	}
+	r.Header = payload[0]
+	position := 1
+
+	var n int
+	var err error
+	if r.AffectedRows, _, n, err = ReadLengthEncodedInt(payload[position:]); err != nil {
+		return err
+	}
+	position += n
+	if r.LastInsertID, _, n, err = ReadLengthEncodedInt(payload[position:]); err != nil {
+		return err
+	}
+	position += n
+
+	if len(payload) < position+4 {
+		return errMalformedPacket
+	}
+	r.StatusFlags = binary.LittleEndian.Uint16(payload[position : position+2])
+	r.Warnings = binary.LittleEndian.Uint16(payload[position+2 : position+4])
+	position += 4
+
+	r.Info, r.SessionStateInfo = nil, nil
+	if !capabilities.Has(ClientSessionTrack) {
+		r.Info = payload[position:]
+		return nil
+	}
+	if position >= len(payload) {
+		return nil
+	}
+	if r.Info, _, n, err = ReadLengthEncodedString(payload[position:]); err != nil {
+		return err
+	}
+	position += n
+	if r.StatusFlags&ServerSessionStateChanged != 0 && position < len(payload) {
+		if r.SessionStateInfo, _, _, err = ReadLengthEncodedString(payload[position:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Encode encodes the OK packet payload.
+func (r OKPacket) Encode(capabilities CapabilityFlag) []byte {
+	buf := []byte{r.Header}
+	buf = AppendLengthEncodedInt(buf, r.AffectedRows)
+	buf = AppendLengthEncodedInt(buf, r.LastInsertID)
+	buf = binary.LittleEndian.AppendUint16(buf, r.StatusFlags)
+	buf = binary.LittleEndian.AppendUint16(buf, r.Warnings)
+
+	if !capabilities.Has(ClientSessionTrack) {
+		return append(buf, r.Info...)
+	}
+	if len(r.Info) > 0 || r.StatusFlags&ServerSessionStateChanged != 0 {
+		buf = AppendLengthEncodedString(buf, r.Info)
+	}
+	if r.StatusFlags&ServerSessionStateChanged != 0 {
+		buf = AppendLengthEncodedString(buf, r.SessionStateInfo)
+	}
+	return buf
+}
+
+// SessionTrackGTIDs is the type of the session state change reporting the
+// GTIDs of committed transactions, with session_track_gtids enabled.
+const SessionTrackGTIDs byte = 0x03
+
+// GTIDs returns the GTID set reported in the session state changes of the OK
+// packet, and false if there is none.
+func (r *OKPacket) GTIDs() (string, bool) {
+	info := r.SessionStateInfo
+	for len(info) > 0 {
+		kind := info[0]
+		data, _, n, err := ReadLengthEncodedString(info[1:])
+		if err != nil {
+			return "", false
+		}
+		info = info[1+n:]
+		// The data is an encoding specification byte, 0 for a GTID set as
+		// text, and the set.
+		if kind != SessionTrackGTIDs || len(data) < 1 || data[0] != 0 {
+			continue
+		}
+		gtids, _, _, err := ReadLengthEncodedString(data[1:])
+		if err != nil || len(gtids) == 0 {
+			return "", false
+		}
+		return string(gtids), true
+	}
+	return "", false
+}
+
+/*
+ERRPacket represents an ERR packet sent by the MySQL Server
+*/
+type ERRPacket struct {
+	Code     uint16
+	SQLState string
+	Message  string
+}
+
+// Decode decodes an ERR packet payload.
+func (r *ERRPacket) Decode(payload []byte) error {
+	if len(payload) < 3 || payload[0] != ERRHeader {
+		return errMalformedPacket
+	}
+	r.Code = binary.LittleEndian.Uint16(payload[1:3])
+	position := 3
+
+	r.SQLState = ""
+	if len(payload) >= 9 && payload[position] == '#' {
+		r.SQLState = string(payload[position+1 : position+6])
+		position += 6
+	}
+	r.Message = string(payload[position:])
+
+	return nil
+}
+
+// Encode encodes the ERR packet payload.
+func (r ERRPacket) Encode() []byte {
+	state := r.SQLState
+	if len(state) != 5 {
+		state = "HY000"
+	}
+
+	buf := []byte{ERRHeader}
+	buf = binary.LittleEndian.AppendUint16(buf, r.Code)
+	buf = append(buf, '#')
+	buf = append(buf, state...)
+	return append(buf, r.Message...)
+}
+
+// Error implements the error interface, formatting the packet like the mysql client does.
+func (r *ERRPacket) Error() string {
+	return fmt.Sprintf("ERROR %d (%s): %s", r.Code, r.SQLState, r.Message)
+}
+
+/*
+EOFPacket represents an EOF packet sent by the MySQL Server
+*/
+type EOFPacket struct {
+	Warnings    uint16
+	StatusFlags uint16
+}
+
+// IsEOFPacket returns true if payload is a (pre ClientDeprecateEOF) EOF packet.
+func IsEOFPacket(payload []byte) bool {
+	return len(payload) > 0 && len(payload) < 9 && payload[0] == EOFHeader
+}
+
+// Decode decodes an EOF packet payload.
+func (r *EOFPacket) Decode(payload []byte) error {
+	if !IsEOFPacket(payload) {
+		return errMalformedPacket
+	}
+	if len(payload) >= 5 {
+		r.Warnings = binary.LittleEndian.Uint16(payload[1:3])
+		r.StatusFlags = binary.LittleEndian.Uint16(payload[3:5])
+	}
+	return nil
+}
+
+// Encode encodes the EOF packet payload.
+func (r EOFPacket) Encode() []byte {
+	buf := []byte{EOFHeader}
+	buf = binary.LittleEndian.AppendUint16(buf, r.Warnings)
+	return binary.LittleEndian.AppendUint16(buf, r.StatusFlags)
+}
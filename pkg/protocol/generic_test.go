@@ -0,0 +1,69 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOKPacketRoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities CapabilityFlag
+		packet       OKPacket
+	}{
+		{"plain", ClientProtocol41, OKPacket{AffectedRows: 3, LastInsertID: 1 << 20, StatusFlags: ServerStatusAutocommit, Warnings: 1, Info: []byte("Rows matched: 3")}},
+		{"session track", ClientProtocol41 | ClientSessionTrack, OKPacket{AffectedRows: 1, StatusFlags: ServerStatusInTrans | ServerSessionStateChanged, Info: []byte{}, SessionStateInfo: []byte{SessionTrackGTIDs, 2, 0, 0}}},
+		{"end of result set", ClientProtocol41 | ClientDeprecateEOF, OKPacket{Header: EOFHeader, StatusFlags: ServerStatusAutocommit, Info: []byte{}}},
+	}
+	for _, tt := range tests {
+		payload := tt.packet.Encode(tt.capabilities)
+		if !IsOKPacket(payload, tt.capabilities) {
+			t.Errorf("%s: IsOKPacket() = false", tt.name)
+		}
+		var got OKPacket
+		if err := got.Decode(payload, tt.capabilities); err != nil {
+			t.Fatalf("%s: Decode() failed: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.packet) {
+			t.Errorf("%s: round trip = %+v, want %+v", tt.name, got, tt.packet)
+		}
+	}
+}
+
+func TestERRPacketRoundTrip(t *testing.T) {
+	want := ERRPacket{Code: 1213, SQLState: "40001", Message: "Deadlock found when trying to get lock; try restarting transaction"}
+	var got ERRPacket
+	if err := got.Decode(want.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+
+	// Invalid SQL states are replaced, since clients expect five characters.
+	if err := got.Decode(ERRPacket{Code: 1148, SQLState: "x", Message: "denied"}.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if got.SQLState != "HY000" {
+		t.Errorf("SQL state = %q, want HY000", got.SQLState)
+	}
+}
+
+func TestEOFPacket(t *testing.T) {
+	payload := EOFPacket{Warnings: 2, StatusFlags: ServerMoreResultsExists}.Encode()
+	if !IsEOFPacket(payload) {
+		t.Fatal("IsEOFPacket() = false")
+	}
+	var got EOFPacket
+	if err := got.Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+	if got.Warnings != 2 || got.StatusFlags != ServerMoreResultsExists {
+		t.Errorf("Decode() = %+v", got)
+	}
+
+	// A row whose first value is 0xfe-prefixed is longer than an EOF packet.
+	if IsEOFPacket(append([]byte{EOFHeader}, make([]byte, 8)...)) {
+		t.Error("IsEOFPacket() = true for a 9-byte payload")
+	}
+}
@@ -0,0 +1,193 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+/*
+HandshakeResponse41 represents the handshake response sent by the client
+*/
+type HandshakeResponse41 struct {
+	CapabilityFlags CapabilityFlag
+	MaxPacketSize   uint32
+	CharacterSet    uint8
+	Username        string
+	AuthResponse    []byte
+	Database        string
+	AuthPluginName  string
+	Attributes      map[string]string
+	ZstdLevel       uint8
+}
+
+// sslRequestLength is the payload length of an SSLRequest packet,
+// which is the fixed-size prefix of a HandshakeResponse41.
+const sslRequestLength = 32
+
+// IsSSLRequest returns true if payload is an SSLRequest packet asking to switch to TLS.
+func IsSSLRequest(payload []byte) bool {
+	if len(payload) != sslRequestLength {
+		return false
+	}
+	return CapabilityFlag(binary.LittleEndian.Uint32(payload[0:4])).Has(ClientSSL)
+}
+
+// Decode decodes a HandshakeResponse41 payload.
+func (r *HandshakeResponse41) Decode(payload []byte) error {
+	if len(payload) < sslRequestLength {
+		return errMalformedPacket
+	}
+
+	r.CapabilityFlags = CapabilityFlag(binary.LittleEndian.Uint32(payload[0:4]))
+	if !r.CapabilityFlags.Has(ClientProtocol41) {
+		return errors.New("unsupported handshake response. Only protocol 4.1 clients are supported")
+	}
+	r.MaxPacketSize = binary.LittleEndian.Uint32(payload[4:8])
+	r.CharacterSet = payload[8]
+	position := sslRequestLength
+
+	username, n, err := readNullTerminated(payload[position:])
+	if err != nil {
+		return err
+	}
+	r.Username = string(username)
+	position += n
+
+	switch {
+	case r.CapabilityFlags.Has(ClientPluginAuthLenEncClientData):
+		auth, _, n, err := ReadLengthEncodedString(payload[position:])
+		if err != nil {
+			return err
+		}
+		r.AuthResponse = auth
+		position += n
+	case r.CapabilityFlags.Has(ClientSecureConn):
+		if position >= len(payload) || position+1+int(payload[position]) > len(payload) {
+			return errMalformedPacket
+		}
+		length := int(payload[position])
+		r.AuthResponse = payload[position+1 : position+1+length]
+		position += 1 + length
+	default:
+		auth, n, err := readNullTerminated(payload[position:])
+		if err != nil {
+			return err
+		}
+		r.AuthResponse = auth
+		position += n
+	}
+
+	r.Database = ""
+	if r.CapabilityFlags.Has(ClientConnectWithDB) && position < len(payload) {
+		database, n, err := readNullTerminated(payload[position:])
+		if err != nil {
+			return err
+		}
+		r.Database = string(database)
+		position += n
+	}
+
+	r.AuthPluginName = ""
+	if r.CapabilityFlags.Has(ClientPluginAuth) && position < len(payload) {
+		plugin, n, err := readNullTerminated(payload[position:])
+		if err != nil {
+			return err
+		}
+		r.AuthPluginName = string(plugin)
+		position += n
+	}
+
+	r.Attributes = nil
+	if r.CapabilityFlags.Has(ClientConnectAttrs) && position < len(payload) {
+		attrs, _, n, err := ReadLengthEncodedString(payload[position:])
+		if err != nil {
+			return err
+		}
+		position += n
+
+		r.Attributes = make(map[string]string)
+		for len(attrs) > 0 {
+			key, _, n, err := ReadLengthEncodedString(attrs)
+			if err != nil {
+				return err
+			}
+			attrs = attrs[n:]
+			value, _, n, err := ReadLengthEncodedString(attrs)
+			if err != nil {
+				return err
+			}
+			attrs = attrs[n:]
+			r.Attributes[string(key)] = string(value)
+		}
+	}
+
+	if r.CapabilityFlags.Has(ClientZstdCompressionAlgorithm) && position < len(payload) {
+		r.ZstdLevel = payload[position]
+	}
+
+	return nil
+}
+
+// Encode encodes the HandshakeResponse41 payload.
+func (r HandshakeResponse41) Encode() []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(r.CapabilityFlags))
+	buf = binary.LittleEndian.AppendUint32(buf, r.MaxPacketSize)
+	buf = append(buf, r.CharacterSet)
+	buf = append(buf, make([]byte, 23)...)
+
+	buf = append(buf, r.Username...)
+	buf = append(buf, 0x00)
+
+	switch {
+	case r.CapabilityFlags.Has(ClientPluginAuthLenEncClientData):
+		buf = AppendLengthEncodedString(buf, r.AuthResponse)
+	case r.CapabilityFlags.Has(ClientSecureConn):
+		buf = append(buf, byte(len(r.AuthResponse))) // #nosec G115 - auth responses are scrambles well below 256 bytes
+		buf = append(buf, r.AuthResponse...)
+	default:
+		buf = append(buf, r.AuthResponse...)
+		buf = append(buf, 0x00)
+	}
+
+	if r.CapabilityFlags.Has(ClientConnectWithDB) {
+		buf = append(buf, r.Database...)
+		buf = append(buf, 0x00)
+	}
+
+	if r.CapabilityFlags.Has(ClientPluginAuth) {
+		buf = append(buf, r.AuthPluginName...)
+		buf = append(buf, 0x00)
+	}
+
+	if r.CapabilityFlags.Has(ClientConnectAttrs) {
+		keys := make([]string, 0, len(r.Attributes))
+		for key := range r.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var attrs []byte
+		for _, key := range keys {
+			attrs = AppendLengthEncodedString(attrs, []byte(key))
+			attrs = AppendLengthEncodedString(attrs, []byte(r.Attributes[key]))
+		}
+		buf = AppendLengthEncodedString(buf, attrs)
+	}
+
+	if r.CapabilityFlags.Has(ClientZstdCompressionAlgorithm) {
+		buf = append(buf, r.ZstdLevel)
+	}
+
+	return buf
+}
+
+// readNullTerminated returns the bytes up to the first NUL byte and the number of bytes consumed.
+func readNullTerminated(b []byte) ([]byte, int, error) {
+	index := bytes.IndexByte(b, 0x00)
+	if index == -1 {
+		return nil, 0, errMalformedPacket
+	}
+	return b[:index], index + 1, nil
+}
@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestHandshakeResponseRoundTrip(t *testing.T) {
+	base := ClientProtocol41 | ClientSecureConn | ClientPluginAuth
+	tests := []HandshakeResponse41{
+		{
+			CapabilityFlags: base,
+			MaxPacketSize:   MaxPacketSize,
+			CharacterSet:    45,
+			Username:        "app",
+			AuthResponse:    []byte{1, 2, 3},
+			AuthPluginName:  "mysql_native_password",
+		},
+		{
+			CapabilityFlags: base | ClientPluginAuthLenEncClientData | ClientConnectWithDB | ClientConnectAttrs,
+			MaxPacketSize:   1 << 20,
+			CharacterSet:    255,
+			Username:        "reporting",
+			AuthResponse:    make([]byte, 32),
+			Database:        "shop",
+			AuthPluginName:  "caching_sha2_password",
+			Attributes:      map[string]string{"_client_name": "libmysql", "program_name": "report"},
+		},
+	}
+	for _, want := range tests {
+		var got HandshakeResponse41
+		if err := got.Decode(want.Encode()); err != nil {
+			t.Fatalf("Decode(%s) failed: %v", want.Username, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("round trip = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestHandshakeResponseRejectsOldProtocol(t *testing.T) {
+	payload := make([]byte, sslRequestLength+2)
+	binary.LittleEndian.PutUint32(payload, uint32(ClientSecureConn))
+	var r HandshakeResponse41
+	if err := r.Decode(payload); err == nil {
+		t.Error("Decode() accepted a pre-4.1 handshake response")
+	}
+}
+
+func TestIsSSLRequest(t *testing.T) {
+	sslRequest := HandshakeResponse41{CapabilityFlags: ClientProtocol41 | ClientSSL, CharacterSet: 45}.Encode()[:sslRequestLength]
+	plain := HandshakeResponse41{CapabilityFlags: ClientProtocol41, CharacterSet: 45}.Encode()[:sslRequestLength]
+	full := HandshakeResponse41{CapabilityFlags: ClientProtocol41 | ClientSSL, Username: "app"}.Encode()
+
+	if !IsSSLRequest(sslRequest) {
+		t.Error("IsSSLRequest(SSLRequest) = false")
+	}
+	if IsSSLRequest(plain) {
+		t.Error("IsSSLRequest() = true without CLIENT_SSL")
+	}
+	if IsSSLRequest(full) {
+		t.Error("IsSSLRequest() = true for a full handshake response")
+	}
+}
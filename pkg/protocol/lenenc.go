@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errMalformedPacket is returned when a payload is shorter than its encoded fields claim.
+var errMalformedPacket = errors.New("malformed packet")
+
+// ReadLengthEncodedInt decodes a length-encoded integer from the start of b.
+// It returns the value, whether it was the NULL marker and the number of bytes consumed.
+func ReadLengthEncodedInt(b []byte) (uint64, bool, int, error) {
+	if len(b) == 0 {
+		return 0, false, 0, errMalformedPacket
+	}
+
+	switch b[0] {
+	case 0xfb:
+		return 0, true, 1, nil
+	case 0xfc:
+		if len(b) < 3 {
+			return 0, false, 0, errMalformedPacket
+		}
+		return uint64(binary.LittleEndian.Uint16(b[1:3])), false, 3, nil
+	case 0xfd:
+		if len(b) < 4 {
+			return 0, false, 0, errMalformedPacket
+		}
+		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, false, 4, nil
+	case 0xfe:
+		if len(b) < 9 {
+			return 0, false, 0, errMalformedPacket
+		}
+		return binary.LittleEndian.Uint64(b[1:9]), false, 9, nil
+	default:
+		return uint64(b[0]), false, 1, nil
+	}
+}
+
+// ReadLengthEncodedString decodes a length-encoded string from the start of b.
+// It returns the string, whether it was the NULL marker and the number of bytes consumed.
+func ReadLengthEncodedString(b []byte) ([]byte, bool, int, error) {
+	length, isNull, n, err := ReadLengthEncodedInt(b)
+	if err != nil || isNull {
+		return nil, isNull, n, err
+	}
+	if uint64(len(b)-n) < length {
+		return nil, false, 0, errMalformedPacket
+	}
+	end := n + int(length) // #nosec G115 - bounded by len(b) above
+	return b[n:end], false, end, nil
+}
+
+// AppendLengthEncodedInt appends v to b as a length-encoded integer.
+func AppendLengthEncodedInt(b []byte, v uint64) []byte {
+	switch {
+	case v < 0xfb:
+		return append(b, byte(v))
+	case v <= 0xffff:
+		return append(b, 0xfc, byte(v), byte(v>>8))
+	case v <= 0xffffff:
+		return append(b, 0xfd, byte(v), byte(v>>8), byte(v>>16))
+	default:
+		b = append(b, 0xfe)
+		return binary.LittleEndian.AppendUint64(b, v)
+	}
+}
+
+// AppendLengthEncodedString appends s to b as a length-encoded string.
+func AppendLengthEncodedString(b []byte, s []byte) []byte {
+	b = AppendLengthEncodedInt(b, uint64(len(s)))
+	return append(b, s...)
+}
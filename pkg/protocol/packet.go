@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// MaxPacketSize is the largest payload a single physical MySQL packet can carry.
+// Larger payloads are split over several packets with consecutive sequence IDs.
+const MaxPacketSize = 1<<24 - 1
+
+/*
+Packet represents a logical MySQL packet, with payloads split over several
+physical packets already reassembled.
+*/
+type Packet struct {
+	SequenceID uint8
+	Payload    []byte
+}
+
+// ReadPacket reads the next logical packet from r.
+func ReadPacket(r io.Reader) (*Packet, error) {
+	header := make([]byte, 4)
+	p := &Packet{}
+
+	for first := true; ; first = false {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if !first && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		length := int(binary.LittleEndian.Uint32([]byte{header[0], header[1], header[2], 0x00}))
+		if first {
+			p.SequenceID = header[3]
+		}
+
+		start := len(p.Payload)
+		p.Payload = append(p.Payload, make([]byte, length)...)
+		if _, err := io.ReadFull(r, p.Payload[start:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		if length < MaxPacketSize {
+			return p, nil
+		}
+	}
+}
+
+// WritePacket writes payload to w as one or more physical packets starting at sequence ID seq.
+func WritePacket(w io.Writer, seq uint8, payload []byte) error {
+	p := Packet{SequenceID: seq, Payload: payload}
+	_, err := w.Write(p.Encode())
+	return err
+}
+
+// Encode encodes the packet, including headers, as it is sent on the wire.
+func (p Packet) Encode() []byte {
+	buf := make([]byte, 0, len(p.Payload)+4*(len(p.Payload)/MaxPacketSize+1))
+	seq := p.SequenceID
+	payload := p.Payload
+
+	for {
+		n := len(payload)
+		if n > MaxPacketSize {
+			n = MaxPacketSize
+		}
+
+		ln := make([]byte, 4)
+		binary.LittleEndian.PutUint32(ln, uint32(n)) // #nosec G115 - n is capped at MaxPacketSize
+		buf = append(buf, ln[:3]...)
+		buf = append(buf, seq)
+		buf = append(buf, payload[:n]...)
+
+		seq++
+		payload = payload[n:]
+		if n < MaxPacketSize {
+			return buf
+		}
+	}
+}
+
+// NextSequenceID returns the sequence ID following the last physical packet of p.
+func (p Packet) NextSequenceID() uint8 {
+	return p.SequenceID + uint8(len(p.Payload)/MaxPacketSize+1) // #nosec G115 - wraps like the protocol does
+}
@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		seq     uint8
+		size    int
+		packets int
+	}{
+		{"empty", 0, 0, 1},
+		{"small", 3, 10, 1},
+		{"just below the limit", 1, MaxPacketSize - 1, 1},
+		{"exactly the limit", 1, MaxPacketSize, 2},
+		{"split", 255, MaxPacketSize + 10, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := bytes.Repeat([]byte{0xab}, tt.size)
+			p := Packet{SequenceID: tt.seq, Payload: payload}
+			encoded := p.Encode()
+			if want := tt.size + 4*tt.packets; len(encoded) != want {
+				t.Fatalf("encoded length = %d, want %d", len(encoded), want)
+			}
+
+			got, err := ReadPacket(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.SequenceID != tt.seq || !bytes.Equal(got.Payload, payload) {
+				t.Errorf("ReadPacket() = seq %d, %d bytes, want seq %d, %d bytes", got.SequenceID, len(got.Payload), tt.seq, tt.size)
+			}
+			if want := tt.seq + uint8(tt.packets); p.NextSequenceID() != want {
+				t.Errorf("NextSequenceID() = %d, want %d", p.NextSequenceID(), want)
+			}
+		})
+	}
+}
+
+func TestReadPacketReadsExactly(t *testing.T) {
+	first := Packet{SequenceID: 0, Payload: []byte("first")}.Encode()
+	second := Packet{SequenceID: 1, Payload: []byte("second")}.Encode()
+	r := bytes.NewReader(append(first, second...))
+
+	if _, err := ReadPacket(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != len(second) {
+		t.Fatalf("ReadPacket consumed %d bytes of the next packet", len(second)-r.Len())
+	}
+}
+
+func TestReadPacketTruncated(t *testing.T) {
+	encoded := Packet{SequenceID: 0, Payload: []byte("payload")}.Encode()
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"nothing", nil, io.EOF},
+		{"partial header", encoded[:2], io.ErrUnexpectedEOF},
+		{"partial payload", encoded[:6], io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		if _, err := ReadPacket(bytes.NewReader(tt.data)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ReadPacket() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -35,25 +35,30 @@ type InitialHandshakePacket struct {
 }
 
 // Decode decodes the first packet received from the MySQL Server
-// It's a handshake packet
+// It's a handshake packet. If the server refused the connection instead,
+// the returned error is its *ERRPacket.
 func (r *InitialHandshakePacket) Decode(conn net.Conn) error {
-	data := make([]byte, 1024)
-	_, err := conn.Read(data)
+	packet, err := ReadPacket(conn)
 	if err != nil {
 		return err
 	}
 
-	header := &PacketHeader{}
-	ln := []byte{data[0], data[1], data[2], 0x00}
-	header.Length = binary.LittleEndian.Uint32(ln)
-	// a single byte integer is the same in BigEndian and LittleEndian
-	header.SequenceID = data[3]
-
-	r.header = header
+	r.header = &PacketHeader{
+		Length:     uint32(len(packet.Payload)), // #nosec G115 - a handshake is far below 4GB
+		SequenceID: packet.SequenceID,
+	}
 	// Assign payload-only data to new var just for convenience
-	payload := data[4 : header.Length+4]
+	payload := packet.Payload
 	position := 0
 
+	if len(payload) > 0 && payload[0] == ERRHeader {
+		errPacket := &ERRPacket{}
+		if err := errPacket.Decode(payload); err != nil {
+			return err
+		}
+		return errPacket
+	}
+
 	// Protocol version check
 	r.ProtocolVersion = payload[0]
 	if r.ProtocolVersion != 0x0a {
@@ -99,7 +104,7 @@ func (r *InitialHandshakePacket) Decode(conn net.Conn) error {
 	cap := uint32(capLow) | uint32(capHi)<<16
 	r.CapabilitiesFlags = CapabilityFlag(cap)
 
-	if r.CapabilitiesFlags&clientPluginAuth != 0 {
+	if r.CapabilitiesFlags&ClientPluginAuth != 0 {
 		r.AuthPluginDataLen = payload[position]
 		if r.AuthPluginDataLen == 0 {
 			return errors.New("wrong auth plugin data length")
@@ -110,7 +115,7 @@ func (r *InitialHandshakePacket) Decode(conn net.Conn) error {
 	// Skip reserved bytes
 	position += 10
 
-	if r.CapabilitiesFlags&clientSecureConn != 0 {
+	if r.CapabilitiesFlags&ClientSecureConn != 0 {
 		end := position + Max(13, int(r.AuthPluginDataLen)-8)
 		r.AuthPluginData = append(r.AuthPluginData, payload[position:end]...)
 		position = end
@@ -169,8 +174,10 @@ func (r InitialHandshakePacket) Encode() ([]byte, error) {
 	}
 
 	h := PacketHeader{
-		Length:     length,
-		SequenceID: r.header.SequenceID,
+		Length: length,
+	}
+	if r.header != nil {
+		h.SequenceID = r.header.SequenceID
 	}
 
 	newBuf := make([]byte, 0, h.Length+4)
@@ -0,0 +1,259 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_query_response_text_resultset.html
+
+// Column types reported in column definitions.
+const (
+	TypeDecimal    byte = 0x00
+	TypeTiny       byte = 0x01
+	TypeShort      byte = 0x02
+	TypeLong       byte = 0x03
+	TypeFloat      byte = 0x04
+	TypeDouble     byte = 0x05
+	TypeNull       byte = 0x06
+	TypeTimestamp  byte = 0x07
+	TypeLongLong   byte = 0x08
+	TypeInt24      byte = 0x09
+	TypeDate       byte = 0x0a
+	TypeTime       byte = 0x0b
+	TypeDateTime   byte = 0x0c
+	TypeYear       byte = 0x0d
+	TypeVarchar    byte = 0x0f
+	TypeBit        byte = 0x10
+	TypeJSON       byte = 0xf5
+	TypeNewDecimal byte = 0xf6
+	TypeBlob       byte = 0xfc
+	TypeVarString  byte = 0xfd
+	TypeString     byte = 0xfe
+)
+
+// Column definition flags.
+const (
+	NotNullFlag  uint16 = 0x0001
+	BinaryFlag   uint16 = 0x0080
+	UnsignedFlag uint16 = 0x0020
+)
+
+// CharacterSetUTF8MB4 is the collation ID of utf8mb4_general_ci.
+const CharacterSetUTF8MB4 uint16 = 45
+
+// CharacterSetBinary is the collation ID of binary.
+const CharacterSetBinary uint16 = 63
+
+/*
+ColumnDefinition41 represents a column definition of a result set
+*/
+type ColumnDefinition41 struct {
+	Catalog      string
+	Schema       string
+	Table        string
+	OrgTable     string
+	Name         string
+	OrgName      string
+	CharacterSet uint16
+	ColumnLength uint32
+	Type         byte
+	Flags        uint16
+	Decimals     uint8
+}
+
+// NewColumn returns the definition of a computed column, as used by result sets
+// the proxy generates itself.
+func NewColumn(name string, columnType byte) ColumnDefinition41 {
+	c := ColumnDefinition41{
+		Catalog:      "def",
+		Name:         name,
+		CharacterSet: CharacterSetUTF8MB4,
+		ColumnLength: 1024,
+		Type:         columnType,
+	}
+	switch columnType {
+	case TypeLongLong, TypeLong, TypeTiny, TypeShort, TypeInt24, TypeDouble, TypeFloat, TypeNewDecimal:
+		c.CharacterSet = CharacterSetBinary
+		c.ColumnLength = 21
+		c.Flags = BinaryFlag
+	}
+	return c
+}
+
+// Decode decodes a column definition payload.
+func (r *ColumnDefinition41) Decode(payload []byte) error {
+	fields := make([]string, 6)
+	position := 0
+	for i := range fields {
+		value, _, n, err := ReadLengthEncodedString(payload[position:])
+		if err != nil {
+			return err
+		}
+		fields[i] = string(value)
+		position += n
+	}
+	r.Catalog, r.Schema, r.Table, r.OrgTable, r.Name, r.OrgName = fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+
+	// Length of the fixed-length fields, always 0x0c.
+	_, _, n, err := ReadLengthEncodedInt(payload[position:])
+	if err != nil {
+		return err
+	}
+	position += n
+	if len(payload) < position+10 {
+		return errMalformedPacket
+	}
+
+	r.CharacterSet = binary.LittleEndian.Uint16(payload[position : position+2])
+	r.ColumnLength = binary.LittleEndian.Uint32(payload[position+2 : position+6])
+	r.Type = payload[position+6]
+	r.Flags = binary.LittleEndian.Uint16(payload[position+7 : position+9])
+	r.Decimals = payload[position+9]
+
+	return nil
+}
+
+// Encode encodes the column definition payload.
+func (r ColumnDefinition41) Encode() []byte {
+	var buf []byte
+	for _, field := range []string{r.Catalog, r.Schema, r.Table, r.OrgTable, r.Name, r.OrgName} {
+		buf = AppendLengthEncodedString(buf, []byte(field))
+	}
+	buf = AppendLengthEncodedInt(buf, 0x0c)
+	buf = binary.LittleEndian.AppendUint16(buf, r.CharacterSet)
+	buf = binary.LittleEndian.AppendUint32(buf, r.ColumnLength)
+	buf = append(buf, r.Type)
+	buf = binary.LittleEndian.AppendUint16(buf, r.Flags)
+	buf = append(buf, r.Decimals)
+	return append(buf, 0x00, 0x00)
+}
+
+// TextRow is a row of a text protocol result set. NULL values are nil.
+type TextRow [][]byte
+
+// DecodeTextRow decodes a text protocol row with the given number of columns.
+func DecodeTextRow(payload []byte, columns int) (TextRow, error) {
+	row := make(TextRow, columns)
+	position := 0
+	for i := range row {
+		value, isNull, n, err := ReadLengthEncodedString(payload[position:])
+		if err != nil {
+			return nil, err
+		}
+		if !isNull {
+			row[i] = append([]byte{}, value...)
+		}
+		position += n
+	}
+	return row, nil
+}
+
+// Encode encodes the row payload.
+func (r TextRow) Encode() []byte {
+	var buf []byte
+	for _, value := range r {
+		if value == nil {
+			buf = append(buf, 0xfb)
+			continue
+		}
+		buf = AppendLengthEncodedString(buf, value)
+	}
+	return buf
+}
+
+// ResultSet is a decoded text protocol result set.
+type ResultSet struct {
+	Columns []ColumnDefinition41
+	Rows    []TextRow
+}
+
+// errNotResultSet is returned when decoding packets that do not form a single text result set.
+var errNotResultSet = errors.New("packets do not form a text result set")
+
+// DecodeResultSet decodes the packets of a single text result set, as answered to a COM_QUERY.
+func DecodeResultSet(packets []*Packet, capabilities CapabilityFlag) (*ResultSet, error) {
+	if len(packets) == 0 {
+		return nil, errNotResultSet
+	}
+
+	count, _, _, err := ReadLengthEncodedInt(packets[0].Payload)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || uint64(len(packets)) < count+2 {
+		return nil, errNotResultSet
+	}
+
+	r := &ResultSet{Columns: make([]ColumnDefinition41, count)}
+	position := 1
+	for i := range r.Columns {
+		if err := r.Columns[i].Decode(packets[position].Payload); err != nil {
+			return nil, err
+		}
+		position++
+	}
+	if !capabilities.Has(ClientDeprecateEOF) {
+		if !IsEOFPacket(packets[position].Payload) {
+			return nil, errNotResultSet
+		}
+		position++
+	}
+
+	for ; position < len(packets)-1; position++ {
+		row, err := DecodeTextRow(packets[position].Payload, len(r.Columns))
+		if err != nil {
+			return nil, err
+		}
+		r.Rows = append(r.Rows, row)
+	}
+
+	return r, nil
+}
+
+// Encode encodes the result set as the packets answering a COM_QUERY, starting
+// at sequence ID 1 and terminated with the given status flags.
+func (r ResultSet) Encode(capabilities CapabilityFlag, statusFlags uint16) []*Packet {
+	packets := make([]*Packet, 0, len(r.Columns)+len(r.Rows)+3)
+	seq := uint8(1)
+	add := func(payload []byte) {
+		p := &Packet{SequenceID: seq, Payload: payload}
+		packets = append(packets, p)
+		seq = p.NextSequenceID()
+	}
+
+	add(AppendLengthEncodedInt(nil, uint64(len(r.Columns))))
+	for _, column := range r.Columns {
+		add(column.Encode())
+	}
+
+	deprecateEOF := capabilities.Has(ClientDeprecateEOF)
+	if !deprecateEOF {
+		add(EOFPacket{StatusFlags: statusFlags}.Encode())
+	}
+	for _, row := range r.Rows {
+		add(row.Encode())
+	}
+	if deprecateEOF {
+		add(OKPacket{Header: EOFHeader, StatusFlags: statusFlags}.Encode(capabilities))
+	} else {
+		add(EOFPacket{StatusFlags: statusFlags}.Encode())
+	}
+
+	return packets
+}
+
+// Size returns the approximate memory used by the result set in bytes.
+func (r ResultSet) Size() int {
+	size := 0
+	for _, column := range r.Columns {
+		size += len(column.Catalog) + len(column.Schema) + len(column.Table) + len(column.OrgTable) + len(column.Name) + len(column.OrgName) + 32
+	}
+	for _, row := range r.Rows {
+		size += 24 * (len(row) + 1)
+		for _, value := range row {
+			size += len(value)
+		}
+	}
+	return size
+}
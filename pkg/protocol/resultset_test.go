@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testResultSet() ResultSet {
+	return ResultSet{
+		Columns: []ColumnDefinition41{NewColumn("id", TypeLongLong), NewColumn("name", TypeVarString)},
+		Rows: []TextRow{
+			{[]byte("1"), []byte("alice")},
+			{[]byte("2"), nil},
+		},
+	}
+}
+
+func TestResultSetEncodeFraming(t *testing.T) {
+	rs := testResultSet()
+	tests := []struct {
+		name         string
+		capabilities CapabilityFlag
+		// headers are the first payload bytes of the expected packets.
+		headers []byte
+	}{
+		{"EOF", ClientProtocol41, []byte{2, 3, 3, EOFHeader, 1, 1, EOFHeader}},
+		{"DEPRECATE_EOF", ClientProtocol41 | ClientDeprecateEOF, []byte{2, 3, 3, 1, 1, EOFHeader}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets := rs.Encode(tt.capabilities, ServerStatusAutocommit)
+			if len(packets) != len(tt.headers) {
+				t.Fatalf("Encode() returned %d packets, want %d", len(packets), len(tt.headers))
+			}
+			for i, p := range packets {
+				if p.SequenceID != uint8(i+1) {
+					t.Errorf("packet %d has sequence ID %d, want %d", i, p.SequenceID, i+1)
+				}
+				if p.Payload[0] != tt.headers[i] {
+					t.Errorf("packet %d starts with 0x%02x, want 0x%02x", i, p.Payload[0], tt.headers[i])
+				}
+			}
+
+			last := packets[len(packets)-1].Payload
+			if tt.capabilities.Has(ClientDeprecateEOF) {
+				var okPacket OKPacket
+				if !IsOKPacket(last, tt.capabilities) || okPacket.Decode(last, tt.capabilities) != nil || okPacket.StatusFlags != ServerStatusAutocommit {
+					t.Errorf("result set ends with %x, want an OK packet with the status flags", last)
+				}
+			} else {
+				var eof EOFPacket
+				if eof.Decode(last) != nil || eof.StatusFlags != ServerStatusAutocommit {
+					t.Errorf("result set ends with %x, want an EOF packet with the status flags", last)
+				}
+			}
+
+			got, err := DecodeResultSet(packets, tt.capabilities)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, rs) {
+				t.Errorf("round trip = %+v, want %+v", *got, rs)
+			}
+		})
+	}
+}
+
+func TestDecodeResultSetRejectsOtherResponses(t *testing.T) {
+	okPacket := &Packet{SequenceID: 1, Payload: OKPacket{}.Encode(ClientProtocol41)}
+	if _, err := DecodeResultSet([]*Packet{okPacket}, ClientProtocol41); err == nil {
+		t.Error("DecodeResultSet() accepted an OK packet")
+	}
+
+	// Packets framed with EOF do not decode as DEPRECATE_EOF framing, and
+	// the other way round.
+	packets := testResultSet().Encode(ClientProtocol41|ClientDeprecateEOF, 0)
+	if _, err := DecodeResultSet(packets, ClientProtocol41); err == nil {
+		t.Error("DecodeResultSet() accepted a result set without the EOF after the columns")
+	}
+}
@@ -0,0 +1,190 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_stmt_execute.html
+
+// ParamType is the type of a prepared statement parameter, with the unsigned
+// flag in the high byte.
+type ParamType uint16
+
+// paramUnsigned is set in the high byte of unsigned parameter types.
+const paramUnsigned = 0x80
+
+/*
+StmtExecute represents a COM_STMT_EXECUTE packet
+*/
+type StmtExecute struct {
+	StatementID    uint32
+	Flags          byte
+	IterationCount uint32
+	// ParamTypes are the types the parameters were bound with.
+	ParamTypes []ParamType
+	// Params are the parameter values: nil, int64, uint64, float64, or []byte
+	// for strings and binary data. Temporal values are formatted as strings.
+	Params []interface{}
+}
+
+// Decode decodes a COM_STMT_EXECUTE payload of a statement with numParams
+// parameters. Clients only send the parameter types when they change, so the
+// types of the previous execution must be passed in.
+func (r *StmtExecute) Decode(payload []byte, numParams int, previousTypes []ParamType) error {
+	if len(payload) < 10 || payload[0] != ComStmtExecute {
+		return errMalformedPacket
+	}
+	r.StatementID = binary.LittleEndian.Uint32(payload[1:5])
+	r.Flags = payload[5]
+	r.IterationCount = binary.LittleEndian.Uint32(payload[6:10])
+	r.ParamTypes = previousTypes
+	r.Params = make([]interface{}, numParams)
+	if numParams == 0 {
+		return nil
+	}
+
+	position := 10
+	bitmapLength := (numParams + 7) / 8
+	if len(payload) < position+bitmapLength+1 {
+		return errMalformedPacket
+	}
+	nullBitmap := payload[position : position+bitmapLength]
+	position += bitmapLength
+
+	newParamsBound := payload[position] == 1
+	position++
+	if newParamsBound {
+		if len(payload) < position+2*numParams {
+			return errMalformedPacket
+		}
+		r.ParamTypes = make([]ParamType, numParams)
+		for i := range r.ParamTypes {
+			r.ParamTypes[i] = ParamType(binary.LittleEndian.Uint16(payload[position : position+2]))
+			position += 2
+		}
+	}
+	if len(r.ParamTypes) != numParams {
+		return fmt.Errorf("parameter types of statement %d are not known", r.StatementID)
+	}
+
+	for i := range r.Params {
+		if nullBitmap[i/8]&(1<<(i%8)) != 0 {
+			continue
+		}
+		value, n, err := decodeBinaryValue(payload[position:], r.ParamTypes[i])
+		if err != nil {
+			return err
+		}
+		r.Params[i] = value
+		position += n
+	}
+
+	return nil
+}
+
+// decodeBinaryValue decodes a binary protocol value of the given type and
+// returns it with its encoded length.
+func decodeBinaryValue(b []byte, paramType ParamType) (interface{}, int, error) {
+	columnType := byte(paramType)
+	unsigned := paramType>>8&paramUnsigned != 0
+
+	fixed := map[byte]int{
+		TypeTiny: 1, TypeShort: 2, TypeYear: 2, TypeLong: 4, TypeInt24: 4,
+		TypeLongLong: 8, TypeFloat: 4, TypeDouble: 8,
+	}
+	if size, ok := fixed[columnType]; ok && len(b) < size {
+		return nil, 0, errMalformedPacket
+	}
+
+	switch columnType {
+	case TypeNull:
+		return nil, 0, nil
+	case TypeTiny:
+		if unsigned {
+			return uint64(b[0]), 1, nil
+		}
+		return int64(int8(b[0])), 1, nil
+	case TypeShort, TypeYear:
+		v := binary.LittleEndian.Uint16(b)
+		if unsigned {
+			return uint64(v), 2, nil
+		}
+		return int64(int16(v)), 2, nil
+	case TypeLong, TypeInt24:
+		v := binary.LittleEndian.Uint32(b)
+		if unsigned {
+			return uint64(v), 4, nil
+		}
+		return int64(int32(v)), 4, nil
+	case TypeLongLong:
+		v := binary.LittleEndian.Uint64(b)
+		if unsigned {
+			return v, 8, nil
+		}
+		return int64(v), 8, nil // #nosec G115 - reinterprets the signed wire value
+	case TypeFloat:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 4, nil
+	case TypeDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), 8, nil
+	case TypeDate, TypeDateTime, TypeTimestamp:
+		return decodeBinaryDateTime(b, columnType == TypeDate)
+	case TypeTime:
+		return decodeBinaryTime(b)
+	}
+
+	value, isNull, n, err := ReadLengthEncodedString(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	if isNull {
+		return nil, n, nil
+	}
+	return append([]byte{}, value...), n, nil
+}
+
+// decodeBinaryDateTime decodes a binary DATE, DATETIME or TIMESTAMP value.
+func decodeBinaryDateTime(b []byte, dateOnly bool) (interface{}, int, error) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, 0, errMalformedPacket
+	}
+	length := int(b[0])
+	var year, month, day, hour, minute, second, micro int
+	if length >= 4 {
+		year = int(binary.LittleEndian.Uint16(b[1:3]))
+		month, day = int(b[3]), int(b[4])
+	}
+	if length >= 7 {
+		hour, minute, second = int(b[5]), int(b[6]), int(b[7])
+	}
+	if length >= 11 {
+		micro = int(binary.LittleEndian.Uint32(b[8:12]))
+	}
+
+	if dateOnly {
+		return []byte(fmt.Sprintf("%04d-%02d-%02d", year, month, day)), 1 + length, nil
+	}
+	return []byte(fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d.%06d", year, month, day, hour, minute, second, micro)), 1 + length, nil
+}
+
+// decodeBinaryTime decodes a binary TIME value.
+func decodeBinaryTime(b []byte) (interface{}, int, error) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, 0, errMalformedPacket
+	}
+	length := int(b[0])
+	sign := ""
+	var days, hours, minutes, seconds, micro int
+	if length >= 8 {
+		if b[1] == 1 {
+			sign = "-"
+		}
+		days = int(binary.LittleEndian.Uint32(b[2:6]))
+		hours, minutes, seconds = int(b[6]), int(b[7]), int(b[8])
+	}
+	if length >= 12 {
+		micro = int(binary.LittleEndian.Uint32(b[9:13]))
+	}
+	return []byte(fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, days*24+hours, minutes, seconds, micro)), 1 + length, nil
+}
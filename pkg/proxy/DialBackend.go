@@ -0,0 +1,14 @@
+package proxy
+
+import (
+	"context"
+	"net"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+)
+
+// DialBackend opens a connection to a MySQL server, using TLS if configured,
+// within the configured connect timeout.
+func DialBackend(address string) (net.Conn, error) {
+	return config.DialBackend(context.Background(), address)
+}
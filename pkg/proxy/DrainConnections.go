@@ -0,0 +1,23 @@
+package proxy
+
+import (
+	"log"
+
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+)
+
+// DrainConnections closes the open client connections that are not running a
+// command and returns their number. Connections running a command are left to
+// end at their next statement boundary. Reason labels the kills in the metrics.
+func DrainConnections(reason string) int {
+	closed := 0
+	for _, c := range Connections() {
+		if c.CurrentActivity().State == models.StateActive {
+			continue
+		}
+		log.Printf("Draining connection [%d]", c.ID)
+		closeConnection(c, reason)
+		closed++
+	}
+	return closed
+}
@@ -1,82 +1,85 @@
 package proxy
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"fmt"
-	"os"
 	"log"
 	"net"
 
-	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/maintenance"
 	"github.com/supporttools/go-sql-proxy/pkg/metrics"
 	"github.com/supporttools/go-sql-proxy/pkg/models"
+	"github.com/supporttools/go-sql-proxy/pkg/pcap"
 )
 
 // HandleConnection starts the proxy connection, handling data transfer and optional protocol decoding.
 func HandleConnection(c *models.Connection) error {
-	address := fmt.Sprintf("%s:%d", c.Host, c.Port)
-	
-	var mysqlConn net.Conn
-	var err error
-	
-	if config.CFG.UseSSL {
-		mysqlConn, err = dialWithSSL(address)
-	} else {
-		mysqlConn, err = net.Dial("tcp", address)
+	meterConnection(c)
+	defer func() {
+		// The connection is already closed if it was killed or rejected.
+		if err := c.Conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Error closing client connection [%d]: %v", c.ID, err)
+		}
+	}()
+	backend := backends.Primary()
+	if backend == nil {
+		backend = backends.Register(c.BackendAddress())
+	}
+	address := backend.Address
+	if m := maintenance.Current(); m.Enabled {
+		return rejectConnection(c, "maintenance_mode", m.ErrorCode, m.SQLState, m.Message)
+	}
+	if state := backend.State(); state != backends.StateActive {
+		return rejectConnection(c, string(state), errServerShutdown, "08S01",
+			fmt.Sprintf("backend %s is not accepting new connections (%s)", address, state))
+	}
+	if backend.Full() {
+		return rejectFull(c, backend)
 	}
-	
+
+	mysqlConn, backend, err := dialSessionBackend(backend)
 	if err != nil {
-		log.Printf("Failed to connect to MySQL [%d]: %s", c.ID, err)
-		return err
+		reason := "backend_unavailable"
+		if errors.Is(err, errCircuitOpen) {
+			reason = "circuit_open"
+		}
+		return rejectConnection(c, reason, errConnHostError, "HY000", "could not connect to backend: "+err.Error())
+	}
+	address = backend.Address
+	if !backend.TryAcquire() {
+		mysqlConn.Close()
+		return rejectFull(c, backend)
 	}
 
+	// Both legs are recorded above TLS, so pcap captures contain plaintext.
+	mysqlConn = pcap.Tap(mysqlConn, c.ID, true)
+	client := pcap.Tap(c.Conn, c.ID, false)
+	defer client.End()
+	c.Conn = client
+	c.SetBackend(address, mysqlConn)
+
 	metrics.IncrementProxyConnections() // Increment metric counter
 
 	defer func() {
 		metrics.DecrementProxyConnections() // Decrement metric counter when connection is closed
-		if err := mysqlConn.Close(); err != nil {
+		// The session may have been moved to another backend.
+		backends.Register(c.BackendAddress()).Release()
+		// The connection is already closed if it was killed.
+		if err := c.BackendConn().Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 			log.Printf("Error closing MySQL connection [%d]: %v", c.ID, err)
 		}
 	}()
 
 	log.Printf("Proxy connection [%d] established to MySQL server at %s", c.ID, address)
 
+	registerConnection(c)
+	defer unregisterConnection(c)
+
 	if !c.EnableDecoding {
+		c.SetActivity(models.StatePassthrough, "")
 		return transferData(c, mysqlConn)
 	}
 
 	return handleProtocolDecoding(c, mysqlConn)
 }
-
-// dialWithSSL creates an SSL/TLS connection to the MySQL server
-func dialWithSSL(address string) (net.Conn, error) {
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: config.CFG.SSLSkipVerify, // #nosec G402 - InsecureSkipVerify is configurable for development environments
-	}
-
-	// Load custom CA if provided
-	if config.CFG.SSLCAFile != "" {
-		caCert, err := os.ReadFile(config.CFG.SSLCAFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read CA file: %w", err)
-		}
-
-		caCertPool := x509.NewCertPool()
-		if !caCertPool.AppendCertsFromPEM(caCert) {
-			return nil, fmt.Errorf("failed to parse CA certificate")
-		}
-		tlsConfig.RootCAs = caCertPool
-	}
-
-	// Load client certificates if provided
-	if config.CFG.SSLCertFile != "" && config.CFG.SSLKeyFile != "" {
-		cert, err := tls.LoadX509KeyPair(config.CFG.SSLCertFile, config.CFG.SSLKeyFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load client certificates: %w", err)
-		}
-		tlsConfig.Certificates = []tls.Certificate{cert}
-	}
-
-	return tls.Dial("tcp", address, tlsConfig)
-}
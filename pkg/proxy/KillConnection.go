@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+)
+
+// KillConnection ends the client connection with the given proxy connection
+// ID: its backend connection is killed on the server and both sides are
+// closed. Reason labels the kill in the metrics.
+func KillConnection(id uint64, reason string) error {
+	c, ok := LookupConnection(id)
+	if !ok {
+		return fmt.Errorf("unknown connection ID %d", id)
+	}
+	closeConnection(c, reason)
+	return nil
+}
+
+// closeConnection kills the backend thread of c, if it is known, and closes
+// both sides of the connection.
+func closeConnection(c *models.Connection, reason string) {
+	if c.BackendThreadID.Load() != 0 {
+		if err := killBackendThread(c, true, reason); err != nil {
+			log.Printf("Failed to kill backend of connection [%d]: %v", c.ID, err)
+		}
+	}
+	if err := c.Conn.Close(); err != nil {
+		log.Printf("Error closing client connection [%d]: %v", c.ID, err)
+	}
+	if server := c.BackendConn(); server != nil {
+		if err := server.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Error closing MySQL connection [%d]: %v", c.ID, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"net"
+	"time"
 
 	"github.com/supporttools/go-sql-proxy/pkg/models"
 )
@@ -14,5 +15,6 @@ func NewConnection(host string, port int, conn net.Conn, id uint64, enableDecodi
 		Conn:           conn,
 		ID:             id,
 		EnableDecoding: enableDecoding,
+		ConnectedAt:    time.Now(),
 	}
 }
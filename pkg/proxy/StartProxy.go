@@ -4,13 +4,20 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
 	"github.com/supporttools/go-sql-proxy/pkg/models"
 )
 
 // StartProxy starts the proxy server listening for incoming connections.
 func StartProxy(p *models.Proxy, port int) error {
 	log.Printf("Start listening on: %d", port)
+	if backends.Primary() == nil {
+		// Backend discovery sets the primary once it resolved the backends.
+		backends.SetPrimary(net.JoinHostPort(p.Host, strconv.Itoa(p.Port)))
+	}
+
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// statementHints are the proxy hints given in the comments of a statement.
+type statementHints struct {
+	// route is "primary" or "replica", or empty.
+	route string
+	// backend is the tag or address of the backends the statement runs on,
+	// or empty.
+	backend string
+	// timeout overrides the statement timeout if it is greater than 0.
+	timeout time.Duration
+}
+
+// applyHints reads the /* proxy:name=value */ hints of a COM_QUERY packet
+// and, with QUERY_HINTS_STRIP, removes their comments from the packet and
+// req. Unknown and invalid hints are logged and ignored. It returns nil if
+// the statement has no hints.
+func (s *session) applyHints(packet *protocol.Packet, req *rules.Request) *statementHints {
+	if !config.CFG.QueryHints {
+		return nil
+	}
+	found, stripped := sqlparse.Hints(req.Query)
+	if found == nil {
+		return nil
+	}
+
+	hints := &statementHints{}
+	for _, h := range found {
+		valid := true
+		switch h.Name {
+		case "route":
+			route := strings.ToLower(h.Value)
+			valid = route == "primary" || route == "replica"
+			if valid {
+				hints.route = route
+			}
+		case "backend":
+			valid = h.Value != ""
+			hints.backend = h.Value
+		case "timeout":
+			timeout, err := time.ParseDuration(h.Value)
+			valid = err == nil && timeout > 0
+			if valid {
+				hints.timeout = timeout
+			}
+		default:
+			log.Printf("Ignoring unknown hint %q of connection [%d]", h.Name, s.conn.ID)
+			metrics.IncrementQueryHints("other", "unknown")
+			continue
+		}
+		if !valid {
+			log.Printf("Ignoring invalid hint %s=%q of connection [%d]", h.Name, h.Value, s.conn.ID)
+			metrics.IncrementQueryHints(h.Name, "invalid")
+		}
+	}
+	if hints.timeout > 0 {
+		metrics.IncrementQueryHints("timeout", "applied")
+	}
+
+	if config.CFG.QueryHintsStrip {
+		s.replaceQuery(packet, req, stripped)
+	}
+	return hints
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rewrite"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+// applyRewrites applies the rewrite rules to a COM_QUERY packet. When the
+// statement changed, the packet and req are updated to the rewritten statement
+// and true is returned.
+func (s *session) applyRewrites(packet *protocol.Packet, req *rules.Request) bool {
+	if !rewrite.Enabled() {
+		return false
+	}
+
+	query, changed := rewrite.Apply(req)
+	if !changed {
+		return false
+	}
+
+	s.replaceQuery(packet, req, query)
+	return true
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/gtid"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+)
+
+// awaitGTIDs returns true if the replica behind link has executed the
+// session's writes, as known from the link or the replica's cached
+// gtid_executed, or once it executed them within READ_YOUR_WRITES_WAIT. It
+// returns false if the read has to run on the primary instead.
+func (s *session) awaitGTIDs(link *backendLink) (bool, error) {
+	if !config.CFG.ReadYourWrites || len(s.gtids) == 0 {
+		return true, nil
+	}
+	if s.caughtUp(link.backend) {
+		link.gtidVersion = s.gtidVersion
+		metrics.IncrementReadYourWrites("caught_up")
+		return true, nil
+	}
+	if config.CFG.ReadYourWritesWait <= 0 {
+		metrics.IncrementReadYourWrites("primary")
+		return false, nil
+	}
+
+	// WAIT_FOR_EXECUTED_GTID_SET returns 0 once the GTIDs were executed and
+	// 1 on timeout.
+	query := fmt.Sprintf("SELECT WAIT_FOR_EXECUTED_GTID_SET('%s', %s)", s.gtids, strconv.FormatFloat(config.CFG.ReadYourWritesWait.Seconds(), 'f', -1, 64))
+	value, err := queryBackend(link.conn, link.in, s.conn.Capabilities, query)
+	if err != nil {
+		return false, err
+	}
+	if string(value) != "0" {
+		metrics.IncrementReadYourWrites("primary")
+		return false, nil
+	}
+	link.gtidVersion = s.gtidVersion
+	metrics.IncrementReadYourWrites("waited")
+	return true, nil
+}
+
+// caughtUp returns true if replica is known to have executed the session's
+// writes.
+func (s *session) caughtUp(replica *backends.Backend) bool {
+	if !config.CFG.ReadYourWrites || len(s.gtids) == 0 {
+		return true
+	}
+	if link, ok := s.links[replica]; ok && link.gtidVersion == s.gtidVersion {
+		return true
+	}
+	return replica.ExecutedGTIDs().Contains(s.gtids)
+}
+
+// fetchGTIDs reads gtid_executed of the session's own backend after it wrote
+// without GTID tracking. Reads then wait for all transactions the backend
+// committed, which include the session's.
+func (s *session) fetchGTIDs() error {
+	value, err := queryBackend(s.server, s.serverIn, s.conn.Capabilities, "SELECT @@GLOBAL.gtid_executed")
+	if err != nil {
+		return err
+	}
+	set, err := gtid.Parse(string(value))
+	if err != nil {
+		return err
+	}
+	if s.gtids == nil {
+		s.gtids = make(gtid.Set)
+	}
+	s.gtids.Add(set)
+	s.gtidVersion++
+	s.wrote = false
+	return nil
+}
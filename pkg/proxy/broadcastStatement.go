@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// broadcastStatement runs a COM_QUERY statement without a shard key on a
+// backend of every shard and answers the client with the combined response:
+// the first error, an OK packet adding up the rows all shards affected, or
+// the rows of all shards in one result set. All shards must be reachable
+// before the statement is sent to any of them.
+func (s *session) broadcastStatement(packet *protocol.Packet, shards []string) error {
+	type shardConn struct {
+		backend *backends.Backend
+		conn    net.Conn
+		in      *bufio.Reader
+		home    bool
+	}
+
+	home := backends.Register(s.conn.BackendAddress())
+	conns := make([]shardConn, 0, len(shards))
+	for _, shard := range shards {
+		if home.Tagged(shard) {
+			conns = append(conns, shardConn{backend: home, conn: s.server, in: s.serverIn, home: true})
+			continue
+		}
+		target := backends.PickTagged(shard)
+		if target == nil {
+			_, err := s.rejectShard(shard, fmt.Sprintf("no backend of shard %s is available", shard))
+			return err
+		}
+		link, err := s.readLink(target)
+		if err != nil {
+			_, err := s.rejectShard(shard, fmt.Sprintf("could not connect to shard %s: %v", shard, err))
+			return err
+		}
+		conns = append(conns, shardConn{backend: target, conn: link.conn, in: link.in})
+	}
+
+	responses := make([][]*protocol.Packet, 0, len(conns))
+	var failed error
+	for _, c := range conns {
+		response, err := runStatement(c.conn, c.in, s.conn.Capabilities, packet.Payload)
+		switch {
+		case err != nil && c.home:
+			return err
+		case err != nil:
+			s.closeLink(c.backend)
+			failed = errors.Join(failed, fmt.Errorf("%s: %w", c.backend.Address, err))
+		default:
+			responses = append(responses, response)
+		}
+	}
+	if failed != nil {
+		_, err := s.rejectShard("", "statement failed on some shards: "+failed.Error())
+		return err
+	}
+
+	merged, err := mergeResponses(responses, s.conn.Capabilities)
+	if err != nil {
+		return err
+	}
+	seq := uint8(1)
+	for _, p := range merged {
+		p.SequenceID = seq
+		if err := s.writeClient(p); err != nil {
+			return err
+		}
+		seq = p.NextSequenceID()
+	}
+	metrics.IncrementShardStatements("", "broadcast")
+	return s.flushClient()
+}
+
+// runStatement sends a command to an idle backend connection read through
+// in and returns the packets of its response: an OK or ERR packet, or a
+// result set ending with its terminating packet or an ERR packet.
+func runStatement(conn net.Conn, in *bufio.Reader, capabilities protocol.CapabilityFlag, payload []byte) ([]*protocol.Packet, error) {
+	if err := protocol.WritePacket(conn, 0, payload); err != nil {
+		return nil, err
+	}
+	first, err := protocol.ReadPacket(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(first.Payload) == 0 {
+		return nil, errors.New("received empty response")
+	}
+	switch first.Payload[0] {
+	case protocol.ERRHeader, protocol.OKHeader:
+		return []*protocol.Packet{first}, nil
+	case protocol.LocalInfileHeader:
+		return nil, errors.New("LOAD DATA LOCAL INFILE is not supported")
+	}
+
+	columns, _, _, err := protocol.ReadLengthEncodedInt(first.Payload)
+	if err != nil {
+		return nil, err
+	}
+	packets := []*protocol.Packet{first}
+	definitions := int(columns)
+	if !capabilities.Has(protocol.ClientDeprecateEOF) {
+		definitions++
+	}
+	for i := 0; i < definitions; i++ {
+		p, err := protocol.ReadPacket(in)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, p)
+	}
+	for {
+		p, err := protocol.ReadPacket(in)
+		if err != nil {
+			return nil, err
+		}
+		if len(p.Payload) == 0 {
+			return nil, errors.New("received empty row")
+		}
+		packets = append(packets, p)
+		if p.Payload[0] == protocol.ERRHeader || protocol.IsEOFPacket(p.Payload) ||
+			(p.Payload[0] == protocol.EOFHeader && protocol.IsOKPacket(p.Payload, capabilities)) {
+			return packets, nil
+		}
+	}
+}
+
+// mergeResponses combines the responses of shards to the same statement, as
+// returned by runStatement.
+func mergeResponses(responses [][]*protocol.Packet, capabilities protocol.CapabilityFlag) ([]*protocol.Packet, error) {
+	for _, response := range responses {
+		if last := response[len(response)-1]; last.Payload[0] == protocol.ERRHeader {
+			return []*protocol.Packet{last}, nil
+		}
+	}
+
+	first := responses[0]
+	if first[0].Payload[0] == protocol.OKHeader {
+		total := protocol.OKPacket{Header: protocol.OKHeader}
+		for i, response := range responses {
+			ok := &protocol.OKPacket{}
+			if err := ok.Decode(response[0].Payload, capabilities); err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				total.StatusFlags = ok.StatusFlags
+			}
+			total.AffectedRows += ok.AffectedRows
+			total.Warnings += ok.Warnings
+			if total.LastInsertID == 0 {
+				total.LastInsertID = ok.LastInsertID
+			}
+		}
+		return []*protocol.Packet{{Payload: total.Encode(capabilities)}}, nil
+	}
+
+	columns, _, _, err := protocol.ReadLengthEncodedInt(first[0].Payload)
+	if err != nil {
+		return nil, err
+	}
+	header := 1 + int(columns)
+	if !capabilities.Has(protocol.ClientDeprecateEOF) {
+		header++
+	}
+	merged := append([]*protocol.Packet{}, first[:header]...)
+	for _, response := range responses {
+		if len(response) <= header || response[0].Payload[0] == protocol.OKHeader {
+			return nil, errUnexpectedPacket
+		}
+		merged = append(merged, response[header:len(response)-1]...)
+	}
+	last := responses[len(responses)-1]
+	return append(merged, last[len(last)-1]), nil
+}
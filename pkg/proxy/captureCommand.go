@@ -0,0 +1,25 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/capture"
+)
+
+// captureCommand records a command forwarded to the backend in the capture
+// file, with the time it was received and how long its response took.
+func (s *session) captureCommand(received time.Time, payload []byte, latency time.Duration, r *response) {
+	if !capture.Enabled() {
+		return
+	}
+
+	record := &capture.Record{Payload: payload, Latency: latency}
+	if r != nil {
+		if r.err != nil {
+			record.ErrorCode = r.err.Code
+		}
+		record.StatementID = r.statementID
+		record.Params = r.params
+	}
+	capture.Command(s.conn.ID, received, record)
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+)
+
+// probeTimeout bounds the read probing an idle backend connection. Reads whose
+// deadline already passed fail without reading, so it cannot be zero.
+const probeTimeout = 100 * time.Microsecond
+
+// probeIdle is how long a backend connection must have been idle before it is
+// probed. Connections used more recently are assumed to be open, so busy
+// sessions do not pay for a probe on every command.
+const probeIdle = time.Second
+
+// checkBackend runs at a statement boundary, before a command is forwarded.
+// If the idle backend connection was lost, such as by a backend restart, the
+// session is reconnected so the client does not notice. Sessions that cannot
+// be reconnected are answered with an error and end. Connections are only
+// probed after probeIdle, and not at all when reconnecting is disabled.
+func (s *session) checkBackend() error {
+	if config.CFG.ReconnectTimeout <= 0 || time.Since(s.idleSince) < probeIdle || !s.backendLost() {
+		return nil
+	}
+
+	previous := s.conn.BackendAddress()
+	log.Printf("Backend connection [%d] to %s was lost, reconnecting", s.conn.ID, previous)
+	if err := s.reconnectBackend(); err != nil {
+		metrics.IncrementBackendReconnects("forced")
+		log.Printf("Failed to reconnect connection [%d]: %v", s.conn.ID, err)
+		if writeErr := s.writeError(1, errServerShutdown, "08S01",
+			fmt.Sprintf("connection to backend %s was lost and the session could not be restored: %v", previous, err)); writeErr != nil {
+			return writeErr
+		}
+		return fmt.Errorf("session could not be reconnected: %w", err)
+	}
+	metrics.IncrementBackendReconnects("transparent")
+	log.Printf("Reconnected connection [%d] to %s", s.conn.ID, s.conn.BackendAddress())
+	return nil
+}
+
+// backendLost returns true if the idle backend connection was closed or sent
+// an unsolicited packet, such as the error a server sends when shutting down.
+func (s *session) backendLost() bool {
+	return connLost(s.server, s.serverIn)
+}
+
+// connLost returns true if conn, an idle backend connection read through in,
+// was closed or sent an unsolicited packet.
+func connLost(conn net.Conn, in *bufio.Reader) bool {
+	if in.Buffered() > 0 {
+		return true
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(probeTimeout)); err != nil {
+		return true
+	}
+	_, err := in.Peek(1)
+	if deadlineErr := conn.SetReadDeadline(time.Time{}); deadlineErr != nil {
+		return true
+	}
+
+	var netErr net.Error
+	return !errors.As(err, &netErr) || !netErr.Timeout()
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"encoding/binary"
+
+	"github.com/supporttools/go-sql-proxy/pkg/firewall"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// newRequest describes a statement of the session for rule evaluation.
+func (s *session) newRequest(query string) *rules.Request {
+	return &rules.Request{
+		User:          s.conn.User,
+		ClientIP:      s.conn.ClientIP(),
+		Schema:        s.conn.Schema,
+		Query:         query,
+		Digest:        sqlparse.Digest(query),
+		StatementType: sqlparse.StatementType(query),
+	}
+}
+
+// checkFirewall evaluates a statement against the firewall rules and answers
+// denied statements with an ERR packet. It returns true if the statement was denied.
+func (s *session) checkFirewall(req *rules.Request) (bool, error) {
+	if !firewall.Enabled() {
+		return false, nil
+	}
+
+	decision := firewall.Evaluate(req)
+	if decision.Action != firewall.ActionDeny {
+		return false, nil
+	}
+
+	return true, s.writeError(1, decision.ErrorCode, decision.SQLState, decision.ErrorMessage)
+}
+
+// errNotSupportedYet is ER_NOT_SUPPORTED_YET, answered to clients enabling
+// multi-statement queries while the firewall is active.
+const errNotSupportedYet uint16 = 1235
+
+// optionMultiStatementsOn is the COM_SET_OPTION option enabling
+// multi-statement queries.
+const optionMultiStatementsOn uint16 = 0
+
+// checkSetOption answers COM_SET_OPTION enabling multi-statement queries with
+// an error while the firewall is active, which hides the capability from
+// clients. It returns true if the command was answered.
+func (s *session) checkSetOption(payload []byte) (bool, error) {
+	if !firewall.Enabled() || len(payload) < 3 || binary.LittleEndian.Uint16(payload[1:3]) != optionMultiStatementsOn {
+		return false, nil
+	}
+	return true, s.writeError(1, errNotSupportedYet, "42000", "Multi-statement queries are not allowed by the proxy firewall")
+}
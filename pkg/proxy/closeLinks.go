@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+	"net"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// closeLinks relays the session to its own backend connection again and
+// closes all of its links.
+func (s *session) closeLinks() {
+	s.leaveLink()
+	for backend := range s.links {
+		s.closeLink(backend)
+	}
+	s.reader = nil
+}
+
+// closeLink closes the session's link to backend, if it has one.
+func (s *session) closeLink(backend *backends.Backend) {
+	link, ok := s.links[backend]
+	if !ok {
+		return
+	}
+	delete(s.links, backend)
+	for _, stmt := range s.statements {
+		delete(stmt.links, link)
+	}
+	// Let the backend end the connection cleanly.
+	if err := protocol.WritePacket(link.conn, 0, []byte{protocol.ComQuit}); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Failed to quit link [%d] to %s: %v", s.conn.ID, backend.Address, err)
+	}
+	if err := link.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Error closing link [%d] to %s: %v", s.conn.ID, backend.Address, err)
+	}
+	backend.Release()
+}
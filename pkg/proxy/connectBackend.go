@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/credentials"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// connectTimeout bounds connecting and authenticating to a backend a session
+// is moved to.
+const connectTimeout = 10 * time.Second
+
+// connectBackend opens a backend connection at address for the session,
+// authenticated as its user with the password from the backend users file
+// and with its current schema and replayed SET statements. It returns the connection and the
+// server's handshake.
+func (s *session) connectBackend(address string) (net.Conn, *protocol.InitialHandshakePacket, error) {
+	user, schema := s.conn.Identity()
+	password, ok := credentials.Password(user)
+	if !ok {
+		return nil, nil, fmt.Errorf("no backend password for user %q", user)
+	}
+
+	conn, err := DialBackend(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(connectTimeout)); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	handshake := &protocol.InitialHandshakePacket{}
+	if err := handshake.Decode(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if err := authenticateBackend(conn, s.handshakeResponse(handshake, user, schema), password, handshake.AuthPluginData); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if err := s.replaySession(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, handshake, nil
+}
+
+// handshakeResponse returns the handshake response opening a backend
+// connection for the session: the one the client sent, with the session's
+// current user and schema.
+func (s *session) handshakeResponse(handshake *protocol.InitialHandshakePacket, user, schema string) *protocol.HandshakeResponse41 {
+	response := *s.handshake
+	response.Username = user
+	response.Database = schema
+	response.AuthPluginName = string(handshake.AuthPluginName)
+	// The authentication capabilities do not change how the command phase is
+	// framed, so they can differ from what the client negotiated.
+	response.CapabilityFlags |= protocol.ClientPluginAuth | protocol.ClientSecureConn
+	if schema != "" {
+		response.CapabilityFlags |= protocol.ClientConnectWithDB
+	}
+	return &response
+}
+
+// authenticateBackend sends response and answers the authentication exchange
+// on conn with password, until the server accepts or rejects it.
+func authenticateBackend(conn net.Conn, response *protocol.HandshakeResponse41, password string, scramble []byte) error {
+	in := bufio.NewReader(conn)
+	method := response.AuthPluginName
+	scramble = trimScramble(scramble)
+
+	authResponse, err := protocol.Scramble(method, password, scramble)
+	if err != nil {
+		return err
+	}
+	response.AuthResponse = authResponse
+
+	seq := uint8(1)
+	payload := response.Encode()
+	for {
+		if err := protocol.WritePacket(conn, seq, payload); err != nil {
+			return err
+		}
+		packet, err := protocol.ReadPacket(in)
+		if err != nil {
+			return err
+		}
+		seq = packet.NextSequenceID()
+
+		for len(packet.Payload) == 2 && packet.Payload[0] == protocol.AuthMoreDataHeader && packet.Payload[1] == protocol.CachingSHA2FastAuthOK {
+			// The OK packet follows a successful fast authentication.
+			if packet, err = protocol.ReadPacket(in); err != nil {
+				return err
+			}
+			seq = packet.NextSequenceID()
+		}
+		if len(packet.Payload) == 0 {
+			return errors.New("received empty authentication packet")
+		}
+
+		switch packet.Payload[0] {
+		case protocol.OKHeader:
+			return nil
+		case protocol.ERRHeader:
+			errPacket := &protocol.ERRPacket{}
+			if err := errPacket.Decode(packet.Payload); err != nil {
+				return err
+			}
+			return errPacket
+		case protocol.EOFHeader:
+			authSwitch := &protocol.AuthSwitchRequest{}
+			if err := authSwitch.Decode(packet.Payload); err != nil {
+				return err
+			}
+			method, scramble = authSwitch.PluginName, trimScramble(authSwitch.PluginData)
+			if payload, err = protocol.Scramble(method, password, scramble); err != nil {
+				return err
+			}
+		case protocol.AuthMoreDataHeader:
+			switch {
+			case len(packet.Payload) == 2 && packet.Payload[1] == protocol.CachingSHA2FullAuth && config.CFG.UseSSL:
+				payload = append([]byte(password), 0)
+			case len(packet.Payload) == 2 && packet.Payload[1] == protocol.CachingSHA2FullAuth:
+				payload = []byte{protocol.CachingSHA2PublicKeyRead}
+			default:
+				// The server's public key, requested for full authentication.
+				if payload, err = protocol.EncryptPassword(password, scramble, packet.Payload[1:]); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unexpected authentication packet 0x%02x", packet.Payload[0])
+		}
+	}
+}
+
+// trimScramble returns the 20 byte scramble of a handshake or auth switch
+// request, without the NUL byte servers append.
+func trimScramble(scramble []byte) []byte {
+	if len(scramble) > 20 {
+		return scramble[:20]
+	}
+	return scramble
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+)
+
+// errConnHostError is CR_CONN_HOST_ERROR, the error clients report when the
+// server cannot be reached, answered when no backend could be connected to.
+const errConnHostError uint16 = 2003
+
+// errCircuitOpen is returned by dialSessionBackend when no connection was
+// attempted because the circuit breakers of all backends are open.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// dialSessionBackend opens the backend connection of a new session to
+// backend, or to one of the fallback backends if it cannot be reached, and
+// returns the backend connected to. Each round tries backend and then the
+// configured and discovered fallbacks that accept sessions, are not full and
+// whose circuit breakers allow it; failed rounds are
+// retried BACKEND_CONNECT_RETRIES times after an exponential backoff with
+// jitter.
+func dialSessionBackend(backend *backends.Backend) (net.Conn, *backends.Backend, error) {
+	candidates := []*backends.Backend{backend}
+	for _, address := range strings.Split(config.CFG.BackendFallbacks, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			candidates = appendCandidate(candidates, backends.Register(address))
+		}
+	}
+	for _, b := range backends.Discovered() {
+		candidates = appendCandidate(candidates, b)
+	}
+
+	var previous []string
+	for attempt := 0; ; attempt++ {
+		var failures []string
+		dialed := false
+		for i, b := range candidates {
+			if i > 0 && (!b.Accepting() || b.Full()) {
+				continue
+			}
+			if !b.Allow() {
+				failures = append(failures, b.Address+": "+errCircuitOpen.Error())
+				continue
+			}
+
+			dialed = true
+			conn, err := DialBackend(b.Address)
+			if err == nil {
+				b.ReportSuccess()
+				return conn, b, nil
+			}
+			b.ReportFailure()
+			log.Printf("Failed to connect to backend %s: %v", b.Address, err)
+			failures = append(failures, err.Error())
+		}
+
+		switch {
+		case !dialed && previous != nil:
+			// The previous round opened the remaining circuit breakers.
+			return nil, nil, errors.New(strings.Join(previous, "; "))
+		case !dialed:
+			// Fail fast until a circuit breaker half-opens.
+			return nil, nil, fmt.Errorf("%w for %s", errCircuitOpen, describeCandidates(candidates))
+		}
+		if attempt >= config.CFG.BackendConnectRetries {
+			return nil, nil, errors.New(strings.Join(failures, "; "))
+		}
+		previous = failures
+		time.Sleep(retryBackoff(attempt))
+	}
+}
+
+// appendCandidate appends b to candidates unless it is already included.
+func appendCandidate(candidates []*backends.Backend, b *backends.Backend) []*backends.Backend {
+	if slices.Contains(candidates, b) {
+		return candidates
+	}
+	return append(candidates, b)
+}
+
+// retryBackoff returns the delay before retry attempt+1: BACKEND_RETRY_BACKOFF
+// doubled for each previous attempt, at most BACKEND_RETRY_MAX_BACKOFF, of
+// which a random half is waited so that clients do not retry in lockstep.
+func retryBackoff(attempt int) time.Duration {
+	backoff := config.CFG.BackendRetryBackoff
+	for i := 0; i < attempt && backoff < config.CFG.BackendRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, config.CFG.BackendRetryMaxBackoff)
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// describeCandidates returns the addresses of backends as a list.
+func describeCandidates(candidates []*backends.Backend) string {
+	addresses := make([]string, len(candidates))
+	for i, b := range candidates {
+		addresses[i] = b.Address
+	}
+	return strings.Join(addresses, ", ")
+}
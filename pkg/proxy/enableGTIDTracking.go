@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/gtid"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// trackGTIDsStatement makes the backend report the GTID of each transaction
+// the session commits in the session state changes of the OK packet.
+const trackGTIDsStatement = "SET SESSION session_track_gtids = OWN_GTID"
+
+// enableGTIDTracking enables read-your-writes GTID tracking on the session's
+// backend connection if READ_YOUR_WRITES is set and the client negotiated
+// CLIENT_SESSION_TRACK, so OK packets carry session state changes. The
+// statement is replayed when the session moves. Backends that refuse it
+// leave GTIDs untracked, and gtid_executed is read after writes instead.
+func (s *session) enableGTIDTracking() error {
+	s.trackingGTIDs = false
+	if !config.CFG.ReadWriteSplit || !config.CFG.ReadYourWrites || !s.conn.Capabilities.Has(protocol.ClientSessionTrack) {
+		return nil
+	}
+
+	err := execBackend(s.server, s.serverIn, append([]byte{protocol.ComQuery}, trackGTIDsStatement...))
+	var errPacket *protocol.ERRPacket
+	switch {
+	case errors.As(err, &errPacket):
+		log.Printf("GTIDs of connection [%d] are not tracked: %v", s.conn.ID, err)
+		return nil
+	case err != nil:
+		return err
+	}
+	s.replay = append(s.replay, setStatement{query: trackGTIDsStatement, names: []string{"session_track_gtids"}})
+	s.replayVersion++
+	s.trackingGTIDs = true
+	return nil
+}
+
+// trackWrites records the GTIDs committed by a statement the session ran on
+// its own backend, or, if GTIDs are not tracked, that it wrote.
+func (s *session) trackWrites(cmd byte, req *rules.Request, r *response) {
+	if !config.CFG.ReadWriteSplit || !config.CFG.ReadYourWrites {
+		return
+	}
+	for _, text := range r.gtids {
+		set, err := gtid.Parse(text)
+		if err != nil {
+			log.Printf("Failed to parse GTIDs of connection [%d]: %v", s.conn.ID, err)
+			s.wrote = true
+			continue
+		}
+		if s.gtids == nil {
+			s.gtids = make(gtid.Set)
+		}
+		s.gtids.Add(set)
+		s.gtidVersion++
+	}
+
+	if s.trackingGTIDs || req == nil || (cmd != protocol.ComQuery && cmd != protocol.ComStmtExecute) {
+		return
+	}
+	switch sqlparse.StatementType(req.Query) {
+	case "SET", "USE", "SHOW", "DESCRIBE", "DESC", "EXPLAIN", "HELP":
+		return
+	}
+	if !sqlparse.ReadOnly(req.Query) {
+		s.wrote = true
+	}
+}
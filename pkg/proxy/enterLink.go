@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+)
+
+// homeConn is the session's own backend connection, kept while a read runs
+// on a link.
+type homeConn struct {
+	address  string
+	conn     net.Conn
+	in       *bufio.Reader
+	threadID uint32
+}
+
+// enterLink relays the session to link until leaveLink is called, so the next
+// command and its response, statement timeouts and kills use the link's
+// backend connection.
+func (s *session) enterLink(link *backendLink) {
+	s.home = &homeConn{
+		address:  s.conn.BackendAddress(),
+		conn:     s.server,
+		in:       s.serverIn,
+		threadID: s.conn.BackendThreadID.Load(),
+	}
+	s.server, s.serverIn = link.conn, link.in
+	s.conn.SetBackend(link.backend.Address, link.conn)
+	s.conn.BackendThreadID.Store(link.threadID)
+}
+
+// leaveLink relays the session to its own backend connection again after
+// enterLink.
+func (s *session) leaveLink() {
+	if s.home == nil {
+		return
+	}
+	s.server, s.serverIn = s.home.conn, s.home.in
+	s.conn.SetBackend(s.home.address, s.home.conn)
+	s.conn.BackendThreadID.Store(s.home.threadID)
+	s.home = nil
+}
@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// response summarizes a server response relayed to the client.
+type response struct {
+	statusFlags uint16
+	hasStatus   bool
+	statementID uint32
+	params      uint16
+	ok          *protocol.OKPacket
+	err         *protocol.ERRPacket
+	// gtids are the GTID sets of transactions the response committed, as
+	// reported in the session state changes of its OK packets.
+	gtids []string
+}
+
+// setOK records the OK packet that completed the response.
+func (r *response) setOK(payload []byte, capabilities protocol.CapabilityFlag) error {
+	ok := &protocol.OKPacket{}
+	if err := ok.Decode(payload, capabilities); err != nil {
+		return err
+	}
+	r.ok = ok
+	r.statusFlags = ok.StatusFlags
+	r.hasStatus = true
+	if gtids, found := ok.GTIDs(); found {
+		r.gtids = append(r.gtids, gtids)
+	}
+	return nil
+}
+
+// setErr records the ERR packet that completed the response.
+func (r *response) setErr(payload []byte) error {
+	errPacket := &protocol.ERRPacket{}
+	if err := errPacket.Decode(payload); err != nil {
+		return err
+	}
+	r.err = errPacket
+	return nil
+}
+
+// setEOF records the status flags of an EOF packet.
+func (r *response) setEOF(payload []byte) error {
+	eof := &protocol.EOFPacket{}
+	if err := eof.Decode(payload); err != nil {
+		return err
+	}
+	r.statusFlags = eof.StatusFlags
+	r.hasStatus = true
+	return nil
+}
+
+// errUnexpectedPacket is returned when the server sends a packet the response state does not allow.
+var errUnexpectedPacket = errors.New("unexpected packet in server response")
+
+// forwardResponse relays the server's response to command cmd to the client
+// and returns once the response is complete.
+func (s *session) forwardResponse(cmd byte) (*response, error) {
+	r := &response{}
+
+	var err error
+	switch cmd {
+	case protocol.ComQuery, protocol.ComStmtExecute, protocol.ComProcessInfo:
+		err = s.forwardResultSets(r)
+	case protocol.ComStmtPrepare:
+		err = s.forwardPrepare(r)
+	case protocol.ComFieldList, protocol.ComStmtFetch:
+		err = s.forwardRows(r)
+	case protocol.ComStatistics:
+		_, err = s.relayServerPacket()
+	case protocol.ComChangeUser:
+		err = s.relayAuthExchange(r)
+	default:
+		err = s.forwardGeneric(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The backend thread is idle now; a timeout must not kill it anymore.
+	if s.timeout != nil {
+		s.timeout.finish()
+	}
+
+	return r, s.flushClient()
+}
+
+// forwardGeneric relays a response consisting of a single OK, ERR or EOF packet.
+func (s *session) forwardGeneric(r *response) error {
+	p, err := s.relayServerPacket()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case p.Payload[0] == protocol.ERRHeader:
+		return r.setErr(p.Payload)
+	case p.Payload[0] == protocol.OKHeader:
+		return r.setOK(p.Payload, s.conn.Capabilities)
+	case protocol.IsEOFPacket(p.Payload):
+		return r.setEOF(p.Payload)
+	}
+	return nil
+}
+
+// forwardResultSets relays the response to a statement, which is made of
+// one or more OK packets or result sets.
+func (s *session) forwardResultSets(r *response) error {
+	deprecateEOF := s.conn.Capabilities.Has(protocol.ClientDeprecateEOF)
+
+	for {
+		p, err := s.relayServerPacket()
+		if err != nil {
+			return err
+		}
+
+		switch p.Payload[0] {
+		case protocol.ERRHeader:
+			return r.setErr(p.Payload)
+		case protocol.OKHeader:
+			if err := r.setOK(p.Payload, s.conn.Capabilities); err != nil {
+				return err
+			}
+		case protocol.LocalInfileHeader:
+			if err := s.forwardLocalInfile(); err != nil {
+				return err
+			}
+			continue
+		default:
+			columns, _, _, err := protocol.ReadLengthEncodedInt(p.Payload)
+			if err != nil {
+				return err
+			}
+			for i := uint64(0); i < columns; i++ {
+				if _, err := s.relayServerPacket(); err != nil {
+					return err
+				}
+			}
+
+			if !deprecateEOF {
+				eof, err := s.relayServerPacket()
+				if err != nil {
+					return err
+				}
+				if err := r.setEOF(eof.Payload); err != nil {
+					return err
+				}
+				// A cursor was opened, rows are fetched with COM_STMT_FETCH.
+				if r.statusFlags&protocol.ServerStatusCursorExists != 0 {
+					return nil
+				}
+			}
+
+			if err := s.forwardRows(r); err != nil {
+				return err
+			}
+			if r.err != nil {
+				return nil
+			}
+		}
+
+		if r.statusFlags&protocol.ServerMoreResultsExists == 0 {
+			return nil
+		}
+	}
+}
+
+// forwardRows relays rows until the packet terminating them.
+func (s *session) forwardRows(r *response) error {
+	for {
+		if err := s.dropMidResult(); err != nil {
+			return err
+		}
+		p, err := s.relayServerPacket()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case p.Payload[0] == protocol.ERRHeader:
+			return r.setErr(p.Payload)
+		case p.Payload[0] == protocol.EOFHeader && protocol.IsOKPacket(p.Payload, s.conn.Capabilities):
+			return r.setOK(p.Payload, s.conn.Capabilities)
+		case protocol.IsEOFPacket(p.Payload):
+			return r.setEOF(p.Payload)
+		}
+		s.faultRows++
+	}
+}
+
+// forwardPrepare relays the response to COM_STMT_PREPARE.
+func (s *session) forwardPrepare(r *response) error {
+	p, err := s.relayServerPacket()
+	if err != nil {
+		return err
+	}
+
+	switch p.Payload[0] {
+	case protocol.ERRHeader:
+		return r.setErr(p.Payload)
+	case protocol.OKHeader:
+	default:
+		return errUnexpectedPacket
+	}
+	if len(p.Payload) < 9 {
+		return errUnexpectedPacket
+	}
+
+	r.statementID = binary.LittleEndian.Uint32(p.Payload[1:5])
+	columns := int(binary.LittleEndian.Uint16(p.Payload[5:7]))
+	r.params = binary.LittleEndian.Uint16(p.Payload[7:9])
+	params := int(r.params)
+	for _, n := range []int{params, columns} {
+		if n == 0 {
+			continue
+		}
+		if !s.conn.Capabilities.Has(protocol.ClientDeprecateEOF) {
+			n++
+		}
+		for i := 0; i < n; i++ {
+			if _, err := s.relayServerPacket(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// forwardLocalInfile relays the file contents a client sends for LOAD DATA LOCAL INFILE,
+// which ends with an empty packet.
+func (s *session) forwardLocalInfile() error {
+	s.stopClientWatch()
+	if err := s.flushClient(); err != nil {
+		return err
+	}
+
+	for {
+		p, err := s.readClient()
+		if err != nil {
+			return err
+		}
+		if err := s.writeServer(p); err != nil {
+			return err
+		}
+		if len(p.Payload) == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/canary"
+	"github.com/supporttools/go-sql-proxy/pkg/capture"
+	"github.com/supporttools/go-sql-proxy/pkg/digests"
+	"github.com/supporttools/go-sql-proxy/pkg/maintenance"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/shadow"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// handleCommands runs the command phase of a decoded session. Each client
+// command is inspected before it is forwarded, and its response is relayed
+// back to the client packet by packet.
+func (s *session) handleCommands() error {
+	if shadow.Enabled() {
+		s.shadow = shadow.NewSession(s.conn.Schema)
+		defer s.shadow.Close()
+	}
+	if capture.Enabled() {
+		clientIP := ""
+		if ip := s.conn.ClientIP(); ip != nil {
+			clientIP = ip.String()
+		}
+		capture.SessionStart(s.conn.ID, s.conn.User, s.conn.Schema, clientIP)
+		defer capture.SessionEnd(s.conn.ID)
+	}
+	if primary := backends.Primary(); primary != nil && primary.Address == s.conn.BackendAddress() {
+		s.primary = primary
+	}
+	defer s.closeLinks()
+	if err := s.enableGTIDTracking(); err != nil {
+		return err
+	}
+
+	for {
+		s.conn.SetActivity(models.StateIdle, "")
+		s.idleSince = time.Now()
+		packet, err := s.readClient()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if len(packet.Payload) == 0 {
+			return errors.New("received empty command packet")
+		}
+		received := time.Now()
+
+		cmd := packet.Payload[0]
+		if cmd != protocol.ComQuit && maintenance.Draining() {
+			// Draining sessions end at the next statement boundary.
+			m := maintenance.Current()
+			log.Printf("Closing connection [%d] for maintenance", s.conn.ID)
+			return s.writeError(1, m.ErrorCode, m.SQLState, m.Message)
+		}
+		if cmd != protocol.ComQuit {
+			answered, err := s.holdCommand()
+			if err != nil {
+				return err
+			}
+			if answered {
+				continue
+			}
+			if err := s.checkBackend(); err != nil {
+				return err
+			}
+		}
+		switch cmd {
+		case protocol.ComQuit:
+			return s.writeServer(packet)
+		case protocol.ComBinlogDump, protocol.ComBinlogDumpGTID:
+			// Replication streams are not request/response based.
+			if err := s.writeServer(packet); err != nil {
+				return err
+			}
+			return s.passthrough()
+		}
+
+		var query string
+		var req *rules.Request
+		var hints *statementHints
+		switch cmd {
+		case protocol.ComQuery, protocol.ComStmtPrepare:
+			query = string(packet.Payload[1:])
+			req = s.newRequest(query)
+			if cmd == protocol.ComQuery {
+				hints = s.applyHints(packet, req)
+				s.applyRewrites(packet, req)
+			}
+			// The firewall checks the statement as it will be forwarded.
+			denied, err := s.checkFirewall(req)
+			if err != nil {
+				return err
+			}
+			if denied {
+				continue
+			}
+
+			answered, err := s.translateConnectionIDs(packet, req)
+			if err != nil {
+				return err
+			}
+			if answered {
+				continue
+			}
+			query = req.Query
+		case protocol.ComStmtExecute:
+			if statement, ok := s.statements[statementID(packet.Payload)]; ok {
+				req = s.newRequest(statement.query)
+			}
+		case protocol.ComStmtClose:
+			s.closeStatement(statementID(packet.Payload))
+		case protocol.ComSetOption:
+			answered, err := s.checkSetOption(packet.Payload)
+			if err != nil {
+				return err
+			}
+			if answered {
+				continue
+			}
+		}
+
+		// Faults apply to statements answered from the cache, too.
+		injected, err := s.injectFault(req)
+		if err != nil {
+			return err
+		}
+		if injected {
+			continue
+		}
+		if cmd == protocol.ComQuery {
+			served, err := s.serveFromCache(req)
+			if err != nil {
+				return err
+			}
+			if served {
+				continue
+			}
+		}
+
+		mirror := false
+		switch cmd {
+		case protocol.ComQuery:
+			mirror = s.shouldMirror(req)
+		case protocol.ComStmtExecute:
+			if req != nil {
+				s.skipMirror(req)
+			}
+		case protocol.ComInitDB:
+			if s.shadow != nil {
+				// Keep the schema of the shadow session in sync.
+				query = "USE `" + strings.ReplaceAll(string(packet.Payload[1:]), "`", "``") + "`"
+				req = s.newRequest(query)
+				mirror = true
+			}
+		}
+
+		route, err := s.routeShard(cmd, packet, req)
+		if err != nil {
+			return err
+		}
+		if route == shardAnswered {
+			continue
+		}
+		routed := route == shardLink
+		if route == shardNone {
+			routed = s.routeRead(cmd, req, hints)
+		}
+		if err := s.writeServer(packet); err != nil {
+			return err
+		}
+		if !expectsResponse(cmd) {
+			s.captureCommand(received, packet.Payload, 0, nil)
+			continue
+		}
+
+		statement := protocol.CommandName(cmd)
+		if req != nil {
+			statement = req.Query
+		}
+		s.conn.SetActivity(models.StateActive, statement)
+
+		if cmd == protocol.ComQuery || cmd == protocol.ComStmtExecute {
+			var timeout time.Duration
+			if hints != nil {
+				timeout = hints.timeout
+			}
+			s.startStatementTimeout(req, timeout)
+		}
+		if cmd == protocol.ComQuery || cmd == protocol.ComStmtExecute || cmd == protocol.ComStmtFetch {
+			s.startClientWatch()
+		}
+		startTime := time.Now()
+		r, err := s.forwardResponse(cmd)
+		s.fault = nil
+		s.stopClientWatch()
+		s.stopStatementTimeout()
+		s.leaveLink()
+		if err != nil {
+			return err
+		}
+		latency := time.Since(startTime)
+		metrics.LastRequestLatency.Set(latency.Seconds())
+
+		captured := s.capture
+		s.capture = nil
+
+		s.captureCommand(received, packet.Payload, latency, r)
+		if req != nil && (cmd == protocol.ComQuery || cmd == protocol.ComStmtExecute) {
+			digests.Record(req.User, req.Schema, req.Digest, req.Query, latency, r.err != nil)
+			canary.Record(s.cohort, latency, r.err != nil)
+		}
+		s.trackSession(cmd, packet.Payload, query, r)
+		if !routed {
+			s.trackWrites(cmd, req, r)
+		}
+		if (cmd == protocol.ComResetConnection || cmd == protocol.ComChangeUser) && r.err == nil {
+			// The backend no longer tracks GTIDs.
+			if err := s.enableGTIDTracking(); err != nil {
+				return err
+			}
+		}
+		s.storeInCache(r, captured)
+		s.invalidateCache(req, r)
+		if mirror {
+			s.mirrorStatement(req, r, captured, latency)
+		}
+	}
+}
+
+// expectsResponse returns false for commands the server does not answer.
+func expectsResponse(cmd byte) bool {
+	switch cmd {
+	case protocol.ComStmtSendLongData, protocol.ComStmtClose:
+		return false
+	}
+	return true
+}
+
+// statementID returns the statement ID of a COM_STMT_* command payload.
+func statementID(payload []byte) uint32 {
+	if len(payload) < 5 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(payload[1:5])
+}
+
+// trackSession updates the recorded session state after a command completed.
+func (s *session) trackSession(cmd byte, payload []byte, query string, r *response) {
+	if r.err != nil {
+		return
+	}
+	if r.hasStatus {
+		s.conn.StatusFlags = r.statusFlags
+	}
+
+	switch cmd {
+	case protocol.ComStmtPrepare:
+		s.statements[r.statementID] = &preparedStatement{query: query, params: int(r.params)}
+	case protocol.ComInitDB:
+		s.conn.SetSchema(string(payload[1:]))
+	case protocol.ComQuery:
+		if schema, ok := sqlparse.UseSchema(query); ok {
+			s.conn.SetSchema(schema)
+		}
+		if names, ok := sqlparse.SetVariables(query); ok {
+			s.recordSet(query, names)
+		}
+		if state := sessionStateChange(query); state != "" {
+			s.sessionState = state
+		}
+	case protocol.ComResetConnection:
+		// Resetting the session deallocates its prepared statements and
+		// discards its state.
+		s.statements = make(map[uint32]*preparedStatement)
+		s.sessionState = ""
+		s.replay = nil
+		s.closeLinks()
+	case protocol.ComChangeUser:
+		s.statements = make(map[uint32]*preparedStatement)
+		s.sessionState = ""
+		s.replay = nil
+		s.closeLinks()
+		changeUser := &protocol.ChangeUserPacket{}
+		if err := changeUser.Decode(payload, s.conn.Capabilities); err == nil {
+			s.conn.SetUser(changeUser.Username)
+			s.conn.SetSchema(changeUser.Database)
+			if changeUser.CharacterSet != 0 && changeUser.CharacterSet <= 0xff && s.handshake != nil {
+				s.handshake.CharacterSet = uint8(changeUser.CharacterSet)
+			}
+		}
+	}
+}
+
+// sessionStateChange describes the session state query creates that cannot
+// be restored on another backend, or returns an empty string.
+func sessionStateChange(query string) string {
+	switch sqlparse.StatementType(query) {
+	case "LOCK":
+		return "table locks"
+	case "PREPARE":
+		return "prepared statements"
+	case "CREATE":
+		if strings.Contains(strings.ToUpper(sqlparse.Normalize(query)), "TEMPORARY") {
+			return "temporary tables"
+		}
+	}
+	return ""
+}
@@ -1,13 +1,52 @@
 package proxy
 
 import (
+	"crypto/tls"
+	"errors"
+	"io"
 	"log"
 	"net"
 
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/firewall"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
 	"github.com/supporttools/go-sql-proxy/pkg/models"
 	"github.com/supporttools/go-sql-proxy/pkg/protocol"
 )
 
+// unsupportedCapabilities are hidden from clients, since the proxy could no
+// longer decode the command phase if they were negotiated. TLS is handled by
+// clientCapabilities.
+const unsupportedCapabilities = protocol.ClientCompress |
+	protocol.ClientZstdCompressionAlgorithm |
+	protocol.ClientQueryAttributes |
+	protocol.ClientOptionalResultsetMetadata
+
+// hiddenCapabilities returns the capabilities hidden from clients and
+// backends. Multi-statement queries are disabled while the firewall is
+// active, so statements it allowed cannot carry further statements.
+func hiddenCapabilities() protocol.CapabilityFlag {
+	if firewall.Enabled() {
+		return unsupportedCapabilities | protocol.ClientMultiStatements
+	}
+	return unsupportedCapabilities
+}
+
+// clientCapabilities returns the capabilities of the backend's greeting
+// offered to clients. TLS is offered if the proxy terminates it, and passed
+// through from the backend otherwise, unless the firewall is active: sessions
+// relayed as TLS cannot be inspected.
+func clientCapabilities(backend protocol.CapabilityFlag, tlsConfig *tls.Config) protocol.CapabilityFlag {
+	capabilities := backend &^ hiddenCapabilities()
+	switch {
+	case tlsConfig != nil:
+		capabilities |= protocol.ClientSSL
+	case firewall.Enabled():
+		capabilities &^= protocol.ClientSSL
+	}
+	return capabilities
+}
+
 // handleProtocolDecoding decodes the MySQL protocol if enabled, starting with the handshake packet.
 func handleProtocolDecoding(c *models.Connection, mysqlConn net.Conn) error {
 	handshakePacket := &protocol.InitialHandshakePacket{}
@@ -18,6 +57,16 @@ func handleProtocolDecoding(c *models.Connection, mysqlConn net.Conn) error {
 
 	//log.Printf("Decoded InitialHandshakePacket for connection [%d]: %+v", c.ID, handshakePacket)
 
+	// Clients see the proxy's connection ID, which stays the same for the
+	// whole session; KILL and CONNECTION_ID() are translated to the backend's.
+	c.BackendThreadID.Store(handshakePacket.ConnectionID)
+	handshakePacket.ConnectionID = uint32(c.ID) // #nosec G115 - IDs wrap like MySQL's 32-bit handshake IDs
+	tlsConfig, err := config.ClientTLSConfig()
+	if err != nil {
+		return err
+	}
+	handshakePacket.CapabilitiesFlags = clientCapabilities(handshakePacket.CapabilitiesFlags, tlsConfig)
+
 	response, err := handshakePacket.Encode()
 	if err != nil {
 		log.Printf("Failed to encode handshake response [%d]: %s", c.ID, err)
@@ -29,5 +78,31 @@ func handleProtocolDecoding(c *models.Connection, mysqlConn net.Conn) error {
 		return err
 	}
 
-	return transferData(c, mysqlConn)
+	// The first packet is read unbuffered, so nothing the client sends after
+	// an SSLRequest is consumed before the TLS handshake.
+	first, err := protocol.ReadPacket(io.TeeReader(c.Conn, metrics.NewCounterWriter(metrics.DataFromClient)))
+	if err != nil {
+		return err
+	}
+	if protocol.IsSSLRequest(first.Payload) {
+		if tlsConfig == nil {
+			if firewall.Enabled() {
+				return errors.New("client requested TLS, which is not offered while the firewall is active")
+			}
+			return relayClientTLS(c, mysqlConn, first)
+		}
+		if err := startClientTLS(c, tlsConfig); err != nil {
+			log.Printf("TLS handshake failed [%d]: %s", c.ID, err)
+			return err
+		}
+		first = nil
+	}
+
+	s := newSession(c, mysqlConn)
+	if err := s.relayAuth(first); err != nil {
+		log.Printf("Authentication failed [%d]: %s", c.ID, err)
+		return err
+	}
+
+	return s.handleCommands()
 }
@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+func TestClientCapabilities(t *testing.T) {
+	backend := protocol.ClientProtocol41 | protocol.ClientSSL | protocol.ClientCompress | protocol.ClientDeprecateEOF
+
+	got := clientCapabilities(backend, nil)
+	if !got.Has(protocol.ClientSSL) {
+		t.Error("TLS of the backend is not passed through without a client certificate")
+	}
+	if got.Has(protocol.ClientCompress) {
+		t.Error("compression is offered to clients")
+	}
+	if !got.Has(protocol.ClientDeprecateEOF) {
+		t.Error("CLIENT_DEPRECATE_EOF was hidden")
+	}
+
+	got = clientCapabilities(backend&^protocol.ClientSSL, &tls.Config{})
+	if !got.Has(protocol.ClientSSL) {
+		t.Error("TLS is not offered while the proxy terminates it")
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/pause"
+)
+
+// MySQL errors answered to commands that could not be held or moved.
+const (
+	// errLockWaitTimeout is ER_LOCK_WAIT_TIMEOUT.
+	errLockWaitTimeout uint16 = 1205
+	// errConCount is ER_CON_COUNT_ERROR.
+	errConCount uint16 = 1040
+)
+
+// holdCommand runs at a statement boundary, before a command is forwarded. It
+// holds the command while traffic is paused and then moves the session to the
+// primary backend if it changed. It returns true if the command was answered
+// instead; an error ends the session.
+func (s *session) holdCommand() (bool, error) {
+	if err := pause.Hold(); err != nil {
+		code := errLockWaitTimeout
+		if errors.Is(err, pause.ErrQueueFull) {
+			code = errConCount
+		}
+		return true, s.writeError(1, code, "HY000", "proxy paused: "+err.Error())
+	}
+
+	primary := backends.Primary()
+	if s.primary == nil || primary == nil || primary == s.primary {
+		return false, nil
+	}
+	if err := s.moveSession(primary); err != nil {
+		log.Printf("Failed to move connection [%d] to %s: %v", s.conn.ID, primary.Address, err)
+		if writeErr := s.writeError(1, errServerShutdown, "08S01",
+			fmt.Sprintf("primary changed to %s and the session could not follow: %v", primary.Address, err)); writeErr != nil {
+			return true, writeErr
+		}
+		return true, fmt.Errorf("session could not follow the primary: %w", err)
+	}
+	s.primary = primary
+	return false, nil
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/faults"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+// errFaultDropped ends sessions whose connection a fault rule drops.
+var errFaultDropped = errors.New("connection dropped by fault rule")
+
+// injectFault injects the faults of the enabled fault rule matching a
+// statement before it is forwarded: it delays the statement, and answers it
+// with an error or drops the connection instead of forwarding it. Like MySQL,
+// an injected deadlock rolls back the open transaction. Faults
+// applying to the response are left in s.fault. It returns true if the
+// statement was answered.
+func (s *session) injectFault(req *rules.Request) (bool, error) {
+	s.fault = nil
+	s.faultRows = 0
+	if req == nil {
+		return false, nil
+	}
+	rule := faults.For(req)
+	if rule == nil {
+		return false, nil
+	}
+
+	if rule.Latency > 0 {
+		metrics.IncrementInjectedFaults(rule.Name, "latency")
+		time.Sleep(time.Duration(rule.Latency))
+	}
+	switch {
+	case rule.Error == faults.ErrLostConnection:
+		metrics.IncrementInjectedFaults(rule.Name, "error")
+		log.Printf("Dropping connection [%d] for fault rule %q", s.conn.ID, rule.Name)
+		return true, fmt.Errorf("%w %q", errFaultDropped, rule.Name)
+	case rule.Error != 0:
+		metrics.IncrementInjectedFaults(rule.Name, "error")
+		if rule.Error == faults.ErrLockDeadlock && s.conn.StatusFlags&protocol.ServerStatusInTrans != 0 {
+			// MySQL rolls back the transaction of a deadlock victim.
+			if err := s.rollbackTransaction(); err != nil {
+				return true, fmt.Errorf("failed to roll back transaction for fault rule %q: %w", rule.Name, err)
+			}
+		}
+		return true, s.writeError(1, rule.Error, rule.SQLState, rule.Message)
+	}
+	if rule.Bandwidth > 0 {
+		metrics.IncrementInjectedFaults(rule.Name, "throttle")
+	}
+	if rule.Drop || rule.Bandwidth > 0 {
+		s.fault = rule
+	}
+	return false, nil
+}
+
+// rollbackTransaction rolls back the session's open transaction on its
+// backend, discarding its writes as far as the result cache is concerned.
+func (s *session) rollbackTransaction() error {
+	if err := execBackend(s.server, s.serverIn, append([]byte{protocol.ComQuery}, "ROLLBACK"...)); err != nil {
+		return err
+	}
+	s.conn.StatusFlags &^= protocol.ServerStatusInTrans
+	s.writtenTables = nil
+	s.calledProcedure = false
+	return nil
+}
+
+// dropMidResult returns errFaultDropped, after sending the client the rows
+// relayed so far, once the rows the fault rule of the statement lets through
+// were relayed.
+func (s *session) dropMidResult() error {
+	if s.fault == nil || !s.fault.Drop || s.faultRows < s.fault.DropAfterRows {
+		return nil
+	}
+	metrics.IncrementInjectedFaults(s.fault.Name, "drop")
+	log.Printf("Dropping connection [%d] after %d rows for fault rule %q", s.conn.ID, s.faultRows, s.fault.Name)
+	if err := s.flushClient(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w %q", errFaultDropped, s.fault.Name)
+}
+
+// throttle sends the queued packets to the client and waits for as long as
+// sending n bytes takes at the bandwidth of the statement's fault rule.
+func (s *session) throttle(n int) error {
+	if s.fault == nil || s.fault.Bandwidth == 0 {
+		return nil
+	}
+	if err := s.flushClient(); err != nil {
+		return err
+	}
+	time.Sleep(time.Duration(n) * time.Second / time.Duration(s.fault.Bandwidth))
+	return nil
+}
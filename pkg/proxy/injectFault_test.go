@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/supporttools/go-sql-proxy/pkg/faults"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// enableFault loads fault rules from data and enables the rule named name.
+func enableFault(t *testing.T, data, name string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "faults.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := faults.LoadRules(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := faults.SetEnabled(name, true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { faults.DisableAll() })
+}
+
+// expectError reads an ERR packet from conn and fails the test unless it has the given code.
+func expectError(t *testing.T, conn net.Conn, seq uint8, code uint16) {
+	t.Helper()
+	p, err := protocol.ReadPacket(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errPacket protocol.ERRPacket
+	if p.SequenceID != seq || errPacket.Decode(p.Payload) != nil || errPacket.Code != code {
+		t.Fatalf("packet %d = %x, want ERR %d with sequence ID %d", p.SequenceID, p.Payload, code, seq)
+	}
+}
+
+const deadlockRules = `{"rules": [{"name": "deadlock", "regex": "(?i)^update accounts", "error": 1213}]}`
+
+func TestInjectedDeadlockRollsBackTransaction(t *testing.T) {
+	enableFault(t, deadlockRules, "deadlock")
+	ts := newTestSession(t)
+	ts.conn.StatusFlags |= protocol.ServerStatusInTrans
+	ts.writtenTables = []string{"shop.accounts"}
+	done := ts.run(ts.handleCommands)
+
+	ts.query(t, "UPDATE accounts SET balance = 0")
+	// The backend rolls back instead of running the statement.
+	p := expect(t, ts.backend, 0, protocol.ComQuery)
+	if string(p.Payload[1:]) != "ROLLBACK" {
+		t.Fatalf("backend received %q, want ROLLBACK", p.Payload[1:])
+	}
+	send(t, ts.backend, 1, ok(protocol.ServerStatusAutocommit))
+	expectError(t, ts.client, 1, faults.ErrLockDeadlock)
+
+	ts.client.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if ts.conn.StatusFlags&protocol.ServerStatusInTrans != 0 {
+		t.Error("session is still in a transaction after the deadlock")
+	}
+	if ts.writtenTables != nil {
+		t.Errorf("written tables = %v after the rollback, want none", ts.writtenTables)
+	}
+}
+
+func TestInjectedErrorOutsideTransaction(t *testing.T) {
+	enableFault(t, deadlockRules, "deadlock")
+	ts := newTestSession(t)
+	done := ts.run(ts.handleCommands)
+
+	// Without a transaction the backend does not take part: a statement
+	// forwarded to it would block until the deadline.
+	ts.query(t, "UPDATE accounts SET balance = 0")
+	expectError(t, ts.client, 1, faults.ErrLockDeadlock)
+
+	// Statements the rule does not match are forwarded.
+	ts.query(t, "UPDATE orders SET state = 'paid'")
+	expect(t, ts.backend, 0, protocol.ComQuery)
+	send(t, ts.backend, 1, ok(protocol.ServerStatusAutocommit))
+	expect(t, ts.client, 1, protocol.OKHeader)
+
+	ts.client.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInjectedLostConnection(t *testing.T) {
+	enableFault(t, `{"rules": [{"name": "lost", "regex": "(?i)from accounts", "error": 2013}]}`, "lost")
+	ts := newTestSession(t)
+	done := ts.run(ts.handleCommands)
+
+	ts.query(t, "SELECT * FROM accounts")
+	if err := <-done; !errors.Is(err, errFaultDropped) {
+		t.Errorf("handleCommands() = %v, want %v", err, errFaultDropped)
+	}
+}
+
+func TestInjectedDropAfterRows(t *testing.T) {
+	enableFault(t, `{"rules": [{"name": "drop", "regex": "(?i)from users", "drop": true, "dropAfterRows": 1}]}`, "drop")
+	ts := newTestSession(t)
+	done := ts.run(ts.handleCommands)
+
+	const query = "SELECT id, name FROM users"
+	ts.query(t, query)
+	// The proxy stops reading the backend once it drops the connection.
+	go func() {
+		for _, p := range usersResultSet.Encode(ts.conn.Capabilities, protocol.ServerStatusAutocommit) {
+			if protocol.WritePacket(ts.backend, p.SequenceID, p.Payload) != nil {
+				return
+			}
+		}
+	}()
+	p := expect(t, ts.backend, 0, protocol.ComQuery)
+	if string(p.Payload[1:]) != query {
+		t.Errorf("backend received %q, want %q", p.Payload[1:], query)
+	}
+
+	// The client receives the column count, the columns and the first row.
+	packets := usersResultSet.Encode(ts.conn.Capabilities, protocol.ServerStatusAutocommit)
+	for _, want := range packets[:len(usersResultSet.Columns)+2] {
+		expect(t, ts.client, want.SequenceID, want.Payload[0])
+	}
+	if err := <-done; !errors.Is(err, errFaultDropped) {
+		t.Errorf("handleCommands() = %v, want %v", err, errFaultDropped)
+	}
+}
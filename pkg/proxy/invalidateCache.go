@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"github.com/supporttools/go-sql-proxy/pkg/cache"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// invalidateCache removes cached result sets of the tables a write modified,
+// for every statement of a multi-statement query. Stored procedures may write
+// any table, so CALL purges the whole cache. Tables written inside a
+// transaction are invalidated again when the transaction ends, since other
+// sessions only see the writes then.
+func (s *session) invalidateCache(req *rules.Request, r *response) {
+	if !cache.Enabled() || !config.CFG.CacheInvalidateOnWrite || r == nil {
+		return
+	}
+	inTrans := s.conn.StatusFlags&protocol.ServerStatusInTrans != 0
+
+	// Statements before a failing one of a multi-statement query ran.
+	if req != nil && (r.err == nil || sqlparse.MultipleStatements(req.Query)) {
+		var tables []string
+		for _, statement := range sqlparse.SplitStatements(req.Query) {
+			switch statementType := sqlparse.StatementType(statement); {
+			case statementType == "CALL":
+				cache.Purge()
+				s.calledProcedure = s.calledProcedure || inTrans
+			case isWrite(statementType):
+				tables = append(tables, qualifyTables(req.Schema, sqlparse.Tables(statement))...)
+			}
+		}
+		cache.Invalidate(tables)
+		if inTrans {
+			s.writtenTables = append(s.writtenTables, tables...)
+		}
+	}
+
+	if inTrans {
+		return
+	}
+	if s.calledProcedure {
+		cache.Purge()
+		s.calledProcedure = false
+	}
+	if len(s.writtenTables) > 0 {
+		cache.Invalidate(s.writtenTables)
+		s.writtenTables = nil
+	}
+}
+
+// isWrite returns true for statement types that modify tables.
+func isWrite(statementType string) bool {
+	switch statementType {
+	case "INSERT", "UPDATE", "DELETE", "REPLACE", "TRUNCATE", "ALTER", "DROP", "RENAME", "LOAD":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+)
+
+// killTimeout bounds how long issuing a KILL on the side connection may take.
+const killTimeout = 5 * time.Second
+
+// killConnections holds one side connection pool per backend address, used
+// to issue KILL statements with the configured source database credentials.
+var killConnections sync.Map
+
+// killBackendThread kills the statement running on the backend thread of c,
+// or the whole backend connection if connection is true. Reason labels the
+// kill in the metrics.
+func killBackendThread(c *models.Connection, connection bool, reason string) error {
+	threadID := c.BackendThreadID.Load()
+	if threadID == 0 {
+		return fmt.Errorf("backend thread ID of connection [%d] is not known", c.ID)
+	}
+	if err := killThread(c.BackendAddress(), threadID, connection, reason); err != nil {
+		return err
+	}
+	log.Printf("Killed backend thread %d of connection [%d] (%s)", threadID, c.ID, reason)
+	return nil
+}
+
+// killThread kills the statement running on thread threadID of the backend
+// at address, or the whole connection if connection is true.
+func killThread(address string, threadID uint32, connection bool, reason string) error {
+	db, err := killConnection(address)
+	if err != nil {
+		metrics.IncrementBackendKills(reason, "error")
+		return err
+	}
+
+	statement := "KILL QUERY %d"
+	if connection {
+		statement = "KILL CONNECTION %d"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(statement, threadID)); err != nil {
+		metrics.IncrementBackendKills(reason, "error")
+		return fmt.Errorf("failed to kill backend thread %d: %w", threadID, err)
+	}
+
+	metrics.IncrementBackendKills(reason, "success")
+	return nil
+}
+
+// killConnection returns the side connection pool for the backend at address.
+func killConnection(address string) (*sql.DB, error) {
+	if db, ok := killConnections.Load(address); ok {
+		return db.(*sql.DB), nil
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.User = config.CFG.SourceDatabaseUser
+	cfg.Passwd = config.CFG.SourceDatabasePassword
+	cfg.Net = config.BackendNet
+	cfg.Addr = address
+	cfg.Timeout = killTimeout
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxIdleTime(time.Minute)
+
+	if actual, loaded := killConnections.LoadOrStore(address, db); loaded {
+		db.Close()
+		return actual.(*sql.DB), nil
+	}
+	return db, nil
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"net"
+
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+)
+
+// meteredConn counts the bytes read from and written to a client connection.
+type meteredConn struct {
+	net.Conn
+	c *models.Connection
+}
+
+// Read reads data from the client.
+func (m *meteredConn) Read(p []byte) (int, error) {
+	n, err := m.Conn.Read(p)
+	m.c.BytesIn.Add(uint64(n)) // #nosec G115 - n is never negative
+	return n, err
+}
+
+// Write writes data to the client.
+func (m *meteredConn) Write(p []byte) (int, error) {
+	n, err := m.Conn.Write(p)
+	m.c.BytesOut.Add(uint64(n)) // #nosec G115 - n is never negative
+	return n, err
+}
+
+// meterConnection counts the traffic of the client connection of c in its
+// BytesIn and BytesOut.
+func meterConnection(c *models.Connection) {
+	c.Conn = &meteredConn{Conn: c.Conn, c: c}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/shadow"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// shouldMirror returns true if the statement described by req is mirrored to
+// the shadow backend, and starts capturing its response for the comparison.
+func (s *session) shouldMirror(req *rules.Request) bool {
+	if s.shadow == nil || !shadow.Mirrors(req.StatementType, req.Query) || sqlparse.MultipleStatements(req.Query) {
+		return false
+	}
+	s.startCapture(shadow.MaxCapture)
+	return true
+}
+
+// skipMirror counts an execution of a prepared statement that would have been
+// mirrored if it had been sent as a query.
+func (s *session) skipMirror(req *rules.Request) {
+	if s.shadow != nil && shadow.Mirrors(req.StatementType, req.Query) {
+		s.shadow.Skip(req.Query, req.Digest)
+	}
+}
+
+// mirrorStatement queues a statement that completed on the primary backend
+// for the shadow backend, together with the response captured for it.
+func (s *session) mirrorStatement(req *rules.Request, r *response, c *resultCapture, latency time.Duration) {
+	primary := shadow.Result{
+		Capabilities: s.conn.Capabilities,
+		Latency:      latency,
+	}
+	if r.err != nil {
+		primary.ErrorCode = r.err.Code
+	}
+	if c != nil && !c.overflow && r.statusFlags&protocol.ServerMoreResultsExists == 0 {
+		primary.Packets = c.packets
+	}
+	s.shadow.Mirror(req.Query, req.Digest, primary)
+}
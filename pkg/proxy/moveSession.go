@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/pcap"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// moveSession moves the session to backend between two commands: a backend
+// connection is opened with the session's user, schema and replayed SET
+// statements, and the previous one is closed. Sessions whose state cannot be restored there are not moved.
+func (s *session) moveSession(backend *backends.Backend) error {
+	if reason := s.unmovable(); reason != "" {
+		return errors.New("session has " + reason)
+	}
+
+	conn, handshake, err := s.connectBackend(backend.Address)
+	if err != nil {
+		return err
+	}
+	previous := s.conn.BackendAddress()
+	// Let the previous backend end the session cleanly.
+	if err := protocol.WritePacket(s.server, 0, []byte{protocol.ComQuit}); err != nil {
+		log.Printf("Failed to quit previous backend connection [%d]: %v", s.conn.ID, err)
+	}
+	if err := s.server.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Error closing previous backend connection [%d]: %v", s.conn.ID, err)
+	}
+
+	s.useBackend(backend, conn, handshake)
+	log.Printf("Moved connection [%d] from %s to %s", s.conn.ID, previous, backend.Address)
+	return nil
+}
+
+// useBackend relays the session to conn, a connection to backend opened by
+// connectBackend, in place of its previous backend connection.
+func (s *session) useBackend(backend *backends.Backend, conn net.Conn, handshake *protocol.InitialHandshakePacket) {
+	previous := s.conn.BackendAddress()
+	conn = pcap.Tap(conn, s.conn.ID, true)
+
+	s.server = conn
+	s.serverIn = bufio.NewReader(io.TeeReader(conn, metrics.NewCounterWriter(metrics.DataToClient)))
+	s.conn.SetBackend(backend.Address, conn)
+	s.conn.BackendThreadID.Store(handshake.ConnectionID)
+	backends.Register(previous).Release()
+	backend.Acquire()
+}
+
+// unmovable describes the session state that prevents moving the session to
+// another backend, or returns an empty string if there is none.
+func (s *session) unmovable() string {
+	switch {
+	case s.conn.StatusFlags&protocol.ServerStatusInTrans != 0:
+		return "an open transaction"
+	case len(s.statements) > 0:
+		return "prepared statements"
+	case s.sessionState != "":
+		return s.sessionState
+	}
+	return ""
+}
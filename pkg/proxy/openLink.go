@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/pcap"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// backendLink is a backend connection of a session besides its own, which
+// reads are routed to.
+type backendLink struct {
+	backend  *backends.Backend
+	conn     net.Conn
+	in       *bufio.Reader
+	threadID uint32
+	// schema is the default schema of the connection.
+	schema string
+	// replayVersion is the version of the session's SET statements the
+	// connection has replayed.
+	replayVersion int
+	// gtidVersion is the version of the session's GTIDs the connection is
+	// known to have executed.
+	gtidVersion int
+	// used is when a read was last routed to the connection.
+	used time.Time
+}
+
+// openLink opens a link to backend, authenticated like a moved session, with
+// the session's schema and replayed SET statements. Links count as sessions
+// of their backend.
+func (s *session) openLink(backend *backends.Backend) (*backendLink, error) {
+	if !backend.TryAcquire() {
+		return nil, errors.New("backend reached its maximum number of connections")
+	}
+	_, schema := s.conn.Identity()
+	conn, handshake, err := s.connectBackend(backend.Address)
+	if err != nil {
+		backend.Release()
+		return nil, err
+	}
+	conn = pcap.Tap(conn, s.conn.ID, true)
+
+	return &backendLink{
+		backend:       backend,
+		conn:          conn,
+		in:            bufio.NewReader(io.TeeReader(conn, metrics.NewCounterWriter(metrics.DataToClient))),
+		threadID:      handshake.ConnectionID,
+		schema:        schema,
+		replayVersion: s.replayVersion,
+		used:          time.Now(),
+	}, nil
+}
+
+// syncLink brings an idle link up to date with the session before a read is
+// routed to it: the schema is selected and SET statements recorded since the
+// last read are replayed. It fails if the link was lost, which is probed
+// after probeIdle.
+func (s *session) syncLink(link *backendLink) error {
+	if time.Since(link.used) >= probeIdle && connLost(link.conn, link.in) {
+		return errors.New("connection was lost")
+	}
+	link.used = time.Now()
+	if _, schema := s.conn.Identity(); schema != link.schema {
+		if schema == "" {
+			return errors.New("the session no longer has a schema")
+		}
+		if err := execBackend(link.conn, link.in, append([]byte{protocol.ComInitDB}, schema...)); err != nil {
+			return fmt.Errorf("failed to select schema %s: %w", schema, err)
+		}
+		link.schema = schema
+	}
+	if link.replayVersion != s.replayVersion {
+		if err := s.replaySession(link.conn); err != nil {
+			return err
+		}
+		link.replayVersion = s.replayVersion
+	}
+	return nil
+}
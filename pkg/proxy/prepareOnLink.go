@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// preparedStatement is a statement the client prepared on the session's own
+// backend connection.
+type preparedStatement struct {
+	query  string
+	params int
+	// types are the parameter types of the last execution, which clients
+	// only send when they change.
+	types []protocol.ParamType
+	// links maps the links the statement was also prepared on to its
+	// statement ID there.
+	links map[*backendLink]uint32
+}
+
+// closeStatement forgets a prepared statement and closes it on the links it
+// was prepared on. COM_STMT_CLOSE has no response.
+func (s *session) closeStatement(id uint32) {
+	stmt, ok := s.statements[id]
+	if !ok {
+		return
+	}
+	delete(s.statements, id)
+	for link, linkID := range stmt.links {
+		payload := binary.LittleEndian.AppendUint32([]byte{protocol.ComStmtClose}, linkID)
+		if err := protocol.WritePacket(link.conn, 0, payload); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Failed to close statement on link [%d] to %s: %v", s.conn.ID, link.backend.Address, err)
+		}
+	}
+}
+
+// prepareOnLink returns the ID of stmt on link, preparing it there first if
+// it was not yet.
+func (s *session) prepareOnLink(link *backendLink, stmt *preparedStatement) (uint32, error) {
+	if id, ok := stmt.links[link]; ok {
+		return id, nil
+	}
+
+	if err := protocol.WritePacket(link.conn, 0, append([]byte{protocol.ComStmtPrepare}, stmt.query...)); err != nil {
+		return 0, err
+	}
+	p, err := protocol.ReadPacket(link.in)
+	if err != nil {
+		return 0, err
+	}
+	if len(p.Payload) > 0 && p.Payload[0] == protocol.ERRHeader {
+		errPacket := &protocol.ERRPacket{}
+		if err := errPacket.Decode(p.Payload); err != nil {
+			return 0, err
+		}
+		return 0, errPacket
+	}
+	if len(p.Payload) < 9 || p.Payload[0] != protocol.OKHeader {
+		return 0, errUnexpectedPacket
+	}
+
+	id := binary.LittleEndian.Uint32(p.Payload[1:5])
+	columns := int(binary.LittleEndian.Uint16(p.Payload[5:7]))
+	params := int(binary.LittleEndian.Uint16(p.Payload[7:9]))
+	// The parameter and column definitions are not needed.
+	for _, n := range []int{params, columns} {
+		if n == 0 {
+			continue
+		}
+		if !s.conn.Capabilities.Has(protocol.ClientDeprecateEOF) {
+			n++
+		}
+		for i := 0; i < n; i++ {
+			if _, err := protocol.ReadPacket(link.in); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if stmt.links == nil {
+		stmt.links = make(map[*backendLink]uint32)
+	}
+	stmt.links[link] = id
+	return id, nil
+}
+
+// executeOnLink rewrites a COM_STMT_EXECUTE payload of stmt for its statement
+// ID on a link. The parameter types are always included, since the link may
+// not have seen the execution that last sent them.
+func executeOnLink(payload []byte, stmt *preparedStatement, linkID uint32) []byte {
+	out := append([]byte{}, payload[:10]...)
+	binary.LittleEndian.PutUint32(out[1:5], linkID)
+	if stmt.params == 0 {
+		return out
+	}
+
+	position := 10 + (stmt.params+7)/8
+	out = append(out, payload[10:position]...)
+	if payload[position] == 1 {
+		// The types are included already.
+		return append(out, payload[position:]...)
+	}
+	out = append(out, 1)
+	for _, t := range stmt.types {
+		out = binary.LittleEndian.AppendUint16(out, uint16(t))
+	}
+	return append(out, payload[position+1:]...)
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"net"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// queryBackend runs query on conn, an idle backend connection read through in
+// with the given capabilities, and returns the first column of the first row
+// of its result set.
+func queryBackend(conn net.Conn, in *bufio.Reader, capabilities protocol.CapabilityFlag, query string) ([]byte, error) {
+	packets, err := runStatement(conn, in, capabilities, append([]byte{protocol.ComQuery}, query...))
+	if err != nil {
+		return nil, err
+	}
+	if last := packets[len(packets)-1]; last.Payload[0] == protocol.ERRHeader {
+		errPacket := &protocol.ERRPacket{}
+		if err := errPacket.Decode(last.Payload); err != nil {
+			return nil, err
+		}
+		return nil, errPacket
+	}
+	if packets[0].Payload[0] == protocol.OKHeader {
+		return nil, errors.New("statement returned no result set")
+	}
+
+	rs, err := protocol.DecodeResultSet(packets, capabilities)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs.Rows) == 0 {
+		return nil, errors.New("statement returned no rows")
+	}
+	return rs.Rows[0][0], nil
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+)
+
+// reconnectInterval is the delay between attempts to reconnect a session.
+const reconnectInterval = 250 * time.Millisecond
+
+// reconnectBackend replaces the lost backend connection of the session with
+// a new one to the primary, or to the same backend if the session is not on
+// the primary, retrying until RECONNECT_TIMEOUT. Sessions whose state cannot
+// be restored are not reconnected.
+func (s *session) reconnectBackend() error {
+	if reason := s.unmovable(); reason != "" {
+		return errors.New("session has " + reason)
+	}
+	if config.CFG.ReconnectTimeout <= 0 {
+		return errors.New("reconnecting is disabled")
+	}
+
+	if err := s.server.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Error closing lost backend connection [%d]: %v", s.conn.ID, err)
+	}
+
+	deadline := time.Now().Add(config.CFG.ReconnectTimeout)
+	for {
+		backend := backends.Register(s.conn.BackendAddress())
+		if s.primary != nil {
+			if primary := backends.Primary(); primary != nil {
+				backend = primary
+			}
+		}
+
+		conn, handshake, err := s.connectBackend(backend.Address)
+		if err == nil {
+			s.useBackend(backend, conn, handshake)
+			if s.primary != nil {
+				s.primary = backend
+			}
+			return nil
+		}
+		if time.Now().Add(reconnectInterval).After(deadline) {
+			return err
+		}
+		log.Printf("Failed to reconnect connection [%d] to %s, retrying: %v", s.conn.ID, backend.Address, err)
+		time.Sleep(reconnectInterval)
+	}
+}
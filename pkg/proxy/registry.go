@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+)
+
+// connections holds the open client connections by proxy connection ID.
+var connections sync.Map
+
+// registerConnection adds a client connection to the registry.
+func registerConnection(c *models.Connection) {
+	connections.Store(c.ID, c)
+}
+
+// unregisterConnection removes a closed client connection from the registry.
+func unregisterConnection(c *models.Connection) {
+	connections.Delete(c.ID)
+}
+
+// LookupConnection returns the open client connection with the given proxy connection ID.
+func LookupConnection(id uint64) (*models.Connection, bool) {
+	c, ok := connections.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return c.(*models.Connection), true
+}
+
+// Connections returns the open client connections ordered by ID.
+func Connections() []*models.Connection {
+	var list []*models.Connection
+	connections.Range(func(_, c any) bool {
+		list = append(list, c.(*models.Connection))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
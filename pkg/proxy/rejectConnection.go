@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// errServerShutdown is ER_SERVER_SHUTDOWN, answered to connections to backends
+// that do not accept new sessions.
+const errServerShutdown uint16 = 1053
+
+// rejectConnection answers a new client connection with an ERR packet in
+// place of the server greeting, which clients report like a server error,
+// and closes it. Reason labels the rejection in the metrics.
+func rejectConnection(c *models.Connection, reason string, code uint16, sqlState, message string) error {
+	metrics.IncrementRejectedConnections(reason)
+	log.Printf("Rejecting connection [%d]: %s", c.ID, message)
+
+	errPacket := protocol.ERRPacket{Code: code, SQLState: sqlState, Message: message}
+	packet := &protocol.Packet{SequenceID: 0, Payload: errPacket.Encode()}
+	_, err := c.Conn.Write(packet.Encode())
+	if closeErr := c.Conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// rejectFull rejects a new client connection to backend, which reached the
+// maximum number of connections of its spec.
+func rejectFull(c *models.Connection, backend *backends.Backend) error {
+	return rejectConnection(c, "max_connections", errConCount, "08004",
+		fmt.Sprintf("backend %s reached its maximum number of connections", backend.Address))
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// relayAuth relays the client's handshake response and the authentication
+// exchange that follows it, recording the session's user and schema. A
+// routing rule may move the session to another backend first. packet is the
+// handshake response if it was already read.
+func (s *session) relayAuth(packet *protocol.Packet) error {
+	var err error
+	if packet == nil {
+		if packet, err = s.readClient(); err != nil {
+			return err
+		}
+	}
+
+	handshakeResponse := &protocol.HandshakeResponse41{}
+	if err := handshakeResponse.Decode(packet.Payload); err != nil {
+		return err
+	}
+	handshakeResponse.CapabilityFlags &^= hiddenCapabilities()
+
+	s.conn.SetUser(handshakeResponse.Username)
+	s.conn.SetSchema(handshakeResponse.Database)
+	s.conn.SetAttributes(handshakeResponse.Attributes)
+	s.conn.Capabilities = handshakeResponse.CapabilityFlags
+	s.handshake = handshakeResponse
+
+	if s.seqShift, err = s.routeConnection(handshakeResponse, packet.SequenceID); err != nil {
+		return err
+	}
+	// The backend never sees the SSLRequest of a client whose TLS the proxy
+	// terminated, so the client's packets are one ahead of the backend's.
+	if s.seqShift == 0 {
+		s.seqShift = packet.SequenceID - 1
+	}
+	// TLS was negotiated with the client, not with the backend.
+	backendResponse := *handshakeResponse
+	backendResponse.CapabilityFlags &^= protocol.ClientSSL
+	if err := s.writeServer(&protocol.Packet{SequenceID: 1, Payload: backendResponse.Encode()}); err != nil {
+		return err
+	}
+
+	r := &response{}
+	err = s.relayAuthExchange(r)
+	s.seqShift = 0
+	if err != nil {
+		return err
+	}
+	if err := s.flushClient(); err != nil {
+		return err
+	}
+	if r.err != nil {
+		return r.err
+	}
+	s.conn.StatusFlags = r.statusFlags
+
+	return nil
+}
+
+// relayAuthExchange relays authentication packets between server and client
+// until the server accepts or rejects the client.
+func (s *session) relayAuthExchange(r *response) error {
+	for {
+		p, err := s.relayServerPacket()
+		if err != nil {
+			return err
+		}
+
+		switch p.Payload[0] {
+		case protocol.OKHeader:
+			return r.setOK(p.Payload, s.conn.Capabilities)
+		case protocol.ERRHeader:
+			return r.setErr(p.Payload)
+		case protocol.AuthMoreDataHeader:
+			// caching_sha2_password fast authentication succeeded, the OK packet follows.
+			if len(p.Payload) == 2 && p.Payload[1] == 0x03 {
+				continue
+			}
+		}
+
+		// Auth switch requests and other auth data await the client's answer.
+		if err := s.flushClient(); err != nil {
+			return err
+		}
+		answer, err := s.readClient()
+		if err != nil {
+			return err
+		}
+		answer.SequenceID -= s.seqShift
+		if err := s.writeServer(answer); err != nil {
+			return err
+		}
+	}
+}
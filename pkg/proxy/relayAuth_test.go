@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+func TestRelayAuthSequenceIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		// first is the sequence ID of the client's handshake response: 1,
+		// or 2 after an SSLRequest the proxy terminated.
+		first     uint8
+		sslClient bool
+	}{
+		{"plaintext", 1, false},
+		{"terminated TLS", 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestSession(t)
+			capabilities := testCapabilities
+			if tt.sslClient {
+				capabilities |= protocol.ClientSSL
+			}
+			response := protocol.HandshakeResponse41{
+				CapabilityFlags: capabilities,
+				CharacterSet:    45,
+				Username:        "app",
+				AuthResponse:    []byte{1, 2, 3},
+				AuthPluginName:  "mysql_native_password",
+			}
+			first := &protocol.Packet{SequenceID: tt.first, Payload: response.Encode()}
+			done := ts.run(func() error { return ts.relayAuth(first) })
+
+			// The backend sees a plaintext handshake starting at sequence ID 1.
+			p := expect(t, ts.backend, 1, byte(capabilities))
+			var received protocol.HandshakeResponse41
+			if err := received.Decode(p.Payload); err != nil {
+				t.Fatal(err)
+			}
+			if received.CapabilityFlags.Has(protocol.ClientSSL) {
+				t.Error("CLIENT_SSL was forwarded to the backend")
+			}
+			if received.Username != "app" {
+				t.Errorf("user = %q, want app", received.Username)
+			}
+
+			// An auth switch and its answer are shifted between both sides.
+			send(t, ts.backend, 2, protocol.AuthSwitchRequest{PluginName: "caching_sha2_password", PluginData: make([]byte, 20)}.Encode())
+			expect(t, ts.client, tt.first+1, 0xfe)
+			send(t, ts.client, tt.first+2, make([]byte, 32))
+			expect(t, ts.backend, 3, 0)
+			send(t, ts.backend, 4, ok(protocol.ServerStatusAutocommit))
+			expect(t, ts.client, tt.first+3, protocol.OKHeader)
+
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if ts.seqShift != 0 {
+				t.Errorf("seqShift = %d after authentication, want 0", ts.seqShift)
+			}
+			if ts.conn.User != "app" {
+				t.Errorf("user = %q, want app", ts.conn.User)
+			}
+		})
+	}
+}
+
+func TestRelayAuthReadsHandshakeResponse(t *testing.T) {
+	ts := newTestSession(t)
+	done := ts.run(func() error { return ts.relayAuth(nil) })
+
+	response := protocol.HandshakeResponse41{CapabilityFlags: testCapabilities, Username: "app", AuthPluginName: "mysql_native_password"}
+	send(t, ts.client, 1, response.Encode())
+	expect(t, ts.backend, 1, byte(testCapabilities&0xff))
+	send(t, ts.backend, 2, protocol.ERRPacket{Code: 1045, SQLState: "28000", Message: "Access denied"}.Encode())
+	p := expect(t, ts.client, 2, protocol.ERRHeader)
+
+	var errPacket protocol.ERRPacket
+	if err := errPacket.Decode(p.Payload); err != nil || errPacket.Code != 1045 {
+		t.Errorf("client received %v, want error 1045", errPacket)
+	}
+	if err := <-done; err == nil {
+		t.Error("relayAuth() succeeded after the backend rejected the client")
+	}
+}
@@ -0,0 +1,23 @@
+package proxy
+
+import (
+	"log"
+	"net"
+
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// relayClientTLS forwards the SSLRequest of a client to the backend and
+// relays the rest of the session as raw bytes, since the proxy cannot decode
+// TLS it does not terminate.
+func relayClientTLS(c *models.Connection, mysqlConn net.Conn, sslRequest *protocol.Packet) error {
+	if _, err := mysqlConn.Write(sslRequest.Encode()); err != nil {
+		return err
+	}
+	metrics.IncrementClientTLSSessions("relayed")
+	log.Printf("Relaying TLS of connection [%d] without decoding it", c.ID)
+	c.SetActivity(models.StatePassthrough, "")
+	return transferData(c, mysqlConn)
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// setStatement is a SET statement replayed on new backend connections.
+type setStatement struct {
+	query string
+	names []string
+}
+
+var (
+	replayableOnce sync.Once
+	// replayable are the variables whose SET statements are replayed, from
+	// RECONNECT_SET_VARIABLES.
+	replayable map[string]bool
+)
+
+// replaySession runs the session's recorded SET statements on conn, a new
+// backend connection, and fails if any of them is not answered with OK.
+func (s *session) replaySession(conn net.Conn) error {
+	in := bufio.NewReader(conn)
+	for _, set := range s.replay {
+		if err := execBackend(conn, in, append([]byte{protocol.ComQuery}, set.query...)); err != nil {
+			return fmt.Errorf("failed to replay %q: %w", set.query, err)
+		}
+	}
+	return nil
+}
+
+// execBackend sends the command payload on conn, an idle backend connection
+// read through in, and fails unless it is answered with OK.
+func execBackend(conn net.Conn, in *bufio.Reader, payload []byte) error {
+	if err := protocol.WritePacket(conn, 0, payload); err != nil {
+		return err
+	}
+	packet, err := protocol.ReadPacket(in)
+	if err != nil {
+		return err
+	}
+	if len(packet.Payload) == 0 {
+		return errors.New("received empty response")
+	}
+
+	switch packet.Payload[0] {
+	case protocol.OKHeader:
+		return nil
+	case protocol.ERRHeader:
+		errPacket := &protocol.ERRPacket{}
+		if err := errPacket.Decode(packet.Payload); err != nil {
+			return err
+		}
+		return errPacket
+	}
+	return fmt.Errorf("unexpected response 0x%02x", packet.Payload[0])
+}
+
+// recordSet records a SET statement that assigned the session variables
+// names. Statements only assigning replayable variables are replayed on new
+// backend connections, superseding earlier ones that assigned no other
+// variables; any other variable pins the session to its backend.
+func (s *session) recordSet(query string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	if sqlparse.MultipleStatements(query) {
+		s.sessionState = "session variables"
+		return
+	}
+	for _, name := range names {
+		if !isReplayable(name) {
+			s.sessionState = "session variables"
+			return
+		}
+	}
+
+	assigned := make(map[string]bool, len(names))
+	for _, name := range names {
+		assigned[name] = true
+	}
+	kept := s.replay[:0]
+	for _, set := range s.replay {
+		for _, name := range set.names {
+			if !assigned[name] {
+				kept = append(kept, set)
+				break
+			}
+		}
+	}
+	s.replay = append(kept, setStatement{query: query, names: names})
+	s.replayVersion++
+}
+
+// isReplayable returns true if SET statements assigning the session variable
+// name are replayed on new backend connections.
+func isReplayable(name string) bool {
+	replayableOnce.Do(func() {
+		replayable = make(map[string]bool)
+		for _, name := range strings.Split(config.CFG.ReconnectSetVariables, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				replayable[name] = true
+			}
+		}
+	})
+	return replayable[name]
+}
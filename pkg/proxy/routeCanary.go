@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"log"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/canary"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// routeCanary moves a new session to a backend of the canary group, before
+// it authenticates, if the canary selects it, and records the cohort the
+// session's statements are compared in. Selected sessions stay on their
+// backend, in the baseline, if no backend of the canary group is available.
+func (s *session) routeCanary(handshakeResponse *protocol.HandshakeResponse41, seq uint8) (uint8, error) {
+	group, selected := canary.Select(s.conn.User, s.conn.ClientIP())
+	if group == "" {
+		return 0, nil
+	}
+	s.cohort = canary.Baseline
+	defer func() { metrics.IncrementCanarySessions(s.cohort) }()
+	if !selected {
+		return 0, nil
+	}
+	if backends.Register(s.conn.BackendAddress()).Tagged(group) {
+		s.cohort = canary.Canary
+		return 0, nil
+	}
+
+	target := backends.PickTagged(group)
+	if target == nil {
+		log.Printf("Keeping connection [%d] in the canary baseline: no backend of group %s is available", s.conn.ID, group)
+		return 0, nil
+	}
+	if handshakeResponse.CapabilityFlags&protocol.ClientPluginAuth == 0 {
+		log.Printf("Keeping connection [%d] in the canary baseline: the client does not support authentication plugins", s.conn.ID)
+		return 0, nil
+	}
+	conn, err := DialBackend(target.Address)
+	if err != nil {
+		target.ReportFailure()
+		log.Printf("Keeping connection [%d] in the canary baseline: could not connect to %s: %v", s.conn.ID, target.Address, err)
+		return 0, nil
+	}
+	target.ReportSuccess()
+
+	previous := s.conn.BackendAddress()
+	shift, err := s.switchBackend(handshakeResponse, seq, target, conn)
+	if err != nil {
+		return 0, err
+	}
+	s.cohort = canary.Canary
+	log.Printf("Routed connection [%d] of user %s from %s to canary %s", s.conn.ID, s.conn.User, previous, target.Address)
+	return shift, nil
+}
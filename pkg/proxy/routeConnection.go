@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/routing"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+// routeConnection moves a new session to a backend of the group a routing
+// rule picks for it, before it authenticates, if its backend is not in that
+// group. Sessions no rule matches may be sent to the canary group instead.
+// It returns the sequence ID the client's packets are ahead of the new
+// backend's, or an error after answering the client if no backend of the
+// group is available.
+func (s *session) routeConnection(handshakeResponse *protocol.HandshakeResponse41, seq uint8) (uint8, error) {
+	var rule *routing.Rule
+	if routing.Enabled() {
+		req := &rules.Request{User: s.conn.User, ClientIP: s.conn.ClientIP(), Schema: s.conn.Schema}
+		rule = routing.For(req, handshakeResponse.Attributes)
+	}
+	if rule == nil {
+		return s.routeCanary(handshakeResponse, seq)
+	}
+	if backends.Register(s.conn.BackendAddress()).Tagged(rule.Group) {
+		metrics.IncrementRoutedConnections(rule.Group, "kept")
+		return 0, nil
+	}
+
+	target := backends.PickTagged(rule.Group)
+	if target == nil {
+		metrics.IncrementRoutedConnections(rule.Group, "unavailable")
+		err := fmt.Errorf("no backend of group %s is available", rule.Group)
+		return 0, errors.Join(err, s.writeError(seq+1, errConnHostError, "HY000", err.Error()))
+	}
+	if handshakeResponse.CapabilityFlags&protocol.ClientPluginAuth == 0 {
+		metrics.IncrementRoutedConnections(rule.Group, "unavailable")
+		err := errors.New("the client does not support authentication plugins")
+		return 0, errors.Join(err, s.writeError(seq+1, errConnHostError, "HY000", "cannot route connection: "+err.Error()))
+	}
+
+	conn, err := DialBackend(target.Address)
+	if err != nil {
+		target.ReportFailure()
+		metrics.IncrementRoutedConnections(rule.Group, "unavailable")
+		return 0, errors.Join(err, s.writeError(seq+1, errConnHostError, "HY000", "could not connect to backend: "+err.Error()))
+	}
+	target.ReportSuccess()
+	previous := s.conn.BackendAddress()
+	shift, err := s.switchBackend(handshakeResponse, seq, target, conn)
+	if err != nil {
+		return 0, err
+	}
+	metrics.IncrementRoutedConnections(rule.Group, "routed")
+	log.Printf("Routed connection [%d] of user %s from %s to %s (rule %q)", s.conn.ID, s.conn.User, previous, target.Address, rule.Name)
+	return shift, nil
+}
+
+// switchBackend makes conn, a new connection to target, the backend
+// connection of a session that has not authenticated yet. The client is
+// asked to authenticate again with the scramble of the new backend, so the
+// proxy needs no passwords; its answer replaces the auth response of
+// handshakeResponse. It returns the sequence ID the client's packets are
+// ahead of the new backend's. conn is closed on errors.
+func (s *session) switchBackend(handshakeResponse *protocol.HandshakeResponse41, seq uint8, target *backends.Backend, conn net.Conn) (uint8, error) {
+	handshake := &protocol.InitialHandshakePacket{}
+	if err := conn.SetReadDeadline(time.Now().Add(connectTimeout)); err != nil {
+		conn.Close()
+		return 0, err
+	}
+	if err := handshake.Decode(conn); err != nil {
+		conn.Close()
+		return 0, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return 0, err
+	}
+
+	// Ask the client to authenticate with the new backend's scramble.
+	authSwitch := protocol.AuthSwitchRequest{PluginName: string(handshake.AuthPluginName), PluginData: trimScramble(handshake.AuthPluginData)}
+	if err := s.writeClient(&protocol.Packet{SequenceID: seq + 1, Payload: authSwitch.Encode()}); err != nil {
+		conn.Close()
+		return 0, err
+	}
+	if err := s.flushClient(); err != nil {
+		conn.Close()
+		return 0, err
+	}
+	answer, err := s.readClient()
+	if err != nil {
+		conn.Close()
+		return 0, err
+	}
+	handshakeResponse.AuthPluginName = authSwitch.PluginName
+	handshakeResponse.AuthResponse = answer.Payload
+
+	// The previous backend connection has not authenticated yet.
+	if err := s.server.Close(); err != nil {
+		log.Printf("Error closing previous backend connection [%d]: %v", s.conn.ID, err)
+	}
+	s.useBackend(target, conn, handshake)
+	// The backend expects the handshake response next, as sequence ID 1.
+	return answer.SequenceID - 1, nil
+}
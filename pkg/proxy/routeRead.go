@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// linkRetryInterval is how long a session routes reads to the primary after
+// a link to a replica failed to open.
+const linkRetryInterval = 30 * time.Second
+
+// errLinkBackoff is returned by readLink while a failed link is not retried.
+var errLinkBackoff = errors.New("link failed recently")
+
+// routeRead relays the next command to a replica of the read pool if read/
+// write splitting is enabled and it is a read that may run there: a single
+// SELECT outside of a transaction, in autocommit mode, of a session on the
+// primary without state that replicas cannot share. With READ_YOUR_WRITES the replica must
+// also have executed the session's writes. Reads stay on the session's own
+// backend, the primary, when no replica qualifies or its link fails. Hints
+// route statements to the primary, reads to a replica even if read/write
+// splitting is disabled, or statements to the backends with a tag.
+// It returns true if the command was routed; call leaveLink after the
+// response was relayed.
+func (s *session) routeRead(cmd byte, req *rules.Request, hints *statementHints) bool {
+	if cmd != protocol.ComQuery || req == nil {
+		return false
+	}
+	hinted := hints != nil && (hints.route != "" || hints.backend != "")
+	if !config.CFG.ReadWriteSplit && !hinted {
+		return false
+	}
+	if s.conn.StatusFlags&protocol.ServerStatusInTrans != 0 || s.conn.StatusFlags&protocol.ServerStatusAutocommit == 0 ||
+		s.sessionState != "" {
+		if hinted {
+			log.Printf("Ignoring routing hints of connection [%d]: the session is pinned to its backend", s.conn.ID)
+			s.countRouteHints(hints, "ignored")
+		}
+		return false
+	}
+	switch {
+	case hints != nil && hints.backend != "":
+		return s.routeToBackend(hints)
+	case s.primary == nil:
+		// The replicas replicate from the primary, not from the backend a
+		// routing rule or a fallback proxied the session to.
+		if hinted {
+			log.Printf("Ignoring routing hints of connection [%d]: the session is not on the primary", s.conn.ID)
+			s.countRouteHints(hints, "ignored")
+		}
+		return false
+	case hints != nil && hints.route == "primary":
+		metrics.IncrementQueryHints("route", "applied")
+		return false
+	case !sqlparse.ReadOnly(req.Query):
+		// Writes stay on the primary, even if a hint asks for a replica.
+		if hints != nil && hints.route == "replica" {
+			log.Printf("Ignoring route hint of connection [%d]: the statement is not a read", s.conn.ID)
+			metrics.IncrementQueryHints("route", "ignored")
+		}
+		return false
+	}
+
+	if config.CFG.ReadYourWrites && s.wrote {
+		if err := s.fetchGTIDs(); err != nil {
+			log.Printf("Failed to read GTIDs of connection [%d]: %v", s.conn.ID, err)
+			metrics.IncrementRoutedReads("primary")
+			return false
+		}
+	}
+
+	replica := s.pickReader()
+	if replica == nil {
+		s.countRouteHints(hints, "ignored")
+		metrics.IncrementRoutedReads("primary")
+		return false
+	}
+	link, err := s.readLink(replica)
+	caughtUp := false
+	if err == nil {
+		if caughtUp, err = s.awaitGTIDs(link); err != nil {
+			s.closeLink(replica)
+		}
+	}
+	switch {
+	case err != nil:
+		if !errors.Is(err, errLinkBackoff) {
+			log.Printf("Failed to route read of connection [%d] to replica %s: %v", s.conn.ID, replica.Address, err)
+		}
+		s.reader = nil
+		s.countRouteHints(hints, "ignored")
+		metrics.IncrementRoutedReads("primary")
+		return false
+	case !caughtUp:
+		s.countRouteHints(hints, "ignored")
+		metrics.IncrementRoutedReads("primary")
+		return false
+	}
+	s.enterLink(link)
+	s.countRouteHints(hints, "applied")
+	metrics.IncrementRoutedReads("replica")
+	return true
+}
+
+// routeToBackend relays the next command to a backend with the tag or
+// address of the backend hint, unless it is the session's own backend. The
+// statement stays on the session's own backend when no such backend accepts
+// sessions or its link fails.
+func (s *session) routeToBackend(hints *statementHints) bool {
+	target := backends.PickTagged(hints.backend)
+	if target == nil {
+		log.Printf("Ignoring backend hint of connection [%d]: no backend %q is available", s.conn.ID, hints.backend)
+		metrics.IncrementQueryHints("backend", "ignored")
+		return false
+	}
+	if target.Address == s.conn.BackendAddress() {
+		metrics.IncrementQueryHints("backend", "applied")
+		return false
+	}
+	link, err := s.readLink(target)
+	if err != nil {
+		if !errors.Is(err, errLinkBackoff) {
+			log.Printf("Failed to route statement of connection [%d] to backend %s: %v", s.conn.ID, target.Address, err)
+		}
+		metrics.IncrementQueryHints("backend", "ignored")
+		return false
+	}
+	s.enterLink(link)
+	metrics.IncrementQueryHints("backend", "applied")
+	return true
+}
+
+// countRouteHints counts the outcome of the route hint, if any.
+func (s *session) countRouteHints(hints *statementHints, outcome string) {
+	if hints == nil {
+		return
+	}
+	if hints.backend != "" {
+		metrics.IncrementQueryHints("backend", outcome)
+	} else if hints.route != "" {
+		metrics.IncrementQueryHints("route", outcome)
+	}
+}
+
+// pickReader returns the replica the session's reads are routed to: the
+// previous one while it stays in the read pool and has executed the
+// session's writes, or else one picked by weight, preferring replicas known
+// to have executed them. It returns nil if the pool is empty.
+func (s *session) pickReader() *backends.Backend {
+	maxLag := config.CFG.ReplicaMaxLag
+	if !config.CFG.ReadWriteSplit || config.CFG.ReplicaLagCheckInterval <= 0 {
+		// Without lag checks the lag is never known.
+		maxLag = 0
+	}
+	current := s.reader
+	if current != nil && !current.Readable(maxLag) {
+		current = nil
+	}
+	if current != nil && s.caughtUp(current) {
+		return current
+	}
+
+	reader := backends.PickReplica(maxLag, s.caughtUp)
+	if reader == nil {
+		// Wait for the current replica to catch up, or for another one.
+		reader = current
+	}
+	if reader == nil {
+		reader = backends.PickReplica(maxLag, nil)
+	}
+	if s.reader != nil && s.reader != reader {
+		s.closeLink(s.reader)
+	}
+	s.reader = reader
+	return reader
+}
+
+// readLink returns the session's link to replica, synced with the session,
+// and opens it if there is none. Links that were lost are opened again.
+func (s *session) readLink(replica *backends.Backend) (*backendLink, error) {
+	if link, ok := s.links[replica]; ok {
+		err := s.syncLink(link)
+		if err == nil {
+			return link, nil
+		}
+		log.Printf("Reopening link [%d] to %s: %v", s.conn.ID, replica.Address, err)
+		s.closeLink(replica)
+	}
+
+	if failed, ok := s.linkFailures[replica]; ok && time.Since(failed) < linkRetryInterval {
+		return nil, errLinkBackoff
+	}
+	link, err := s.openLink(replica)
+	if err != nil {
+		s.linkFailures[replica] = time.Now()
+		return nil, err
+	}
+	delete(s.linkFailures, replica)
+	s.links[replica] = link
+	return link, nil
+}
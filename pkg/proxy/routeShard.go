@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sharding"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// errUnknown is ER_UNKNOWN_ERROR, answered to statements the shard router
+// cannot run.
+const errUnknown uint16 = 1105
+
+// stmtCursorFlags are the flags of COM_STMT_EXECUTE opening a cursor.
+const stmtCursorFlags = 0x0f
+
+// shardRoute is how routeShard handled a statement.
+type shardRoute int
+
+const (
+	// shardNone means the statement does not use sharded tables.
+	shardNone shardRoute = iota
+	// shardHome means the statement runs on the session's own backend,
+	// which belongs to its shard.
+	shardHome
+	// shardLink means the statement was routed to a link; call leaveLink
+	// after the response was relayed.
+	shardLink
+	// shardAnswered means the proxy answered the statement.
+	shardAnswered
+)
+
+// routeShard routes a COM_QUERY or COM_STMT_EXECUTE statement on sharded
+// tables to a backend of the shard its shard key maps to, taken from the
+// WHERE clause or the inserted row, or from the prepared statement's
+// parameters. Statements without a key are rejected or broadcast to all
+// shards, as the shard map's policy says. Statements of sessions pinned to
+// their backend, such as in transactions, only run there if it belongs to
+// their shard.
+func (s *session) routeShard(cmd byte, packet *protocol.Packet, req *rules.Request) (shardRoute, error) {
+	m := sharding.Current()
+	if m == nil || req == nil || (cmd != protocol.ComQuery && cmd != protocol.ComStmtExecute) {
+		return shardNone, nil
+	}
+	switch req.StatementType {
+	case "SELECT", "INSERT", "REPLACE", "UPDATE", "DELETE":
+	default:
+		return shardNone, nil
+	}
+	if !m.Sharded(sqlparse.Tables(req.Query)) {
+		return shardNone, nil
+	}
+
+	var stmt *preparedStatement
+	var execute *protocol.StmtExecute
+	if cmd == protocol.ComStmtExecute {
+		stmt = s.statements[statementID(packet.Payload)]
+		execute = &protocol.StmtExecute{}
+		if err := execute.Decode(packet.Payload, stmt.params, stmt.types); err != nil {
+			return s.rejectShard("", "failed to decode statement parameters: "+err.Error())
+		}
+		stmt.types = execute.ParamTypes
+		if execute.Flags&stmtCursorFlags != 0 {
+			return s.rejectShard("", "cursors are not supported on sharded tables")
+		}
+	}
+
+	key, found := sqlparse.FindShardKey(req.Query, m.Column)
+	pinned := s.sessionState
+	switch {
+	case s.conn.StatusFlags&protocol.ServerStatusInTrans != 0:
+		pinned = "an open transaction"
+	case s.conn.StatusFlags&protocol.ServerStatusAutocommit == 0:
+		pinned = "autocommit disabled"
+	}
+	if !found {
+		if m.Keyless == sharding.KeylessBroadcast && cmd == protocol.ComQuery && pinned == "" {
+			return shardAnswered, s.broadcastStatement(packet, m.All())
+		}
+		return s.rejectShard("", fmt.Sprintf("statement on sharded tables has no single value of shard key %s", m.Column))
+	}
+
+	value := key.Value
+	if key.Param >= 0 {
+		ok := execute != nil && key.Param < len(execute.Params)
+		if ok {
+			value, ok = paramKey(execute.Params[key.Param])
+		}
+		if !ok {
+			return s.rejectShard("", fmt.Sprintf("shard key %s is NULL or not a number or string", m.Column))
+		}
+	}
+	shard, err := m.Shard(value)
+	if err != nil {
+		return s.rejectShard("", err.Error())
+	}
+
+	home := backends.Register(s.conn.BackendAddress())
+	if home.Tagged(shard) {
+		metrics.IncrementShardStatements(shard, "routed")
+		return shardHome, nil
+	}
+	if pinned != "" {
+		return s.rejectShard(shard, fmt.Sprintf("statement for shard %s cannot run on %s in a session with %s", shard, home.Address, pinned))
+	}
+
+	target := backends.PickTagged(shard)
+	if target == nil {
+		return s.rejectShard(shard, fmt.Sprintf("no backend of shard %s is available", shard))
+	}
+	link, err := s.readLink(target)
+	if err != nil {
+		log.Printf("Failed to route statement of connection [%d] to shard %s: %v", s.conn.ID, shard, err)
+		return s.rejectShard(shard, fmt.Sprintf("could not connect to shard %s: %v", shard, err))
+	}
+	if stmt != nil {
+		id, err := s.prepareOnLink(link, stmt)
+		if err != nil {
+			s.closeLink(target)
+			return s.rejectShard(shard, fmt.Sprintf("could not prepare statement on shard %s: %v", shard, err))
+		}
+		packet.Payload = executeOnLink(packet.Payload, stmt, id)
+	}
+
+	s.enterLink(link)
+	metrics.IncrementShardStatements(shard, "routed")
+	return shardLink, nil
+}
+
+// rejectShard answers a statement the shard router cannot run with an error.
+func (s *session) rejectShard(shard, message string) (shardRoute, error) {
+	metrics.IncrementShardStatements(shard, "rejected")
+	return shardAnswered, s.writeError(1, errUnknown, "HY000", message)
+}
+
+// paramKey formats a prepared statement parameter as a shard key.
+func paramKey(param interface{}) (string, bool) {
+	switch v := param.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
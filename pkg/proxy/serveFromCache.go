@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/supporttools/go-sql-proxy/pkg/cache"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// pendingCacheEntry describes where to cache the captured result of a statement.
+type pendingCacheEntry struct {
+	key    string
+	rule   *cache.Rule
+	tables []string
+}
+
+// serveFromCache answers a COM_QUERY from the result cache. It returns true if
+// the client was answered; otherwise, if the statement is cacheable, the
+// response relayed for it is captured so storeInCache can cache it.
+func (s *session) serveFromCache(req *rules.Request) (bool, error) {
+	if !cache.Enabled() || req.StatementType != "SELECT" {
+		return false, nil
+	}
+	// Inside a transaction the client must see its own uncommitted writes.
+	// Session variables that are not replayed are not part of the cache key.
+	if s.conn.StatusFlags&protocol.ServerStatusInTrans != 0 || s.sessionState != "" || !sqlparse.Deterministic(req.Query) {
+		return false, nil
+	}
+
+	rule := cache.FindRule(req)
+	if rule == nil {
+		return false, nil
+	}
+
+	key := cache.Key(req.User, req.Schema, s.cacheSession(), req.Query)
+	rs, ok := cache.Get(key, rule)
+	if !ok {
+		s.cacheEntry = &pendingCacheEntry{
+			key:    key,
+			rule:   rule,
+			tables: qualifyTables(req.Schema, sqlparse.Tables(req.Query)),
+		}
+		s.startCapture(rule.MaxEntrySize)
+		return false, nil
+	}
+
+	statusFlags := s.conn.StatusFlags &^ (protocol.ServerMoreResultsExists | protocol.ServerSessionStateChanged)
+	for _, p := range rs.Encode(s.conn.Capabilities, statusFlags) {
+		if err := s.writeClient(p); err != nil {
+			return true, err
+		}
+	}
+	return true, s.flushClient()
+}
+
+// cacheSession describes the session state cached results depend on: the
+// character set negotiated in the handshake, whether result sets end with
+// EOF packets, and the session's SET statements, in the order they ran.
+func (s *session) cacheSession() string {
+	var sb strings.Builder
+	if s.handshake != nil {
+		sb.WriteString(strconv.Itoa(int(s.handshake.CharacterSet)))
+	}
+	if s.conn.Capabilities&protocol.ClientDeprecateEOF != 0 {
+		sb.WriteString(" deprecate_eof")
+	}
+	for _, set := range s.replay {
+		sb.WriteString("\x00")
+		sb.WriteString(set.query)
+	}
+	return sb.String()
+}
+
+// qualifyTables qualifies table names without a schema with the given schema.
+func qualifyTables(schema string, tables []string) []string {
+	qualified := make([]string, len(tables))
+	for i, table := range tables {
+		if !strings.Contains(table, ".") {
+			table = schema + "." + table
+		}
+		qualified[i] = table
+	}
+	return qualified
+}
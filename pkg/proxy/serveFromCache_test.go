@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/supporttools/go-sql-proxy/pkg/cache"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// loadCacheRules activates a cache rule for statements reading the users table.
+func loadCacheRules(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cache.json")
+	data := []byte(`{"rules": [{"name": "users", "regex": "(?i)from users", "ttl": "1m"}]}`)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.LoadRules(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cache.Purge)
+}
+
+// usersResultSet is the result set the backend returns in cache tests.
+var usersResultSet = protocol.ResultSet{
+	Columns: []protocol.ColumnDefinition41{protocol.NewColumn("id", protocol.TypeLongLong), protocol.NewColumn("name", protocol.TypeVarString)},
+	Rows:    []protocol.TextRow{{[]byte("1"), []byte("alice")}, {[]byte("2"), nil}},
+}
+
+// query sends a COM_QUERY from the client of ts.
+func (ts *testSession) query(t *testing.T, query string) {
+	t.Helper()
+	send(t, ts.client, 0, append([]byte{protocol.ComQuery}, query...))
+}
+
+// answer reads the statement forwarded to the backend of ts and answers it
+// with usersResultSet and the given status flags.
+func (ts *testSession) answer(t *testing.T, query string, statusFlags uint16) {
+	t.Helper()
+	p := expect(t, ts.backend, 0, protocol.ComQuery)
+	if string(p.Payload[1:]) != query {
+		t.Errorf("backend received %q, want %q", p.Payload[1:], query)
+	}
+	for _, p := range usersResultSet.Encode(ts.conn.Capabilities, statusFlags) {
+		send(t, ts.backend, p.SequenceID, p.Payload)
+	}
+}
+
+// expectResultSet reads usersResultSet with the given status flags, framed
+// for the capabilities of ts, from the client of ts.
+func (ts *testSession) expectResultSet(t *testing.T, statusFlags uint16) {
+	t.Helper()
+	for _, want := range usersResultSet.Encode(ts.conn.Capabilities, statusFlags) {
+		got := expect(t, ts.client, want.SequenceID, want.Payload[0])
+		if !bytes.Equal(got.Payload, want.Payload) {
+			t.Errorf("packet %d = %x, want %x", want.SequenceID, got.Payload, want.Payload)
+		}
+	}
+}
+
+func TestServeFromCache(t *testing.T) {
+	loadCacheRules(t)
+	tests := []struct {
+		name         string
+		capabilities protocol.CapabilityFlag
+	}{
+		{"DEPRECATE_EOF", testCapabilities},
+		{"EOF", testCapabilities &^ protocol.ClientDeprecateEOF},
+	}
+	// The sessions share the cache: each must miss once, since results are
+	// cached per framing.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestSession(t)
+			ts.conn.Capabilities = tt.capabilities
+			done := ts.run(ts.handleCommands)
+
+			const query = "SELECT id, name FROM users"
+			ts.query(t, query)
+			ts.answer(t, query, protocol.ServerStatusAutocommit)
+			ts.expectResultSet(t, protocol.ServerStatusAutocommit)
+
+			// The backend does not take part in a hit: a statement forwarded
+			// to it would block until the deadline.
+			ts.query(t, query)
+			ts.expectResultSet(t, protocol.ServerStatusAutocommit)
+
+			ts.client.Close()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestServeFromCacheSkipsNonDeterministicQueries(t *testing.T) {
+	loadCacheRules(t)
+	ts := newTestSession(t)
+	done := ts.run(ts.handleCommands)
+
+	const query = "SELECT id, NOW() FROM users"
+	for i := 0; i < 2; i++ {
+		ts.query(t, query)
+		ts.answer(t, query, protocol.ServerStatusAutocommit)
+		ts.expectResultSet(t, protocol.ServerStatusAutocommit)
+	}
+
+	ts.client.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeFromCacheSkipsTransactions(t *testing.T) {
+	loadCacheRules(t)
+	ts := newTestSession(t)
+	ts.conn.StatusFlags |= protocol.ServerStatusInTrans
+	done := ts.run(ts.handleCommands)
+
+	const query = "SELECT id, name FROM users WHERE id < 10"
+	inTrans := uint16(protocol.ServerStatusAutocommit | protocol.ServerStatusInTrans)
+	for i := 0; i < 2; i++ {
+		ts.query(t, query)
+		ts.answer(t, query, inTrans)
+		ts.expectResultSet(t, inTrans)
+	}
+
+	ts.client.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
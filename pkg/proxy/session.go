@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/faults"
+	"github.com/supporttools/go-sql-proxy/pkg/gtid"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/shadow"
+)
+
+// session is the decoded command phase of a proxy connection. All packets are
+// read and written through it so the traffic metrics stay accurate.
+type session struct {
+	conn      *models.Connection
+	server    net.Conn
+	clientIn  *bufio.Reader
+	clientOut *bufio.Writer
+	serverIn  *bufio.Reader
+
+	// capture collects the relayed response of a statement to be cached or
+	// compared with the shadow backend.
+	capture *resultCapture
+	// cacheEntry describes where to cache the captured response.
+	cacheEntry *pendingCacheEntry
+	// shadow mirrors the session's statements to the shadow backend.
+	shadow *shadow.Session
+	// writtenTables are the tables written in the open transaction, which
+	// are invalidated in the result cache again when it ends.
+	writtenTables []string
+	// calledProcedure is true if a stored procedure ran in the open
+	// transaction, which purges the result cache again when it ends.
+	calledProcedure bool
+	// statements maps the IDs of prepared statements to the statements.
+	statements map[uint32]*preparedStatement
+	// timeout limits the statement whose response is being relayed.
+	timeout *statementTimeout
+	// watch detects the client disconnecting while a statement runs.
+	watch *clientWatch
+	// handshake is the client's handshake response, replayed to open
+	// backend connections when the session is moved.
+	handshake *protocol.HandshakeResponse41
+	// primary is the primary backend the session was proxied to, if any.
+	// The session follows it when another backend becomes the primary.
+	primary *backends.Backend
+	// sessionState describes session state that cannot be restored on
+	// another backend, such as session variables or table locks.
+	sessionState string
+	// replay are the SET statements replayed on new backend connections of
+	// the session, in the order they ran.
+	replay []setStatement
+	// replayVersion counts the changes to replay, so links to replicas
+	// replay it again before their next read.
+	replayVersion int
+	// links are the session's connections to replicas, opened when reads
+	// are first routed there.
+	links map[*backends.Backend]*backendLink
+	// linkFailures records when links to replicas last failed to open.
+	linkFailures map[*backends.Backend]time.Time
+	// reader is the replica the session's reads are routed to.
+	reader *backends.Backend
+	// home is the session's own backend connection while a read runs on a
+	// link.
+	home *homeConn
+	// gtids are the GTIDs of the session's writes, which reads routed to
+	// replicas must see.
+	gtids gtid.Set
+	// gtidVersion counts the changes to gtids, so links to replicas that
+	// caught up with them are not checked again.
+	gtidVersion int
+	// trackingGTIDs is true while the backend reports the GTIDs of the
+	// session's transactions in OK packets.
+	trackingGTIDs bool
+	// wrote is true if the session wrote since gtids was last read from its
+	// backend, which is needed when GTIDs are not tracked.
+	wrote bool
+	// seqShift is how far the sequence IDs of the client's packets are
+	// ahead of the backend's while a connection routed to another backend
+	// authenticates.
+	seqShift uint8
+	// cohort is the cohort the canary compares the session's statements
+	// in, or empty if it is not compared.
+	cohort string
+	// fault is the fault rule whose faults apply to the response being
+	// relayed, if any.
+	fault *faults.Rule
+	// faultRows counts the rows of the response relayed while fault drops
+	// the connection mid-result.
+	faultRows int
+	// idleSince is when the session last became idle, waiting for the
+	// client's next command.
+	idleSince time.Time
+}
+
+// newSession creates the session of connection c relayed to server.
+func newSession(c *models.Connection, server net.Conn) *session {
+	return &session{
+		conn:      c,
+		server:    server,
+		clientIn:  bufio.NewReader(io.TeeReader(c.Conn, metrics.NewCounterWriter(metrics.DataFromClient))),
+		clientOut: bufio.NewWriter(c.Conn),
+		serverIn:  bufio.NewReader(io.TeeReader(server, metrics.NewCounterWriter(metrics.DataToClient))),
+
+		statements:   make(map[uint32]*preparedStatement),
+		links:        make(map[*backends.Backend]*backendLink),
+		linkFailures: make(map[*backends.Backend]time.Time),
+	}
+}
+
+// readClient reads the next packet sent by the client.
+func (s *session) readClient() (*protocol.Packet, error) {
+	return protocol.ReadPacket(s.clientIn)
+}
+
+// writeClient queues a packet for the client. Call flushClient to send it.
+func (s *session) writeClient(p *protocol.Packet) error {
+	_, err := s.clientOut.Write(p.Encode())
+	return err
+}
+
+// flushClient sends all queued packets to the client.
+func (s *session) flushClient() error {
+	return s.clientOut.Flush()
+}
+
+// readServer reads the next packet sent by the server.
+func (s *session) readServer() (*protocol.Packet, error) {
+	return protocol.ReadPacket(s.serverIn)
+}
+
+// writeServer sends a packet to the server.
+func (s *session) writeServer(p *protocol.Packet) error {
+	_, err := s.server.Write(p.Encode())
+	return err
+}
+
+// relayServerPacket reads the next packet from the server and queues it for the client.
+func (s *session) relayServerPacket() (*protocol.Packet, error) {
+	p, err := s.readServer()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Payload) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p.SequenceID += s.seqShift
+	if s.timeout != nil {
+		s.timeout.translateError(p)
+	}
+	if s.capture != nil {
+		s.capture.add(p)
+	}
+	if err := s.writeClient(p); err != nil {
+		return nil, err
+	}
+	return p, s.throttle(len(p.Payload) + 4)
+}
+
+// writeError sends an ERR packet with sequence ID seq to the client.
+func (s *session) writeError(seq uint8, code uint16, sqlState, message string) error {
+	errPacket := protocol.ERRPacket{Code: code, SQLState: sqlState, Message: message}
+	if err := s.writeClient(&protocol.Packet{SequenceID: seq, Payload: errPacket.Encode()}); err != nil {
+		return err
+	}
+	return s.flushClient()
+}
+
+// passthrough stops decoding and relays the rest of the session as raw bytes.
+func (s *session) passthrough() error {
+	s.conn.SetActivity(models.StatePassthrough, "")
+	if err := s.flushClient(); err != nil {
+		return err
+	}
+	if err := forwardBuffered(s.serverIn, s.conn.Conn); err != nil {
+		return err
+	}
+	if err := forwardBuffered(s.clientIn, s.server); err != nil {
+		return err
+	}
+	return transferData(s.conn, s.server)
+}
+
+// forwardBuffered writes the data already buffered by r to w.
+func forwardBuffered(r *bufio.Reader, w io.Writer) error {
+	n := r.Buffered()
+	if n == 0 {
+		return nil
+	}
+	buf, err := r.Peek(n)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
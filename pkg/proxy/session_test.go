@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// testCapabilities are the capabilities of the clients in session tests.
+const testCapabilities = protocol.ClientProtocol41 | protocol.ClientSecureConn | protocol.ClientPluginAuth |
+	protocol.ClientTransactions | protocol.ClientDeprecateEOF
+
+// testSession is a session between a client and a backend connected with
+// in-memory pipes, for tests that play both ends.
+type testSession struct {
+	*session
+	client  net.Conn
+	backend net.Conn
+}
+
+// newTestSession creates a session whose client and backend ends are
+// returned for the test to play.
+func newTestSession(t *testing.T) *testSession {
+	t.Helper()
+	client, proxyClient := net.Pipe()
+	proxyServer, backend := net.Pipe()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, conn := range []net.Conn{client, proxyClient, proxyServer, backend} {
+		if err := conn.SetDeadline(deadline); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		client.Close()
+		backend.Close()
+		proxyClient.Close()
+		proxyServer.Close()
+	})
+
+	c := NewConnection("127.0.0.1", 3306, proxyClient, 1, true)
+	c.SetBackend("127.0.0.1:3306", proxyServer)
+	c.Capabilities = testCapabilities
+	c.StatusFlags = protocol.ServerStatusAutocommit
+	return &testSession{session: newSession(c, proxyServer), client: client, backend: backend}
+}
+
+// run runs f, the proxy side of the test, in the background and returns a
+// channel receiving its error.
+func (ts *testSession) run(f func() error) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- f() }()
+	return done
+}
+
+// expect reads the next packet from conn and fails the test unless it has
+// sequence ID seq and starts with header.
+func expect(t *testing.T, conn net.Conn, seq uint8, header byte) *protocol.Packet {
+	t.Helper()
+	p, err := protocol.ReadPacket(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SequenceID != seq {
+		t.Errorf("sequence ID = %d, want %d", p.SequenceID, seq)
+	}
+	if len(p.Payload) == 0 || p.Payload[0] != header {
+		t.Fatalf("packet = %x, want header 0x%02x", p.Payload, header)
+	}
+	return p
+}
+
+// send writes a packet with sequence ID seq to conn.
+func send(t *testing.T, conn net.Conn, seq uint8, payload []byte) {
+	t.Helper()
+	if err := protocol.WritePacket(conn, seq, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ok returns the payload of an OK packet with the given status flags.
+func ok(statusFlags uint16) []byte {
+	return protocol.OKPacket{StatusFlags: statusFlags}.Encode(testCapabilities)
+}
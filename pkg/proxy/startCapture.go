@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// resultCapture collects the packets of a response up to a size limit.
+type resultCapture struct {
+	limit    int
+	packets  []*protocol.Packet
+	size     int
+	overflow bool
+}
+
+// add records a relayed packet, dropping the capture once it exceeds its limit.
+func (c *resultCapture) add(p *protocol.Packet) {
+	if c.overflow {
+		return
+	}
+	c.size += len(p.Payload)
+	if c.size > c.limit {
+		c.overflow = true
+		c.packets = nil
+		return
+	}
+	c.packets = append(c.packets, p)
+}
+
+// startCapture captures the response to the current command, up to limit
+// payload bytes, raising the limit if a capture was already started.
+func (s *session) startCapture(limit int) {
+	if s.capture == nil {
+		s.capture = &resultCapture{limit: limit}
+		return
+	}
+	s.capture.limit = max(s.capture.limit, limit)
+}
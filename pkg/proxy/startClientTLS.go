@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/models"
+	"github.com/supporttools/go-sql-proxy/pkg/pcap"
+)
+
+// startClientTLS terminates the TLS of a client that sent an SSLRequest. TLS
+// is layered below the packet capture tap, so captures contain plaintext.
+func startClientTLS(c *models.Connection, tlsConfig *tls.Config) error {
+	var conn *tls.Conn
+	if tap, ok := c.Conn.(*pcap.Conn); ok {
+		conn = tls.Server(tap.Conn, tlsConfig)
+		tap.Conn = conn
+	} else {
+		conn = tls.Server(c.Conn, tlsConfig)
+		c.Conn = conn
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(connectTimeout)); err != nil {
+		return err
+	}
+	if err := conn.Handshake(); err != nil {
+		metrics.IncrementClientTLSSessions("failed")
+		return err
+	}
+	metrics.IncrementClientTLSSessions("terminated")
+	return conn.SetDeadline(time.Time{})
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+)
+
+// Policies for statements whose client disconnected before they completed.
+const (
+	disconnectKillOff        = "off"
+	disconnectKillQuery      = "query"
+	disconnectKillConnection = "connection"
+)
+
+// clientWatch watches the client connection while a statement runs.
+type clientWatch struct {
+	done chan struct{}
+}
+
+// startClientWatch watches for the client disconnecting while the response
+// to a statement is outstanding and kills the statement on the backend
+// according to the configured policy.
+func (s *session) startClientWatch() {
+	policy := config.CFG.ClientDisconnectKill
+	if policy != disconnectKillQuery && policy != disconnectKillConnection {
+		return
+	}
+
+	w := &clientWatch{done: make(chan struct{})}
+	s.watch = w
+	go func() {
+		defer close(w.done)
+
+		// Peek returns as soon as the client sends anything or the connection
+		// is closed; stopClientWatch interrupts it with a read deadline.
+		_, err := s.clientIn.Peek(1)
+		if err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+			return
+		}
+
+		metrics.IncrementClientDisconnectKills(policy)
+		log.Printf("Client of connection [%d] disconnected during a statement: %v", s.conn.ID, err)
+		if err := killBackendThread(s.conn, policy == disconnectKillConnection, "client_disconnect"); err != nil {
+			log.Printf("Failed to kill statement of disconnected client on connection [%d]: %v", s.conn.ID, err)
+		}
+	}()
+}
+
+// stopClientWatch stops watching the client and waits until the watch,
+// including any kill it issued, has finished. The session may read from the
+// client again afterwards.
+func (s *session) stopClientWatch() {
+	w := s.watch
+	if w == nil {
+		return
+	}
+	s.watch = nil
+
+	if err := s.conn.Conn.SetReadDeadline(time.Unix(1, 0)); err != nil {
+		log.Printf("Failed to interrupt client watch on connection [%d]: %v", s.conn.ID, err)
+	}
+	<-w.done
+	if err := s.conn.Conn.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear read deadline on connection [%d]: %v", s.conn.ID, err)
+	}
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/timeouts"
+)
+
+// MySQL error codes of interrupted statements.
+const (
+	// errQueryInterrupted is ER_QUERY_INTERRUPTED, answered to statements killed with KILL QUERY.
+	errQueryInterrupted uint16 = 1317
+	// errQueryTimeout is ER_QUERY_TIMEOUT, which MySQL reports for max_execution_time.
+	errQueryTimeout uint16 = 3024
+)
+
+// killGracePeriod is how long the backend may take to answer a killed
+// statement before the proxy stops waiting and closes the connection.
+const killGracePeriod = 10 * time.Second
+
+// statementTimeout limits the time a statement may take to complete.
+type statementTimeout struct {
+	// mu is held while the statement is killed, and guards finished.
+	mu      sync.Mutex
+	timer   *time.Timer
+	timeout time.Duration
+	rule    string
+	// address and threadID are the backend and thread the statement runs on.
+	address  string
+	threadID uint32
+	// finished is set once the response to the statement was read, after
+	// which the thread must not be killed anymore.
+	finished bool
+	expired  atomic.Bool
+}
+
+// startStatementTimeout kills the statement described by req on the backend
+// if its response does not complete within the timeout configured for it, or
+// within override if it is greater than 0.
+func (s *session) startStatementTimeout(req *rules.Request, override time.Duration) {
+	if req == nil {
+		return
+	}
+	timeout, rule := override, "hint"
+	if override <= 0 {
+		if !timeouts.Enabled() {
+			return
+		}
+		timeout, rule = timeouts.For(req)
+	}
+	if timeout <= 0 {
+		return
+	}
+
+	t := &statementTimeout{
+		timeout:  timeout,
+		rule:     rule,
+		address:  s.conn.BackendAddress(),
+		threadID: s.conn.BackendThreadID.Load(),
+	}
+	server := s.server
+	t.timer = time.AfterFunc(timeout, func() {
+		// The lock is held while killing, so the response cannot be marked
+		// finished, and the next statement of the session cannot be sent,
+		// before the KILL has been executed.
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.finished {
+			return
+		}
+
+		t.expired.Store(true)
+		metrics.IncrementQueryTimeouts(rule)
+		log.Printf("Statement on connection [%d] exceeded timeout of %s (rule %q): %s", s.conn.ID, timeout, rule, req.Query)
+		if err := killThread(t.address, t.threadID, false, "timeout"); err != nil {
+			log.Printf("Failed to kill timed out statement on connection [%d]: %v", s.conn.ID, err)
+		} else {
+			log.Printf("Killed backend thread %d of connection [%d] (timeout)", t.threadID, s.conn.ID)
+		}
+
+		// Stop waiting if the backend does not answer the killed statement.
+		if err := server.SetReadDeadline(time.Now().Add(killGracePeriod)); err != nil {
+			log.Printf("Failed to set read deadline on connection [%d]: %v", s.conn.ID, err)
+		}
+	})
+	s.timeout = t
+}
+
+// finish marks the response to the statement as read, so the timeout no
+// longer kills its thread. If a kill is in progress, it waits for it.
+func (t *statementTimeout) finish() {
+	t.timer.Stop()
+	t.mu.Lock()
+	t.finished = true
+	t.mu.Unlock()
+}
+
+// stopStatementTimeout stops the timeout of the statement that completed.
+func (s *session) stopStatementTimeout() {
+	t := s.timeout
+	if t == nil {
+		return
+	}
+	s.timeout = nil
+
+	t.finish()
+	if t.expired.Load() {
+		if err := s.server.SetReadDeadline(time.Time{}); err != nil {
+			log.Printf("Failed to clear read deadline on connection [%d]: %v", s.conn.ID, err)
+		}
+	}
+}
+
+// translateError replaces the error of a statement killed for exceeding its
+// timeout with one that tells the client why it was interrupted.
+func (t *statementTimeout) translateError(p *protocol.Packet) {
+	if !t.expired.Load() || p.Payload[0] != protocol.ERRHeader {
+		return
+	}
+
+	errPacket := &protocol.ERRPacket{}
+	if err := errPacket.Decode(p.Payload); err != nil || errPacket.Code != errQueryInterrupted {
+		return
+	}
+
+	errPacket.Code = errQueryTimeout
+	errPacket.SQLState = "HY000"
+	errPacket.Message = fmt.Sprintf("Query execution was interrupted, proxy statement timeout of %s exceeded (rule %q)", t.timeout, t.rule)
+	p.Payload = errPacket.Encode()
+}
@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+// killServer starts a backend that accepts any credentials and answers every
+// statement with OK. It returns its address and the statements it received.
+func killServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	statements := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveKillConnection(conn, statements)
+		}
+	}()
+	return l.Addr().String(), statements
+}
+
+// serveKillConnection runs the handshake and command phase of a killServer connection.
+func serveKillConnection(conn net.Conn, statements chan<- string) {
+	defer conn.Close()
+
+	capabilities := protocol.ClientProtocol41 | protocol.ClientSecureConn | protocol.ClientPluginAuth | protocol.ClientTransactions
+	handshake := []byte{10}
+	handshake = append(handshake, "8.0.36\x00"...)
+	handshake = binary.LittleEndian.AppendUint32(handshake, 7)
+	handshake = append(handshake, "12345678\x00"...)
+	handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities))
+	handshake = append(handshake, 45)
+	handshake = binary.LittleEndian.AppendUint16(handshake, protocol.ServerStatusAutocommit)
+	handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities>>16))
+	handshake = append(handshake, 21)
+	handshake = append(handshake, make([]byte, 10)...)
+	handshake = append(handshake, "123456789012\x00mysql_native_password\x00"...)
+	if protocol.WritePacket(conn, 0, handshake) != nil {
+		return
+	}
+	if _, err := protocol.ReadPacket(conn); err != nil {
+		return
+	}
+	if protocol.WritePacket(conn, 2, ok(protocol.ServerStatusAutocommit)) != nil {
+		return
+	}
+
+	for {
+		p, err := protocol.ReadPacket(conn)
+		if err != nil || len(p.Payload) == 0 || p.Payload[0] == protocol.ComQuit {
+			return
+		}
+		statements <- string(p.Payload[1:])
+		if protocol.WritePacket(conn, 1, ok(protocol.ServerStatusAutocommit)) != nil {
+			return
+		}
+	}
+}
+
+// interrupted returns the payload of the ERR packet of a killed statement.
+func interrupted() []byte {
+	return protocol.ERRPacket{Code: errQueryInterrupted, SQLState: "70100", Message: "Query execution was interrupted"}.Encode()
+}
+
+func TestStatementTimeoutKillsStatement(t *testing.T) {
+	address, statements := killServer(t)
+	ts := newTestSession(t)
+	ts.conn.SetBackend(address, ts.server)
+	ts.conn.BackendThreadID.Store(42)
+
+	ts.startStatementTimeout(&rules.Request{Query: "SELECT SLEEP(10)"}, 50*time.Millisecond)
+	done := ts.run(func() error {
+		_, err := ts.forwardResponse(protocol.ComQuery)
+		return err
+	})
+
+	select {
+	case statement := <-statements:
+		if statement != "KILL QUERY 42" {
+			t.Errorf("backend received %q, want KILL QUERY 42", statement)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the timed out statement was not killed")
+	}
+
+	// The interrupted statement is reported as timed out.
+	send(t, ts.backend, 1, interrupted())
+	expectError(t, ts.client, 1, errQueryTimeout)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	ts.stopStatementTimeout()
+}
+
+func TestStatementTimeoutSparesFinishedStatement(t *testing.T) {
+	address, statements := killServer(t)
+	ts := newTestSession(t)
+	ts.conn.SetBackend(address, ts.server)
+	ts.conn.BackendThreadID.Store(42)
+
+	ts.startStatementTimeout(&rules.Request{Query: "SELECT 1"}, 50*time.Millisecond)
+	done := ts.run(func() error {
+		_, err := ts.forwardResponse(protocol.ComQuery)
+		return err
+	})
+	send(t, ts.backend, 1, ok(protocol.ServerStatusAutocommit))
+	expect(t, ts.client, 1, protocol.OKHeader)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// The timeout expires before the session stops it, while the thread
+	// already runs the next statement or sits idle.
+	time.Sleep(200 * time.Millisecond)
+	ts.stopStatementTimeout()
+	select {
+	case statement := <-statements:
+		t.Errorf("backend received %q after the statement completed", statement)
+	default:
+	}
+}
+
+func TestStatementTimeoutTranslateError(t *testing.T) {
+	other := protocol.ERRPacket{Code: 1064, SQLState: "42000", Message: "syntax error"}.Encode()
+	tests := []struct {
+		name    string
+		expired bool
+		payload []byte
+		want    uint16
+	}{
+		{"expired and interrupted", true, interrupted(), errQueryTimeout},
+		{"killed by someone else", false, interrupted(), errQueryInterrupted},
+		{"expired with another error", true, other, 1064},
+	}
+	for _, tt := range tests {
+		timeout := &statementTimeout{timeout: time.Second, rule: "slow"}
+		timeout.expired.Store(tt.expired)
+		p := &protocol.Packet{SequenceID: 1, Payload: tt.payload}
+		timeout.translateError(p)
+
+		var errPacket protocol.ERRPacket
+		if err := errPacket.Decode(p.Payload); err != nil {
+			t.Fatal(err)
+		}
+		if errPacket.Code != tt.want {
+			t.Errorf("%s: error code = %d, want %d", tt.name, errPacket.Code, tt.want)
+		}
+	}
+
+	timeout := &statementTimeout{}
+	timeout.expired.Store(true)
+	p := &protocol.Packet{SequenceID: 1, Payload: ok(0)}
+	timeout.translateError(p)
+	if p.Payload[0] != protocol.OKHeader {
+		t.Errorf("translateError() changed an OK packet to %x", p.Payload)
+	}
+}
@@ -0,0 +1,25 @@
+package proxy
+
+import (
+	"log"
+
+	"github.com/supporttools/go-sql-proxy/pkg/cache"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+)
+
+// storeInCache caches the result set captured for the statement serveFromCache
+// could not answer, once its response completed successfully.
+func (s *session) storeInCache(r *response, c *resultCapture) {
+	entry := s.cacheEntry
+	s.cacheEntry = nil
+	if entry == nil || c == nil || c.overflow || r == nil || r.err != nil || r.statusFlags&protocol.ServerMoreResultsExists != 0 {
+		return
+	}
+
+	rs, err := protocol.DecodeResultSet(c.packets, s.conn.Capabilities)
+	if err != nil {
+		log.Printf("Not caching result of %q: %v", entry.key, err)
+		return
+	}
+	cache.Put(entry.key, entry.rule, entry.tables, rs)
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// MySQL errors returned for KILL statements the proxy answers itself.
+const (
+	// errNoSuchThread is ER_NO_SUCH_THREAD.
+	errNoSuchThread uint16 = 1094
+	// errKillDenied is ER_KILL_DENIED_ERROR.
+	errKillDenied uint16 = 1095
+)
+
+// translateConnectionIDs maps the proxy connection IDs clients see to backend
+// thread IDs. KILL statements are rewritten to target the backend thread of
+// the given proxy connection, and CONNECTION_ID() is replaced with the proxy
+// connection ID. It returns true if the proxy answered the statement itself.
+func (s *session) translateConnectionIDs(packet *protocol.Packet, req *rules.Request) (bool, error) {
+	if id, queryOnly, ok := sqlparse.Kill(req.Query); ok && packet.Payload[0] == protocol.ComQuery {
+		return s.translateKill(packet, req, id, queryOnly)
+	}
+
+	if query, changed := sqlparse.ReplaceConnectionID(req.Query, s.conn.ID); changed {
+		s.replaceQuery(packet, req, query)
+	}
+	return false, nil
+}
+
+// translateKill handles KILL [QUERY] id for the proxy connection id.
+func (s *session) translateKill(packet *protocol.Packet, req *rules.Request, id uint64, queryOnly bool) (bool, error) {
+	target, ok := LookupConnection(id)
+	if !ok || target.BackendThreadID.Load() == 0 {
+		return true, s.writeError(1, errNoSuchThread, "HY000", fmt.Sprintf("Unknown thread id: %d", id))
+	}
+
+	// On the same backend, the backend checks the privileges itself. Sessions
+	// are compared by the backend they are on now, which fallbacks, routing
+	// and switchovers may have changed.
+	if target.BackendAddress() == s.conn.BackendAddress() {
+		statement := "KILL CONNECTION %d"
+		if queryOnly {
+			statement = "KILL QUERY %d"
+		}
+		s.replaceQuery(packet, req, fmt.Sprintf(statement, target.BackendThreadID.Load()))
+		return false, nil
+	}
+
+	if user, _ := target.Identity(); user != s.conn.User {
+		return true, s.writeError(1, errKillDenied, "HY000", fmt.Sprintf("You are not owner of thread %d", id))
+	}
+	if err := killBackendThread(target, !queryOnly, "client_kill"); err != nil {
+		log.Printf("Failed to kill connection [%d] for connection [%d]: %v", id, s.conn.ID, err)
+		return true, s.writeError(1, errNoSuchThread, "HY000", fmt.Sprintf("Unknown thread id: %d", id))
+	}
+
+	okPacket := protocol.OKPacket{Header: protocol.OKHeader, StatusFlags: s.conn.StatusFlags}
+	if err := s.writeClient(&protocol.Packet{SequenceID: 1, Payload: okPacket.Encode(s.conn.Capabilities)}); err != nil {
+		return true, err
+	}
+	return true, s.flushClient()
+}
+
+// replaceQuery replaces the statement text of a COM_QUERY or COM_STMT_PREPARE
+// packet and updates req to describe the new statement.
+func (s *session) replaceQuery(packet *protocol.Packet, req *rules.Request, query string) {
+	// The packet is re-encoded on write, which recomputes its length and
+	// splits it again if the statement grew past the maximum packet size.
+	packet.Payload = append([]byte{packet.Payload[0]}, query...)
+	*req = *s.newRequest(query)
+}
@@ -0,0 +1,189 @@
+package replay
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/supporttools/go-sql-proxy/pkg/capture"
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+)
+
+var logger = logging.SetupLogging()
+
+// sessionQueueSize is the number of commands buffered for a replayed session.
+// The reader waits for sessions that fall further behind.
+const sessionQueueSize = 1024
+
+// options are the command line options of the replay subcommand.
+type options struct {
+	file     string
+	target   string
+	user     string
+	password string
+	speed    float64
+	timeout  time.Duration
+	json     bool
+}
+
+// Run replays a capture file against a target backend and prints a report
+// comparing the replayed latencies and errors with the captured ones. It
+// returns the process exit code.
+func Run(args []string) int {
+	opts, err := parseOptions(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	report, err := replay(opts)
+	if err != nil {
+		logger.Errorf("Replay failed: %v", err)
+		return 1
+	}
+
+	if opts.json {
+		err = report.writeJSON(os.Stdout)
+	} else {
+		err = report.writeText(os.Stdout)
+	}
+	if err != nil {
+		logger.Errorf("Failed to write replay report: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// parseOptions parses the command line of the replay subcommand.
+func parseOptions(args []string) (options, error) {
+	var opts options
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.StringVar(&opts.file, "file", "", "capture file to replay")
+	fs.StringVar(&opts.target, "target", "127.0.0.1:3306", "address of the backend to replay against")
+	fs.StringVar(&opts.user, "user", "root", "user to connect as")
+	fs.StringVar(&opts.password, "password", "", "password of the user")
+	fs.Float64Var(&opts.speed, "speed", 1, "speed-up factor applied to the captured timing")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout of each replayed command")
+	fs.BoolVar(&opts.json, "json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	if opts.file == "" {
+		return opts, errors.New("replay: -file is required")
+	}
+	if opts.speed <= 0 {
+		return opts, errors.New("replay: -speed must be positive")
+	}
+	return opts, nil
+}
+
+// replay replays the capture file described by opts.
+func replay(opts options) (*report, error) {
+	file, err := os.Open(opts.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := capture.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	driverConfig := mysql.NewConfig()
+	driverConfig.User = opts.user
+	driverConfig.Passwd = opts.password
+	driverConfig.Net = "tcp"
+	driverConfig.Addr = opts.target
+	driverConfig.Timeout = opts.timeout
+	driverConfig.AllowNativePasswords = true
+
+	connector, err := mysql.NewConnector(driverConfig)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	// Sessions carry state, so connections are never reused between them.
+	db.SetMaxIdleConns(-1)
+
+	rep := newReport()
+	sessions := make(map[uint64]*session)
+	var wg sync.WaitGroup
+
+	open := func(id uint64, schema string) *session {
+		s := newSession(db, schema, opts.timeout, rep)
+		sessions[id] = s
+		rep.sessionStarted()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.run()
+		}()
+		return s
+	}
+
+	start := time.Now()
+	var first time.Duration
+	var last time.Duration
+	for n := 0; ; n++ {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Replay what was read from a capture file that was cut short.
+			logger.Warnf("Stopped reading capture file: %v", err)
+			break
+		}
+
+		// Preserve the time between records, scaled by the speed-up factor.
+		if n == 0 {
+			first = record.Offset
+		}
+		last = record.Offset
+		due := start.Add(time.Duration(float64(record.Offset-first) / opts.speed))
+		if wait := time.Until(due); wait > 0 {
+			time.Sleep(wait)
+		}
+
+		s := sessions[record.ConnectionID]
+		switch record.Type {
+		case capture.RecordSessionStart:
+			if s != nil {
+				s.close()
+			}
+			open(record.ConnectionID, record.Schema)
+		case capture.RecordCommand:
+			if s == nil {
+				// The session started before the capture did.
+				s = open(record.ConnectionID, "")
+			}
+			s.queue <- record
+		case capture.RecordSessionEnd:
+			if s != nil {
+				s.close()
+				delete(sessions, record.ConnectionID)
+			}
+		}
+	}
+
+	for _, s := range sessions {
+		s.close()
+	}
+	wg.Wait()
+
+	rep.captured = last - first
+	rep.replayed = time.Since(start)
+	return rep, nil
+}
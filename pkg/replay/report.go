@@ -0,0 +1,202 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// Latencies summarizes the latencies of a digest.
+type Latencies struct {
+	P50Seconds float64 `json:"p50Seconds"`
+	P95Seconds float64 `json:"p95Seconds"`
+	P99Seconds float64 `json:"p99Seconds"`
+}
+
+// DigestReport compares the captured and replayed commands of one digest.
+type DigestReport struct {
+	Digest          string    `json:"digest"`
+	Fingerprint     string    `json:"fingerprint"`
+	Commands        uint64    `json:"commands"`
+	Captured        Latencies `json:"captured"`
+	Replayed        Latencies `json:"replayed"`
+	ErrorMismatches uint64    `json:"errorMismatches"`
+	Failures        uint64    `json:"failures"`
+	LastMismatch    string    `json:"lastMismatch,omitempty"`
+}
+
+// Report is the result of a replay, with the digests that differ most first.
+type Report struct {
+	Sessions                uint64         `json:"sessions"`
+	ConnectFailures         uint64         `json:"connectFailures"`
+	Commands                uint64         `json:"commands"`
+	Skipped                 uint64         `json:"skipped"`
+	ErrorMismatches         uint64         `json:"errorMismatches"`
+	Failures                uint64         `json:"failures"`
+	CapturedDurationSeconds float64        `json:"capturedDurationSeconds"`
+	ReplayedDurationSeconds float64        `json:"replayedDurationSeconds"`
+	Digests                 []DigestReport `json:"digests"`
+}
+
+// digestStats accumulates the replayed commands of one digest.
+type digestStats struct {
+	report   DigestReport
+	captured []time.Duration
+	replayed []time.Duration
+}
+
+// report accumulates the outcome of a replay.
+type report struct {
+	mu       sync.Mutex
+	totals   Report
+	digests  map[string]*digestStats
+	captured time.Duration
+	replayed time.Duration
+}
+
+// newReport returns an empty report.
+func newReport() *report {
+	return &report{digests: make(map[string]*digestStats)}
+}
+
+// sessionStarted counts a replayed session.
+func (r *report) sessionStarted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.totals.Sessions++
+}
+
+// connectFailed counts a session that could not connect to the target.
+func (r *report) connectFailed(err error) {
+	logger.Warnf("Failed to connect replayed session: %v", err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.totals.ConnectFailures++
+	r.totals.Skipped++
+}
+
+// skipped counts a command that was not replayed.
+func (r *report) skipped() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.totals.Skipped++
+}
+
+// add records a replayed command against its captured latency and error code.
+func (r *report) add(query string, captured, replayed time.Duration, capturedCode uint16, err error) {
+	digest := sqlparse.Digest(query)
+	code, fromServer := errorCode(err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.digests[digest]
+	if !ok {
+		d = &digestStats{report: DigestReport{Digest: digest, Fingerprint: sqlparse.Normalize(query)}}
+		r.digests[digest] = d
+	}
+
+	r.totals.Commands++
+	d.report.Commands++
+	d.captured = append(d.captured, captured)
+	d.replayed = append(d.replayed, replayed)
+
+	switch {
+	case !fromServer:
+		r.totals.Failures++
+		d.report.Failures++
+		d.report.LastMismatch = err.Error()
+	case code != capturedCode:
+		r.totals.ErrorMismatches++
+		d.report.ErrorMismatches++
+		d.report.LastMismatch = fmt.Sprintf("captured error %d, replayed error %d: %s", capturedCode, code, query)
+	}
+}
+
+// result returns the finished report.
+func (r *report) result() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := r.totals
+	result.CapturedDurationSeconds = r.captured.Seconds()
+	result.ReplayedDurationSeconds = r.replayed.Seconds()
+	result.Digests = make([]DigestReport, 0, len(r.digests))
+	for _, d := range r.digests {
+		dr := d.report
+		dr.Captured = percentiles(d.captured)
+		dr.Replayed = percentiles(d.replayed)
+		result.Digests = append(result.Digests, dr)
+	}
+
+	sort.Slice(result.Digests, func(i, j int) bool {
+		a, b := result.Digests[i], result.Digests[j]
+		if a.ErrorMismatches+a.Failures != b.ErrorMismatches+b.Failures {
+			return a.ErrorMismatches+a.Failures > b.ErrorMismatches+b.Failures
+		}
+		if a.Commands != b.Commands {
+			return a.Commands > b.Commands
+		}
+		return a.Digest < b.Digest
+	})
+	return result
+}
+
+// percentiles returns the latency percentiles of durations.
+func percentiles(durations []time.Duration) Latencies {
+	if len(durations) == 0 {
+		return Latencies{}
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	at := func(p float64) float64 {
+		return sorted[int(p*float64(len(sorted)-1))].Seconds()
+	}
+	return Latencies{P50Seconds: at(0.50), P95Seconds: at(0.95), P99Seconds: at(0.99)}
+}
+
+// writeJSON writes the report as JSON.
+func (r *report) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r.result())
+}
+
+// writeText writes the report as a table.
+func (r *report) writeText(w io.Writer) error {
+	result := r.result()
+
+	fmt.Fprintf(w, "Sessions: %d (%d failed to connect)\n", result.Sessions, result.ConnectFailures)
+	fmt.Fprintf(w, "Commands: %d replayed, %d skipped\n", result.Commands, result.Skipped)
+	fmt.Fprintf(w, "Error mismatches: %d, failures: %d\n", result.ErrorMismatches, result.Failures)
+	fmt.Fprintf(w, "Duration: %.3fs captured, %.3fs replayed\n\n", result.CapturedDurationSeconds, result.ReplayedDurationSeconds)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIGEST\tCOMMANDS\tCAPTURED P50/P95/P99 MS\tREPLAYED P50/P95/P99 MS\tERRORS\tFINGERPRINT")
+	for _, d := range result.Digests {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%s\n",
+			d.Digest, d.Commands, formatLatencies(d.Captured), formatLatencies(d.Replayed),
+			d.ErrorMismatches+d.Failures, truncate(d.Fingerprint, 80))
+	}
+	return tw.Flush()
+}
+
+// formatLatencies formats latency percentiles in milliseconds.
+func formatLatencies(l Latencies) string {
+	return fmt.Sprintf("%.2f/%.2f/%.2f", l.P50Seconds*1000, l.P95Seconds*1000, l.P99Seconds*1000)
+}
+
+// truncate shortens s to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
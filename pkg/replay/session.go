@@ -0,0 +1,210 @@
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/supporttools/go-sql-proxy/pkg/capture"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// prepared is a replayed prepared statement.
+type prepared struct {
+	stmt   *sql.Stmt
+	query  string
+	params int
+	types  []protocol.ParamType
+}
+
+// session replays the commands of one captured session, in order, over its
+// own connection to the target.
+type session struct {
+	db      *sql.DB
+	schema  string
+	timeout time.Duration
+	report  *report
+	queue   chan *capture.Record
+
+	conn *sql.Conn
+	// statements maps the captured statement IDs to the replayed statements.
+	statements map[uint32]*prepared
+}
+
+// newSession returns a session that starts in schema.
+func newSession(db *sql.DB, schema string, timeout time.Duration, rep *report) *session {
+	return &session{
+		db:         db,
+		schema:     schema,
+		timeout:    timeout,
+		report:     rep,
+		queue:      make(chan *capture.Record, sessionQueueSize),
+		statements: make(map[uint32]*prepared),
+	}
+}
+
+// close ends the session once its queued commands have been replayed.
+func (s *session) close() {
+	close(s.queue)
+}
+
+// run replays the queued commands.
+func (s *session) run() {
+	defer func() {
+		for _, p := range s.statements {
+			p.stmt.Close()
+		}
+		if s.conn != nil {
+			s.conn.Close()
+		}
+	}()
+
+	for record := range s.queue {
+		if s.conn == nil {
+			if err := s.connect(); err != nil {
+				s.report.connectFailed(err)
+				// Drop the commands of a session that cannot connect.
+				for range s.queue {
+					s.report.skipped()
+				}
+				return
+			}
+		}
+		s.replay(record)
+	}
+}
+
+// connect opens the connection of the session.
+func (s *session) connect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	if s.schema != "" {
+		if _, err := conn.ExecContext(ctx, useQuery(s.schema)); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	s.conn = conn
+	return nil
+}
+
+// replay replays a captured command and records its outcome.
+func (s *session) replay(record *capture.Record) {
+	if len(record.Payload) == 0 {
+		s.report.skipped()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	cmd := record.Payload[0]
+	body := record.Payload[1:]
+	var query string
+	var err error
+	start := time.Now()
+
+	switch cmd {
+	case protocol.ComQuery:
+		query = string(body)
+		if _, _, ok := sqlparse.Kill(query); ok {
+			// Thread IDs of the captured sessions do not exist on the target.
+			s.report.skipped()
+			return
+		}
+		err = drain(s.conn.QueryContext(ctx, query))
+	case protocol.ComInitDB:
+		query = useQuery(string(body))
+		_, err = s.conn.ExecContext(ctx, query)
+	case protocol.ComPing:
+		query = protocol.CommandName(cmd)
+		err = s.conn.PingContext(ctx)
+	case protocol.ComStmtPrepare:
+		query = string(body)
+		var stmt *sql.Stmt
+		if stmt, err = s.conn.PrepareContext(ctx, query); err == nil {
+			s.statements[record.StatementID] = &prepared{stmt: stmt, query: query, params: int(record.Params)}
+		}
+	case protocol.ComStmtExecute:
+		p, args, ok := s.decodeExecute(record.Payload)
+		if !ok {
+			s.report.skipped()
+			return
+		}
+		query = p.query
+		err = drain(p.stmt.QueryContext(ctx, args...))
+	case protocol.ComStmtClose:
+		if len(body) >= 4 {
+			id := binary.LittleEndian.Uint32(body)
+			if p, ok := s.statements[id]; ok {
+				p.stmt.Close()
+				delete(s.statements, id)
+			}
+		}
+		return
+	case protocol.ComQuit:
+		return
+	default:
+		s.report.skipped()
+		return
+	}
+
+	s.report.add(query, record.Latency, time.Since(start), record.ErrorCode, err)
+}
+
+// decodeExecute returns the statement and arguments of a COM_STMT_EXECUTE payload.
+func (s *session) decodeExecute(payload []byte) (*prepared, []interface{}, bool) {
+	if len(payload) < 5 {
+		return nil, nil, false
+	}
+	p, ok := s.statements[binary.LittleEndian.Uint32(payload[1:5])]
+	if !ok {
+		return nil, nil, false
+	}
+
+	execute := &protocol.StmtExecute{}
+	if err := execute.Decode(payload, p.params, p.types); err != nil {
+		logger.Debugf("Skipping undecodable execution of %q: %v", p.query, err)
+		return nil, nil, false
+	}
+	p.types = execute.ParamTypes
+	return p, execute.Params, true
+}
+
+// drain reads all rows of a result and returns the first error.
+func drain(rows *sql.Rows, err error) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// useQuery returns the USE statement that selects schema.
+func useQuery(schema string) string {
+	return "USE `" + strings.ReplaceAll(schema, "`", "``") + "`"
+}
+
+// errorCode returns the MySQL error code of err, and whether err came from the server.
+func errorCode(err error) (uint16, bool) {
+	if err == nil {
+		return 0, true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number, true
+	}
+	return 0, false
+}
@@ -0,0 +1,296 @@
+package replication
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/supporttools/go-sql-proxy/pkg/backends"
+	"github.com/supporttools/go-sql-proxy/pkg/config"
+	"github.com/supporttools/go-sql-proxy/pkg/gtid"
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+)
+
+var logger = logging.SetupLogging()
+
+// replicaStatusQueries are the statements reporting replication status, with
+// the column holding the lag, in the order they are tried. SHOW SLAVE STATUS
+// is for servers before MySQL 8.0.22.
+var replicaStatusQueries = []struct{ query, column string }{
+	{"SHOW REPLICA STATUS", "Seconds_Behind_Source"},
+	{"SHOW SLAVE STATUS", "Seconds_Behind_Master"},
+}
+
+// errLagUnknown is returned when a replica does not report its lag, such as
+// when replication is stopped.
+var errLagUnknown = errors.New("replication lag is not known")
+
+// Config configures the replication checks.
+type Config struct {
+	// Interval is the time between two checks of all replicas.
+	Interval time.Duration
+	// MaxLag is the lag beyond which replicas leave the read pool.
+	MaxLag time.Duration
+	// Query returns the lag in seconds in its first column, or is empty to
+	// read it from SHOW REPLICA STATUS.
+	Query string
+	// GTIDs enables reading gtid_executed of the replicas.
+	GTIDs bool
+}
+
+// lagChecker measures the replication lag of the replicas.
+type lagChecker struct {
+	cfg Config
+
+	mu sync.Mutex
+	// pools are the connection pools of the replicas checked.
+	pools map[string]*sql.DB
+	// readable records whether each replica was last in the read pool.
+	readable map[string]bool
+}
+
+// WatchLag measures the replication lag of the replicas of the backends file
+// every cfg.Interval until ctx is done. The lag is read from
+// Seconds_Behind_Source of SHOW REPLICA STATUS or, if cfg.Query is set, from
+// the first column it returns, such as the age of a heartbeat row. Replicas
+// whose lag exceeds cfg.MaxLag or is not known leave the read pool. With
+// cfg.GTIDs the GTID sets the replicas executed are cached as well.
+func WatchLag(ctx context.Context, cfg Config) {
+	c := &lagChecker{
+		cfg:      cfg,
+		pools:    make(map[string]*sql.DB),
+		readable: make(map[string]bool),
+	}
+	defer c.close()
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, cfg.Interval)
+		c.checkAll(checkCtx)
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll measures the lag of all replicas concurrently.
+func (c *lagChecker) checkAll(ctx context.Context) {
+	replicas := backends.Replicas()
+	checked := make(map[string]bool, len(replicas))
+	var wg sync.WaitGroup
+	for _, b := range replicas {
+		checked[b.Address] = true
+		db, err := c.pool(b.Address)
+		if err != nil {
+			c.record(b, 0, err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lag, err := c.measure(ctx, db)
+			c.record(b, lag, err)
+			if c.cfg.GTIDs {
+				c.readExecuted(ctx, b, db)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Forget backends that are no longer replicas.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for address, db := range c.pools {
+		if !checked[address] {
+			db.Close()
+			delete(c.pools, address)
+			delete(c.readable, address)
+			metrics.SetReplicationLag(address, 0, false)
+		}
+	}
+}
+
+// record stores the lag measured on b, or that it is not known because of
+// err, and logs b leaving or rejoining the read pool.
+func (c *lagChecker) record(b *backends.Backend, lag time.Duration, err error) {
+	known := err == nil
+	b.SetLag(lag, known)
+	metrics.SetReplicationLag(b.Address, lag.Seconds(), known)
+
+	readable := b.Readable(c.cfg.MaxLag)
+	c.mu.Lock()
+	previous, seen := c.readable[b.Address]
+	c.readable[b.Address] = readable
+	c.mu.Unlock()
+
+	switch {
+	case readable && seen && !previous:
+		logger.Infof("Replica %s rejoined the read pool with a lag of %s", b.Address, lag)
+	case readable || (seen && !previous):
+	case !known:
+		logger.Warnf("Replica %s is out of the read pool: %v", b.Address, err)
+	case lag > c.cfg.MaxLag:
+		logger.Warnf("Replica %s is out of the read pool: replication lag %s exceeds %s", b.Address, lag, c.cfg.MaxLag)
+	default:
+		logger.Warnf("Replica %s is out of the read pool", b.Address)
+	}
+}
+
+// readExecuted caches the GTID set the replica b behind db has executed. The
+// cache is cleared if it cannot be read.
+func (c *lagChecker) readExecuted(ctx context.Context, b *backends.Backend, db *sql.DB) {
+	var executed string
+	if err := db.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_executed").Scan(&executed); err != nil {
+		b.SetExecutedGTIDs(nil)
+		return
+	}
+	set, err := gtid.Parse(executed)
+	if err != nil {
+		logger.Warnf("Failed to parse gtid_executed of %s: %v", b.Address, err)
+		b.SetExecutedGTIDs(nil)
+		return
+	}
+	b.SetExecutedGTIDs(set)
+}
+
+// measure returns the replication lag of the replica behind db.
+func (c *lagChecker) measure(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	if c.cfg.Query != "" {
+		return heartbeat(ctx, db, c.cfg.Query)
+	}
+
+	var err error
+	for _, status := range replicaStatusQueries {
+		var lag time.Duration
+		if lag, err = replicaStatus(ctx, db, status.query, status.column); err == nil || errors.Is(err, errLagUnknown) {
+			return lag, err
+		}
+	}
+	return 0, err
+}
+
+// heartbeat runs query and returns the lag in seconds in the first column of
+// its first row.
+func heartbeat(ctx context.Context, db *sql.DB, query string) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	values, err := firstRow(rows)
+	if err != nil {
+		return 0, err
+	}
+	if values[0] == nil {
+		return 0, errLagUnknown
+	}
+	seconds, err := strconv.ParseFloat(string(values[0]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lag %q: %w", values[0], err)
+	}
+	return time.Duration(max(seconds, 0) * float64(time.Second)), nil
+}
+
+// replicaStatus runs query, a SHOW REPLICA STATUS statement, and returns the
+// lag in column.
+func replicaStatus(ctx context.Context, db *sql.DB, query, column string) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	index := -1
+	for i, name := range columns {
+		if strings.EqualFold(name, column) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return 0, fmt.Errorf("%s has no column %s", query, column)
+	}
+	values, err := firstRow(rows)
+	if err != nil {
+		return 0, err
+	}
+	if values[index] == nil {
+		// Replication is stopped or broken.
+		return 0, errLagUnknown
+	}
+	seconds, err := strconv.ParseInt(string(values[index]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", column, values[index], err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// firstRow returns the values of the first row of rows, or errLagUnknown if
+// there is none, such as for SHOW REPLICA STATUS on a server that is not a
+// replica.
+func firstRow(rows *sql.Rows) ([]sql.RawBytes, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, errors.Join(errLagUnknown, rows.Err())
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// pool returns the connection pool of the replica at address, opening it with
+// the proxy's database credentials.
+func (c *lagChecker) pool(address string) (*sql.DB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if db, ok := c.pools[address]; ok {
+		return db, nil
+	}
+
+	dsn := mysql.NewConfig()
+	dsn.User = config.CFG.SourceDatabaseUser
+	dsn.Passwd = config.CFG.SourceDatabasePassword
+	dsn.Net = config.BackendNet
+	dsn.Addr = address
+	db, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	c.pools[address] = db
+	return db, nil
+}
+
+// close closes the connection pools of all replicas.
+func (c *lagChecker) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, db := range c.pools {
+		db.Close()
+	}
+}
@@ -0,0 +1,155 @@
+package rewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+var logger = logging.SetupLogging()
+
+// Rule is a single rewrite rule. Matching rules are applied in ascending priority
+// order, each one to the statement as rewritten by the rules before it.
+//
+// With a regex, every match is replaced by Replace, which may reference capture
+// groups as $1 or ${name}. Without a regex, Replace substitutes the whole
+// statement, available as $0. Append is added to the end of the statement.
+type Rule struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	rules.Match
+	Replace string `json:"replace,omitempty"`
+	Append  string `json:"append,omitempty"`
+	DryRun  bool   `json:"dryRun,omitempty"`
+	Final   bool   `json:"final,omitempty"`
+
+	replace *regexp.Regexp
+}
+
+// RuleSet is the content of the rewrite rules file.
+type RuleSet struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// wholeStatement matches the complete statement for rules without a regex.
+var wholeStatement = regexp.MustCompile(`(?s)^.*$`)
+
+// ruleSet holds the active rules, swapped atomically on reload.
+var ruleSet atomic.Pointer[RuleSet]
+
+// dryRun makes every rule log its rewrite instead of applying it.
+var dryRun atomic.Bool
+
+// LoadRules loads and activates the rewrite rules from a JSON file.
+func LoadRules(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to read rewrite rules: %w", err)
+	}
+
+	set := &RuleSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("failed to parse rewrite rules: %w", err)
+	}
+
+	for i, rule := range set.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Replace == "" && rule.Append == "" {
+			return fmt.Errorf("rewrite rule %q: replace or append is required", rule.Name)
+		}
+		if err := rule.Compile(); err != nil {
+			return fmt.Errorf("rewrite rule %q: %w", rule.Name, err)
+		}
+		rule.replace = rule.Regexp()
+		if rule.replace == nil {
+			rule.replace = wholeStatement
+		}
+	}
+	sort.SliceStable(set.Rules, func(i, j int) bool {
+		return set.Rules[i].Priority < set.Rules[j].Priority
+	})
+
+	ruleSet.Store(set)
+	logger.Infof("Loaded %d rewrite rules from %s", len(set.Rules), path)
+	return nil
+}
+
+// SetDryRun enables or disables dry-run mode for all rules.
+func SetDryRun(enabled bool) {
+	dryRun.Store(enabled)
+}
+
+// Rules returns the active rewrite rules in evaluation order.
+func Rules() []*Rule {
+	if set := ruleSet.Load(); set != nil {
+		return set.Rules
+	}
+	return nil
+}
+
+// Enabled returns true if rewrite rules have been loaded.
+func Enabled() bool {
+	return ruleSet.Load() != nil
+}
+
+// Apply rewrites a statement and returns the new statement text and whether it changed.
+func Apply(r *rules.Request) (string, bool) {
+	set := ruleSet.Load()
+	if set == nil {
+		return r.Query, false
+	}
+
+	query := r.Query
+	current := *r
+	for _, rule := range set.Rules {
+		current.Query = query
+		if !rule.Matches(&current) {
+			continue
+		}
+
+		rewritten := rule.apply(query)
+		if rewritten == query {
+			continue
+		}
+
+		if dryRun.Load() || rule.DryRun {
+			metrics.IncrementRewriteRuleHits(rule.Name, true)
+			logger.Infof("Rewrite rule %q (dry run) would rewrite statement from %s: %q -> %q", rule.Name, r.User, query, rewritten)
+		} else {
+			metrics.IncrementRewriteRuleHits(rule.Name, false)
+			logger.Debugf("Rewrite rule %q rewrote statement from %s: %q -> %q", rule.Name, r.User, query, rewritten)
+			query = rewritten
+			// Later rules match the digest and type of the rewritten statement.
+			current.Digest = sqlparse.Digest(query)
+			current.StatementType = sqlparse.StatementType(query)
+		}
+
+		if rule.Final {
+			break
+		}
+	}
+
+	return query, query != r.Query
+}
+
+// apply returns query rewritten by the rule.
+func (rule *Rule) apply(query string) string {
+	if rule.Replace != "" {
+		query = rule.replace.ReplaceAllString(query, rule.Replace)
+	}
+	if rule.Append != "" {
+		query = strings.TrimRight(query, "; \t\r\n") + rule.Append
+	}
+	return query
+}
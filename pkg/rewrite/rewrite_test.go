@@ -0,0 +1,110 @@
+package rewrite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// loadRules activates the rewrite rules in data for the rest of the test.
+func loadRules(t *testing.T, data string) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rewrite.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ruleSet.Store(nil) })
+	return LoadRules(path)
+}
+
+func request(query string) *rules.Request {
+	return &rules.Request{
+		User:          "app",
+		Query:         query,
+		Digest:        sqlparse.Digest(query),
+		StatementType: sqlparse.StatementType(query),
+	}
+}
+
+func TestApply(t *testing.T) {
+	data := `{"rules": [
+		{"name": "index-hint", "priority": 1, "regex": "(?i)FROM orders WHERE", "replace": "FROM orders FORCE INDEX (idx_state) WHERE"},
+		{"name": "limit", "priority": 2, "statementTypes": ["SELECT"], "regex": "(?i)^SELECT \\* FROM (users)\\b", "replace": "SELECT * FROM app.$1", "append": " LIMIT 1000"},
+		{"name": "wrap", "priority": 3, "regex": "(?i)^SELECT COUNT", "replace": "/* counted */ $0", "final": true},
+		{"name": "after-final", "priority": 4, "regex": "counted", "replace": "never"},
+		{"name": "dry", "priority": 5, "regex": "(?i)^DELETE", "replace": "SELECT 1", "dryRun": true}
+	]}`
+	if err := loadRules(t, data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM orders WHERE state = 'new'", "SELECT * FROM orders FORCE INDEX (idx_state) WHERE state = 'new'"},
+		{"SELECT * FROM users;", "SELECT * FROM app.users LIMIT 1000"},
+		{"SELECT * FROM users", "SELECT * FROM app.users LIMIT 1000"},
+		{"UPDATE users SET name = 'x'", "UPDATE users SET name = 'x'"},
+		{"SELECT COUNT(*) FROM users", "/* counted */ SELECT COUNT(*) FROM users"},
+		{"DELETE FROM users", "DELETE FROM users"},
+	}
+	for _, tt := range tests {
+		got, changed := Apply(request(tt.query))
+		if got != tt.want || changed != (tt.want != tt.query) {
+			t.Errorf("Apply(%q) = %q, %v, want %q, %v", tt.query, got, changed, tt.want, tt.want != tt.query)
+		}
+	}
+}
+
+func TestApplyMatchesRewrittenStatement(t *testing.T) {
+	// The second rule matches the statement type the first one produced.
+	data := `{"rules": [
+		{"name": "soft-delete", "priority": 1, "regex": "(?i)^DELETE FROM users WHERE", "replace": "UPDATE users SET deleted = 1 WHERE"},
+		{"name": "audit", "priority": 2, "statementTypes": ["UPDATE"], "append": " /* audited */"},
+		{"name": "no-delete", "priority": 3, "statementTypes": ["DELETE"], "append": " LIMIT 0"}
+	]}`
+	if err := loadRules(t, data); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := Apply(request("DELETE FROM users WHERE id = 1"))
+	if want := "UPDATE users SET deleted = 1 WHERE id = 1 /* audited */"; got != want {
+		t.Errorf("Apply() = %q, want %q", got, want)
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	if err := loadRules(t, `{"rules": [{"name": "limit", "regex": "(?i)^SELECT", "append": " LIMIT 10"}]}`); err != nil {
+		t.Fatal(err)
+	}
+	SetDryRun(true)
+	t.Cleanup(func() { SetDryRun(false) })
+
+	const query = "SELECT * FROM users"
+	if got, changed := Apply(request(query)); got != query || changed {
+		t.Errorf("Apply(%q) in dry-run mode = %q, %v, want the statement unchanged", query, got, changed)
+	}
+}
+
+func TestLoadRulesRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"no rewrite", `{"rules": [{"name": "empty", "regex": "SELECT"}]}`},
+		{"bad regex", `{"rules": [{"name": "bad", "regex": "(", "replace": "x"}]}`},
+		{"bad json", `{"rules": [`},
+	}
+	for _, tt := range tests {
+		if err := loadRules(t, tt.data); err == nil {
+			t.Errorf("LoadRules(%s) succeeded, want an error", tt.name)
+		}
+		if Enabled() {
+			t.Errorf("LoadRules(%s) activated the rules", tt.name)
+		}
+	}
+}
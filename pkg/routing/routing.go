@@ -0,0 +1,125 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync/atomic"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+var logger = logging.SetupLogging()
+
+// Rule routes the connections it matches to a group of backends, the
+// backends with the tag Group in the backends file. The first matching rule
+// in ascending priority order applies. Rules match the user, client address
+// and initial schema of a connection, and its connection attributes.
+type Rule struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	rules.Match
+	// Attributes maps connection attributes, such as _program_name, to the
+	// shell-style patterns their values have to match.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Group      string            `json:"group"`
+}
+
+// RuleSet is the content of the connection routing rules file.
+type RuleSet struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// ruleSet holds the active rules, swapped atomically on reload.
+var ruleSet atomic.Pointer[RuleSet]
+
+// LoadRules loads and activates the connection routing rules from a JSON
+// file.
+func LoadRules(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to read routing rules: %w", err)
+	}
+
+	set := &RuleSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("failed to parse routing rules: %w", err)
+	}
+
+	for i, rule := range set.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("routing rule %q: %w", rule.Name, err)
+		}
+	}
+	sort.SliceStable(set.Rules, func(i, j int) bool {
+		return set.Rules[i].Priority < set.Rules[j].Priority
+	})
+
+	ruleSet.Store(set)
+	logger.Infof("Loaded %d routing rules from %s", len(set.Rules), path)
+	return nil
+}
+
+// validate checks that the rule names a group and only has criteria known
+// when a connection is opened, and compiles them.
+func (r *Rule) validate() error {
+	if r.Group == "" {
+		return errors.New("group is required")
+	}
+	if len(r.StatementTypes) > 0 || len(r.Digests) > 0 || r.Regex != "" || r.NotRegex != "" {
+		return errors.New("statement criteria do not apply to connections")
+	}
+	for name, pattern := range r.Attributes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q of attribute %s: %w", pattern, name, err)
+		}
+	}
+	return r.Compile()
+}
+
+// Rules returns the active routing rules in evaluation order.
+func Rules() []*Rule {
+	if set := ruleSet.Load(); set != nil {
+		return set.Rules
+	}
+	return nil
+}
+
+// Enabled returns true if routing rules have been loaded.
+func Enabled() bool {
+	return ruleSet.Load() != nil
+}
+
+// For returns the first rule matching a connection described by r, with the
+// connection attributes the client sent, or nil if none does.
+func For(r *rules.Request, attributes map[string]string) *Rule {
+	for _, rule := range Rules() {
+		if rule.Matches(r) && rule.matchAttributes(attributes) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// matchAttributes returns true if every attribute criterion of the rule
+// matches the value the client sent. Attributes the client did not send
+// match no pattern.
+func (r *Rule) matchAttributes(attributes map[string]string) bool {
+	for name, pattern := range r.Attributes {
+		value, ok := attributes[name]
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
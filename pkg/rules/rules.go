@@ -0,0 +1,136 @@
+package rules
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Request describes a client statement that rules are evaluated against.
+type Request struct {
+	User          string
+	ClientIP      net.IP
+	Schema        string
+	Query         string
+	Digest        string
+	StatementType string
+}
+
+// Match holds the criteria a statement has to satisfy for a rule to apply.
+// Every non-empty criterion has to match; list criteria match if any entry does.
+// Users and Schemas accept shell-style patterns such as "app_*".
+type Match struct {
+	Users          []string `json:"users,omitempty"`
+	CIDRs          []string `json:"cidrs,omitempty"`
+	Schemas        []string `json:"schemas,omitempty"`
+	StatementTypes []string `json:"statementTypes,omitempty"`
+	Digests        []string `json:"digests,omitempty"`
+	Regex          string   `json:"regex,omitempty"`
+	NotRegex       string   `json:"notRegex,omitempty"`
+
+	networks []*net.IPNet
+	regex    *regexp.Regexp
+	notRegex *regexp.Regexp
+}
+
+// Compile validates the criteria and prepares them for matching.
+func (m *Match) Compile() error {
+	for _, pattern := range append(append([]string{}, m.Users...), m.Schemas...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	m.networks = nil
+	for _, cidr := range m.CIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		m.networks = append(m.networks, network)
+	}
+
+	var err error
+	if m.regex, err = compileRegex(m.Regex); err != nil {
+		return err
+	}
+	if m.notRegex, err = compileRegex(m.NotRegex); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Matches returns true if r satisfies all criteria of m. Compile must have been called.
+func (m *Match) Matches(r *Request) bool {
+	if len(m.Users) > 0 && !matchPattern(m.Users, r.User) {
+		return false
+	}
+	if len(m.Schemas) > 0 && !matchPattern(m.Schemas, r.Schema) {
+		return false
+	}
+	if len(m.networks) > 0 && !matchNetwork(m.networks, r.ClientIP) {
+		return false
+	}
+	if len(m.StatementTypes) > 0 && !matchFold(m.StatementTypes, r.StatementType) {
+		return false
+	}
+	if len(m.Digests) > 0 && !matchFold(m.Digests, r.Digest) {
+		return false
+	}
+	if m.regex != nil && !m.regex.MatchString(r.Query) {
+		return false
+	}
+	if m.notRegex != nil && m.notRegex.MatchString(r.Query) {
+		return false
+	}
+	return true
+}
+
+// Regexp returns the compiled Regex criterion, or nil if none is set.
+func (m *Match) Regexp() *regexp.Regexp {
+	return m.regex
+}
+
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", expr, err)
+	}
+	return re, nil
+}
+
+func matchPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchNetwork(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package shadow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+// Outcomes of a mirrored statement.
+const (
+	outcomeMatch    = "match"
+	outcomeMismatch = "mismatch"
+	outcomeError    = "error"
+	outcomeDropped  = "dropped"
+	outcomeSkipped  = "skipped"
+)
+
+// DigestReport summarizes the mirrored statements of one digest.
+type DigestReport struct {
+	Digest                string  `json:"digest"`
+	Fingerprint           string  `json:"fingerprint"`
+	Statements            uint64  `json:"statements"`
+	Matches               uint64  `json:"matches"`
+	Mismatches            uint64  `json:"mismatches"`
+	Errors                uint64  `json:"errors"`
+	Dropped               uint64  `json:"dropped"`
+	Skipped               uint64  `json:"skipped"`
+	PrimaryLatencySeconds float64 `json:"primaryLatencySeconds"`
+	ShadowLatencySeconds  float64 `json:"shadowLatencySeconds"`
+	LatencyDeltaSeconds   float64 `json:"latencyDeltaSeconds"`
+	LastError             string  `json:"lastError,omitempty"`
+	LastMismatch          string  `json:"lastMismatch,omitempty"`
+}
+
+// Report is the mirroring report, with the digests that differ most first.
+type Report struct {
+	Digests []DigestReport `json:"digests"`
+}
+
+// digestStats accumulates the outcomes of the statements of one digest.
+type digestStats struct {
+	report         DigestReport
+	primaryLatency time.Duration
+	shadowLatency  time.Duration
+	compared       uint64
+}
+
+var (
+	statsMu sync.Mutex
+	stats   = make(map[string]*digestStats)
+)
+
+// record returns the statistics of a digest, creating them for its first statement.
+func record(digest, query string) *digestStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	d, ok := stats[digest]
+	if !ok {
+		d = &digestStats{report: DigestReport{Digest: digest, Fingerprint: sqlparse.Normalize(query)}}
+		stats[digest] = d
+	}
+	return d
+}
+
+// dropped counts a statement that was not mirrored because the queue was full.
+func (d *digestStats) dropped() {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	d.report.Dropped++
+}
+
+// skipped counts a statement that was not mirrored because it was executed
+// as a prepared statement.
+func (d *digestStats) skipped() {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	d.report.Skipped++
+}
+
+// compare records the outcome of a statement on the shadow backend against the primary.
+func compare(st statement, latency time.Duration, checksum string, hasChecksum bool, err error) {
+	var shadowCode uint16
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		shadowCode = mysqlErr.Number
+	}
+
+	outcome := outcomeMatch
+	mismatch := ""
+	switch {
+	case err != nil && (mysqlErr == nil || st.primary.ErrorCode == 0):
+		outcome = outcomeError
+	case shadowCode != st.primary.ErrorCode:
+		outcome = outcomeMismatch
+		mismatch = "error code differs"
+	case hasChecksum && st.primary.Packets != nil:
+		rs, decodeErr := protocol.DecodeResultSet(st.primary.Packets, st.primary.Capabilities)
+		if decodeErr != nil {
+			break
+		}
+		primary := newChecksum()
+		for _, row := range rs.Rows {
+			primary.add(row)
+		}
+		if primary.sum() != checksum {
+			outcome = outcomeMismatch
+			mismatch = "result checksum differs"
+		}
+	}
+
+	metrics.IncrementShadowStatements(outcome)
+	if outcome != outcomeMatch {
+		metrics.IncrementShadowDigestDifferences(st.digest, outcome)
+	}
+	if err == nil || mysqlErr != nil {
+		metrics.ObserveShadowLatency(st.primary.Latency, latency)
+	}
+
+	d := record(st.digest, st.query)
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	d.report.Statements++
+	switch outcome {
+	case outcomeMatch:
+		d.report.Matches++
+	case outcomeMismatch:
+		d.report.Mismatches++
+		d.report.LastMismatch = mismatch + ": " + st.query
+	case outcomeError:
+		d.report.Errors++
+		d.report.LastError = err.Error()
+	}
+	if outcome != outcomeError {
+		d.compared++
+		d.primaryLatency += st.primary.Latency
+		d.shadowLatency += latency
+	}
+}
+
+// CurrentReport returns the mirroring report.
+func CurrentReport() Report {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	report := Report{Digests: make([]DigestReport, 0, len(stats))}
+	for _, d := range stats {
+		r := d.report
+		if d.compared > 0 {
+			r.PrimaryLatencySeconds = d.primaryLatency.Seconds() / float64(d.compared)
+			r.ShadowLatencySeconds = d.shadowLatency.Seconds() / float64(d.compared)
+			r.LatencyDeltaSeconds = r.ShadowLatencySeconds - r.PrimaryLatencySeconds
+		}
+		report.Digests = append(report.Digests, r)
+	}
+
+	sort.Slice(report.Digests, func(i, j int) bool {
+		a, b := report.Digests[i], report.Digests[j]
+		if a.Mismatches+a.Errors != b.Mismatches+b.Errors {
+			return a.Mismatches+a.Errors > b.Mismatches+b.Errors
+		}
+		return a.Digest < b.Digest
+	})
+	return report
+}
+
+// ReportHandler serves the mirroring report as JSON.
+func ReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(CurrentReport()); err != nil {
+			logger.Errorf("Failed to write shadow report: %v", err)
+		}
+	})
+}
+
+// checksum is an order-independent checksum of result rows, so that rows
+// returned in a different order without ORDER BY still match.
+type checksum struct {
+	rows []string
+}
+
+// newChecksum returns an empty checksum.
+func newChecksum() *checksum {
+	return &checksum{}
+}
+
+// add adds a row to the checksum.
+func (c *checksum) add(row protocol.TextRow) {
+	sum := sha256.Sum256(row.Encode())
+	c.rows = append(c.rows, string(sum[:]))
+}
+
+// sum returns the checksum of the rows added.
+func (c *checksum) sum() string {
+	sort.Strings(c.rows)
+	h := sha256.New()
+	for _, row := range c.rows {
+		h.Write([]byte(row))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,287 @@
+package shadow
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/metrics"
+	"github.com/supporttools/go-sql-proxy/pkg/protocol"
+	"github.com/supporttools/go-sql-proxy/pkg/sqlparse"
+)
+
+var logger = logging.SetupLogging()
+
+// Mode selects the statements mirrored to the shadow backend.
+type Mode string
+
+const (
+	// ModeOff disables mirroring.
+	ModeOff Mode = "off"
+	// ModeReads mirrors statements that do not modify data, plus the USE and
+	// session-scoped SET statements that shape the session they run in.
+	ModeReads Mode = "reads"
+	// ModeAll mirrors every statement.
+	ModeAll Mode = "all"
+)
+
+// MaxCapture is the largest primary response, in payload bytes, whose result is
+// compared with the shadow's. Larger responses are only compared by error code.
+const MaxCapture = 4 << 20
+
+// dialNetwork is the network name the shadow dialer is registered under with the MySQL driver.
+const dialNetwork = "proxy-shadow"
+
+// Config configures mirroring.
+type Config struct {
+	Mode      Mode
+	Address   string
+	User      string
+	Password  string
+	Timeout   time.Duration
+	QueueSize int
+	// Dial opens connections to the shadow backend.
+	Dial func(address string) (net.Conn, error)
+}
+
+// state is the active mirroring configuration.
+type state struct {
+	mode      Mode
+	db        *sql.DB
+	timeout   time.Duration
+	queueSize int
+}
+
+var active atomic.Pointer[state]
+
+// Configure starts mirroring to the shadow backend described by cfg.
+func Configure(cfg Config) error {
+	switch cfg.Mode {
+	case ModeOff:
+		return nil
+	case ModeReads, ModeAll:
+	default:
+		return fmt.Errorf("unknown shadow mode %q", cfg.Mode)
+	}
+	if cfg.QueueSize <= 0 {
+		return fmt.Errorf("shadow queue size must be positive")
+	}
+
+	mysql.RegisterDialContext(dialNetwork, func(_ context.Context, address string) (net.Conn, error) {
+		return cfg.Dial(address)
+	})
+
+	driverConfig := mysql.NewConfig()
+	driverConfig.User = cfg.User
+	driverConfig.Passwd = cfg.Password
+	driverConfig.Net = dialNetwork
+	driverConfig.Addr = cfg.Address
+	driverConfig.Timeout = cfg.Timeout
+	driverConfig.AllowNativePasswords = true
+
+	connector, err := mysql.NewConnector(driverConfig)
+	if err != nil {
+		return err
+	}
+
+	active.Store(&state{
+		mode:      cfg.Mode,
+		db:        sql.OpenDB(connector),
+		timeout:   cfg.Timeout,
+		queueSize: cfg.QueueSize,
+	})
+	logger.Infof("Mirroring %s statements to shadow backend %s", cfg.Mode, cfg.Address)
+	return nil
+}
+
+// Enabled returns true if statements are mirrored.
+func Enabled() bool {
+	return active.Load() != nil
+}
+
+// Mirrors returns true if query, a statement of the given type, is mirrored.
+// In reads mode, SET statements are only mirrored if they change the session,
+// not global or persisted variables.
+func Mirrors(statementType, query string) bool {
+	st := active.Load()
+	if st == nil {
+		return false
+	}
+
+	switch statementType {
+	case "", "KILL", "SHUTDOWN":
+		// Thread IDs and server control do not carry over to the shadow.
+		return false
+	case "SELECT", "SHOW", "DESCRIBE", "DESC", "EXPLAIN", "TABLE", "VALUES", "USE":
+		return true
+	case "SET":
+		return st.mode == ModeAll || !sqlparse.SetsGlobalState(query)
+	}
+	return st.mode == ModeAll
+}
+
+// Result is the outcome of a statement on the primary backend.
+type Result struct {
+	// ErrorCode is the MySQL error code the statement failed with, or 0.
+	ErrorCode uint16
+	// Packets are the packets of the response, if it was captured.
+	Packets []*protocol.Packet
+	// Capabilities are the capabilities the response was encoded with.
+	Capabilities protocol.CapabilityFlag
+	Latency      time.Duration
+}
+
+// statement is a statement queued for the shadow backend.
+type statement struct {
+	query   string
+	digest  string
+	primary Result
+}
+
+// Session mirrors the statements of one client session, in order, over a
+// dedicated shadow connection.
+type Session struct {
+	state  *state
+	schema string
+	queue  chan statement
+}
+
+// NewSession starts mirroring a client session whose default schema is schema.
+func NewSession(schema string) *Session {
+	st := active.Load()
+	if st == nil {
+		return nil
+	}
+
+	s := &Session{
+		state:  st,
+		schema: schema,
+		queue:  make(chan statement, st.queueSize),
+	}
+	go s.run()
+	return s
+}
+
+// Mirror queues a statement that completed on the primary. If the queue is
+// full the statement is dropped so the client is never slowed down.
+func (s *Session) Mirror(query, digest string, primary Result) {
+	select {
+	case s.queue <- statement{query: query, digest: digest, primary: primary}:
+	default:
+		metrics.IncrementShadowStatements(outcomeDropped)
+		record(digest, query).dropped()
+	}
+}
+
+// Skip counts a statement that would be mirrored but is not, since it was
+// executed as a prepared statement, which the shadow session does not replay.
+func (s *Session) Skip(query, digest string) {
+	metrics.IncrementShadowStatements(outcomeSkipped)
+	record(digest, query).skipped()
+}
+
+// Close stops mirroring once the queued statements have run.
+func (s *Session) Close() {
+	close(s.queue)
+}
+
+// run executes the queued statements on the shadow backend.
+func (s *Session) run() {
+	var conn *sql.Conn
+	defer func() {
+		if conn != nil {
+			// Discard the connection instead of returning it to the pool,
+			// since it carries the state of the mirrored session.
+			_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			conn.Close()
+		}
+	}()
+
+	for st := range s.queue {
+		if conn == nil {
+			var err error
+			if conn, err = s.connect(); err != nil {
+				compare(st, 0, "", false, err)
+				continue
+			}
+		}
+
+		latency, checksum, hasChecksum, err := s.execute(conn, st.query)
+		compare(st, latency, checksum, hasChecksum, err)
+
+		if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+			conn.Close()
+			conn = nil
+		}
+	}
+}
+
+// connect opens the shadow connection of the session.
+func (s *Session) connect() (*sql.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.state.timeout)
+	defer cancel()
+
+	conn, err := s.state.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.schema != "" {
+		if _, err := conn.ExecContext(ctx, "USE `"+strings.ReplaceAll(s.schema, "`", "``")+"`"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// execute runs a statement on the shadow connection and returns its latency
+// and the checksum of its rows.
+func (s *Session) execute(conn *sql.Conn, query string) (time.Duration, string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.state.timeout)
+	defer cancel()
+
+	start := time.Now()
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return time.Since(start), "", false, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return time.Since(start), "", false, err
+	}
+
+	checksum := newChecksum()
+	values := make([]sql.RawBytes, len(columns))
+	scan := make([]interface{}, len(columns))
+	for i := range values {
+		scan[i] = &values[i]
+	}
+	row := make(protocol.TextRow, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(scan...); err != nil {
+			return time.Since(start), "", false, err
+		}
+		// RawBytes are nil for NULL, like the values of a decoded TextRow.
+		for i, value := range values {
+			row[i] = value
+		}
+		checksum.add(row)
+	}
+	if err := rows.Err(); err != nil {
+		return time.Since(start), "", false, err
+	}
+
+	// Statements without columns answered with an OK packet, whose rows
+	// the primary side does not checksum either.
+	return time.Since(start), checksum.sum(), len(columns) > 0, nil
+}
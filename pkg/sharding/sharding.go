@@ -0,0 +1,187 @@
+package sharding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+)
+
+var logger = logging.SetupLogging()
+
+// Algorithms mapping shard keys to shards.
+const (
+	// AlgorithmHash maps a key to the shard at its FNV-1a hash modulo the
+	// number of shards.
+	AlgorithmHash = "hash"
+	// AlgorithmRange maps an integer key to the shard whose range holds it.
+	AlgorithmRange = "range"
+)
+
+// Policies for statements on sharded tables without a shard key.
+const (
+	// KeylessReject answers keyless statements with an error.
+	KeylessReject = "reject"
+	// KeylessBroadcast runs keyless statements on every shard.
+	KeylessBroadcast = "broadcast"
+)
+
+// Range maps the integer keys from From, inclusive, to To, exclusive, to a
+// shard. A missing bound is unbounded.
+type Range struct {
+	Shard string `json:"shard"`
+	From  *int64 `json:"from,omitempty"`
+	To    *int64 `json:"to,omitempty"`
+}
+
+// Map is the content of the shard map file. Shards are backend groups, the
+// backends with the shard's name as a tag in the backends file.
+type Map struct {
+	// Column is the shard key column.
+	Column string `json:"column"`
+	// Tables are the sharded tables, or empty if all tables are sharded.
+	Tables    []string `json:"tables,omitempty"`
+	Algorithm string   `json:"algorithm"`
+	// Shards are the shards of the hash algorithm, in order.
+	Shards []string `json:"shards,omitempty"`
+	// Ranges are the key ranges of the range algorithm.
+	Ranges  []Range `json:"ranges,omitempty"`
+	Keyless string  `json:"keyless"`
+}
+
+// current holds the active shard map, swapped atomically on reload.
+var current atomic.Pointer[Map]
+
+// LoadMap loads and activates the shard map from a JSON file.
+func LoadMap(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to read shard map: %w", err)
+	}
+
+	m := &Map{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("failed to parse shard map: %w", err)
+	}
+	if err := m.validate(); err != nil {
+		return fmt.Errorf("invalid shard map: %w", err)
+	}
+
+	current.Store(m)
+	logger.Infof("Loaded shard map with %d shards on column %s from %s", len(m.All()), m.Column, path)
+	return nil
+}
+
+// validate checks the map and fills in defaults.
+func (m *Map) validate() error {
+	if m.Column == "" {
+		return errors.New("column is required")
+	}
+	if m.Algorithm == "" {
+		m.Algorithm = AlgorithmHash
+	}
+	if m.Keyless == "" {
+		m.Keyless = KeylessReject
+	}
+	if m.Keyless != KeylessReject && m.Keyless != KeylessBroadcast {
+		return fmt.Errorf("unknown keyless policy %q", m.Keyless)
+	}
+
+	switch m.Algorithm {
+	case AlgorithmHash:
+		if len(m.Shards) == 0 {
+			return errors.New("the hash algorithm requires shards")
+		}
+	case AlgorithmRange:
+		if len(m.Ranges) == 0 {
+			return errors.New("the range algorithm requires ranges")
+		}
+		for _, r := range m.Ranges {
+			if r.Shard == "" {
+				return errors.New("ranges require a shard")
+			}
+			if r.From != nil && r.To != nil && *r.From >= *r.To {
+				return fmt.Errorf("range of shard %s is empty", r.Shard)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown algorithm %q", m.Algorithm)
+	}
+	return nil
+}
+
+// Current returns the active shard map, or nil if none has been loaded.
+func Current() *Map {
+	return current.Load()
+}
+
+// Enabled returns true if a shard map has been loaded.
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Sharded returns true if one of tables, as returned by sqlparse.Tables, is
+// sharded.
+func (m *Map) Sharded(tables []string) bool {
+	if len(m.Tables) == 0 {
+		return len(tables) > 0
+	}
+	for _, table := range tables {
+		// Tables may be qualified with their schema.
+		name := table[strings.LastIndexByte(table, '.')+1:]
+		if slices.ContainsFunc(m.Tables, func(t string) bool { return strings.EqualFold(t, name) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// Shard returns the shard of a key, given as it is written in a statement or
+// formatted from a prepared statement parameter.
+func (m *Map) Shard(key string) (string, error) {
+	if m.Algorithm == AlgorithmRange {
+		value, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("shard key %q is not an integer", key)
+		}
+		for _, r := range m.Ranges {
+			if (r.From == nil || value >= *r.From) && (r.To == nil || value < *r.To) {
+				return r.Shard, nil
+			}
+		}
+		return "", fmt.Errorf("no shard holds key %d", value)
+	}
+
+	// Integers hash the same however they are written.
+	if value, err := strconv.ParseInt(key, 10, 64); err == nil {
+		key = strconv.FormatInt(value, 10)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return m.Shards[h.Sum32()%uint32(len(m.Shards))], nil // #nosec G115 - the number of shards is small
+}
+
+// All returns the distinct shards of the map.
+func (m *Map) All() []string {
+	names := m.Shards
+	if m.Algorithm == AlgorithmRange {
+		names = nil
+		for _, r := range m.Ranges {
+			names = append(names, r.Shard)
+		}
+	}
+	var shards []string
+	for _, name := range names {
+		if !slices.Contains(shards, name) {
+			shards = append(shards, name)
+		}
+	}
+	return shards
+}
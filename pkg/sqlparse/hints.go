@@ -0,0 +1,46 @@
+package sqlparse
+
+import (
+	"strings"
+	"unicode"
+)
+
+// hintPrefix starts the comments holding hints for the proxy.
+const hintPrefix = "proxy:"
+
+// Hint is a name=value hint for the proxy in a /* proxy:... */ comment.
+type Hint struct {
+	Name  string
+	Value string
+}
+
+// Hints returns the hints in the /* proxy:name=value */ comments of query,
+// where a comment may hold several hints separated by spaces or commas, and
+// query without those comments. Names are lowercased.
+func Hints(query string) ([]Hint, string) {
+	var hints []Hint
+	var stripped strings.Builder
+	for _, t := range Tokenize(query) {
+		body, ok := hintComment(t)
+		if !ok {
+			stripped.WriteString(t.Text)
+			continue
+		}
+		for _, field := range strings.FieldsFunc(body, func(r rune) bool { return unicode.IsSpace(r) || r == ',' }) {
+			name, value, _ := strings.Cut(field, "=")
+			hints = append(hints, Hint{Name: strings.ToLower(name), Value: value})
+		}
+	}
+	if hints == nil {
+		return nil, query
+	}
+	return hints, strings.TrimSpace(stripped.String())
+}
+
+// hintComment returns the hints in the body of a /* proxy:... */ comment.
+func hintComment(t Token) (string, bool) {
+	if t.Kind != TokenComment || !strings.HasPrefix(t.Text, "/*") || !strings.HasSuffix(t.Text, "*/") || len(t.Text) < 4 {
+		return "", false
+	}
+	return strings.CutPrefix(strings.TrimSpace(t.Text[2:len(t.Text)-2]), hintPrefix)
+}
@@ -0,0 +1,177 @@
+package sqlparse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Normalize returns the fingerprint of query: comments are removed, literals
+// are replaced by ?, lists of literals are collapsed to (?+), unquoted words
+// are lowercased and whitespace is collapsed. Statements that only differ in
+// their literal values share the same fingerprint.
+func Normalize(query string) string {
+	var out []Token
+
+	for _, t := range Tokenize(query) {
+		switch t.Kind {
+		case TokenComment, TokenSpace:
+			if len(out) > 0 && out[len(out)-1].Kind != TokenSpace {
+				out = append(out, Token{Kind: TokenSpace, Text: " "})
+			}
+		case TokenString, TokenNumber, TokenPlaceholder:
+			out = dropSign(out)
+			out = append(out, Token{Kind: TokenPlaceholder, Text: "?"})
+		case TokenWord:
+			out = append(out, Token{Kind: TokenWord, Text: strings.ToLower(t.Text)})
+		default:
+			out = append(out, t)
+		}
+	}
+
+	return strings.TrimSpace(joinTokens(collapseLists(out)))
+}
+
+// Digest returns a stable hexadecimal identifier of the fingerprint of query.
+func Digest(query string) string {
+	sum := sha256.Sum256([]byte(Normalize(query)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// StatementType returns the uppercased leading keyword of query, such as
+// SELECT or DROP. Common table expressions report the statement they introduce.
+func StatementType(query string) string {
+	tokens := significant(Tokenize(query))
+
+	for i, t := range tokens {
+		if t.Kind != TokenWord {
+			continue
+		}
+		keyword := strings.ToUpper(t.Text)
+		if keyword != "WITH" {
+			return keyword
+		}
+
+		depth := 0
+		for _, t := range tokens[i+1:] {
+			switch {
+			case t.Text == "(":
+				depth++
+			case t.Text == ")":
+				depth--
+			case depth == 0 && t.Kind == TokenWord:
+				switch keyword := strings.ToUpper(t.Text); keyword {
+				case "SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE", "TABLE", "VALUES":
+					return keyword
+				}
+			}
+		}
+		return keyword
+	}
+
+	return ""
+}
+
+// significant returns tokens without whitespace and comments.
+func significant(tokens []Token) []Token {
+	out := make([]Token, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Kind != TokenSpace && t.Kind != TokenComment {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// dropSign removes a unary sign preceding a literal so -1 and 1 normalize alike.
+func dropSign(out []Token) []Token {
+	n := len(out)
+	if n == 0 || out[n-1].Kind != TokenPunct || (out[n-1].Text != "-" && out[n-1].Text != "+") {
+		return out
+	}
+
+	prev := n - 2
+	for prev >= 0 && out[prev].Kind == TokenSpace {
+		prev--
+	}
+	if prev >= 0 && (out[prev].Kind != TokenPunct || out[prev].Text == ")") {
+		// Binary operator, e.g. a - 1.
+		return out
+	}
+
+	return out[:n-1]
+}
+
+// collapseLists replaces parenthesized lists of placeholders, and repeated
+// lists such as multi-row VALUES, with a single (?+).
+func collapseLists(tokens []Token) []Token {
+	var out []Token
+
+	for i := 0; i < len(tokens); i++ {
+		end, ok := placeholderList(tokens, i)
+		if !ok {
+			out = append(out, tokens[i])
+			continue
+		}
+
+		// Swallow following ", (?, ?)" groups.
+		for {
+			j := skipSpace(tokens, end)
+			if j >= len(tokens) || tokens[j].Text != "," {
+				break
+			}
+			next, ok := placeholderList(tokens, skipSpace(tokens, j+1))
+			if !ok {
+				break
+			}
+			end = next
+		}
+
+		out = append(out, Token{Kind: TokenPunct, Text: "("}, Token{Kind: TokenPlaceholder, Text: "?+"}, Token{Kind: TokenPunct, Text: ")"})
+		i = end - 1
+	}
+
+	return out
+}
+
+// placeholderList reports whether tokens[i:] starts with a parenthesized list
+// of placeholders and returns the offset following its closing parenthesis.
+func placeholderList(tokens []Token, i int) (int, bool) {
+	if i >= len(tokens) || tokens[i].Text != "(" {
+		return 0, false
+	}
+
+	expectValue := true
+	for j := i + 1; j < len(tokens); j++ {
+		switch {
+		case tokens[j].Kind == TokenSpace:
+		case expectValue && tokens[j].Kind == TokenPlaceholder:
+			expectValue = false
+		case !expectValue && tokens[j].Text == ",":
+			expectValue = true
+		case !expectValue && tokens[j].Text == ")":
+			return j + 1, true
+		default:
+			return 0, false
+		}
+	}
+
+	return 0, false
+}
+
+// skipSpace returns the offset of the first non-space token at or after i.
+func skipSpace(tokens []Token, i int) int {
+	for i < len(tokens) && tokens[i].Kind == TokenSpace {
+		i++
+	}
+	return i
+}
+
+// joinTokens concatenates the text of tokens.
+func joinTokens(tokens []Token) string {
+	var sb strings.Builder
+	for _, t := range tokens {
+		sb.WriteString(t.Text)
+	}
+	return sb.String()
+}
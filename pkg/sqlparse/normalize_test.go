@@ -0,0 +1,61 @@
+package sqlparse
+
+import "testing"
+
+func TestStatementType(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"select 1", "SELECT"},
+		{"  \n\tDROP TABLE t", "DROP"},
+		{"(SELECT 1)", "SELECT"},
+		{"-- c\nDELETE FROM t", "DELETE"},
+		{"WITH c AS (SELECT 1) UPDATE t JOIN c SET x = 1", "UPDATE"},
+		{"WITH RECURSIVE c (n) AS (SELECT 1 UNION SELECT n + 1 FROM c) SELECT * FROM c", "SELECT"},
+		{"/* DROP TABLE t */ SELECT 1", "SELECT"},
+		{"/*+ MAX_EXECUTION_TIME(1000) */ SELECT 1", "SELECT"},
+		{"/*!50000 DROP TABLE t */", "DROP"},
+		{"/*!DROP TABLE t*/", "DROP"},
+		{"/*M!100100 DROP TABLE t */", "DROP"},
+		{"/*!40101 SET NAMES utf8mb4 */", "SET"},
+		{"SELECT 1 /*!50000 UNION SELECT password FROM users */", "SELECT"},
+		{"/* only a comment */", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := StatementType(tt.query); got != tt.want {
+			t.Errorf("StatementType(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT  *\nFROM t WHERE id = 42", "select * from t where id = ?"},
+		{"SELECT a - 1, -1 FROM t", "select a - ?, ? from t"},
+		{"SELECT * FROM t WHERE id IN (1, 2, 3)", "select * from t where id in (?+)"},
+		{"INSERT INTO t VALUES (1, 'a'), (2, 'b')", "insert into t values (?+)"},
+		{"SELECT 1 /* c */ -- d", "select ?"},
+		{"SELECT 1 /*!50000 UNION SELECT 2 */", "select ? union select ?"},
+		{"/*M!100100 DROP TABLE t */", "drop table t"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.query); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDigestIncludesExecutableComments(t *testing.T) {
+	plain := "SELECT name FROM users WHERE id = 1"
+	if Digest(plain) == Digest(plain+" /*!50000 UNION SELECT password FROM users */") {
+		t.Error("executable comments do not change the digest")
+	}
+	if Digest(plain) != Digest(plain+" /* comment */") {
+		t.Error("ordinary comments change the digest")
+	}
+}
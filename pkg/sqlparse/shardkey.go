@@ -0,0 +1,328 @@
+package sqlparse
+
+import "strings"
+
+// ShardKey is the value of a shard key column in a statement.
+type ShardKey struct {
+	// Value is the literal the column is compared with or assigned,
+	// unquoted.
+	Value string
+	// Param is the index of the prepared statement parameter holding the
+	// value, or -1 for a literal.
+	Param int
+}
+
+// whereClauseEnd are keywords ending a WHERE clause.
+var whereClauseEnd = map[string]bool{
+	"GROUP": true, "ORDER": true, "LIMIT": true, "HAVING": true, "WINDOW": true,
+	"FOR": true, "LOCK": true, "UNION": true, "INTO": true, "EXCEPT": true, "INTERSECT": true,
+}
+
+// FindShardKey returns the value of column in query: the value a single row
+// INSERT or REPLACE assigns it, or the value the WHERE clause of a SELECT,
+// UPDATE or DELETE compares it with for equality at the top level of a
+// conjunction. It returns false if the statement has no such key, compares
+// the column with several values, or uses OR in its WHERE clause.
+func FindShardKey(query, column string) (ShardKey, bool) {
+	if MultipleStatements(query) {
+		return ShardKey{}, false
+	}
+	tokens := significant(Tokenize(query))
+	switch StatementType(query) {
+	case "INSERT", "REPLACE":
+		return insertShardKey(tokens, column)
+	case "SELECT", "UPDATE", "DELETE":
+		return whereShardKey(tokens, column)
+	}
+	return ShardKey{}, false
+}
+
+// insertShardKey returns the value of column in the column list and single
+// row of VALUES, or in the SET assignments, of an INSERT or REPLACE.
+func insertShardKey(tokens []Token, column string) (ShardKey, bool) {
+	for i, t := range tokens {
+		if t.Kind != TokenWord {
+			continue
+		}
+		switch strings.ToUpper(t.Text) {
+		case "SET":
+			return assignedShardKey(tokens, i+1, column)
+		case "VALUES", "VALUE":
+			return valuesShardKey(tokens, i, column)
+		case "SELECT":
+			return ShardKey{}, false
+		}
+	}
+	return ShardKey{}, false
+}
+
+// valuesShardKey reads the column list before tokens[values] and the single
+// row following it.
+func valuesShardKey(tokens []Token, values int, column string) (ShardKey, bool) {
+	open := -1
+	for i := values - 1; i >= 0 && open < 0; i-- {
+		if tokens[i].Text == "(" {
+			open = i
+		}
+	}
+	if open < 0 {
+		return ShardKey{}, false
+	}
+	columns := splitList(tokens, open)
+	index := -1
+	for i, c := range columns {
+		if len(c) == 1 && identMatches(c[0], column) {
+			index = i
+		}
+	}
+	if index < 0 || values+1 >= len(tokens) || tokens[values+1].Text != "(" {
+		return ShardKey{}, false
+	}
+
+	row := splitList(tokens, values+1)
+	if len(row) != len(columns) {
+		return ShardKey{}, false
+	}
+	end := values + 1
+	for _, item := range row {
+		end += len(item) + 1
+	}
+	if end+1 < len(tokens) && tokens[end+1].Text == "," {
+		// Rows of a multi-row INSERT may belong to different shards.
+		return ShardKey{}, false
+	}
+	return shardValue(tokens, row[index])
+}
+
+// splitList returns the items of the comma-separated list in the
+// parentheses opened at tokens[open].
+func splitList(tokens []Token, open int) [][]Token {
+	var items [][]Token
+	depth := 0
+	start := open + 1
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i].Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return append(items, tokens[start:i])
+			}
+		case ",":
+			if depth == 1 {
+				items = append(items, tokens[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return nil
+}
+
+// assignedShardKey reads the value assigned to column in the SET clause
+// starting at tokens[i].
+func assignedShardKey(tokens []Token, i int, column string) (ShardKey, bool) {
+	depth := 0
+	start := i
+	for ; i <= len(tokens); i++ {
+		end := i == len(tokens)
+		if !end {
+			switch tokens[i].Text {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+			// ON DUPLICATE KEY UPDATE ends the assignments of the row.
+			end = depth == 0 && tokens[i].Kind == TokenWord && strings.EqualFold(tokens[i].Text, "ON")
+		}
+		if !end && (depth > 0 || tokens[i].Text != ",") {
+			continue
+		}
+		if i-start >= 3 && identMatches(tokens[start], column) && tokens[start+1].Text == "=" {
+			return shardValue(tokens, tokens[start+2:i])
+		}
+		if end {
+			break
+		}
+		start = i + 1
+	}
+	return ShardKey{}, false
+}
+
+// whereShardKey returns the value column is compared with in the top-level
+// conjunction of the WHERE clause.
+func whereShardKey(tokens []Token, column string) (ShardKey, bool) {
+	depth := 0
+	start := -1
+	for i, t := range tokens {
+		switch t.Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth == 0 && t.Kind == TokenWord && strings.EqualFold(t.Text, "WHERE") {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return ShardKey{}, false
+	}
+
+	var key ShardKey
+	found := false
+	depth = 0
+	for i := start; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.Text {
+		case "(":
+			depth++
+			continue
+		case ")":
+			depth--
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		word := strings.ToUpper(t.Text)
+		if t.Kind == TokenWord && whereClauseEnd[word] || t.Text == ";" {
+			break
+		}
+		if t.Kind == TokenWord && (word == "OR" || word == "XOR") || t.Text == "|" {
+			// OR or ||.
+			return ShardKey{}, false
+		}
+
+		if i > start && !conjunctionEnds(tokens, i) {
+			continue
+		}
+		value, ok := comparedValue(tokens, i, column)
+		if !ok {
+			continue
+		}
+		if found && value != key {
+			return ShardKey{}, false
+		}
+		key, found = value, true
+	}
+	return key, found
+}
+
+// comparedValue returns the value column is compared with for equality by
+// the predicate at tokens[i]: column = value, value = column or
+// column IN (value), where column may be qualified.
+func comparedValue(tokens []Token, i int, column string) (ShardKey, bool) {
+	end := qualifiedEnd(tokens, i)
+	if identMatches(tokens[end], column) && end+2 < len(tokens) {
+		next := tokens[end+1]
+		switch {
+		case next.Text == "=":
+			value := valueTokens(tokens, end+2)
+			if predicateEnds(tokens, end+2+len(value)) {
+				return shardValue(tokens, value)
+			}
+		case next.Kind == TokenWord && strings.EqualFold(next.Text, "IN") && tokens[end+2].Text == "(":
+			items := splitList(tokens, end+2)
+			if len(items) == 1 && predicateEnds(tokens, end+4+len(items[0])) {
+				return shardValue(tokens, items[0])
+			}
+		}
+		return ShardKey{}, false
+	}
+
+	// value = column
+	value := valueTokens(tokens, i)
+	j := i + len(value)
+	if len(value) == 0 || j+1 >= len(tokens) || tokens[j].Text != "=" {
+		return ShardKey{}, false
+	}
+	end = qualifiedEnd(tokens, j+1)
+	if !identMatches(tokens[end], column) || !predicateEnds(tokens, end+1) {
+		return ShardKey{}, false
+	}
+	return shardValue(tokens, value)
+}
+
+// qualifiedEnd returns the offset of the last part of a qualified name such
+// as schema.table.column starting at tokens[i].
+func qualifiedEnd(tokens []Token, i int) int {
+	for i+2 < len(tokens) && tokens[i+1].Text == "." {
+		i += 2
+	}
+	return i
+}
+
+// conjunctionEnds returns true if an AND or && ends before tokens[i].
+func conjunctionEnds(tokens []Token, i int) bool {
+	t := tokens[i-1]
+	return t.Kind == TokenWord && strings.EqualFold(t.Text, "AND") || t.Text == "&" && i >= 2 && tokens[i-2].Text == "&"
+}
+
+// predicateEnds returns true if a predicate of a WHERE clause may end before
+// tokens[i].
+func predicateEnds(tokens []Token, i int) bool {
+	if i >= len(tokens) {
+		return true
+	}
+	t := tokens[i]
+	return t.Kind == TokenWord && strings.EqualFold(t.Text, "AND") || t.Text == "&" && i+1 < len(tokens) && tokens[i+1].Text == "&" ||
+		t.Text == ";" || t.Text == ")" ||
+		t.Kind == TokenWord && (whereClauseEnd[strings.ToUpper(t.Text)] || strings.EqualFold(t.Text, "OR") || strings.EqualFold(t.Text, "XOR"))
+}
+
+// valueTokens returns the tokens of a literal or parameter marker at
+// tokens[i], including the sign of a negative number.
+func valueTokens(tokens []Token, i int) []Token {
+	if i < len(tokens) && tokens[i].Text == "-" && i+1 < len(tokens) && tokens[i+1].Kind == TokenNumber {
+		return tokens[i : i+2]
+	}
+	if i < len(tokens) {
+		switch tokens[i].Kind {
+		case TokenNumber, TokenString, TokenPlaceholder:
+			return tokens[i : i+1]
+		}
+	}
+	return nil
+}
+
+// shardValue returns the shard key of value, which must be a single literal
+// or parameter marker of tokens.
+func shardValue(tokens []Token, value []Token) (ShardKey, bool) {
+	switch {
+	case len(value) == 2 && value[0].Text == "-" && value[1].Kind == TokenNumber:
+		return ShardKey{Value: "-" + value[1].Text, Param: -1}, true
+	case len(value) != 1:
+		return ShardKey{}, false
+	case value[0].Kind == TokenNumber:
+		return ShardKey{Value: value[0].Text, Param: -1}, true
+	case value[0].Kind == TokenString:
+		return ShardKey{Value: Unquote(value[0].Text), Param: -1}, true
+	case value[0].Kind == TokenPlaceholder:
+		return ShardKey{Param: placeholderIndex(tokens, value)}, true
+	}
+	return ShardKey{}, false
+}
+
+// placeholderIndex returns the index of the parameter marker starting value,
+// a subslice of tokens, among the parameter markers of tokens.
+func placeholderIndex(tokens []Token, value []Token) int {
+	index := 0
+	for i := range tokens {
+		if &tokens[i] == &value[0] {
+			return index
+		}
+		if tokens[i].Kind == TokenPlaceholder {
+			index++
+		}
+	}
+	return -1
+}
+
+// identMatches returns true if t is the unqualified, possibly quoted,
+// identifier column.
+func identMatches(t Token, column string) bool {
+	return (t.Kind == TokenWord || t.Kind == TokenQuotedIdent) && strings.EqualFold(Unquote(t.Text), column)
+}
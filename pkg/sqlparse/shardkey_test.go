@@ -0,0 +1,73 @@
+package sqlparse
+
+import "testing"
+
+func TestFindShardKey(t *testing.T) {
+	literal := func(v string) *ShardKey { return &ShardKey{Value: v, Param: -1} }
+	param := func(i int) *ShardKey { return &ShardKey{Param: i} }
+
+	tests := []struct {
+		query string
+		want  *ShardKey
+	}{
+		// WHERE clauses.
+		{"SELECT * FROM orders WHERE tenant_id = 42", literal("42")},
+		{"SELECT * FROM orders WHERE tenant_id = -42", literal("-42")},
+		{"SELECT * FROM orders WHERE tenant_id = 'acme'", literal("acme")},
+		{"SELECT * FROM orders WHERE 42 = tenant_id", literal("42")},
+		{"SELECT * FROM orders o WHERE o.tenant_id = 42", literal("42")},
+		{"SELECT * FROM shop.orders WHERE shop.orders.`TENANT_ID` = 42", literal("42")},
+		{"SELECT * FROM orders WHERE tenant_id IN (42)", literal("42")},
+		{"SELECT * FROM orders WHERE status = 'open' AND tenant_id = 42 ORDER BY id LIMIT 10", literal("42")},
+		{"SELECT * FROM orders WHERE tenant_id = 42 && id > 5", literal("42")},
+		{"SELECT * FROM orders WHERE (a = 1 OR b = 2) AND tenant_id = 42", literal("42")},
+		{"SELECT * FROM orders WHERE tenant_id = 42 AND tenant_id = 42", literal("42")},
+		{"SELECT * FROM orders WHERE id = ? AND tenant_id = ?", param(1)},
+		{"UPDATE orders SET total = ? WHERE tenant_id = ? AND id = ?", param(1)},
+		{"DELETE FROM orders WHERE tenant_id = 7", literal("7")},
+		{"WITH c AS (SELECT 1) SELECT * FROM orders WHERE tenant_id = 3", literal("3")},
+		{"SELECT * FROM orders WHERE tenant_id = 42 /* shard */", literal("42")},
+
+		// WHERE clauses without a single key.
+		{"SELECT * FROM orders", nil},
+		{"SELECT * FROM orders WHERE id = 42", nil},
+		{"SELECT * FROM orders WHERE tenant_id = 42 OR id = 1", nil},
+		{"SELECT * FROM orders WHERE tenant_id = 42 || id = 1", nil},
+		{"SELECT * FROM orders WHERE tenant_id IN (1, 2)", nil},
+		{"SELECT * FROM orders WHERE tenant_id = 1 AND tenant_id = 2", nil},
+		{"SELECT * FROM orders WHERE tenant_id > 42", nil},
+		{"SELECT * FROM orders WHERE tenant_id = 42 + 1", nil},
+		{"SELECT * FROM orders WHERE tenant_id = other_id", nil},
+		{"SELECT * FROM orders WHERE NOT tenant_id = 42", nil},
+		{"SELECT * FROM orders WHERE id IN (SELECT id FROM t WHERE tenant_id = 42)", nil},
+		{"SELECT * FROM orders WHERE tenant_id = 42; SELECT 1", nil},
+
+		// INSERT and REPLACE.
+		{"INSERT INTO orders (id, tenant_id, total) VALUES (1, 42, 9.5)", literal("42")},
+		{"INSERT INTO orders (`id`, `tenant_id`) VALUE (?, ?)", param(1)},
+		{"REPLACE INTO orders (tenant_id, note) VALUES ('acme', 'a, b')", literal("acme")},
+		{"INSERT INTO orders (id, tenant_id) VALUES (1, -3) ON DUPLICATE KEY UPDATE id = 2", literal("-3")},
+		{"INSERT INTO orders SET id = 1, tenant_id = 42", literal("42")},
+		{"INSERT INTO orders SET id = 1, tenant_id = 42 ON DUPLICATE KEY UPDATE tenant_id = 43", literal("42")},
+		{"INSERT INTO orders (id, tenant_id) VALUES (1, 42), (2, 43)", nil},
+		{"INSERT INTO orders (id, tenant_id) VALUES (1, NOW())", nil},
+		{"INSERT INTO orders (id, total) VALUES (1, 42)", nil},
+		{"INSERT INTO orders (id, tenant_id) VALUES (1)", nil},
+		{"INSERT INTO orders VALUES (1, 42)", nil},
+		{"INSERT INTO orders (id, tenant_id) SELECT id, tenant_id FROM staging", nil},
+		{"INSERT INTO orders SET id = 1, tenant_id = LAST_INSERT_ID()", nil},
+
+		// Other statements.
+		{"DROP TABLE orders", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, ok := FindShardKey(tt.query, "tenant_id")
+		switch {
+		case tt.want == nil && ok:
+			t.Errorf("FindShardKey(%q) = %+v, want none", tt.query, got)
+		case tt.want != nil && (!ok || got != *tt.want):
+			t.Errorf("FindShardKey(%q) = %+v, %v, want %+v", tt.query, got, ok, *tt.want)
+		}
+	}
+}
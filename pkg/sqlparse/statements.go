@@ -0,0 +1,596 @@
+package sqlparse
+
+import (
+	"strconv"
+	"strings"
+)
+
+// UseSchema returns the schema selected by a USE statement.
+func UseSchema(query string) (string, bool) {
+	tokens := significant(Tokenize(query))
+	if len(tokens) < 2 || !strings.EqualFold(tokens[0].Text, "USE") {
+		return "", false
+	}
+	return Unquote(tokens[1].Text), true
+}
+
+// PreparedText parses a PREPARE name FROM 'text' statement and returns the
+// statement text it prepares. Adjacent string literals are concatenated, as
+// the server does. Statements prepared from a user variable are not known.
+func PreparedText(query string) (string, bool) {
+	tokens := significant(Tokenize(query))
+	for len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) < 4 || !strings.EqualFold(tokens[0].Text, "PREPARE") || !strings.EqualFold(tokens[2].Text, "FROM") {
+		return "", false
+	}
+
+	literals := tokens[3:]
+	// A character set introducer, such as _utf8mb4'...', may precede the text.
+	if literals[0].Kind == TokenWord && strings.HasPrefix(literals[0].Text, "_") {
+		literals = literals[1:]
+	}
+	if len(literals) == 0 {
+		return "", false
+	}
+	var sb strings.Builder
+	for _, t := range literals {
+		if t.Kind != TokenString {
+			return "", false
+		}
+		sb.WriteString(Unquote(t.Text))
+	}
+	return sb.String(), true
+}
+
+// Kill parses a KILL [CONNECTION | QUERY] statement and returns the thread ID
+// and whether only the running statement is killed.
+func Kill(query string) (uint64, bool, bool) {
+	tokens := significant(Tokenize(query))
+	for len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) < 2 || !strings.EqualFold(tokens[0].Text, "KILL") {
+		return 0, false, false
+	}
+
+	queryOnly := false
+	switch {
+	case len(tokens) == 3 && strings.EqualFold(tokens[1].Text, "QUERY"):
+		queryOnly = true
+	case len(tokens) == 3 && strings.EqualFold(tokens[1].Text, "CONNECTION"):
+	case len(tokens) != 2:
+		return 0, false, false
+	}
+
+	id, err := strconv.ParseUint(tokens[len(tokens)-1].Text, 10, 64)
+	if err != nil {
+		return 0, false, false
+	}
+	return id, queryOnly, true
+}
+
+// ReplaceConnectionID replaces calls to CONNECTION_ID() in query with id and
+// returns the new statement and whether it changed. Calls that make up a
+// select list item are aliased so the result column keeps its name.
+func ReplaceConnectionID(query string, id uint64) (string, bool) {
+	tokens := Tokenize(query)
+
+	var positions []int
+	for i, t := range tokens {
+		if t.Kind != TokenSpace && t.Kind != TokenComment {
+			positions = append(positions, i)
+		}
+	}
+
+	changed := false
+	depth := 0
+	selectList := map[int]bool{}
+	for k := 0; k < len(positions); k++ {
+		t := tokens[positions[k]]
+		switch {
+		case t.Text == "(":
+			depth++
+			continue
+		case t.Text == ")":
+			delete(selectList, depth)
+			depth--
+			continue
+		case t.Kind != TokenWord:
+			continue
+		}
+
+		keyword := strings.ToUpper(t.Text)
+		if keyword == "SELECT" {
+			selectList[depth] = true
+			continue
+		}
+		if selectListEnd[keyword] {
+			selectList[depth] = false
+			continue
+		}
+		if keyword != "CONNECTION_ID" || k+2 >= len(positions) ||
+			tokens[positions[k+1]].Text != "(" || tokens[positions[k+2]].Text != ")" {
+			continue
+		}
+
+		call := joinTokens(tokens[positions[k] : positions[k+2]+1])
+		// A cast keeps the BIGINT UNSIGNED type and is never read as an
+		// ORDER BY or GROUP BY column position.
+		replacement := "CAST(" + strconv.FormatUint(id, 10) + " AS UNSIGNED)"
+		if selectList[depth] && isSelectItemStart(tokens, positions, k) && isSelectItemEnd(tokens, positions, k+3) {
+			replacement += " AS `" + strings.ReplaceAll(call, "`", "``") + "`"
+		}
+
+		tokens[positions[k]].Text = replacement
+		for i := positions[k] + 1; i <= positions[k+2]; i++ {
+			tokens[i].Text = ""
+		}
+		changed = true
+		k += 2
+	}
+
+	if !changed {
+		return query, false
+	}
+	return joinTokens(tokens), true
+}
+
+// selectListEnd are the keywords that end a select list.
+var selectListEnd = map[string]bool{
+	"FROM": true, "INTO": true, "WHERE": true, "GROUP": true, "HAVING": true, "WINDOW": true,
+	"ORDER": true, "LIMIT": true, "FOR": true, "LOCK": true, "UNION": true, "EXCEPT": true, "INTERSECT": true,
+}
+
+// isSelectItemStart returns true if the significant token k starts a select list item.
+func isSelectItemStart(tokens []Token, positions []int, k int) bool {
+	if k == 0 {
+		return false
+	}
+	previous := strings.ToUpper(tokens[positions[k-1]].Text)
+	return previous == "SELECT" || previous == "," || previous == "DISTINCT" || previous == "ALL"
+}
+
+// isSelectItemEnd returns true if a select list item without alias ends before the significant token k.
+func isSelectItemEnd(tokens []Token, positions []int, k int) bool {
+	if k >= len(positions) {
+		return true
+	}
+	next := tokens[positions[k]]
+	return next.Text == "," || next.Text == ";" || (next.Kind == TokenWord && selectListEnd[strings.ToUpper(next.Text)])
+}
+
+// Unquote removes the quotes around an identifier or string literal.
+func Unquote(s string) string {
+	if len(s) < 2 {
+		return s
+	}
+
+	quote := s[0]
+	if (quote != '`' && quote != '\'' && quote != '"') || s[len(s)-1] != quote {
+		return s
+	}
+
+	inner := s[1 : len(s)-1]
+	inner = strings.ReplaceAll(inner, string([]byte{quote, quote}), string(quote))
+	if quote != '`' {
+		inner = unescapeBackslashes(inner)
+	}
+	return inner
+}
+
+// unescapeBackslashes resolves MySQL backslash escape sequences in a string literal.
+func unescapeBackslashes(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case '0':
+			sb.WriteByte(0)
+		case 'b':
+			sb.WriteByte('\b')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'Z':
+			sb.WriteByte(0x1a)
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// SetVariables parses a SET statement and returns the session variables it
+// assigns, lowercased and without @@ and scope prefixes. User variables keep
+// their @ prefix; NAMES, CHARACTER SET and SESSION TRANSACTION are reported as
+// names, character set and transaction. Global and persisted assignments,
+// which do not change the session, are left out.
+func SetVariables(query string) ([]string, bool) {
+	assignments, ok := setAssignments(query)
+	if !ok {
+		return nil, false
+	}
+
+	var names []string
+	for _, assignment := range assignments {
+		if name, session := assignedVariable(assignment); session {
+			names = append(names, name)
+		}
+	}
+	return names, true
+}
+
+// SetsGlobalState returns true if query is a SET statement that assigns a
+// global or persisted variable.
+func SetsGlobalState(query string) bool {
+	assignments, _ := setAssignments(query)
+	for _, tokens := range assignments {
+		if len(tokens) == 0 {
+			continue
+		}
+		switch strings.ToUpper(tokens[0].Text) {
+		case "GLOBAL", "PERSIST", "PERSIST_ONLY":
+			return true
+		}
+		if tokens[0].Kind != TokenVariable {
+			continue
+		}
+		name := strings.ToLower(tokens[0].Text)
+		for _, scope := range []string{"@@global.", "@@persist.", "@@persist_only."} {
+			if strings.HasPrefix(name, scope) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setAssignments splits a SET statement into the tokens of its assignments.
+func setAssignments(query string) ([][]Token, bool) {
+	tokens := significant(Tokenize(query))
+	for len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) < 2 || !strings.EqualFold(tokens[0].Text, "SET") {
+		return nil, false
+	}
+
+	var assignments [][]Token
+	depth := 0
+	start := 1
+	for i := 1; i <= len(tokens); i++ {
+		if i < len(tokens) {
+			switch tokens[i].Text {
+			case "(":
+				depth++
+				continue
+			case ")":
+				depth--
+				continue
+			case ",":
+				if depth != 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		assignments = append(assignments, tokens[start:i])
+		start = i + 1
+	}
+	return assignments, true
+}
+
+// assignedVariable returns the variable assigned by one assignment of a SET
+// statement and whether it is session state.
+func assignedVariable(tokens []Token) (string, bool) {
+	if len(tokens) == 0 {
+		return "", false
+	}
+
+	session := false
+	switch strings.ToUpper(tokens[0].Text) {
+	case "GLOBAL", "PERSIST", "PERSIST_ONLY":
+		return "", false
+	case "SESSION", "LOCAL":
+		session = true
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return "", false
+	}
+
+	first := tokens[0]
+	switch {
+	case first.Kind == TokenVariable && !strings.HasPrefix(first.Text, "@@"):
+		return strings.ToLower(first.Text), true
+	case first.Kind == TokenVariable:
+		name := strings.ToLower(first.Text[2:])
+		for _, scope := range []string{"global.", "persist.", "persist_only."} {
+			if strings.HasPrefix(name, scope) {
+				return "", false
+			}
+		}
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "session."), "local.")
+		return Unquote(name), true
+	}
+
+	switch keyword := strings.ToUpper(first.Text); {
+	case keyword == "NAMES":
+		return "names", true
+	case keyword == "CHARSET" || (keyword == "CHARACTER" && len(tokens) > 1 && strings.EqualFold(tokens[1].Text, "SET")):
+		return "character set", true
+	case keyword == "TRANSACTION":
+		// Without SESSION, SET TRANSACTION only applies to the next transaction.
+		return "transaction", session
+	}
+	return strings.ToLower(Unquote(first.Text)), true
+}
+
+// MultipleStatements returns true if query contains more than one statement.
+func MultipleStatements(query string) bool {
+	tokens := significant(Tokenize(query))
+	for i, t := range tokens {
+		if t.Kind == TokenPunct && t.Text == ";" {
+			for _, rest := range tokens[i+1:] {
+				if rest.Text != ";" {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// SplitStatements returns the statements of a multi-statement query, without
+// the semicolons separating them. Statements without code are left out.
+func SplitStatements(query string) []string {
+	var statements []string
+	start, offset := 0, 0
+	for _, t := range Tokenize(query) {
+		offset += len(t.Text)
+		if t.Kind == TokenPunct && t.Text == ";" {
+			if statement := query[start : offset-1]; len(significant(Tokenize(statement))) > 0 {
+				statements = append(statements, statement)
+			}
+			start = offset
+		}
+	}
+	if statement := query[start:]; len(significant(Tokenize(statement))) > 0 {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// sessionFunctions are functions whose result depends on, or that change,
+// the state of the connection they run on.
+var sessionFunctions = map[string]bool{
+	"LAST_INSERT_ID":    true,
+	"FOUND_ROWS":        true,
+	"ROW_COUNT":         true,
+	"GET_LOCK":          true,
+	"RELEASE_LOCK":      true,
+	"RELEASE_ALL_LOCKS": true,
+	"IS_FREE_LOCK":      true,
+	"IS_USED_LOCK":      true,
+	"NEXTVAL":           true,
+	"LASTVAL":           true,
+	"SETVAL":            true,
+}
+
+// ReadOnly returns true if query is a single SELECT statement that can run
+// on any connection with the same schema and session variables: it takes no
+// locks, writes no user variables or files, and calls no functions that
+// depend on the connection, such as LAST_INSERT_ID() or GET_LOCK().
+func ReadOnly(query string) bool {
+	if StatementType(query) != "SELECT" || MultipleStatements(query) {
+		return false
+	}
+
+	tokens := significant(Tokenize(query))
+	for i, t := range tokens {
+		switch t.Kind {
+		case TokenVariable:
+			// User variables belong to the connection.
+			if !strings.HasPrefix(t.Text, "@@") {
+				return false
+			}
+		case TokenWord:
+			word := strings.ToUpper(t.Text)
+			next := ""
+			if i+1 < len(tokens) {
+				next = strings.ToUpper(tokens[i+1].Text)
+			}
+			switch {
+			case word == "FOR" && (next == "UPDATE" || next == "SHARE"),
+				word == "LOCK" && next == "IN",
+				word == "INTO",
+				word == "SQL_CALC_FOUND_ROWS",
+				sessionFunctions[word] && next == "(":
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// volatileFunctions are functions whose result changes between calls or
+// depends on the session, mapped to whether they may be called without
+// parentheses.
+var volatileFunctions = map[string]bool{
+	"NOW":               false,
+	"SYSDATE":           false,
+	"CURDATE":           false,
+	"CURTIME":           false,
+	"CURRENT_DATE":      true,
+	"CURRENT_TIME":      true,
+	"CURRENT_TIMESTAMP": true,
+	"LOCALTIME":         true,
+	"LOCALTIMESTAMP":    true,
+	"UTC_DATE":          true,
+	"UTC_TIME":          true,
+	"UTC_TIMESTAMP":     true,
+	"UNIX_TIMESTAMP":    false,
+	"RAND":              false,
+	"RANDOM_BYTES":      false,
+	"UUID":              false,
+	"UUID_SHORT":        false,
+	"CONNECTION_ID":     false,
+	"CURRENT_USER":      true,
+	"USER":              false,
+	"SESSION_USER":      false,
+	"SYSTEM_USER":       false,
+	"CURRENT_ROLE":      false,
+	"SLEEP":             false,
+	"BENCHMARK":         false,
+}
+
+// Deterministic returns true if query is a read-only SELECT, as reported by
+// ReadOnly, whose result only depends on the data it reads: it reads no
+// system variables and calls no functions such as NOW(), RAND() or
+// CURRENT_USER() whose result changes between calls or sessions.
+func Deterministic(query string) bool {
+	if !ReadOnly(query) {
+		return false
+	}
+
+	tokens := significant(Tokenize(query))
+	for i, t := range tokens {
+		switch t.Kind {
+		case TokenVariable:
+			return false
+		case TokenWord:
+			bare, ok := volatileFunctions[strings.ToUpper(t.Text)]
+			if !ok {
+				continue
+			}
+			if bare || (i+1 < len(tokens) && tokens[i+1].Text == "(") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// tableModifiers are keywords that may appear between a table keyword and the table name.
+var tableModifiers = map[string]bool{
+	"LOW_PRIORITY":  true,
+	"HIGH_PRIORITY": true,
+	"DELAYED":       true,
+	"IGNORE":        true,
+	"QUICK":         true,
+	"IF":            true,
+	"NOT":           true,
+	"EXISTS":        true,
+	"ONLY":          true,
+	"TEMPORARY":     true,
+	"LATERAL":       true,
+	"STRAIGHT_JOIN": true,
+}
+
+// Tables returns the tables referenced by query, as written (optionally
+// qualified with their schema) but unquoted. Derived tables are skipped.
+func Tables(query string) []string {
+	tokens := significant(Tokenize(query))
+
+	var tables []string
+	seen := make(map[string]bool)
+	add := func(table string) {
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].Kind != TokenWord {
+			continue
+		}
+
+		keyword := strings.ToUpper(tokens[i].Text)
+		switch keyword {
+		case "FROM", "JOIN", "UPDATE", "INTO", "TABLE", "TABLES", "TRUNCATE":
+		default:
+			continue
+		}
+
+		j := i + 1
+		for {
+			for j < len(tokens) && tokens[j].Kind == TokenWord && tableModifiers[strings.ToUpper(tokens[j].Text)] {
+				j++
+			}
+			table, next := tableName(tokens, j)
+			if table == "" {
+				break
+			}
+			add(table)
+			j = skipAlias(tokens, next)
+
+			// FROM a, b and UPDATE a, b list several tables.
+			if j >= len(tokens) || tokens[j].Text != "," || (keyword != "FROM" && keyword != "UPDATE" && keyword != "TABLES" && keyword != "TABLE") {
+				break
+			}
+			j++
+		}
+		i = j - 1
+	}
+
+	return tables
+}
+
+// tableName reads a possibly schema-qualified table name at tokens[i] and
+// returns it with the offset following it, or "" if there is none.
+func tableName(tokens []Token, i int) (string, int) {
+	if i >= len(tokens) || (tokens[i].Kind != TokenWord && tokens[i].Kind != TokenQuotedIdent) {
+		return "", i
+	}
+	if tokens[i].Kind == TokenWord && isReservedAfterTable(tokens[i].Text) {
+		return "", i
+	}
+
+	name := Unquote(tokens[i].Text)
+	i++
+	if i+1 < len(tokens) && tokens[i].Text == "." && (tokens[i+1].Kind == TokenWord || tokens[i+1].Kind == TokenQuotedIdent) {
+		name += "." + Unquote(tokens[i+1].Text)
+		i += 2
+	}
+	return name, i
+}
+
+// skipAlias skips an optional table alias at tokens[i].
+func skipAlias(tokens []Token, i int) int {
+	if i < len(tokens) && strings.EqualFold(tokens[i].Text, "AS") {
+		i++
+	}
+	if i < len(tokens) && (tokens[i].Kind == TokenQuotedIdent || (tokens[i].Kind == TokenWord && !isReservedAfterTable(tokens[i].Text))) {
+		i++
+	}
+	return i
+}
+
+// isReservedAfterTable returns true for keywords that can follow a table name
+// and therefore are neither table names nor aliases.
+func isReservedAfterTable(word string) bool {
+	switch strings.ToUpper(word) {
+	case "WHERE", "SET", "VALUES", "VALUE", "SELECT", "ON", "USING", "JOIN", "INNER", "LEFT", "RIGHT",
+		"CROSS", "NATURAL", "OUTER", "GROUP", "ORDER", "LIMIT", "HAVING", "WINDOW", "UNION", "FOR",
+		"LOCK", "INTO", "PARTITION", "USE", "FORCE", "IGNORE", "STRAIGHT_JOIN", "DUPLICATE", "READ",
+		"WRITE", "AS", "OUTFILE", "DUMPFILE", "WITH", "EXCEPT", "INTERSECT", "RETURNING", "DEFAULT", "TO":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package sqlparse
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"SELECT 1;", []string{"SELECT 1"}},
+		{"SELECT 1; DROP TABLE t", []string{"SELECT 1", " DROP TABLE t"}},
+		{"SELECT ';'; DROP TABLE t;;", []string{"SELECT ';'", " DROP TABLE t"}},
+		{"SELECT 1 -- ; DROP TABLE t", []string{"SELECT 1 -- ; DROP TABLE t"}},
+		{"SELECT 1 /*!50000 ; DROP TABLE t */", []string{"SELECT 1 /*!50000 ", " DROP TABLE t */"}},
+		{"SELECT 1; /* comment */", []string{"SELECT 1"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := SplitStatements(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("SplitStatements(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSetsGlobalState(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SET sql_mode = ''", false},
+		{"SET SESSION time_zone = '+00:00'", false},
+		{"SET @@session.autocommit = 0, @x = 1", false},
+		{"SET NAMES utf8mb4", false},
+		{"SET GLOBAL max_connections = 10", true},
+		{"SET PERSIST max_connections = 10", true},
+		{"set persist_only innodb_log_file_size = 1", true},
+		{"SET @@GLOBAL.read_only = 1", true},
+		{"SET autocommit = 1, @@persist.max_connections = 10", true},
+		{"SELECT 1", false},
+	}
+	for _, tt := range tests {
+		if got := SetsGlobalState(tt.query); got != tt.want {
+			t.Errorf("SetsGlobalState(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT id, name FROM users WHERE id = 1", true},
+		{"SELECT COUNT(*) FROM orders o JOIN users u ON u.id = o.user_id", true},
+		{"SELECT now FROM events", true},
+		{"SELECT NOW()", false},
+		{"SELECT * FROM events WHERE created_at > CURRENT_TIMESTAMP", false},
+		{"SELECT * FROM t ORDER BY RAND() LIMIT 1", false},
+		{"SELECT @x", false},
+		{"SELECT @@time_zone", false},
+		{"SELECT LAST_INSERT_ID()", false},
+		{"SELECT * FROM t WHERE id = 1 FOR UPDATE", false},
+		{"SELECT * FROM t FOR SHARE", false},
+		{"SELECT CURRENT_USER", false},
+		{"SELECT 1; SELECT 2", false},
+		{"UPDATE t SET a = 1", false},
+	}
+	for _, tt := range tests {
+		if got := Deterministic(tt.query); got != tt.want {
+			t.Errorf("Deterministic(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
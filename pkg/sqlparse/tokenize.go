@@ -0,0 +1,222 @@
+package sqlparse
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind classifies a lexical token of a SQL statement.
+type TokenKind int
+
+const (
+	// TokenSpace is a run of whitespace.
+	TokenSpace TokenKind = iota
+	// TokenComment is a /* */, -- or # comment. The opening /*!version or
+	// /*M!version and the closing */ of an executable comment are comments,
+	// while the statement text between them is tokenized as code, since the
+	// server runs it.
+	TokenComment
+	// TokenWord is an unquoted keyword or identifier.
+	TokenWord
+	// TokenQuotedIdent is a backtick-quoted identifier.
+	TokenQuotedIdent
+	// TokenString is a single or double quoted string literal.
+	TokenString
+	// TokenNumber is a numeric, hexadecimal or bit literal.
+	TokenNumber
+	// TokenVariable is a user (@var) or system (@@var) variable.
+	TokenVariable
+	// TokenPlaceholder is a prepared statement parameter marker.
+	TokenPlaceholder
+	// TokenPunct is an operator or punctuation character.
+	TokenPunct
+)
+
+// Token is a lexical token of a SQL statement.
+type Token struct {
+	Kind TokenKind
+	Text string
+}
+
+// Tokenize splits query into lexical tokens. Concatenating the text of all
+// tokens yields the original query.
+func Tokenize(query string) []Token {
+	var tokens []Token
+
+	executable := false
+	for i := 0; i < len(query); {
+		kind, end := scanToken(query, i)
+		switch {
+		case executable && strings.HasPrefix(query[i:], "*/"):
+			kind, end = TokenComment, i+2
+			executable = false
+		case !executable && kind == TokenComment:
+			if opener := executableOpener(query[i:]); opener > 0 {
+				end = i + opener
+				executable = true
+			}
+		}
+		tokens = append(tokens, Token{Kind: kind, Text: query[i:end]})
+		i = end
+	}
+
+	return tokens
+}
+
+// executableOpener returns the length of the /*! or /*M! opening an
+// executable comment at the start of q, including its version number, or 0.
+func executableOpener(q string) int {
+	n := 0
+	switch {
+	case strings.HasPrefix(q, "/*!"):
+		n = 3
+	case strings.HasPrefix(q, "/*M!"):
+		n = 4
+	default:
+		return 0
+	}
+	for n < len(q) && isDigit(q[n]) {
+		n++
+	}
+	return n
+}
+
+// scanToken returns the kind and end offset of the token starting at i.
+func scanToken(q string, i int) (TokenKind, int) {
+	c := q[i]
+	switch {
+	case isSpace(c):
+		j := i + 1
+		for j < len(q) && isSpace(q[j]) {
+			j++
+		}
+		return TokenSpace, j
+	case c == '#' || (c == '-' && strings.HasPrefix(q[i:], "--") && (i+2 == len(q) || q[i+2] <= ' ')):
+		j := strings.IndexByte(q[i:], '\n')
+		if j == -1 {
+			return TokenComment, len(q)
+		}
+		return TokenComment, i + j + 1
+	case c == '/' && strings.HasPrefix(q[i:], "/*"):
+		j := strings.Index(q[i+2:], "*/")
+		if j == -1 {
+			return TokenComment, len(q)
+		}
+		return TokenComment, i + 2 + j + 2
+	case c == '\'' || c == '"':
+		return TokenString, scanQuoted(q, i, c, true)
+	case c == '`':
+		return TokenQuotedIdent, scanQuoted(q, i, c, false)
+	case (c == 'x' || c == 'X' || c == 'b' || c == 'B') && i+1 < len(q) && q[i+1] == '\'':
+		return TokenNumber, scanQuoted(q, i+1, '\'', false)
+	case isDigit(c) || (c == '.' && i+1 < len(q) && isDigit(q[i+1])):
+		j := scanNumber(q, i)
+		if j < len(q) && isWordByte(q, j) {
+			// Identifiers may start with digits, e.g. 1table.
+			return TokenWord, scanWordFrom(q, j)
+		}
+		return TokenNumber, j
+	case c == '@':
+		j := i + 1
+		if j < len(q) && q[j] == '@' {
+			j++
+		}
+		if j < len(q) && (q[j] == '`' || q[j] == '\'' || q[j] == '"') {
+			return TokenVariable, scanQuoted(q, j, q[j], true)
+		}
+		for j < len(q) {
+			if q[j] == '.' {
+				j++
+				continue
+			}
+			if !isWordByte(q, j) {
+				break
+			}
+			j = scanWordFrom(q, j)
+		}
+		return TokenVariable, j
+	case c == '?':
+		return TokenPlaceholder, i + 1
+	case isWordByte(q, i):
+		return TokenWord, scanWordFrom(q, i)
+	default:
+		_, size := utf8.DecodeRuneInString(q[i:])
+		return TokenPunct, i + size
+	}
+}
+
+// scanQuoted returns the end offset of the quoted token starting at i.
+// Doubled quotes are always treated as escapes; backslashes only when backslash is true.
+func scanQuoted(q string, i int, quote byte, backslash bool) int {
+	for j := i + 1; j < len(q); j++ {
+		switch q[j] {
+		case '\\':
+			if backslash {
+				j++
+			}
+		case quote:
+			if j+1 < len(q) && q[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(q)
+}
+
+// scanNumber returns the end offset of the numeric literal starting at i.
+func scanNumber(q string, i int) int {
+	j := i
+	if strings.HasPrefix(q[i:], "0x") || strings.HasPrefix(q[i:], "0b") {
+		j += 2
+		for j < len(q) && isWordByte(q, j) {
+			j++
+		}
+		return j
+	}
+	for j < len(q) && (isDigit(q[j]) || q[j] == '.') {
+		j++
+	}
+	if j < len(q) && (q[j] == 'e' || q[j] == 'E') {
+		k := j + 1
+		if k < len(q) && (q[k] == '+' || q[k] == '-') {
+			k++
+		}
+		if k < len(q) && isDigit(q[k]) {
+			j = k
+			for j < len(q) && isDigit(q[j]) {
+				j++
+			}
+		}
+	}
+	return j
+}
+
+// scanWordFrom returns the end offset of a word continuing at j.
+func scanWordFrom(q string, j int) int {
+	for j < len(q) && isWordByte(q, j) {
+		_, size := utf8.DecodeRuneInString(q[j:])
+		j += size
+	}
+	return j
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isWordByte returns true if the rune starting at q[i] can be part of an unquoted identifier.
+func isWordByte(q string, i int) bool {
+	c := q[i]
+	if c < utf8.RuneSelf {
+		return c == '_' || c == '$' || isDigit(c) || (c|0x20 >= 'a' && c|0x20 <= 'z')
+	}
+	r, _ := utf8.DecodeRuneInString(q[i:])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
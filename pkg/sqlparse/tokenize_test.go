@@ -0,0 +1,41 @@
+package sqlparse
+
+import (
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []Token
+	}{
+		{"SELECT 1", []Token{{TokenWord, "SELECT"}, {TokenSpace, " "}, {TokenNumber, "1"}}},
+		{"a.`b c`", []Token{{TokenWord, "a"}, {TokenPunct, "."}, {TokenQuotedIdent, "`b c`"}}},
+		{`'it''s' "a\"b"`, []Token{{TokenString, `'it''s'`}, {TokenSpace, " "}, {TokenString, `"a\"b"`}}},
+		{"x'0F' 0x1f 1.5e-3", []Token{{TokenNumber, "x'0F'"}, {TokenSpace, " "}, {TokenNumber, "0x1f"}, {TokenSpace, " "}, {TokenNumber, "1.5e-3"}}},
+		{"1table", []Token{{TokenWord, "1table"}}},
+		{"@a @@session.x ?", []Token{{TokenVariable, "@a"}, {TokenSpace, " "}, {TokenVariable, "@@session.x"}, {TokenSpace, " "}, {TokenPlaceholder, "?"}}},
+		{"1 -- c\n2", []Token{{TokenNumber, "1"}, {TokenSpace, " "}, {TokenComment, "-- c\n"}, {TokenNumber, "2"}}},
+		{"1--2", []Token{{TokenNumber, "1"}, {TokenPunct, "-"}, {TokenPunct, "-"}, {TokenNumber, "2"}}},
+		{"# c", []Token{{TokenComment, "# c"}}},
+		{"/* c */x", []Token{{TokenComment, "/* c */"}, {TokenWord, "x"}}},
+		{"/* open", []Token{{TokenComment, "/* open"}}},
+		{"/*!50000 DROP */", []Token{{TokenComment, "/*!50000"}, {TokenSpace, " "}, {TokenWord, "DROP"}, {TokenSpace, " "}, {TokenComment, "*/"}}},
+		{"/*M!100100 DROP*/", []Token{{TokenComment, "/*M!100100"}, {TokenSpace, " "}, {TokenWord, "DROP"}, {TokenComment, "*/"}}},
+		{"/*!DROP*/ 2 */ 3", []Token{{TokenComment, "/*!"}, {TokenWord, "DROP"}, {TokenComment, "*/"}, {TokenSpace, " "}, {TokenNumber, "2"}, {TokenSpace, " "}, {TokenPunct, "*"}, {TokenPunct, "/"}, {TokenSpace, " "}, {TokenNumber, "3"}}},
+		{"/*!'*/'*/", []Token{{TokenComment, "/*!"}, {TokenString, "'*/'"}, {TokenComment, "*/"}}},
+	}
+	for _, tt := range tests {
+		got := Tokenize(tt.query)
+		if len(got) != len(tt.want) {
+			t.Errorf("Tokenize(%q) = %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Tokenize(%q) = %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
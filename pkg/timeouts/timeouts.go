@@ -0,0 +1,101 @@
+package timeouts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/go-sql-proxy/pkg/logging"
+	"github.com/supporttools/go-sql-proxy/pkg/rules"
+)
+
+var logger = logging.SetupLogging()
+
+// DefaultRuleName is reported for statements limited by the default timeout.
+const DefaultRuleName = "default"
+
+// Rule sets the timeout of the statements it matches. The first matching rule
+// in ascending priority order applies; a zero timeout disables the limit.
+type Rule struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	rules.Match
+	Timeout rules.Duration `json:"timeout"`
+}
+
+// RuleSet is the content of the timeout rules file.
+type RuleSet struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// ruleSet holds the active rules, swapped atomically on reload.
+var ruleSet atomic.Pointer[RuleSet]
+
+// defaultTimeout applies to statements no rule matches.
+var defaultTimeout atomic.Int64
+
+// LoadRules loads and activates the timeout rules from a JSON file.
+func LoadRules(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path comes from trusted configuration
+	if err != nil {
+		return fmt.Errorf("failed to read timeout rules: %w", err)
+	}
+
+	set := &RuleSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("failed to parse timeout rules: %w", err)
+	}
+
+	for i, rule := range set.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Timeout < 0 {
+			return fmt.Errorf("timeout rule %q: timeout must not be negative", rule.Name)
+		}
+		if err := rule.Compile(); err != nil {
+			return fmt.Errorf("timeout rule %q: %w", rule.Name, err)
+		}
+	}
+	sort.SliceStable(set.Rules, func(i, j int) bool {
+		return set.Rules[i].Priority < set.Rules[j].Priority
+	})
+
+	ruleSet.Store(set)
+	logger.Infof("Loaded %d timeout rules from %s", len(set.Rules), path)
+	return nil
+}
+
+// SetDefault sets the timeout of statements no rule matches. Zero disables it.
+func SetDefault(timeout time.Duration) {
+	defaultTimeout.Store(int64(timeout))
+}
+
+// Rules returns the active timeout rules in evaluation order.
+func Rules() []*Rule {
+	if set := ruleSet.Load(); set != nil {
+		return set.Rules
+	}
+	return nil
+}
+
+// Enabled returns true if a default timeout is set or timeout rules have been loaded.
+func Enabled() bool {
+	return defaultTimeout.Load() > 0 || ruleSet.Load() != nil
+}
+
+// For returns the timeout of a statement and the name of the rule that set it.
+// A zero timeout means the statement is not limited.
+func For(r *rules.Request) (time.Duration, string) {
+	if set := ruleSet.Load(); set != nil {
+		for _, rule := range set.Rules {
+			if rule.Matches(r) {
+				return time.Duration(rule.Timeout), rule.Name
+			}
+		}
+	}
+	return time.Duration(defaultTimeout.Load()), DefaultRuleName
+}